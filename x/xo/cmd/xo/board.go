@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/ayzatziko/stuff/x/xo/xo"
+)
+
+// render prints board with column letters and row numbers:
+//
+//	   a b c
+//	1  x . .
+//	2  . o .
+//	3  . . .
+//
+// Sub-boards of ultimate are separated by spaces, layers of
+// three-dimensional boards are printed one after another.
+func render(w io.Writer, board *xo.TypeBoard) {
+	for layer := 0; layer < board.Layers(); layer++ {
+		if board.Layers() > 1 {
+			fmt.Fprintf(w, "layer %d\n", layer+1)
+		}
+
+		rows, cols, _ := board.Dimensions()
+		renderCells(w, rows, cols, blockOf(board.Rules().Name()), func(row, col int) xo.TypeSign {
+			cell, _ := xo.NewCell3D(row, col, layer)
+			return board.Cell(cell)
+		})
+	}
+}
+
+// blockOf returns the size of sub-boards of variant.
+func blockOf(variant string) int {
+	if variant == xo.Ultimate().Name() {
+		return 3
+	}
+
+	return 0
+}
+
+// isGravity reports whether signs of variant fall down to the lowest empty
+// cell of a column.
+func isGravity(variant string) bool {
+	return strings.HasPrefix(variant, "gravity-")
+}
+
+// renderCells separates blocks of rows and columns of block size, zero block
+// renders no separators.
+func renderCells(w io.Writer, rows, cols, block int, sign func(row, col int) xo.TypeSign) {
+	separated := func(i int) bool { return block > 0 && i > 0 && i%block == 0 }
+
+	var b strings.Builder
+	b.WriteString("  ")
+	for col := 0; col < cols; col++ {
+		if separated(col) {
+			b.WriteString(" ")
+		}
+		fmt.Fprintf(&b, " %c", 'a'+col)
+	}
+	b.WriteString("\n")
+
+	for row := 0; row < rows; row++ {
+		if separated(row) {
+			b.WriteString("\n")
+		}
+
+		fmt.Fprintf(&b, "%-2d", row+1)
+		for col := 0; col < cols; col++ {
+			if separated(col) {
+				b.WriteString(" ")
+			}
+
+			s := string(sign(row, col))
+			if s == "" {
+				s = "."
+			}
+			fmt.Fprintf(&b, " %s", s)
+		}
+		b.WriteString("\n")
+	}
+
+	io.WriteString(w, b.String())
+}
+
+func formatCell(cell xo.TypeCell, layers int) string {
+	if layers > 1 {
+		return fmt.Sprintf("%c%d %d", 'a'+cell.Col(), cell.Row()+1, cell.Layer()+1)
+	}
+
+	return fmt.Sprintf("%c%d", 'a'+cell.Col(), cell.Row()+1)
+}
+
+// parseCell parses a column letter and a row number like b2, or a row and a
+// column numbers like 2 2, all counted from one. Cells of three-dimensional
+// boards are followed by a layer number: b2 3 or 2 2 3.
+func parseCell(s string, rows, cols, layers int) (xo.TypeCell, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	fields := strings.Fields(s)
+
+	layer := 1
+	if layers > 1 {
+		if len(fields) < 2 {
+			return xo.TypeCell{}, fmt.Errorf("invalid move %q, expected layer number after the cell", s)
+		}
+
+		var err error
+		if layer, err = strconv.Atoi(fields[len(fields)-1]); err != nil {
+			return xo.TypeCell{}, fmt.Errorf("invalid move %q, expected layer number after the cell", s)
+		}
+		fields = fields[:len(fields)-1]
+	}
+
+	var row, col int
+	if len(fields) == 2 {
+		var err1, err2 error
+		row, err1 = strconv.Atoi(fields[0])
+		col, err2 = strconv.Atoi(fields[1])
+		if err1 != nil || err2 != nil {
+			return xo.TypeCell{}, fmt.Errorf("invalid move %q, expected row and column numbers", s)
+		}
+	} else if len(fields) == 1 && len(fields[0]) >= 2 && fields[0][0] >= 'a' && fields[0][0] <= 'z' {
+		col = int(fields[0][0]-'a') + 1
+
+		var err error
+		if row, err = strconv.Atoi(fields[0][1:]); err != nil {
+			return xo.TypeCell{}, fmt.Errorf("invalid move %q, expected column letter and row number", s)
+		}
+	} else {
+		return xo.TypeCell{}, fmt.Errorf("invalid move %q, type help", s)
+	}
+
+	if row < 1 || row > rows || col < 1 || col > cols || layer < 1 || layer > layers {
+		return xo.TypeCell{}, fmt.Errorf("move %q is out of the board", s)
+	}
+
+	return xo.NewCell3D(row-1, col-1, layer-1)
+}
+
+// splitSign cuts the sign chosen for a move in wild variants off the end of
+// line like b2 o.
+func splitSign(line string) (string, xo.TypeSign) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return line, ""
+	}
+
+	sign := xo.TypeSign(strings.ToLower(fields[len(fields)-1]))
+	if sign != xo.SignX && sign != xo.SignO {
+		return line, ""
+	}
+
+	return strings.Join(fields[:len(fields)-1], " "), sign
+}
+
+// parseColumn parses a column letter or number like d or 4 counted from one,
+// it is used for gravity variants where the row is chosen by the board.
+func parseColumn(s string, cols int) (xo.TypeCell, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+
+	col, err := strconv.Atoi(s)
+	if err != nil && len(s) == 1 && s[0] >= 'a' && s[0] <= 'z' {
+		col, err = int(s[0]-'a')+1, nil
+	}
+
+	if err != nil {
+		return xo.TypeCell{}, fmt.Errorf("invalid move %q, expected column letter or number", s)
+	} else if col < 1 || col > cols {
+		return xo.TypeCell{}, fmt.Errorf("move %q is out of the board", s)
+	}
+
+	return xo.NewColumn(col - 1)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ayzatziko/stuff/x/xo/xo"
+)
+
+func TestParseCell(t *testing.T) {
+	for _, tt := range []struct {
+		in       string
+		row, col int
+	}{
+		{"a1", 0, 0},
+		{"b2", 1, 1},
+		{"C1", 0, 2},
+		{"1 3", 0, 2},
+		{" 3  1 ", 2, 0},
+	} {
+		cell, err := parseCell(tt.in, 3, 3, 1)
+		if err != nil {
+			t.Errorf("parseCell(%q): %v", tt.in, err)
+		} else if cell.Row() != tt.row || cell.Col() != tt.col {
+			t.Errorf("parseCell(%q) = %s, want row %d col %d", tt.in, cell, tt.row, tt.col)
+		}
+	}
+
+	for _, in := range []string{"", "d1", "a4", "a0", "0 1", "1", "1 x", "11"} {
+		if cell, err := parseCell(in, 3, 3, 1); err == nil {
+			t.Errorf("parseCell(%q) = %s, want error", in, cell)
+		}
+	}
+}
+
+func TestParseCell3D(t *testing.T) {
+	for _, tt := range []struct {
+		in              string
+		row, col, layer int
+	}{
+		{"a1 1", 0, 0, 0},
+		{"d2 3", 1, 3, 2},
+		{"1 4 4", 0, 3, 3},
+	} {
+		cell, err := parseCell(tt.in, 4, 4, 4)
+		if err != nil {
+			t.Errorf("parseCell(%q): %v", tt.in, err)
+		} else if cell.Row() != tt.row || cell.Col() != tt.col || cell.Layer() != tt.layer {
+			t.Errorf("parseCell(%q) = %s, want row %d col %d layer %d", tt.in, cell, tt.row, tt.col, tt.layer)
+		}
+	}
+
+	for _, in := range []string{"a1", "1 1", "a1 5", "a1 0", "1 1 x"} {
+		if cell, err := parseCell(in, 4, 4, 4); err == nil {
+			t.Errorf("parseCell(%q) = %s, want error", in, cell)
+		}
+	}
+}
+
+func TestParseColumn(t *testing.T) {
+	for in, col := range map[string]int{"a": 0, "D": 3, "7": 6, " 1 ": 0} {
+		cell, err := parseColumn(in, 7)
+		if err != nil {
+			t.Errorf("parseColumn(%q): %v", in, err)
+		} else if cell.Col() != col {
+			t.Errorf("parseColumn(%q) = %s, want col %d", in, cell, col)
+		}
+	}
+
+	for _, in := range []string{"", "h", "8", "0", "a1", "ab"} {
+		if cell, err := parseColumn(in, 7); err == nil {
+			t.Errorf("parseColumn(%q) = %s, want error", in, cell)
+		}
+	}
+}
+
+func TestSplitSign(t *testing.T) {
+	for _, tt := range []struct {
+		in, line string
+		sign     xo.TypeSign
+	}{
+		{"b2 o", "b2", xo.SignO},
+		{"2 2 1 X", "2 2 1", xo.SignX},
+		{"b2", "b2", ""},
+		{"x", "x", ""},
+		{"2 2", "2 2", ""},
+	} {
+		if line, sign := splitSign(tt.in); line != tt.line || sign != tt.sign {
+			t.Errorf("splitSign(%q) = %q, %q, want %q, %q", tt.in, line, sign, tt.line, tt.sign)
+		}
+	}
+}
+
+func TestFormatCell(t *testing.T) {
+	cell, err := xo.NewCell3D(2, 1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := formatCell(cell, 1); got != "b3" {
+		t.Errorf("formatCell = %q, want b3", got)
+	} else if got := formatCell(cell, 4); got != "b3 4" {
+		t.Errorf("formatCell = %q, want b3 4", got)
+	}
+}
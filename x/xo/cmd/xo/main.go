@@ -0,0 +1,310 @@
+// Command xo plays tic-tac-toe in a terminal.
+//
+// Hot-seat game of two players on one terminal:
+//
+//	xo
+//
+// Game against the built-in bot:
+//
+//	xo -bot hard -sign o
+//
+// Local games are played by the classic rules unless another variant is
+// chosen, e.g. -variant ultimate.
+//
+// Game on a server, the first player waits for an opponent in the lobby and
+// the second joins them:
+//
+//	xo -connect host:7777 -user alice -register
+//	xo -connect host:7777 -user bob -register -join alice
+//
+// Moves are entered as a column letter and a row number, e.g. b2, or as a
+// row and a column numbers, e.g. 2 2. Moves of gravity variants like
+// gravity-7x6-4 are a column letter or number only. In wild the sign follows
+// the move, e.g. b2 o. Other commands are hint, resign, draw, accept,
+// decline, help and quit.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ayzatziko/stuff/x/xo/xo"
+)
+
+func main() {
+	var (
+		bot   = flag.String("bot", "", "play against the built-in bot of the level: easy, medium or hard")
+		sign  = flag.String("sign", "x", "your sign in a game against the bot, x moves first")
+		name1 = flag.String("x", "player1", "name of the player playing x")
+		name2 = flag.String("o", "player2", "name of the player playing o")
+
+		variant = flag.String("variant", "classic", "variant of games, except joined on a server: "+strings.Join(xo.Variants(), ", "))
+
+		addr     = flag.String("connect", "", "address of the xo server")
+		user     = flag.String("user", "", "your user name on the server")
+		password = flag.String("password", "", "your password on the server")
+		register = flag.Bool("register", false, "register the user on the server before login")
+		join     = flag.String("join", "", "waiting user to play with on the server, wait for an opponent if empty")
+	)
+	flag.Parse()
+
+	rules, err := xo.RulesByName(*variant)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "xo:", err)
+		os.Exit(2)
+	}
+
+	if *addr != "" {
+		r := remote{user: *user, in: os.Stdin, out: os.Stdout}
+		err = r.play(*addr, *password, *register, *join, xo.TypeSign(*sign), *variant)
+	} else if *bot != "" {
+		err = playBot(os.Stdin, os.Stdout, rules, *bot, xo.TypeSign(*sign))
+	} else {
+		err = playHotSeat(os.Stdin, os.Stdout, rules, *name1, *name2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "xo:", err)
+		os.Exit(1)
+	}
+}
+
+var botLevels = map[string]xo.TypeBotLevel{
+	"easy":   xo.BotLevelEasy,
+	"medium": xo.BotLevelMedium,
+	"hard":   xo.BotLevelHard,
+}
+
+func playHotSeat(in io.Reader, out io.Writer, rules xo.Rules, nameX, nameO string) error {
+	tokenX, tokenO, err := startLocalGame(rules, nameX, nameO)
+	if err != nil {
+		return err
+	}
+
+	g := game{
+		in:     bufio.NewScanner(in),
+		out:    out,
+		tokens: map[xo.TypeUser]string{xo.TypeUser(nameX): tokenX, xo.TypeUser(nameO): tokenO},
+	}
+
+	return g.play()
+}
+
+func playBot(in io.Reader, out io.Writer, rules xo.Rules, levelName string, sign xo.TypeSign) error {
+	level, ok := botLevels[levelName]
+	if !ok {
+		return fmt.Errorf("unknown bot level %q", levelName)
+	}
+
+	const human, bot = "you", "bot"
+
+	var (
+		tokenHuman, tokenBot string
+		err                  error
+	)
+	switch sign {
+	case xo.SignX:
+		tokenHuman, tokenBot, err = startLocalGame(rules, human, bot)
+	case xo.SignO:
+		tokenBot, tokenHuman, err = startLocalGame(rules, bot, human)
+	default:
+		return fmt.Errorf("unknown sign %q", sign)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	g := game{
+		in:     bufio.NewScanner(in),
+		out:    out,
+		tokens: map[xo.TypeUser]string{human: tokenHuman, bot: tokenBot},
+		bot:    bot,
+		level:  level,
+	}
+
+	return g.play()
+}
+
+// startLocalGame registers and logs in both players, the x player moves
+// first.
+func startLocalGame(rules xo.Rules, nameX, nameO string) (tokenX, tokenO string, err error) {
+	if nameX == nameO {
+		return "", "", fmt.Errorf("players must have different names")
+	}
+
+	if tokenX, err = xo.LoginLocal(nameX); err != nil {
+		return "", "", err
+	} else if tokenO, err = xo.LoginLocal(nameO); err != nil {
+		return "", "", err
+	}
+
+	if err := xo.RegisterSelfAsParticipantWithRules(tokenX, xo.SignX, rules); err != nil {
+		return "", "", err
+	} else if err := xo.StartPlayingWithWaitingOpponent(tokenO, xo.SignO, xo.TypeUser(nameX)); err != nil {
+		return "", "", err
+	}
+
+	return tokenX, tokenO, nil
+}
+
+type game struct {
+	in     *bufio.Scanner
+	out    io.Writer
+	tokens map[xo.TypeUser]string
+
+	// bot is the user moving by the built-in bot, empty in hot-seat games
+	bot   xo.TypeUser
+	level xo.TypeBotLevel
+}
+
+func (g *game) play() error {
+	var anyToken string
+	for _, token := range g.tokens {
+		anyToken = token
+	}
+
+	for {
+		board, err := xo.CurrentBoard(anyToken)
+		if err != nil {
+			return err
+		}
+
+		turn := board.Turn()
+		if turn.User() == g.bot {
+			cell, sign, err := xo.BotMoveWithSign(board, g.level)
+			if err != nil {
+				return err
+			}
+
+			move := formatCell(cell, board.Layers())
+			if sign != turn.Sign() {
+				move += " " + string(sign)
+			}
+
+			fmt.Fprintf(g.out, "%s moves %s\n", g.bot, move)
+			if g.finish(xo.MakeAMoveWithSign(g.tokens[g.bot], cell, sign)) {
+				return nil
+			}
+
+			continue
+		}
+
+		render(g.out, &board)
+		if offeredBy := board.DrawOfferedBy(); offeredBy != "" && offeredBy != turn.User() {
+			fmt.Fprintf(g.out, "%s offers a draw, accept or decline\n", offeredBy)
+		}
+		fmt.Fprintf(g.out, "%s (%s)> ", turn.User(), turn.Sign())
+
+		if !g.in.Scan() {
+			if err := g.in.Err(); err != nil {
+				return err
+			}
+
+			return fmt.Errorf("input is closed")
+		}
+
+		done, err := g.command(turn.User(), strings.TrimSpace(g.in.Text()), &board)
+		if err != nil {
+			fmt.Fprintln(g.out, err)
+		} else if done {
+			return nil
+		}
+	}
+}
+
+// command runs a command of the user, returns true if the game is over.
+func (g *game) command(user xo.TypeUser, line string, board *xo.TypeBoard) (bool, error) {
+	token := g.tokens[user]
+
+	switch line {
+	case "":
+		return false, nil
+	case "help":
+		fmt.Fprintln(g.out, "moves: b2 or 2 2, with a layer on 3D boards: b2 1 or 2 2 1, a column on gravity boards: d or 4, followed by x or o in wild; commands: hint, resign, draw, accept, decline, quit")
+		return false, nil
+	case "quit":
+		return true, nil
+	case "hint":
+		analysis, err := xo.Hint(token)
+		if err != nil {
+			return false, err
+		}
+
+		best := make([]string, len(analysis.Best))
+		for i, m := range analysis.Best {
+			best[i] = formatCell(m.Move.Cell, board.Layers())
+			if m.Move.Sign != "" {
+				best[i] += " " + string(m.Move.Sign)
+			}
+		}
+
+		fmt.Fprintf(g.out, "%s, best moves: %s\n", analysis.TypeEval, strings.Join(best, ", "))
+		return false, nil
+	case "resign":
+		return g.finish(xo.Resign(token)), nil
+	case "draw":
+		if err := xo.OfferDraw(token); err != nil {
+			return false, err
+		}
+
+		if g.bot != "" {
+			fmt.Fprintf(g.out, "%s declines\n", g.bot)
+			return false, xo.DeclineDraw(g.tokens[g.bot])
+		}
+
+		return false, nil
+	case "accept":
+		board, msg, err := xo.AcceptDraw(token)
+		if err != nil {
+			return false, err
+		}
+
+		return g.finish(board, msg, nil), nil
+	case "decline":
+		return false, xo.DeclineDraw(token)
+	}
+
+	rows, cols, layers := board.Dimensions()
+	line, sign := splitSign(line)
+
+	var (
+		cell xo.TypeCell
+		err  error
+	)
+	if isGravity(board.Rules().Name()) {
+		cell, err = parseColumn(line, cols)
+	} else {
+		cell, err = parseCell(line, rows, cols, layers)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	finished, msg, err := xo.MakeAMoveWithSign(token, cell, sign)
+	if err != nil {
+		return false, err
+	}
+
+	return g.finish(finished, msg, nil), nil
+}
+
+// finish prints the result of a finished game, returns true if the game is
+// over.
+func (g *game) finish(board *xo.TypeBoard, msg string, err error) bool {
+	if err != nil {
+		fmt.Fprintln(g.out, err)
+		return false
+	} else if board == nil {
+		return false
+	}
+
+	render(g.out, board)
+	fmt.Fprintln(g.out, msg)
+
+	return true
+}
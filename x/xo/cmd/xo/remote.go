@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ayzatziko/stuff/x/xo/xo"
+	"github.com/ayzatziko/stuff/x/xo/xotext"
+)
+
+// remote plays a game on an xo server over the text protocol.
+type remote struct {
+	user string
+	in   io.Reader
+	out  io.Writer
+
+	c *xotext.Client
+	// variant and layers of the game
+	variant string
+	layers  int
+	rows    int
+	cols    int
+}
+
+func (r *remote) play(addr, password string, register bool, join string, sign xo.TypeSign, variant string) (err error) {
+	if r.user == "" {
+		return fmt.Errorf("user is required to play on a server")
+	}
+
+	if r.c, err = xotext.Dial(addr); err != nil {
+		return err
+	}
+	defer r.c.Close()
+
+	if register {
+		if _, err := r.c.Call("REGISTER", r.user, password); err != nil {
+			return err
+		}
+	}
+
+	if _, err := r.c.Call("LOGIN", r.user, password); err != nil {
+		return err
+	}
+
+	if join != "" {
+		_, err = r.c.Call("JOIN", join, string(sign))
+	} else {
+		fmt.Fprintln(r.out, "waiting for an opponent")
+		_, err = r.c.Call("WAIT", string(sign), variant)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+
+		scanner := bufio.NewScanner(r.in)
+		for scanner.Scan() {
+			lines <- strings.TrimSpace(scanner.Text())
+		}
+	}()
+
+	for {
+		select {
+		case event, ok := <-r.c.Events():
+			if !ok {
+				return fmt.Errorf("server closed the connection")
+			}
+
+			if done := r.event(event); done {
+				return nil
+			}
+		case line, ok := <-lines:
+			if !ok {
+				return fmt.Errorf("input is closed")
+			} else if line == "quit" {
+				_, err := r.c.Call("QUIT")
+				return err
+			}
+
+			if err := r.command(line); err != nil {
+				fmt.Fprintln(r.out, err)
+			}
+		}
+	}
+}
+
+// event prints the event, returns true if the game is over.
+func (r *remote) event(event []string) bool {
+	if len(event) == 0 {
+		return false
+	}
+
+	switch event[0] {
+	case "START", "MOVE":
+		if event[0] == "START" && len(event) == 4 {
+			r.variant = event[3]
+		} else if event[0] == "MOVE" && len(event) >= 4 && event[1] != r.user {
+			fmt.Fprintf(r.out, "%s moves %s\n", event[1], strings.Join(event[2:], " "))
+		}
+
+		// the board is gone after the last move, END follows it
+		r.renderBoard()
+	case "DRAW":
+		if len(event) == 2 && event[1] != r.user {
+			fmt.Fprintf(r.out, "%s offers a draw, accept or decline\n", event[1])
+		}
+	case "DECLINE":
+		if len(event) == 2 && event[1] != r.user {
+			fmt.Fprintf(r.out, "%s declines the draw\n", event[1])
+		}
+	case "END":
+		fmt.Fprintln(r.out, strings.Join(event[1:], " "))
+		return true
+	}
+
+	return false
+}
+
+func (r *remote) renderBoard() error {
+	reply, err := r.c.Call("BOARD")
+	if err != nil {
+		return err
+	}
+
+	fields := strings.Fields(reply)
+	if len(fields) < 2 {
+		return fmt.Errorf("unexpected board %q", reply)
+	}
+
+	// layers are separated by |
+	turn, layers := fields[0], [][]string{nil}
+	for _, field := range fields[1:] {
+		if field == "|" {
+			layers = append(layers, nil)
+			continue
+		}
+
+		layers[len(layers)-1] = append(layers[len(layers)-1], field)
+	}
+
+	r.layers, r.rows, r.cols = len(layers), len(layers[0]), len(layers[0][0])
+	for i, rows := range layers {
+		if r.layers > 1 {
+			fmt.Fprintf(r.out, "layer %d\n", i+1)
+		}
+
+		renderCells(r.out, r.rows, r.cols, blockOf(r.variant), func(row, col int) xo.TypeSign {
+			if col >= len(rows[row]) || rows[row][col] == '.' {
+				return ""
+			}
+
+			return xo.TypeSign(rows[row][col : col+1])
+		})
+	}
+
+	if turn == r.user {
+		fmt.Fprint(r.out, "your move> ")
+	} else {
+		fmt.Fprintf(r.out, "waiting for %s\n", turn)
+	}
+
+	return nil
+}
+
+func (r *remote) command(line string) error {
+	switch line {
+	case "":
+		return nil
+	case "help":
+		fmt.Fprintln(r.out, "moves: b2 or 2 2, with a layer on 3D boards: b2 1 or 2 2 1, a column on gravity boards: d or 4, followed by x or o in wild; commands: hint, resign, draw, accept, decline, quit")
+		return nil
+	case "hint":
+		reply, err := r.c.Call("HINT")
+		if err == nil {
+			fmt.Fprintln(r.out, reply)
+		}
+		return err
+	case "resign", "draw", "accept", "decline":
+		_, err := r.c.Call(strings.ToUpper(line))
+		return err
+	}
+
+	if r.rows == 0 {
+		return fmt.Errorf("game is not started")
+	}
+
+	line, sign := splitSign(line)
+
+	var (
+		cell xo.TypeCell
+		err  error
+	)
+	if isGravity(r.variant) {
+		cell, err = parseColumn(line, r.cols)
+	} else {
+		cell, err = parseCell(line, r.rows, r.cols, r.layers)
+	}
+	if err != nil {
+		return err
+	}
+
+	args := []string{fmt.Sprint(cell.Row() + 1), fmt.Sprint(cell.Col() + 1), fmt.Sprint(cell.Layer() + 1)}
+	if sign != "" {
+		args = append(args, string(sign))
+	}
+
+	_, err = r.c.Call("MOVE", args...)
+	return err
+}
@@ -0,0 +1,112 @@
+// Command xoarena plays games between two xo players and reports the win,
+// draw and loss rates of the first one:
+//
+//	xoarena -variant connect-four -games 200 -parallel 8 hard 'engine:xobot -level medium'
+//
+// A player is a level of the built-in bot (easy, medium or hard), random or
+// an external engine of package xoengine as engine:command [args...], the
+// engine is started once for every parallel game.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/ayzatziko/stuff/x/xo/xo"
+	"github.com/ayzatziko/stuff/x/xo/xoarena"
+	"github.com/ayzatziko/stuff/x/xo/xoengine"
+)
+
+var botLevels = map[string]xo.TypeBotLevel{
+	"easy":   xo.BotLevelEasy,
+	"medium": xo.BotLevelMedium,
+	"hard":   xo.BotLevelHard,
+}
+
+func main() {
+	var (
+		variant  = flag.String("variant", "classic", "variant of the games")
+		games    = flag.Int("games", 100, "number of games")
+		parallel = flag.Int("parallel", 4, "number of games played at once")
+		logFile  = flag.String("log", "", "file to write the moves of every game to")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] first second\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	rules, err := xo.RulesByName(*variant)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var players [2]xoarena.Player
+	for i := range players {
+		p, engines, err := newPlayer(flag.Arg(i), *parallel)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, e := range engines {
+			defer e.Close()
+		}
+		players[i] = p
+	}
+
+	report, err := xoarena.Run(rules, players[0], players[1], *games, *parallel)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Print(report)
+
+	if *logFile != "" {
+		f, err := os.Create(*logFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+
+		if err := report.WriteLog(f); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// newPlayer returns the player of spec with the started engines.
+func newPlayer(spec string, parallel int) (xoarena.Player, []*xoengine.Engine, error) {
+	if spec == "random" {
+		return xoarena.Random(), nil, nil
+	} else if level, ok := botLevels[spec]; ok {
+		return xoarena.Bot(level), nil, nil
+	} else if !strings.HasPrefix(spec, "engine:") {
+		return nil, nil, fmt.Errorf("unknown player %q", spec)
+	}
+
+	args := strings.Fields(strings.TrimPrefix(spec, "engine:"))
+	if len(args) == 0 {
+		return nil, nil, fmt.Errorf("no command of engine %q", spec)
+	}
+
+	engines := make([]*xoengine.Engine, 0, parallel)
+	for len(engines) < cap(engines) {
+		e, err := xoengine.Start(args[0], args[1:]...)
+		if err != nil {
+			for _, e := range engines {
+				e.Close()
+			}
+			return nil, nil, err
+		}
+		engines = append(engines, e)
+	}
+
+	return xoarena.Engines(engines...), engines, nil
+}
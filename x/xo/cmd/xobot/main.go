@@ -0,0 +1,49 @@
+// Command xobot is the reference xo engine, it plays by the built-in bot
+// over the protocol of package xoengine on stdin and stdout:
+//
+//	xobot -level hard
+//
+// Servers run it as a lobby user:
+//
+//	xoserver -engine xobot -engine-user robot
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ayzatziko/stuff/x/xo/xo"
+	"github.com/ayzatziko/stuff/x/xo/xoengine"
+)
+
+var botLevels = map[string]xo.TypeBotLevel{
+	"easy":   xo.BotLevelEasy,
+	"medium": xo.BotLevelMedium,
+	"hard":   xo.BotLevelHard,
+}
+
+func main() {
+	var (
+		levelName = flag.String("level", "hard", "level of the bot: easy, medium or hard")
+		delay     = flag.Duration("delay", 0, "delay of every move, e.g. to test time limits")
+	)
+	flag.Parse()
+
+	level, ok := botLevels[*levelName]
+	if !ok {
+		log.Fatalf("unknown bot level %q", *levelName)
+	}
+
+	choose := xoengine.BotChooser(level)
+	name := fmt.Sprintf("xobot %s", level)
+	err := xoengine.Serve(os.Stdin, os.Stdout, name, func(rules xo.Rules, pos *xo.TypePosition, sign xo.TypeSign, timeLeft time.Duration) (xo.TypeMove, error) {
+		time.Sleep(*delay)
+		return choose(rules, pos, sign, timeLeft)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+}
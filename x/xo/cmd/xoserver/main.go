@@ -0,0 +1,184 @@
+// Command xoserver serves xo games over the network.
+//
+//	xoserver -text :7777 -rpc-http :8080 -rpc-tcp :7778 -metrics :9090
+//
+// An empty address disables the protocol. The admin user, see xo.TypeRole,
+// is registered at the start:
+//
+//	xoserver -admin-user operator -admin-password 's3cret-passw0rd'
+//
+// An external engine, see package xoengine, plays as a lobby user waiting
+// for opponents:
+//
+//	xoserver -engine "xobot -level hard" -engine-user robot
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"expvar"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ayzatziko/stuff/x/xo/xo"
+	"github.com/ayzatziko/stuff/x/xo/xoaudit"
+	"github.com/ayzatziko/stuff/x/xo/xoengine"
+	"github.com/ayzatziko/stuff/x/xo/xometrics"
+	"github.com/ayzatziko/stuff/x/xo/xorpc"
+	"github.com/ayzatziko/stuff/x/xo/xotext"
+)
+
+var (
+	textAddr    = flag.String("text", ":7777", "address of the line-oriented text protocol")
+	rpcHTTPAddr = flag.String("rpc-http", "", "address of JSON-RPC 2.0 over HTTP")
+	rpcTCPAddr  = flag.String("rpc-tcp", "", "address of JSON-RPC 2.0 over TCP")
+	metricsAddr = flag.String("metrics", "", "address of /metrics in the Prometheus format and /debug/vars of expvar")
+
+	passwordLength = flag.Int("password-min-length", 8, "minimal length of passwords of users")
+	adminUser      = flag.String("admin-user", "", "user registered as admin at the start")
+	adminPassword  = flag.String("admin-password", "", "password of the admin user")
+	auditFile      = flag.String("audit-file", "", "file of the audit log, kept in memory if empty")
+
+	engine         = flag.String("engine", "", "command line of an engine playing in the lobby")
+	engineUser     = flag.String("engine-user", "robot", "user of the engine")
+	enginePassword = flag.String("engine-password", "", "password of the engine user, random if empty")
+	engineVariant  = flag.String("engine-variant", "classic", "variant the engine waits to play")
+	engineSign     = flag.String("engine-sign", "o", "sign the engine waits with")
+)
+
+func main() {
+	flag.Parse()
+
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run returns when a server fails, the audit log is flushed and closed
+// before.
+func run() (err error) {
+	xo.SetPasswordPolicy(xo.TypePasswordPolicy{MinLength: *passwordLength, MaxLength: xo.DefaultPasswordPolicy.MaxLength})
+
+	if *auditFile != "" {
+		var sink *xoaudit.FileSink
+		if sink, err = xoaudit.OpenFile(*auditFile); err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := sink.Close(); err == nil {
+				err = closeErr
+			}
+		}()
+
+		if err := xo.SetAuditSink(sink); err != nil {
+			return err
+		}
+	}
+
+	if *adminUser != "" {
+		if err := xo.RegisterUser(*adminUser, *adminPassword); err != nil {
+			return err
+		} else if err := xo.SetRole(*adminUser, xo.RoleAdmin); err != nil {
+			return err
+		}
+	}
+
+	errc := make(chan error, 4)
+	if *engine != "" {
+		p, err := startEngine(*engine, *engineUser, *enginePassword, *engineVariant, xo.TypeSign(*engineSign))
+		if err != nil {
+			return err
+		}
+		defer p.Engine.Close()
+
+		log.Printf("engine %q plays as %s", p.Engine.Name, p.User)
+		go func() { errc <- p.Run(nil) }()
+	}
+
+	serve := func(name, addr string, serve func(net.Listener) error) error {
+		if addr == "" {
+			return nil
+		}
+
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("%s on %s", name, l.Addr())
+		go func() { errc <- serve(l) }()
+		return nil
+	}
+
+	if err := serve("text protocol", *textAddr, xotext.Serve); err != nil {
+		return err
+	} else if err := serve("JSON-RPC over HTTP", *rpcHTTPAddr, func(l net.Listener) error {
+		mux := http.NewServeMux()
+		mux.Handle("/rpc", xorpc.Handler())
+		return http.Serve(l, mux)
+	}); err != nil {
+		return err
+	} else if err := serve("JSON-RPC over TCP", *rpcTCPAddr, xorpc.ServeTCP); err != nil {
+		return err
+	} else if err := serve("metrics", *metricsAddr, func(l net.Listener) error {
+		expvar.Publish("xo", xometrics.Default.Expvar())
+
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", xometrics.Default.Handler())
+		mux.Handle("/debug/vars", expvar.Handler())
+		return http.Serve(l, mux)
+	}); err != nil {
+		return err
+	}
+
+	err = <-errc
+
+	// records are appended by a goroutine of xo, they are not lost on exit
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if flushErr := xo.FlushAuditContext(ctx); flushErr != nil {
+		err = fmt.Errorf("%w, %v", err, flushErr)
+	}
+
+	return err
+}
+
+// startEngine spawns the engine, registers its user and logs it in, the
+// state of xo is kept in memory, so the user is registered at every start.
+func startEngine(commandLine, user, password, variant string, sign xo.TypeSign) (*xoengine.Player, error) {
+	rules, err := xo.RulesByName(variant)
+	if err != nil {
+		return nil, err
+	}
+
+	if password == "" {
+		var random [16]byte
+		if _, err := rand.Read(random[:]); err != nil {
+			return nil, err
+		}
+		password = hex.EncodeToString(random[:])
+	}
+
+	if err := xo.RegisterUser(user, password); err != nil {
+		return nil, err
+	}
+
+	token, err := xo.Login(user, password)
+	if err != nil {
+		return nil, err
+	}
+
+	args := strings.Fields(commandLine)
+	e, err := xoengine.Start(args[0], args[1:]...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &xoengine.Player{Engine: e, User: xo.TypeUser(user), Token: token, Rules: rules, Sign: sign}, nil
+}
@@ -0,0 +1,258 @@
+package xo
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ayzatziko/stuff/xerrors"
+)
+
+const (
+	constUsernameLengthMin = 3
+	constUsernameLengthMax = 32
+
+	// anonymousUser replaces deleted users in the history.
+	anonymousUser = "anonymous"
+)
+
+var reservedUsernames = map[string]bool{
+	"admin":         true,
+	"administrator": true,
+	"moderator":     true,
+	"root":          true,
+	"system":        true,
+	anonymousUser:   true,
+}
+
+// foldedUsernames maps lower case usernames to the registered ones, they
+// are unique regardless of case.
+var foldedUsernames = map[string]string{}
+
+// checkUsername returns an error unless username has from 3 to 32 latin
+// letters, digits, '-', '_' and '.', starts with a letter or a digit and is
+// not reserved.
+func checkUsername(username string) error {
+	if len(username) < constUsernameLengthMin || len(username) > constUsernameLengthMax {
+		return fmt.Errorf("%w: %s must have from %d to %d characters", ErrInvalidUsername, quoteUsername(username), constUsernameLengthMin, constUsernameLengthMax)
+	}
+
+	for i, c := range username {
+		alphanumeric := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+		if !alphanumeric && (i == 0 || !strings.ContainsRune("-_.", c)) {
+			return fmt.Errorf("%w: %s may have only latin letters, digits, '-', '_' and '.' after the first letter or digit", ErrInvalidUsername, quoteUsername(username))
+		}
+	}
+
+	if reservedUsernames[strings.ToLower(username)] {
+		return fmt.Errorf("%w: %q is reserved", ErrInvalidUsername, username)
+	}
+
+	return nil
+}
+
+// quoteUsername quotes username cut to the maximum length, invalid usernames
+// may be long or not UTF-8.
+func quoteUsername(username string) string {
+	if len(username) > constUsernameLengthMax {
+		return strconv.Quote(username[:constUsernameLengthMax]) + "..."
+	}
+
+	return strconv.Quote(username)
+}
+
+// TypePasswordPolicy restricts passwords of new users and changed
+// passwords.
+type TypePasswordPolicy struct {
+	MinLength int
+	// MaxLength of zero does not limit the length.
+	MaxLength     int
+	RequireLetter bool
+	RequireDigit  bool
+}
+
+// DefaultPasswordPolicy accepts passwords from 8 characters up to the length
+// of bcrypt hashes but the username, servers set other policies by
+// SetPasswordPolicy.
+var DefaultPasswordPolicy = TypePasswordPolicy{MinLength: 8, MaxLength: 72}
+
+var passwordPolicy = DefaultPasswordPolicy
+
+func SetPasswordPolicy(policy TypePasswordPolicy) {
+	accountsMu.Lock()
+	defer accountsMu.Unlock()
+
+	passwordPolicy = policy
+}
+
+func checkPasswordLocked(username, password string) error {
+	p := passwordPolicy
+
+	var letter, digit bool
+	for _, c := range password {
+		letter = letter || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+		digit = digit || c >= '0' && c <= '9'
+	}
+
+	switch {
+	case len(password) < p.MinLength:
+		return fmt.Errorf("%w: fewer than %d characters", ErrWeakPassword, p.MinLength)
+	case p.MaxLength > 0 && len(password) > p.MaxLength:
+		return fmt.Errorf("%w: more than %d characters", ErrWeakPassword, p.MaxLength)
+	case p.RequireLetter && !letter:
+		return fmt.Errorf("%w: no letter", ErrWeakPassword)
+	case p.RequireDigit && !digit:
+		return fmt.Errorf("%w: no digit", ErrWeakPassword)
+	case password != "" && strings.EqualFold(password, username):
+		return fmt.Errorf("%w: equals the username", ErrWeakPassword)
+	}
+
+	return nil
+}
+
+// ChangePassword changes the password of the user of the session and
+// replaces the session token, the returned token continues the session and
+// the old one stops working.
+func ChangePassword(sessionToken, oldPassword, newPassword string) (string, error) {
+	return ChangePasswordContext(context.Background(), sessionToken, oldPassword, newPassword)
+}
+
+func ChangePasswordContext(ctx context.Context, sessionToken, oldPassword, newPassword string) (_ string, err error) {
+	if err := accountsMu.LockContext(ctx); err != nil {
+		return "", err
+	}
+	defer accountsMu.Unlock()
+
+	user, err := userOf(ctx, sessionToken)
+	if err != nil {
+		return "", err
+	}
+
+	defer xerrors.Wrap(&err, "ChangePassword(%s, *****, *****)", user)
+
+	account := registeredUser[string(user)]
+	if account.password != oldPassword {
+		return "", ErrWrongPassword
+	} else if err := checkPasswordLocked(account.username, newPassword); err != nil {
+		return "", err
+	}
+
+	newToken, err := rotateSession(user, sessionToken)
+	if err != nil {
+		return "", err
+	}
+
+	account.password, account.local = newPassword, false
+	registeredUser[string(user)] = account
+	delete(userAttempts, string(user))
+	audit(ctx, user, AuditPasswordChange, "", "")
+
+	return newToken, nil
+}
+
+// LoginLocal logs in a player of a single process, e.g. of a hot-seat game,
+// registering the user without a password at the first login. Users it
+// registers cannot log in with Login, users registered by RegisterUser
+// cannot log in with it.
+func LoginLocal(username string) (string, error) {
+	return LoginLocalContext(context.Background(), username)
+}
+
+func LoginLocalContext(ctx context.Context, username string) (_ string, err error) {
+	defer xerrors.Wrap(&err, "LoginLocal(%s)", username)
+
+	if err := checkUsername(username); err != nil {
+		return "", err
+	}
+
+	if err := accountsMu.LockContext(ctx); err != nil {
+		return "", err
+	}
+	defer accountsMu.Unlock()
+
+	account, ok := registeredUser[username]
+	if !ok {
+		if existing, ok := foldedUsernames[strings.ToLower(username)]; ok {
+			return "", fmt.Errorf("%w: %q", ErrUserExists, existing)
+		}
+
+		account = typeLoginPass{username: username, role: RolePlayer, registeredAt: now(), local: true}
+		registeredUser[username] = account
+		foldedUsernames[strings.ToLower(username)] = username
+		audit(ctx, TypeUser(username), AuditRegister, "", "")
+		metricRegistrations.Inc()
+	} else if !account.local {
+		return "", ErrWrongPassword
+	} else if account.ban.activeLocked() {
+		return "", account.ban
+	}
+
+	sessionToken, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	startSession(ctx, TypeUser(username), sessionToken)
+	audit(ctx, TypeUser(username), AuditLogin, "", "")
+	metricLogins.Inc()
+
+	return sessionToken, nil
+}
+
+// DeleteAccount ends the session of the user, forfeiting the game, removes
+// the user and replaces the user by "anonymous" in the history.
+func DeleteAccount(sessionToken, password string) error {
+	return DeleteAccountContext(context.Background(), sessionToken, password)
+}
+
+func DeleteAccountContext(ctx context.Context, sessionToken, password string) (err error) {
+	if err := accountsMu.LockContext(ctx); err != nil {
+		return err
+	}
+	defer accountsMu.Unlock()
+
+	user, err := userOf(ctx, sessionToken)
+	if err != nil {
+		return err
+	}
+
+	defer xerrors.Wrap(&err, "DeleteAccount(%s, *****)", user)
+
+	if registeredUser[string(user)].password != password {
+		return ErrWrongPassword
+	}
+
+	audit(ctx, user, AuditAccountDelete, "", "")
+	deleteUserLocked(ctx, user)
+
+	return nil
+}
+
+// deleteUserLocked removes the user, the caller holds accountsMu.
+func deleteUserLocked(ctx context.Context, user TypeUser) {
+	username := string(user)
+	if token, ok := tokenOf(user); ok {
+		endSession(ctx, user, token, "")
+	}
+
+	delete(registeredUser, username)
+	delete(foldedUsernames, strings.ToLower(username))
+	delete(userAttempts, username)
+
+	socialMu.Lock()
+	forgetRelationsLocked(user)
+	socialMu.Unlock()
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	forgetPlayerLocked(username)
+	for i, r := range playsHistory {
+		if r.mayBeWinner == username {
+			playsHistory[i].mayBeWinner = anonymousUser
+		}
+		if r.user2 == username {
+			playsHistory[i].user2 = anonymousUser
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package xo_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	. "github.com/ayzatziko/stuff/x/xo/xo"
+)
+
+func TestUsernamePolicy(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	for _, username := range []string{"", "ab", strings.Repeat("a", 33), "-user", "us er", "usér", "Admin", "anonymous"} {
+		err := RegisterUser(username, testPassword)
+		failIfFalseFmt(t, errors.Is(err, ErrInvalidUsername), "%q: unexpected error %v", username, err)
+	}
+
+	for _, username := range []string{"abc", "User_1", "user.name-2", strings.Repeat("a", 32)} {
+		failIfError(t, RegisterUser(username, testPassword))
+	}
+
+	err := RegisterUser("USER_1", testPassword)
+	failIfFalseFmt(t, errors.Is(err, ErrUserExists), "unexpected error %v", err)
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+	t.Cleanup(func() { SetPasswordPolicy(DefaultPasswordPolicy) })
+
+	SetPasswordPolicy(DefaultPasswordPolicy)
+	for _, password := range []string{"", "p", "secret1", "User1abc", strings.Repeat("p", 73)} {
+		err := RegisterUser("user1abc", password)
+		failIfFalseFmt(t, errors.Is(err, ErrWeakPassword), "%q: unexpected error %v", password, err)
+	}
+	failIfError(t, RegisterUser("user2", "secret12"))
+
+	SetPasswordPolicy(TypePasswordPolicy{MinLength: 8, RequireLetter: true, RequireDigit: true})
+	for _, password := range []string{"", "secret1", "12345678", "password"} {
+		err := RegisterUser("user1", password)
+		failIfFalseFmt(t, errors.Is(err, ErrWeakPassword), "%q: unexpected error %v", password, err)
+	}
+	failIfError(t, RegisterUser("user1", "password1"))
+}
+
+func TestChangePassword(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	failIfError(t, RegisterUser("user1name", "old-password"))
+	token, err := Login("user1name", "old-password")
+	failIfError(t, err)
+
+	_, err = ChangePassword(token, "wrong", "new-password")
+	failIfFalseFmt(t, errors.Is(err, ErrWrongPassword), "unexpected error %v", err)
+	_, err = ChangePassword(token, "old-password", "USER1NAME")
+	failIfFalseFmt(t, errors.Is(err, ErrWeakPassword), "unexpected error %v", err)
+	_, err = ChangePassword("no such session", "old-password", "new-password")
+	failIfFalseFmt(t, errors.Is(err, ErrSessionNotFound), "unexpected error %v", err)
+
+	// the session continues with a new token
+	newToken, err := ChangePassword(token, "old-password", "new-password")
+	failIfError(t, err)
+	_, err = CurrentBoard(token)
+	failIfFalseFmt(t, errors.Is(err, ErrSessionNotFound), "old token works: %v", err)
+	_, err = CurrentBoard(newToken)
+	failIfFalseFmt(t, errors.Is(err, ErrNotPlaying), "new token does not work: %v", err)
+
+	_, err = Login("user1name", "old-password")
+	failIfFalseFmt(t, errors.Is(err, ErrWrongPassword), "unexpected error %v", err)
+	_, err = Login("user1name", "new-password")
+	failIfError(t, err)
+}
+
+func TestLoginLocal(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	token, err := LoginLocal("user1")
+	failIfError(t, err)
+	token, err = LoginLocal("user1")
+	failIfError(t, err)
+	_, err = CurrentBoard(token)
+	failIfFalseFmt(t, errors.Is(err, ErrNotPlaying), "unexpected error %v", err)
+
+	// local users have no password
+	_, err = Login("user1", "")
+	failIfFalseFmt(t, errors.Is(err, ErrWrongPassword), "unexpected error %v", err)
+
+	// users with passwords log in with them
+	failIfError(t, RegisterUser("user2", testPassword))
+	_, err = LoginLocal("user2")
+	failIfFalseFmt(t, errors.Is(err, ErrWrongPassword), "unexpected error %v", err)
+	_, err = LoginLocal("USER2")
+	failIfFalseFmt(t, errors.Is(err, ErrUserExists), "unexpected error %v", err)
+}
+
+func TestDeleteAccount(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	tokenFirst, _ := startGame(t, "user1", "user2")
+	events, _, err := Subscribe(tokenFirst)
+	failIfError(t, err)
+
+	err = DeleteAccount(tokenFirst, "wrong")
+	failIfFalseFmt(t, errors.Is(err, ErrWrongPassword), "unexpected error %v", err)
+	failIfError(t, DeleteAccount(tokenFirst, testPassword))
+
+	winner, loser, _, termination := LastHistoryRecord()
+	failIfFalseFmt(t, winner == "user2" && loser == "anonymous", "unexpected history %q %q", winner, loser)
+	failIfFalseFmt(t, termination == TerminationForfeit, "unexpected termination %q", termination)
+
+	for range events {
+		// the subscription is closed
+	}
+
+	_, err = CurrentBoard(tokenFirst)
+	failIfFalseFmt(t, errors.Is(err, ErrSessionNotFound), "unexpected error %v", err)
+	_, err = Login("user1", testPassword)
+	failIfFalseFmt(t, errors.Is(err, ErrUserNotFound), "unexpected error %v", err)
+
+	// the username is free again
+	failIfError(t, RegisterUser("USER1", testPassword))
+}
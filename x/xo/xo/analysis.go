@@ -0,0 +1,531 @@
+package xo
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ayzatziko/stuff/xerrors"
+)
+
+// TypeValue is the game-theoretic value of a position for the side to move.
+type TypeValue int
+
+const (
+	ValueLoss TypeValue = -1
+	ValueDraw TypeValue = 0
+	ValueWin  TypeValue = 1
+)
+
+func (value TypeValue) String() string {
+	switch value {
+	case ValueLoss:
+		return "loss"
+	case ValueDraw:
+		return "draw"
+	case ValueWin:
+		return "win"
+	}
+
+	return fmt.Sprintf("TypeValue(%d)", int(value))
+}
+
+// TypeEval is the outcome of perfect play. Distance is the number of moves
+// to the end of a won or lost game, the winner hurries and the loser delays.
+type TypeEval struct {
+	Value    TypeValue
+	Distance int
+}
+
+func (e TypeEval) String() string {
+	if e.Value == ValueDraw {
+		return e.Value.String()
+	}
+
+	return fmt.Sprintf("%s in %d", e.Value, e.Distance)
+}
+
+// solverWin is the score of a finished won game, every move to the end takes
+// one off.
+const solverWin = 1 << 20
+
+func evalOf(score int) TypeEval {
+	switch {
+	case score > 0:
+		return TypeEval{Value: ValueWin, Distance: solverWin - score}
+	case score < 0:
+		return TypeEval{Value: ValueLoss, Distance: solverWin + score}
+	}
+
+	return TypeEval{Value: ValueDraw}
+}
+
+func (e TypeEval) score() int {
+	return int(e.Value) * (solverWin - e.Distance)
+}
+
+// TypeMoveEval is the outcome of a move for the side making it.
+type TypeMoveEval struct {
+	Move TypeMove
+	TypeEval
+}
+
+// TypeAnalysis is the outcome of a position for the side to move with
+// outcomes of all legal moves, the best first.
+type TypeAnalysis struct {
+	TypeEval
+	Side  int
+	Best  []TypeMoveEval
+	Moves []TypeMoveEval
+}
+
+// Cells returns the outcome of the best move to every cell, e.g. to shade
+// the cells of the board.
+func (a TypeAnalysis) Cells() map[TypeCell]TypeEval {
+	cells := map[TypeCell]TypeEval{}
+	for _, m := range a.Moves {
+		if _, ok := cells[m.Move.Cell]; !ok {
+			cells[m.Move.Cell] = m.TypeEval
+		}
+	}
+
+	return cells
+}
+
+// constSolverPositionsMax bounds the number of positions a solver solves
+// for an analysis, positions needing more fail with ErrSearchLimit. Every
+// solved position visits all its moves, so an analysis visits about as many
+// positions as the bot searches for a move and takes about a second.
+const constSolverPositionsMax = 1 << 15
+
+// constSolverTableSize is the number of positions a solver remembers.
+const constSolverTableSize = 1 << 18
+
+// constAnalysisRate is the number of analyses a user may request by
+// AnalyzeFor and Hint within constAnalysisRateWindow.
+const (
+	constAnalysisRate       = 10
+	constAnalysisRateWindow = time.Minute
+)
+
+// analysesRequested are times of the last analyses of users.
+var (
+	analysesMu        sync.Mutex
+	analysesRequested = map[TypeUser][]time.Time{}
+)
+
+// constSolverCheckInterval is the number of positions solved between checks
+// of the context of an analysis.
+const constSolverCheckInterval = 1 << 12
+
+// TypeSolver solves positions of a variant by searching to the end of the
+// game. It remembers solved positions between calls taking symmetric
+// positions as one. It is safe for concurrent use.
+type TypeSolver struct {
+	rules  Rules
+	limit  int
+	hasher *typeHasher
+
+	// mu guards the table only, analyses run concurrently
+	mu    sync.Mutex
+	table *typeTable[int32]
+}
+
+// typeSolverSearch is a single analysis of a solver.
+type typeSolverSearch struct {
+	*TypeSolver
+	ctx    context.Context
+	solved int
+}
+
+func NewSolver(rules Rules) *TypeSolver { return NewSolverWithLimit(rules, constSolverPositionsMax) }
+
+// NewSolverWithLimit returns a solver solving up to limit positions for an
+// analysis, the positions it remembers are not counted.
+func NewSolverWithLimit(rules Rules, limit int) *TypeSolver {
+	return &TypeSolver{
+		rules:  rules,
+		limit:  limit,
+		hasher: hasherOf(rules),
+		table:  newTable[int32](constSolverTableSize),
+	}
+}
+
+// Analyze solves pos and all positions after its legal moves.
+func (s *TypeSolver) Analyze(pos *TypePosition) (TypeAnalysis, error) {
+	return s.AnalyzeContext(context.Background(), pos)
+}
+
+// AnalyzeContext is Analyze stopping with the error of ctx when it is done.
+func (s *TypeSolver) AnalyzeContext(ctx context.Context, pos *TypePosition) (_ TypeAnalysis, err error) {
+	defer xerrors.Wrap(&err, "Analyze(%s)", s.rules.Name())
+
+	width, height, depth := pos.Size()
+	if w, h, d := s.rules.NewPosition().Size(); w != width || h != height || d != depth {
+		return TypeAnalysis{}, fmt.Errorf("%w: position %d×%d×%d is not of the variant", ErrIllegalMove, width, height, depth)
+	}
+
+	analysis := TypeAnalysis{Side: pos.Side()}
+	if s.rules.Terminal(pos) {
+		analysis.TypeEval = evalOf(s.terminalScore(pos))
+		return analysis, nil
+	}
+
+	search := typeSolverSearch{TypeSolver: s, ctx: ctx}
+	hashes := s.hasher.hashes(pos)
+
+	sign := sideSign(pos)
+	for _, move := range s.rules.LegalMoves(pos) {
+		next := pos.Clone()
+		if err := s.rules.ApplyMove(next, withSign(move, sign)); err != nil {
+			return TypeAnalysis{}, err
+		}
+
+		score, err := search.solve(next, s.hasher.played(hashes, next))
+		if err != nil {
+			return TypeAnalysis{}, err
+		}
+
+		analysis.Moves = append(analysis.Moves, TypeMoveEval{Move: move, TypeEval: evalOf(closer(-score))})
+	}
+
+	sort.SliceStable(analysis.Moves, func(i, j int) bool {
+		return analysis.Moves[i].score() > analysis.Moves[j].score()
+	})
+
+	analysis.TypeEval = analysis.Moves[0].TypeEval
+	for _, m := range analysis.Moves {
+		if m.TypeEval == analysis.TypeEval {
+			analysis.Best = append(analysis.Best, m)
+		}
+	}
+
+	return analysis, nil
+}
+
+// solve returns the score of pos with hashes for the side to move.
+func (s *typeSolverSearch) solve(pos *TypePosition, hashes []uint64) (int, error) {
+	if s.rules.Terminal(pos) {
+		return s.terminalScore(pos), nil
+	}
+
+	hash := s.hasher.canonical(hashes, pos)
+	if score, ok := s.lookup(hash); ok {
+		return int(score), nil
+	} else if s.solved >= s.limit {
+		return 0, fmt.Errorf("%w: more than %d positions", ErrSearchLimit, s.limit)
+	} else if s.solved%constSolverCheckInterval == 0 {
+		if err := s.ctx.Err(); err != nil {
+			return 0, err
+		}
+	}
+	s.solved++
+
+	sign := sideSign(pos)
+	best := -solverWin - 1
+	for _, move := range s.rules.LegalMoves(pos) {
+		next := pos.Clone()
+		if s.rules.ApplyMove(next, withSign(move, sign)) != nil {
+			continue
+		}
+
+		score, err := s.solve(next, s.hasher.played(hashes, next))
+		if err != nil {
+			return 0, err
+		}
+
+		if score = closer(-score); score > best {
+			best = score
+		}
+	}
+
+	s.store(hash, int32(best))
+	return best, nil
+}
+
+func (s *TypeSolver) lookup(hash uint64) (int32, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.table.get(hash)
+}
+
+func (s *TypeSolver) store(hash uint64, score int32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.table.put(hash, score)
+}
+
+func (s *TypeSolver) terminalScore(pos *TypePosition) int {
+	side, ok := s.rules.Winner(pos)
+	if !ok {
+		return 0
+	} else if side == pos.Side() {
+		return solverWin
+	}
+
+	return -solverWin
+}
+
+// closer takes a move off the distance to the end of the game.
+func closer(score int) int {
+	switch {
+	case score > 0:
+		return score - 1
+	case score < 0:
+		return score + 1
+	}
+
+	return 0
+}
+
+// sideSign returns the sign of the side to move, x before the first move.
+func sideSign(pos *TypePosition) TypeSign {
+	switch n := len(pos.moves); {
+	case n >= 2:
+		return pos.moves[n-2].Sign
+	case n == 1:
+		return oppositeSign(pos.moves[0].Sign)
+	}
+
+	return SignX
+}
+
+var (
+	solversMu sync.Mutex
+	solvers   = map[string]*TypeSolver{}
+)
+
+func Analyze(rules Rules, pos *TypePosition) (TypeAnalysis, error) {
+	return AnalyzeContext(context.Background(), rules, pos)
+}
+
+// AnalyzeContext solves pos of rules with the solver shared by all the games
+// of the variant if it is registered, or with a new one.
+func AnalyzeContext(ctx context.Context, rules Rules, pos *TypePosition) (TypeAnalysis, error) {
+	return solverOf(rules).AnalyzeContext(ctx, pos)
+}
+
+func AnalyzeFor(sessionToken string, rules Rules, pos *TypePosition) (TypeAnalysis, error) {
+	return AnalyzeForContext(context.Background(), sessionToken, rules, pos)
+}
+
+// AnalyzeForContext is AnalyzeContext on behalf of the session user, who
+// may request 10 analyses a minute.
+func AnalyzeForContext(ctx context.Context, sessionToken string, rules Rules, pos *TypePosition) (_ TypeAnalysis, err error) {
+	user, err := userOf(ctx, sessionToken)
+	if err != nil {
+		return TypeAnalysis{}, err
+	}
+
+	defer xerrors.Wrap(&err, "AnalyzeFor(%s)", user)
+
+	if err := throttleAnalysis(user); err != nil {
+		return TypeAnalysis{}, err
+	}
+
+	return AnalyzeContext(ctx, rules, pos)
+}
+
+// throttleAnalysis counts an analysis requested by user, it fails when user
+// has requested too many.
+func throttleAnalysis(user TypeUser) error {
+	analysesMu.Lock()
+	defer analysesMu.Unlock()
+
+	requested, retry := throttle(analysesRequested[user], now(), constAnalysisRate, constAnalysisRateWindow)
+	analysesRequested[user] = requested
+	if retry > 0 {
+		return fmt.Errorf("%w: retry in %s", ErrAnalysisThrottled, retry)
+	}
+
+	return nil
+}
+
+func solverOf(rules Rules) *TypeSolver {
+	if !registered(rules) {
+		return NewSolver(rules)
+	}
+
+	solversMu.Lock()
+	solver, ok := solvers[rules.Name()]
+	if !ok {
+		solver = NewSolver(rules)
+		solvers[rules.Name()] = solver
+	}
+	solversMu.Unlock()
+
+	return solver
+}
+
+// Hint analyzes the board the session user is playing on, the game is not
+// rated after it, see TypeBoard.Rated. Hints count as analyses of AnalyzeFor.
+func Hint(sessionToken string) (TypeAnalysis, error) {
+	return HintContext(context.Background(), sessionToken)
+}
+
+func HintContext(ctx context.Context, sessionToken string) (_ TypeAnalysis, err error) {
+	user, game, err := lockSessionGame(ctx, sessionToken)
+	if err != nil {
+		return TypeAnalysis{}, err
+	}
+	defer xerrors.Wrap(&err, "Hint(%s)", user)
+
+	if err := throttleAnalysis(user); err != nil {
+		game.mu.Unlock()
+		return TypeAnalysis{}, err
+	}
+
+	game.board.unrated = true
+	rules, pos := game.board.rules, game.board.position.Clone()
+	game.mu.Unlock()
+
+	return AnalyzeContext(ctx, rules, pos)
+}
+
+// TypeReview is a played move with its outcome and the analysis of the
+// position before it.
+type TypeReview struct {
+	Move     TypeMove
+	Played   TypeEval
+	Analysis TypeAnalysis
+}
+
+// Mistake reports whether the move has worsened the value of the position
+// for the mover.
+func (r TypeReview) Mistake() bool { return r.Played.Value < r.Analysis.Value }
+
+// Review analyzes every move of pos, e.g. of the board of a finished game.
+func Review(rules Rules, pos *TypePosition) ([]TypeReview, error) {
+	return ReviewContext(context.Background(), rules, pos)
+}
+
+func ReviewContext(ctx context.Context, rules Rules, pos *TypePosition) (_ []TypeReview, err error) {
+	defer xerrors.Wrap(&err, "Review(%s)", rules.Name())
+
+	solver := solverOf(rules)
+
+	var reviews []TypeReview
+	cur := rules.NewPosition()
+	for _, move := range pos.Moves() {
+		analysis, err := solver.AnalyzeContext(ctx, cur)
+		if err != nil {
+			return nil, err
+		}
+
+		review := TypeReview{Move: move, Analysis: analysis}
+		for _, m := range analysis.Moves {
+			if m.Move.Cell == move.Cell && (m.Move.Sign == signNull || m.Move.Sign == move.Sign) {
+				review.Played = m.TypeEval
+				break
+			}
+		}
+
+		if err := rules.ApplyMove(cur, move); err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, review)
+	}
+
+	return reviews, nil
+}
+
+// FormatPosition formats the moves of pos like "x0,0 o1,1", see FormatMove.
+func FormatPosition(pos *TypePosition) string {
+	moves := make([]string, len(pos.moves))
+	for i, m := range pos.moves {
+		moves[i] = FormatMove(m, pos.depth > 1)
+	}
+
+	return strings.Join(moves, " ")
+}
+
+// FormatMove formats move like "x0,0", rows, columns and layers count from
+// zero, the layer is present on three-dimensional boards only: "x0,0,2".
+func FormatMove(move TypeMove, threeDimensional bool) string {
+	s := fmt.Sprintf("%s%d,%d", move.Sign, move.Cell.Row(), move.Cell.Col())
+	if threeDimensional {
+		s += fmt.Sprintf(",%d", move.Cell.Layer())
+	}
+
+	return s
+}
+
+// ParseMove parses a move formatted by FormatMove.
+func ParseMove(s string) (_ TypeMove, err error) {
+	defer xerrors.Wrap(&err, "ParseMove(%q)", s)
+
+	if s == "" {
+		return TypeMove{}, fmt.Errorf("%w: empty move", ErrInvalidCell)
+	}
+
+	sign := TypeSign(s[:1])
+	if sign != SignX && sign != SignO {
+		return TypeMove{}, ErrInvalidSign
+	}
+
+	coordinates := strings.Split(s[1:], ",")
+	if len(coordinates) < 2 || len(coordinates) > 3 {
+		return TypeMove{}, ErrInvalidCell
+	}
+
+	var xyz [3]int
+	for i, c := range coordinates {
+		if xyz[i], err = strconv.Atoi(c); err != nil {
+			return TypeMove{}, ErrInvalidCell
+		}
+	}
+
+	cell, err := NewCell3D(xyz[0], xyz[1], xyz[2])
+	return TypeMove{Cell: cell, Sign: sign}, err
+}
+
+// ParsePosition plays the moves formatted by FormatPosition by rules. The
+// sides alternate their signs after the first move unless the mover chooses
+// the sign like in wild.
+func ParsePosition(rules Rules, s string) (_ *TypePosition, err error) {
+	defer xerrors.Wrap(&err, "ParsePosition(%s, %q)", rules.Name(), s)
+
+	pos := rules.NewPosition()
+	for _, field := range strings.Fields(s) {
+		move, err := ParseMove(field)
+		if err != nil {
+			return nil, err
+		} else if err := checkSign(rules, pos, move); err != nil {
+			return nil, err
+		} else if err := rules.ApplyMove(pos, move); err != nil {
+			return nil, err
+		}
+	}
+
+	return pos, nil
+}
+
+// checkSign returns an error when move places another sign than the side to
+// move of pos would. Variants placing the same sign for both sides like
+// notakto take any sign.
+func checkSign(rules Rules, pos *TypePosition, move TypeMove) error {
+	want := sideSign(pos)
+	if len(pos.moves) == 0 || move.Sign == want || choosesSign(rules) {
+		return nil
+	}
+
+	got, expected := pos.Clone(), pos.Clone()
+	if rules.ApplyMove(got, move) != nil || rules.ApplyMove(expected, TypeMove{Cell: move.Cell, Sign: want}) != nil {
+		// ApplyMove of the caller reports the error
+		return nil
+	}
+
+	gotMove, _ := got.LastMove()
+	expectedMove, _ := expected.LastMove()
+	if gotMove.Sign == expectedMove.Sign {
+		return nil
+	}
+
+	return fmt.Errorf("%w %q, %q is to move", ErrInvalidSign, move.Sign, want)
+}
@@ -0,0 +1,194 @@
+package xo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/ayzatziko/stuff/x/xo/xo"
+)
+
+func TestAnalyzeValues(t *testing.T) {
+	for _, tt := range []struct {
+		rules    Rules
+		position string
+		want     TypeEval
+		best     int
+	}{
+		{Classic(), "", TypeEval{Value: ValueDraw}, 9},
+		{Classic(), "x0,0 o1,0 x0,1 o1,1", TypeEval{Value: ValueWin, Distance: 1}, 1},
+		{Classic(), "x0,0 o0,1 x1,1 o2,2 x1,0", TypeEval{Value: ValueLoss, Distance: 2}, 4},
+		{Classic(), "x0,0 o1,0 x0,1 o1,1 x0,2", TypeEval{Value: ValueLoss}, 0},
+		{Misere(Classic()), "", TypeEval{Value: ValueDraw}, 1},
+		{Wild(), "", TypeEval{Value: ValueWin, Distance: 7}, 2},
+		{Notakto(), "", TypeEval{Value: ValueWin, Distance: 6}, 1},
+	} {
+		pos, err := ParsePosition(tt.rules, tt.position)
+		failIfError(t, err)
+
+		analysis, err := Analyze(tt.rules, pos)
+		failIfError(t, err)
+
+		if analysis.TypeEval != tt.want || len(analysis.Best) != tt.best {
+			t.Errorf("%s %q: got %s with %d best moves %v, want %s with %d", tt.rules.Name(), tt.position, analysis.TypeEval, len(analysis.Best), analysis.Best, tt.want, tt.best)
+		}
+	}
+}
+
+func TestAnalyzeMoves(t *testing.T) {
+	pos, err := ParsePosition(Classic(), "x1,1")
+	failIfError(t, err)
+
+	analysis, err := Analyze(Classic(), pos)
+	failIfError(t, err)
+	failIfFalseFmt(t, analysis.Side == 1 && len(analysis.Moves) == 8, "unexpected analysis %+v", analysis)
+
+	// only corners hold the draw against the center
+	for cell, eval := range analysis.Cells() {
+		corner := cell.Row() != 1 && cell.Col() != 1
+		failIfFalseFmt(t, corner == (eval.Value == ValueDraw), "unexpected evaluation of %s: %s", cell, eval)
+	}
+
+	for i := 1; i < len(analysis.Moves); i++ {
+		prev, cur := analysis.Moves[i-1], analysis.Moves[i]
+		failIfFalseFmt(t, prev.Value >= cur.Value, "moves are not ordered: %v", analysis.Moves)
+	}
+}
+
+func TestSolverSymmetries(t *testing.T) {
+	// tic-tac-toe has 627 unfinished positions up to the symmetries and
+	// 4520 without them, the analyzed position is not counted
+	_, err := NewSolverWithLimit(Classic(), 626).Analyze(Classic().NewPosition())
+	failIfError(t, err)
+
+	_, err = NewSolverWithLimit(Classic(), 625).Analyze(Classic().NewPosition())
+	failIfFalseFmt(t, errors.Is(err, ErrSearchLimit), "expected search limit error, got %v", err)
+}
+
+func TestAnalyzeParametrized(t *testing.T) {
+	rules, err := RulesByName("gravity-4x4-3")
+	failIfError(t, err)
+
+	solversNum, hashersNum := CachedSolvers()
+	_, err = Analyze(rules, rules.NewPosition())
+	failIfError(t, err)
+	Hash(rules, rules.NewPosition())
+
+	// solvers of unregistered variants are not kept
+	gotSolvers, gotHashers := CachedSolvers()
+	failIfFalseFmt(t, gotSolvers == solversNum && gotHashers == hashersNum, "cached %d solvers and %d hashers, want %d and %d", gotSolvers, gotHashers, solversNum, hashersNum)
+}
+
+func TestReview(t *testing.T) {
+	// o answers the center by an edge and loses
+	pos, err := ParsePosition(Classic(), "x1,1 o0,1 x0,0 o2,2 x2,0 o1,0 x0,2")
+	failIfError(t, err)
+	failIfFalseFmt(t, FormatPosition(pos) == "x1,1 o0,1 x0,0 o2,2 x2,0 o1,0 x0,2", "unexpected format %q", FormatPosition(pos))
+
+	reviews, err := Review(Classic(), pos)
+	failIfError(t, err)
+	failIfFalseFmt(t, len(reviews) == 7, "unexpected reviews %v", reviews)
+
+	for i, r := range reviews {
+		failIfFalseFmt(t, r.Mistake() == (i == 1), "move %d %s: unexpected mistake %v, played %s of %s", i, r.Move, r.Mistake(), r.Played, r.Analysis.TypeEval)
+	}
+}
+
+func TestParsePositionErrors(t *testing.T) {
+	for _, s := range []string{"z0,0", "x0", "x0,0,0,0", "xa,0", "x0,0 o0,0", "x3,0"} {
+		_, err := ParsePosition(Classic(), s)
+		failIfFalseFmt(t, err != nil, "%q: expected error", s)
+	}
+
+	for _, s := range []string{"x0,0 x1,1 x2,2", "o0,0 o1,0", "x0,0 o1,1 o2,2"} {
+		_, err := ParsePosition(Classic(), s)
+		failIfFalseFmt(t, errors.Is(err, ErrInvalidSign), "%q: unexpected error %v", s, err)
+	}
+
+	// the mover chooses the sign in wild, both sides place x in notakto
+	_, err := ParsePosition(Wild(), "x0,0 x1,1 o2,2")
+	failIfError(t, err)
+	_, err = ParsePosition(Notakto(), "x0,0 x1,1 o2,2")
+	failIfError(t, err)
+
+	pos, err := ParsePosition(Qubic(), "x0,1,2")
+	failIfError(t, err)
+	failIfFalseFmt(t, FormatPosition(pos) == "x0,1,2", "unexpected format %q", FormatPosition(pos))
+
+	_, err = Analyze(Classic(), pos)
+	failIfFalseFmt(t, err != nil, "expected error analyzing position of another variant")
+}
+
+func TestHint(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	current := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t.Cleanup(SetNow(func() time.Time { return current }))
+
+	tokenFirst, _ := startGame(t, "user1", "user2")
+	board, err := CurrentBoard(tokenFirst)
+	failIfError(t, err)
+	failIfFalseFmt(t, board.Rated(), "new game is not rated")
+
+	analysis, err := Hint(tokenFirst)
+	failIfError(t, err)
+	failIfFalseFmt(t, analysis.Value == ValueDraw && len(analysis.Moves) == 9, "unexpected hint %+v", analysis)
+
+	board, err = CurrentBoard(tokenFirst)
+	failIfError(t, err)
+	failIfFalseFmt(t, !board.Rated(), "game is rated after a hint")
+
+	_, err = Hint("no such session")
+	failIfFalseFmt(t, errors.Is(err, ErrSessionNotFound), "unexpected error %v", err)
+
+	// hints count as analyses
+	for i := 0; i < 9; i++ {
+		_, err := Hint(tokenFirst)
+		failIfError(t, err)
+	}
+	_, err = Hint(tokenFirst)
+	failIfFalseFmt(t, errors.Is(err, ErrAnalysisThrottled), "unexpected error %v", err)
+	_, err = AnalyzeFor(tokenFirst, Classic(), Classic().NewPosition())
+	failIfFalseFmt(t, errors.Is(err, ErrAnalysisThrottled), "unexpected error %v", err)
+
+	// the unrated game is not on leaderboards
+	_, _, err = Resign(tokenFirst)
+	failIfError(t, err)
+	entries, err := Leaderboard(TypeLeaderboardQuery{})
+	failIfError(t, err)
+	failIfFalseFmt(t, len(entries) == 0, "unexpected leaderboard %+v", entries)
+}
+
+func TestAnalyzeFor(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	current := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t.Cleanup(SetNow(func() time.Time { return current }))
+
+	token := loginAs(t, "user1", RolePlayer)
+	pos := Classic().NewPosition()
+
+	_, err := AnalyzeFor("no such session", Classic(), pos)
+	failIfFalseFmt(t, errors.Is(err, ErrSessionNotFound), "unexpected error %v", err)
+
+	for i := 0; i < 10; i++ {
+		_, err := AnalyzeFor(token, Classic(), pos)
+		failIfError(t, err)
+	}
+	_, err = AnalyzeFor(token, Classic(), pos)
+	failIfFalseFmt(t, errors.Is(err, ErrAnalysisThrottled), "unexpected error %v", err)
+
+	current = current.Add(time.Minute)
+	_, err = AnalyzeFor(token, Classic(), pos)
+	failIfError(t, err)
+}
+
+func TestAnalyzeCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// qubic is far beyond the search limit, the analysis stops at once
+	_, err := AnalyzeContext(ctx, Qubic(), Qubic().NewPosition())
+	failIfFalseFmt(t, errors.Is(err, context.Canceled), "unexpected error %v", err)
+}
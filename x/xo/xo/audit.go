@@ -0,0 +1,380 @@
+package xo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ayzatziko/stuff/xerrors"
+)
+
+// Actions of audit records.
+const (
+	AuditRegister        = "register"
+	AuditLogin           = "login"
+	AuditLoginFailed     = "login failed"
+	AuditSessionTakeover = "session takeover"
+	AuditLogout          = "logout"
+	AuditPasswordChange  = "password change"
+	AuditAccountDelete   = "account delete"
+	AuditForfeit         = "forfeit"
+	AuditRoleChange      = "role change"
+	AuditForceLogout     = "force logout"
+	AuditBan             = "ban"
+	AuditUnban           = "unban"
+	AuditGameAbort       = "game abort"
+	AuditAdjudication    = "adjudication"
+	AuditPurge           = "purge"
+	AuditUnlock          = "unlock"
+	// AuditDropped records the number of records dropped while the queue
+	// of the sink was full.
+	AuditDropped = "records dropped"
+)
+
+// TypeAuditRecord is an entry of the audit log, User did Action to Target.
+// TraceID and Address are the values of the context of the operation, see
+// WithTraceID and WithClientAddress. Hash covers the fields and the hash of
+// the previous record, so changing or removing a record breaks the chain.
+type TypeAuditRecord struct {
+	Seq     uint64    `json:"seq"`
+	Time    time.Time `json:"time"`
+	User    TypeUser  `json:"user,omitempty"`
+	Action  string    `json:"action"`
+	Target  TypeUser  `json:"target,omitempty"`
+	Detail  string    `json:"detail,omitempty"`
+	TraceID string    `json:"trace_id,omitempty"`
+	Address string    `json:"address,omitempty"`
+	Prev    string    `json:"prev"`
+	Hash    string    `json:"hash"`
+}
+
+func (r TypeAuditRecord) hash() string {
+	fields := []string{
+		fmt.Sprint(r.Seq),
+		r.Time.UTC().Format(time.RFC3339Nano),
+		string(r.User),
+		r.Action,
+		string(r.Target),
+		r.Detail,
+		r.TraceID,
+		r.Address,
+		r.Prev,
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\x00")))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyAudit checks the hashes of records and their chain, records are the
+// whole log or a contiguous part of it.
+func VerifyAudit(records []TypeAuditRecord) error {
+	for i, r := range records {
+		if r.hash() != r.Hash {
+			return fmt.Errorf("%w: record %d is changed", ErrAuditTampered, r.Seq)
+		} else if i > 0 && (r.Seq != records[i-1].Seq+1 || r.Prev != records[i-1].Hash) {
+			return fmt.Errorf("%w: record %d does not follow record %d", ErrAuditTampered, r.Seq, records[i-1].Seq)
+		}
+	}
+
+	return nil
+}
+
+// AuditSink stores audit records, records are appended by one goroutine in
+// the order of their numbers and a failed append is retried. The context of
+// Append carries the values of the context of the operation but is never
+// done, the operation has already happened.
+type AuditSink interface {
+	Append(ctx context.Context, record TypeAuditRecord) error
+	// Last returns the last appended record, the log continues after it.
+	Last(ctx context.Context) (_ TypeAuditRecord, ok bool, _ error)
+	// Query returns the records by user or about user, all records if user
+	// is empty, from the time inclusive to the time exclusive, zero times
+	// do not limit.
+	Query(ctx context.Context, user TypeUser, from, to time.Time) ([]TypeAuditRecord, error)
+}
+
+// MatchAudit reports whether record matches the query of AuditSink.Query.
+func MatchAudit(record TypeAuditRecord, user TypeUser, from, to time.Time) bool {
+	return (user == "" || record.User == user || record.Target == user) &&
+		(from.IsZero() || !record.Time.Before(from)) &&
+		(to.IsZero() || record.Time.Before(to))
+}
+
+// MemoryAuditSink keeps records in memory, it is the sink by default.
+type MemoryAuditSink struct {
+	mu      sync.Mutex
+	records []TypeAuditRecord
+}
+
+func (s *MemoryAuditSink) Append(_ context.Context, record TypeAuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records = append(s.records, record)
+	return nil
+}
+
+func (s *MemoryAuditSink) Last(context.Context) (TypeAuditRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.records) == 0 {
+		return TypeAuditRecord{}, false, nil
+	}
+
+	return s.records[len(s.records)-1], true, nil
+}
+
+func (s *MemoryAuditSink) Query(ctx context.Context, user TypeUser, from, to time.Time) ([]TypeAuditRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var records []TypeAuditRecord
+	for _, r := range s.records {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if MatchAudit(r, user, from, to) {
+			records = append(records, r)
+		}
+	}
+
+	return records, nil
+}
+
+const (
+	// constAuditRetry is the first delay before a failed record is appended
+	// again, it doubles up to constAuditRetryMax.
+	constAuditRetry    = time.Second
+	constAuditRetryMax = time.Minute
+	// constAuditQueueMax is the number of records waiting for the sink,
+	// further records are dropped and counted.
+	constAuditQueueMax = 1 << 14
+)
+
+// typeAuditItem is a record waiting to be appended to the sink that was set
+// when it was made.
+type typeAuditItem struct {
+	ctx    context.Context
+	sink   AuditSink
+	record TypeAuditRecord
+}
+
+var (
+	auditMu typeMutex
+
+	auditSink AuditSink = &MemoryAuditSink{}
+	auditLast TypeAuditRecord
+	// auditQueue is appended by the writer goroutine in order, a failed
+	// record stays first and is retried so the chain is not broken.
+	auditQueue []*typeAuditItem
+	// auditErr is the last failure of the sink, it is reported by queries
+	// until the record is appended.
+	auditErr error
+	// auditDropped is the number of records dropped since the queue was
+	// full, the writer records it when the queue has room again.
+	auditDropped int
+	// auditChanged is closed and replaced when the queue is shortened or
+	// the sink fails.
+	auditChanged = make(chan struct{})
+	auditWake    = make(chan struct{}, 1)
+)
+
+func init() {
+	go auditWriter()
+}
+
+// SetAuditSink makes sink store the audit log, the log continues after the
+// last record of sink. Records made before are still appended to the
+// previous sink.
+func SetAuditSink(sink AuditSink) error { return SetAuditSinkContext(context.Background(), sink) }
+
+func SetAuditSinkContext(ctx context.Context, sink AuditSink) (err error) {
+	defer xerrors.Wrap(&err, "SetAuditSink")
+
+	last, _, err := sink.Last(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := auditMu.LockContext(ctx); err != nil {
+		return err
+	}
+	defer auditMu.Unlock()
+
+	auditSink, auditLast = sink, last
+
+	return nil
+}
+
+// audit makes a record with the values of ctx and queues it for the writer
+// goroutine, callers holding other locks do not wait for the sink. The
+// record is dropped when the queue is full.
+func audit(ctx context.Context, user TypeUser, action string, target TypeUser, detail string) {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	if len(auditQueue) >= constAuditQueueMax {
+		auditDropped++
+		metricAuditDropped.Inc()
+		return
+	}
+
+	queueAuditLocked(ctx, user, action, target, detail)
+}
+
+// queueAuditLocked queues a record for the writer goroutine, the caller
+// holds auditMu.
+func queueAuditLocked(ctx context.Context, user TypeUser, action string, target TypeUser, detail string) {
+	r := TypeAuditRecord{
+		Time:    now(),
+		User:    user,
+		Action:  action,
+		Target:  target,
+		Detail:  detail,
+		TraceID: TraceID(ctx),
+		Address: ClientAddress(ctx),
+	}
+	if auditLast.Hash != "" {
+		r.Seq, r.Prev = auditLast.Seq+1, auditLast.Hash
+	}
+	r.Hash = r.hash()
+
+	auditQueue = append(auditQueue, &typeAuditItem{ctx: detach(ctx), sink: auditSink, record: r})
+	auditLast = r
+
+	select {
+	case auditWake <- struct{}{}:
+	default:
+	}
+}
+
+// auditWriter appends the queued records, failures are counted and retried,
+// the last failure is reported by FlushAudit and AuditLog.
+func auditWriter() {
+	retry := constAuditRetry
+	for range auditWake {
+		for {
+			auditMu.Lock()
+			if len(auditQueue) == 0 {
+				auditMu.Unlock()
+				break
+			}
+			item := auditQueue[0]
+			auditMu.Unlock()
+
+			err := item.sink.Append(item.ctx, item.record)
+
+			auditMu.Lock()
+			// the queue is dropped by cleanDatabase meanwhile
+			current := len(auditQueue) > 0 && auditQueue[0] == item
+			if err != nil {
+				metricAuditFailures.Inc()
+				if current {
+					auditErr = fmt.Errorf("record %d: %w", item.record.Seq, err)
+				}
+			} else {
+				auditErr, retry = nil, constAuditRetry
+				if current {
+					auditQueue[0] = nil
+					auditQueue = auditQueue[1:]
+				}
+				if auditDropped > 0 {
+					queueAuditLocked(context.Background(), "", AuditDropped, "", fmt.Sprintf("%d records", auditDropped))
+					auditDropped = 0
+				}
+			}
+			close(auditChanged)
+			auditChanged = make(chan struct{})
+			auditMu.Unlock()
+
+			if err != nil {
+				time.Sleep(retry)
+				if retry *= 2; retry > constAuditRetryMax {
+					retry = constAuditRetryMax
+				}
+			}
+		}
+	}
+}
+
+// FlushAudit waits until the records made before are appended to the sink
+// or the sink fails. Servers flush the log before closing the sink.
+func FlushAudit() error { return FlushAuditContext(context.Background()) }
+
+func FlushAuditContext(ctx context.Context) (err error) {
+	defer xerrors.Wrap(&err, "FlushAudit")
+
+	return flushAudit(ctx)
+}
+
+func flushAudit(ctx context.Context) error {
+	if err := auditMu.LockContext(ctx); err != nil {
+		return err
+	}
+	var last *typeAuditItem
+	if len(auditQueue) > 0 {
+		last = auditQueue[len(auditQueue)-1]
+	}
+	auditMu.Unlock()
+
+	for {
+		if err := auditMu.LockContext(ctx); err != nil {
+			return err
+		}
+		pending := false
+		for _, item := range auditQueue {
+			if item == last {
+				pending = true
+				break
+			}
+		}
+		sinkErr, changed := auditErr, auditChanged
+		auditMu.Unlock()
+
+		if sinkErr != nil {
+			return fmt.Errorf("audit sink failed: %w", sinkErr)
+		} else if !pending {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// AuditLog queries the audit log like AuditSink.Query, it is allowed to
+// moderators.
+func AuditLog(sessionToken string, user TypeUser, from, to time.Time) ([]TypeAuditRecord, error) {
+	return AuditLogContext(context.Background(), sessionToken, user, from, to)
+}
+
+func AuditLogContext(ctx context.Context, sessionToken string, user TypeUser, from, to time.Time) (_ []TypeAuditRecord, err error) {
+	operator, err := authorize(ctx, sessionToken, RoleModerator)
+	if err != nil {
+		return nil, err
+	}
+
+	defer xerrors.Wrap(&err, "AuditLog(%s, %s)", operator, user)
+
+	if err := flushAudit(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := auditMu.RLockContext(ctx); err != nil {
+		return nil, err
+	}
+	sink := auditSink
+	auditMu.RUnlock()
+
+	return sink.Query(ctx, user, from, to)
+}
@@ -0,0 +1,171 @@
+package xo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/ayzatziko/stuff/x/xo/xo"
+)
+
+func TestAudit(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	current := time.Now()
+	t.Cleanup(SetNow(func() time.Time { return current }))
+
+	admin := loginAs(t, "boss", RoleAdmin)
+	startGame(t, "user1", "user2")
+	current = current.Add(time.Hour)
+	Login("user1", "wrong")
+	_, err := Login("user1", testPassword)
+	failIfError(t, err)
+	failIfError(t, Ban(admin, "user2", "abuse", 0))
+
+	records, err := AuditLog(admin, "", time.Time{}, time.Time{})
+	failIfError(t, err)
+	failIfError(t, VerifyAudit(records))
+
+	var actions []string
+	for _, r := range records {
+		if r.User == "user1" || r.Target == "user1" {
+			actions = append(actions, r.Action)
+		}
+	}
+	want := []string{AuditRegister, AuditLogin, AuditLoginFailed, AuditSessionTakeover, AuditForfeit, AuditLogin}
+	failIfFalseFmt(t, equalStrings(actions, want), "got actions %q, want %q", actions, want)
+
+	byUser, err := AuditLog(admin, "user1", current, time.Time{})
+	failIfError(t, err)
+	failIfFalseFmt(t, len(byUser) == 4 && byUser[0].Action == AuditLoginFailed, "unexpected records %+v", byUser)
+
+	last := records[len(records)-1]
+	failIfFalseFmt(t, last.User == "boss" && last.Action == AuditBan && last.Target == "user2", "unexpected record %+v", last)
+
+	before, err := AuditLog(admin, "user2", time.Time{}, current)
+	failIfError(t, err)
+	failIfFalseFmt(t, len(before) == 2 && before[1].Action == AuditLogin, "unexpected records %+v", before)
+
+	_, err = AuditLog("no such session", "", time.Time{}, time.Time{})
+	failIfFalseFmt(t, errors.Is(err, ErrSessionNotFound), "unexpected error %v", err)
+}
+
+func TestAuditTampered(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	admin := loginAs(t, "boss", RoleAdmin)
+	loginAs(t, "user1", RolePlayer)
+
+	records, err := AuditLog(admin, "", time.Time{}, time.Time{})
+	failIfError(t, err)
+	failIfError(t, VerifyAudit(records))
+
+	changed := append([]TypeAuditRecord(nil), records...)
+	changed[1].User = "user1"
+	err = VerifyAudit(changed)
+	failIfFalseFmt(t, errors.Is(err, ErrAuditTampered), "changed record is not detected: %v", err)
+
+	removed := append(append([]TypeAuditRecord(nil), records[:1]...), records[2:]...)
+	err = VerifyAudit(removed)
+	failIfFalseFmt(t, errors.Is(err, ErrAuditTampered), "removed record is not detected: %v", err)
+}
+
+type failingSink struct{ MemoryAuditSink }
+
+func (*failingSink) Append(context.Context, TypeAuditRecord) error { return errors.New("disk is full") }
+
+func TestAuditSinkFailure(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	admin := loginAs(t, "boss", RoleAdmin)
+	failIfError(t, SetAuditSink(&failingSink{}))
+	loginAs(t, "user1", RolePlayer)
+
+	_, err := AuditLog(admin, "", time.Time{}, time.Time{})
+	failIfFalseFmt(t, err != nil, "expected error of failing sink")
+}
+
+// blockingSink appends records after release is closed.
+type blockingSink struct {
+	MemoryAuditSink
+	release chan struct{}
+}
+
+func (s *blockingSink) Append(ctx context.Context, record TypeAuditRecord) error {
+	<-s.release
+	return s.MemoryAuditSink.Append(ctx, record)
+}
+
+func TestAuditSlowSink(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	admin := loginAs(t, "boss", RoleAdmin)
+	sink := &blockingSink{release: make(chan struct{})}
+	failIfError(t, SetAuditSink(sink))
+
+	// the sink is not waited for with the locks of accounts held
+	done := make(chan error)
+	go func() {
+		if err := RegisterUser("user1", testPassword); err != nil {
+			done <- err
+			return
+		}
+		_, err := Login("user1", testPassword)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		failIfError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("login waits for the sink")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := FlushAuditContext(ctx)
+	failIfFalseFmt(t, errors.Is(err, context.DeadlineExceeded), "unexpected error %v", err)
+
+	close(sink.release)
+	records, err := AuditLog(admin, "", time.Time{}, time.Time{})
+	failIfError(t, err)
+	failIfError(t, VerifyAudit(records))
+	failIfFalseFmt(t, len(records) == 2 && records[1].Action == AuditLogin, "unexpected records %+v", records)
+}
+
+func TestAuditQueueFull(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	admin := loginAs(t, "boss", RoleAdmin)
+	failIfError(t, FlushAudit())
+	sink := &blockingSink{release: make(chan struct{})}
+	failIfError(t, SetAuditSink(sink))
+
+	for i := 0; i < AuditQueueMax+5; i++ {
+		Audit("user1", AuditLogin)
+	}
+	close(sink.release)
+	failIfError(t, FlushAudit())
+
+	records, err := AuditLog(admin, "", time.Time{}, time.Time{})
+	failIfError(t, err)
+	failIfError(t, VerifyAudit(records))
+	failIfFalseFmt(t, len(records) == AuditQueueMax+1, "got %d records, want %d", len(records), AuditQueueMax+1)
+
+	last := records[len(records)-1]
+	failIfFalseFmt(t, last.Action == AuditDropped && last.Detail == "5 records", "unexpected record %+v", last)
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
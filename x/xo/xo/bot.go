@@ -0,0 +1,284 @@
+package xo
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ayzatziko/stuff/xerrors"
+)
+
+type TypeBotLevel int
+
+const (
+	// BotLevelEasy moves randomly.
+	BotLevelEasy TypeBotLevel = iota + 1
+	// BotLevelMedium wins when it can, blocks opponent's line otherwise.
+	BotLevelMedium
+	// BotLevelHard plays perfectly.
+	BotLevelHard
+)
+
+func (level TypeBotLevel) String() string {
+	switch level {
+	case BotLevelEasy:
+		return "easy"
+	case BotLevelMedium:
+		return "medium"
+	case BotLevelHard:
+		return "hard"
+	}
+
+	return fmt.Sprintf("TypeBotLevel(%d)", int(level))
+}
+
+var (
+	botRandMu sync.Mutex
+	botRand   = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+func botIntn(n int) int {
+	botRandMu.Lock()
+	defer botRandMu.Unlock()
+
+	return botRand.Intn(n)
+}
+
+// botNodesBudget bounds the number of positions the hard bot searches for a
+// move, it searches deeper while the budget allows.
+const botNodesBudget = 200000
+
+// BotMove chooses a move for the participant whose turn it is on board.
+func BotMove(board TypeBoard, level TypeBotLevel) (TypeCell, error) {
+	cell, _, err := BotMoveWithSign(board, level)
+	return cell, err
+}
+
+// BotMoveWithSign chooses a move and the sign to place, see
+// MakeAMoveWithSign.
+func BotMoveWithSign(board TypeBoard, level TypeBotLevel) (_ TypeCell, _ TypeSign, err error) {
+	defer xerrors.Wrap(&err, "BotMove(%s)", level)
+
+	move, err := botMove(board.rules, board.position.Clone(), board.Turn().sign, level)
+	return move.Cell, move.Sign, err
+}
+
+// BotMoveAt chooses a move for the side to move placing sign in pos of
+// rules, e.g. for bots run outside of the game server.
+func BotMoveAt(rules Rules, pos *TypePosition, sign TypeSign, level TypeBotLevel) (_ TypeMove, err error) {
+	defer xerrors.Wrap(&err, "BotMove(%s)", level)
+
+	return botMove(rules, pos.Clone(), sign, level)
+}
+
+func botMove(rules Rules, pos *TypePosition, sign TypeSign, level TypeBotLevel) (TypeMove, error) {
+	if rules.Terminal(pos) {
+		return TypeMove{}, fmt.Errorf("game is finished")
+	}
+
+	moves := rules.LegalMoves(pos)
+	if len(moves) == 0 {
+		return TypeMove{}, fmt.Errorf("no legal moves")
+	}
+
+	for i := range moves {
+		moves[i] = withSign(moves[i], sign)
+	}
+
+	switch level {
+	case BotLevelEasy:
+		return moves[botIntn(len(moves))], nil
+	case BotLevelMedium:
+		return mediumMove(rules, pos, sign, moves), nil
+	case BotLevelHard:
+		return hardMove(rules, pos, sign, moves), nil
+	}
+
+	return TypeMove{}, fmt.Errorf("unknown level")
+}
+
+// withSign gives the sign of the mover to a move that does not choose it.
+func withSign(move TypeMove, sign TypeSign) TypeMove {
+	if move.Sign == signNull {
+		move.Sign = sign
+	}
+
+	return move
+}
+
+// mediumMove wins if it can and avoids moves letting the opponent win next.
+func mediumMove(rules Rules, pos *TypePosition, sign TypeSign, moves []TypeMove) TypeMove {
+	side := pos.Side()
+
+	var safe []TypeMove
+	for _, move := range moves {
+		next := pos.Clone()
+		if rules.ApplyMove(next, move) != nil {
+			continue
+		}
+
+		if rules.Terminal(next) {
+			if winner, ok := rules.Winner(next); ok && winner == side {
+				return move
+			} else if !ok {
+				safe = append(safe, move)
+			}
+
+			continue
+		}
+
+		if !opponentWins(rules, next, oppositeSign(sign)) {
+			safe = append(safe, move)
+		}
+	}
+
+	if len(safe) == 0 {
+		return moves[botIntn(len(moves))]
+	}
+
+	return safe[botIntn(len(safe))]
+}
+
+func opponentWins(rules Rules, pos *TypePosition, sign TypeSign) bool {
+	side := pos.Side()
+	for _, reply := range rules.LegalMoves(pos) {
+		next := pos.Clone()
+		if rules.ApplyMove(next, withSign(reply, sign)) != nil || !rules.Terminal(next) {
+			continue
+		}
+
+		if winner, ok := rules.Winner(next); ok && winner == side {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hardMove searches to the end of the game if the budget allows, otherwise
+// it searches deeper and deeper until the budget is spent.
+func hardMove(rules Rules, pos *TypePosition, sign TypeSign, moves []TypeMove) TypeMove {
+	s := search{rules: rules, hasher: hasherOf(rules), memo: newTable[typeMemoEntry](botTableSize)}
+	if best, ok := s.root(pos, sign, moves, exactDepth); ok {
+		return best
+	}
+
+	s.memo.clear()
+
+	best := moves[0]
+	for depth := 1; ; depth++ {
+		bestMove, ok := s.root(pos, sign, moves, depth)
+		if !ok && depth > 1 {
+			// the iteration is cut by the budget, keep the previous one
+			return best
+		}
+
+		best = bestMove
+		if !s.inexact || !ok {
+			return best
+		}
+	}
+}
+
+// root returns the best of moves searched to depth and false if the budget
+// is spent.
+func (s *search) root(pos *TypePosition, sign TypeSign, moves []TypeMove, depth int) (TypeMove, bool) {
+	s.nodes, s.inexact = 0, false
+
+	hashes := s.hasher.hashes(pos)
+
+	bestScore, bestMove := -botWinScore-1, moves[0]
+	for _, move := range moves {
+		next := pos.Clone()
+		if s.rules.ApplyMove(next, move) != nil {
+			continue
+		}
+
+		if score := -s.negamax(next, s.hasher.played(hashes, next), oppositeSign(sign), depth-1); score > bestScore {
+			bestScore, bestMove = score, move
+		}
+	}
+
+	return bestMove, s.nodes <= botNodesBudget
+}
+
+// botWinScore is the score of the win at the first move, later wins score
+// less.
+const botWinScore = 1 << 20
+
+type typeMemoEntry struct {
+	score, depth int
+}
+
+// exactDepth marks memo entries of positions searched to the end.
+const exactDepth = 1 << 30
+
+// botTableSize is the number of positions the hard bot remembers.
+const botTableSize = 1 << 16
+
+type search struct {
+	rules   Rules
+	hasher  *typeHasher
+	memo    *typeTable[typeMemoEntry]
+	nodes   int
+	inexact bool
+}
+
+// negamax scores pos with hashes for the side to move playing sign.
+func (s *search) negamax(pos *TypePosition, hashes []uint64, sign TypeSign, depth int) int {
+	s.nodes++
+
+	if s.rules.Terminal(pos) {
+		winner, ok := s.rules.Winner(pos)
+		if !ok {
+			return 0
+		} else if winner == pos.Side() {
+			return botWinScore - len(pos.moves)
+		}
+
+		return -botWinScore + len(pos.moves)
+	}
+
+	if depth <= 0 || s.nodes > botNodesBudget {
+		s.inexact = true
+		return 0
+	}
+
+	hash := s.hasher.canonical(hashes, pos)
+	if e, ok := s.memo.get(hash); ok && e.depth >= depth {
+		return e.score
+	}
+
+	inexact := s.inexact
+	s.inexact = false
+
+	best := -botWinScore - 1
+	for _, move := range s.rules.LegalMoves(pos) {
+		next := pos.Clone()
+		if s.rules.ApplyMove(next, withSign(move, sign)) != nil {
+			continue
+		}
+
+		if score := -s.negamax(next, s.hasher.played(hashes, next), oppositeSign(sign), depth-1); score > best {
+			best = score
+		}
+	}
+
+	entryDepth := exactDepth
+	if s.inexact {
+		entryDepth = depth
+	}
+	s.memo.put(hash, typeMemoEntry{score: best, depth: entryDepth})
+	s.inexact = s.inexact || inexact
+
+	return best
+}
+
+func oppositeSign(sign TypeSign) TypeSign {
+	if sign == SignX {
+		return SignO
+	}
+
+	return SignX
+}
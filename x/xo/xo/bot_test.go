@@ -0,0 +1,90 @@
+package xo_test
+
+import (
+	"testing"
+
+	. "github.com/ayzatziko/stuff/x/xo/xo"
+)
+
+func TestBotHardNeverLoses(t *testing.T) {
+	for _, opponent := range []TypeBotLevel{BotLevelEasy, BotLevelMedium, BotLevelHard} {
+		for i := 0; i < 5; i++ {
+			if winner := playBots(t, BotLevelHard, opponent); winner == "second" {
+				t.Fatalf("hard bot moving first lost to %s bot", opponent)
+			} else if opponent == BotLevelHard && winner != "" {
+				t.Fatalf("hard bots game has winner %s", winner)
+			}
+
+			if winner := playBots(t, opponent, BotLevelHard); winner == "first" {
+				t.Fatalf("hard bot moving second lost to %s bot", opponent)
+			}
+		}
+	}
+}
+
+func TestBotMediumWinsWhenCan(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	tokenFirst, tokenSecond := startGame(t, "first", "second")
+	for _, m := range []struct {
+		token string
+		x, y  int
+	}{
+		{tokenFirst, 0, 0},
+		{tokenSecond, 1, 0},
+		{tokenFirst, 0, 1},
+		{tokenSecond, 1, 1},
+	} {
+		cell, err := NewCell(m.x, m.y)
+		failIfError(t, err)
+		_, _, err = MakeAMove(m.token, cell)
+		failIfError(t, err)
+	}
+
+	board, err := CurrentBoard(tokenFirst)
+	failIfError(t, err)
+
+	cell, err := BotMove(board, BotLevelMedium)
+	failIfError(t, err)
+	failIfFalseFmt(t, cell.Row() == 0 && cell.Col() == 2, "expected winning move, got %s", cell)
+}
+
+// playBots plays a game between two bots, returns "first", "second" or empty
+// string for a draw.
+func playBots(t *testing.T, levelFirst, levelSecond TypeBotLevel) string {
+	t.Helper()
+
+	return playBotsWithRules(t, Classic(), levelFirst, levelSecond)
+}
+
+func playBotsWithRules(t *testing.T, rules Rules, levelFirst, levelSecond TypeBotLevel) string {
+	t.Helper()
+	defer CleanDatabase()
+
+	tokenFirst, tokenSecond := startGameWithRules(t, "first", "second", rules)
+	levels := map[TypeUser]TypeBotLevel{"first": levelFirst, "second": levelSecond}
+	tokens := map[TypeUser]string{"first": tokenFirst, "second": tokenSecond}
+
+	for {
+		board, err := CurrentBoard(tokenFirst)
+		failIfError(t, err)
+
+		user := board.Turn().User()
+		cell, sign, err := BotMoveWithSign(board, levels[user])
+		failIfError(t, err)
+
+		b, _, err := MakeAMoveWithSign(tokens[user], cell, sign)
+		failIfError(t, err)
+		if b == nil {
+			continue
+		}
+
+		for _, winner := range []TypeUser{"first", "second"} {
+			if ok, _ := b.Winner(winner); ok {
+				return string(winner)
+			}
+		}
+
+		return ""
+	}
+}
@@ -0,0 +1,345 @@
+package xo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ayzatziko/stuff/xerrors"
+)
+
+// Every running game has a chat of its participants and spectators, it ends
+// with the game. Messages are delivered as EventChat events.
+
+const (
+	// constChatMaxLength is the maximum number of characters of a message.
+	constChatMaxLength = 280
+	// constChatHistory is the number of last messages kept by a game.
+	constChatHistory = 100
+	// constChatRate is the number of messages a user may send within
+	// constChatRateWindow.
+	constChatRate       = 5
+	constChatRateWindow = 10 * time.Second
+)
+
+type TypeChatMessage struct {
+	User TypeUser
+	Text string
+	Time time.Time
+	// Spectator is set when the author does not play the game.
+	Spectator bool
+}
+
+// ChatFilter checks a message of user before it is sent, it returns the
+// text to send, for example with profanity masked, or an error rejecting
+// the message.
+type ChatFilter func(user TypeUser, text string) (string, error)
+
+var chatFilter atomic.Pointer[ChatFilter]
+
+// SetChatFilter sets the filter of chat messages, nil sends messages as is.
+func SetChatFilter(filter ChatFilter) {
+	if filter == nil {
+		chatFilter.Store(nil)
+	} else {
+		chatFilter.Store(&filter)
+	}
+}
+
+// WordFilter returns a filter masking the words regardless of case.
+func WordFilter(words ...string) ChatFilter {
+	banned := make(map[string]struct{}, len(words))
+	for _, word := range words {
+		banned[strings.ToLower(word)] = struct{}{}
+	}
+
+	return func(_ TypeUser, text string) (string, error) {
+		var b strings.Builder
+		for len(text) > 0 {
+			end := strings.IndexFunc(text, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+			if end == 0 {
+				_, size := utf8.DecodeRuneInString(text)
+				b.WriteString(text[:size])
+				text = text[size:]
+				continue
+			} else if end < 0 {
+				end = len(text)
+			}
+
+			if word := text[:end]; hasKey(banned, strings.ToLower(word)) {
+				b.WriteString(strings.Repeat("*", utf8.RuneCountInString(word)))
+			} else {
+				b.WriteString(word)
+			}
+			text = text[end:]
+		}
+
+		return b.String(), nil
+	}
+}
+
+// throttle drops the times of sent out of the window before t, and appends
+// t unless rate times are left. Then it returns the time to retry after.
+func throttle(sent []time.Time, t time.Time, rate int, window time.Duration) (_ []time.Time, retry time.Duration) {
+	for len(sent) > 0 && t.Sub(sent[0]) >= window {
+		sent = sent[1:]
+	}
+	if len(sent) >= rate {
+		return sent, sent[0].Add(window).Sub(t)
+	}
+
+	return append(sent, t), 0
+}
+
+func hasKey[K comparable, V any](m map[K]V, k K) bool {
+	_, ok := m[k]
+	return ok
+}
+
+func SendChat(sessionToken, text string) error {
+	return SendChatContext(context.Background(), sessionToken, text)
+}
+
+// SendChatContext sends a message to the chat of the game the session user
+// is playing or watching.
+func SendChatContext(ctx context.Context, sessionToken, text string) (err error) {
+	user, err := userOf(ctx, sessionToken)
+	if err != nil {
+		return err
+	}
+
+	defer xerrors.Wrap(&err, "SendChat(%s)", user)
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return fmt.Errorf("empty message")
+	} else if n := utf8.RuneCountInString(text); n > constChatMaxLength {
+		return fmt.Errorf("message has %d characters, more than %d", n, constChatMaxLength)
+	}
+
+	if filter := chatFilter.Load(); filter != nil {
+		if text, err = (*filter)(user, text); err != nil {
+			return err
+		}
+	}
+
+	game, err := lockViewedGameOf(ctx, user)
+	if err != nil {
+		return err
+	}
+	defer game.mu.Unlock()
+
+	t := now()
+	sent, retry := throttle(game.chatSent[user], t, constChatRate, constChatRateWindow)
+	if retry > 0 {
+		return fmt.Errorf("%w: retry in %s", ErrChatThrottled, retry)
+	}
+
+	if game.chatSent == nil {
+		game.chatSent = map[TypeUser][]time.Time{}
+	}
+	game.chatSent[user] = sent
+
+	game.chat = append(game.chat, TypeChatMessage{User: user, Text: text, Time: t, Spectator: !isParticipant(game.board, user)})
+	if len(game.chat) > constChatHistory {
+		game.chat = game.chat[len(game.chat)-constChatHistory:]
+	}
+
+	publishLocked(game, TypeEvent{Kind: EventChat, User: user, Message: text})
+
+	return nil
+}
+
+func ChatHistory(sessionToken string) ([]TypeChatMessage, error) {
+	return ChatHistoryContext(context.Background(), sessionToken)
+}
+
+// ChatHistoryContext returns the last messages of the chat of the game the
+// session user is playing or watching, except for messages of muted users.
+func ChatHistoryContext(ctx context.Context, sessionToken string) (_ []TypeChatMessage, err error) {
+	user, err := userOf(ctx, sessionToken)
+	if err != nil {
+		return nil, err
+	}
+
+	defer xerrors.Wrap(&err, "ChatHistory(%s)", user)
+
+	game, err := lockViewedGameOf(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	defer game.mu.Unlock()
+
+	messages := make([]TypeChatMessage, 0, len(game.chat))
+	for _, m := range game.chat {
+		if !game.mutedLocked(user, m.User) {
+			messages = append(messages, m)
+		}
+	}
+
+	return messages, nil
+}
+
+func Mute(sessionToken string, other TypeUser) error {
+	return MuteContext(context.Background(), sessionToken, other)
+}
+
+// MuteContext hides the messages of other from the session user until the
+// end of the game.
+func MuteContext(ctx context.Context, sessionToken string, other TypeUser) error {
+	return setMuted(ctx, "Mute", sessionToken, other, true)
+}
+
+func Unmute(sessionToken string, other TypeUser) error {
+	return UnmuteContext(context.Background(), sessionToken, other)
+}
+
+func UnmuteContext(ctx context.Context, sessionToken string, other TypeUser) error {
+	return setMuted(ctx, "Unmute", sessionToken, other, false)
+}
+
+func setMuted(ctx context.Context, op, sessionToken string, other TypeUser, muted bool) (err error) {
+	user, err := userOf(ctx, sessionToken)
+	if err != nil {
+		return err
+	}
+
+	defer xerrors.Wrap(&err, "%s(%s, %s)", op, user, other)
+
+	if other == user {
+		return fmt.Errorf("cannot mute self")
+	}
+
+	game, err := lockViewedGameOf(ctx, user)
+	if err != nil {
+		return err
+	}
+	defer game.mu.Unlock()
+
+	if !muted {
+		delete(game.muted[user], other)
+		return nil
+	}
+
+	if game.muted == nil {
+		game.muted = map[TypeUser]map[TypeUser]struct{}{}
+	}
+	if game.muted[user] == nil {
+		game.muted[user] = map[TypeUser]struct{}{}
+	}
+	game.muted[user][other] = struct{}{}
+
+	return nil
+}
+
+// mutedLocked reports whether user muted other, the caller holds the lock of
+// the game.
+func (game *typeGame) mutedLocked(user, other TypeUser) bool {
+	return hasKey(game.muted[user], other)
+}
+
+func isParticipant(board *TypeBoard, user TypeUser) bool {
+	return board.participants[0].user == user || board.participants[1].user == user
+}
+
+func Spectate(sessionToken string, player TypeUser) (TypeBoard, error) {
+	return SpectateContext(context.Background(), sessionToken, player)
+}
+
+// SpectateContext makes the session user a spectator of the game of player
+// and returns a copy of its board. Spectators get the events of the game
+// and take part in its chat until the game ends or they stop spectating.
+func SpectateContext(ctx context.Context, sessionToken string, player TypeUser) (_ TypeBoard, err error) {
+	user, err := userOf(ctx, sessionToken)
+	if err != nil {
+		return TypeBoard{}, err
+	}
+
+	defer xerrors.Wrap(&err, "Spectate(%s, %s)", user, player)
+
+	if err := lobbyMu.LockContext(ctx); err != nil {
+		return TypeBoard{}, err
+	}
+	defer lobbyMu.Unlock()
+
+	if waitingLocked(user) {
+		return TypeBoard{}, fmt.Errorf("waiting for an opponent")
+	}
+
+	game, err := lockGameOf(ctx, player)
+	if err != nil {
+		return TypeBoard{}, err
+	}
+	defer game.mu.Unlock()
+
+	states, unlock := lockUsers(user)
+	defer unlock()
+
+	if st := states[0]; st == nil || st.token != sessionToken {
+		return TypeBoard{}, ErrSessionNotFound
+	} else if st.game != nil {
+		return TypeBoard{}, fmt.Errorf("already playing with %s", opponentOf(st.game.board, user))
+	} else if st.watching != nil && st.watching != game {
+		return TypeBoard{}, errWatching(st.watching)
+	} else {
+		st.watching = game
+	}
+
+	if game.spectators == nil {
+		game.spectators = map[TypeUser]struct{}{}
+	}
+	game.spectators[user] = struct{}{}
+
+	return game.board.clone(), nil
+}
+
+func StopSpectating(sessionToken string) error {
+	return StopSpectatingContext(context.Background(), sessionToken)
+}
+
+func StopSpectatingContext(ctx context.Context, sessionToken string) (err error) {
+	user, err := userOf(ctx, sessionToken)
+	if err != nil {
+		return err
+	}
+
+	defer xerrors.Wrap(&err, "StopSpectating(%s)", user)
+
+	game := gameOf(user, true)
+	if game == nil || isParticipant(game.board, user) {
+		return fmt.Errorf("not spectating")
+	}
+
+	if err := game.mu.LockContext(ctx); err != nil {
+		return err
+	}
+	defer game.mu.Unlock()
+
+	unwatchLocked(game, user)
+
+	return nil
+}
+
+// unwatchLocked removes the spectator user from the game, the caller holds
+// the lock of the game.
+func unwatchLocked(game *typeGame, user TypeUser) {
+	delete(game.spectators, user)
+
+	states, unlock := lockUsers(user)
+	defer unlock()
+
+	if st := states[0]; st != nil && st.watching == game {
+		st.watching = nil
+		userShardOf(user).pruneLocked(user, st)
+	}
+}
+
+func errWatching(game *typeGame) error {
+	// participants never change, they are read without the lock of the game
+	board := game.board
+	return fmt.Errorf("spectating the game of %s and %s, stop first", board.participants[0].user, board.participants[1].user)
+}
@@ -0,0 +1,164 @@
+package xo_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/ayzatziko/stuff/x/xo/xo"
+)
+
+func TestChat(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	current := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t.Cleanup(SetNow(func() time.Time { return current }))
+
+	tokenFirst, tokenSecond := startGame(t, "user1", "user2")
+	failIfError(t, RegisterUser("fan", testPassword))
+	tokenFan, err := Login("fan", testPassword)
+	failIfError(t, err)
+
+	_, err = Spectate(tokenFan, "user2")
+	failIfError(t, err)
+
+	events := map[string]<-chan TypeEvent{}
+	for _, token := range []string{tokenFirst, tokenSecond, tokenFan} {
+		c, cancel, err := Subscribe(token)
+		failIfError(t, err)
+		t.Cleanup(cancel)
+		events[token] = c
+	}
+
+	failIfError(t, SendChat(tokenFirst, "  good luck "))
+	for token, c := range events {
+		e := <-c
+		failIfFalseFmt(t, e.Kind == EventChat && e.User == "user1" && e.Message == "good luck", "unexpected event %+v of %s", e, token)
+	}
+
+	// the fan is muted by user2 only
+	failIfError(t, Mute(tokenSecond, "fan"))
+	failIfError(t, SendChat(tokenFan, "go user2"))
+	e := <-events[tokenFirst]
+	failIfFalseFmt(t, e.Kind == EventChat && e.User == "fan", "unexpected event %+v", e)
+	<-events[tokenFan]
+
+	cell, err := NewCell(1, 1)
+	failIfError(t, err)
+	_, _, err = MakeAMove(tokenFirst, cell)
+	failIfError(t, err)
+	for _, c := range events {
+		e := <-c
+		failIfFalseFmt(t, e.Kind == EventMove, "unexpected event %+v", e)
+	}
+
+	history, err := ChatHistory(tokenSecond)
+	failIfError(t, err)
+	failIfFalseFmt(t, len(history) == 1 && history[0].User == "user1" && !history[0].Spectator, "unexpected history %+v", history)
+
+	history, err = ChatHistory(tokenFirst)
+	failIfError(t, err)
+	failIfFalseFmt(t, len(history) == 2 && history[1].Spectator && history[1].Text == "go user2", "unexpected history %+v", history)
+
+	failIfError(t, Unmute(tokenSecond, "fan"))
+	history, err = ChatHistory(tokenSecond)
+	failIfError(t, err)
+	failIfFalseFmt(t, len(history) == 2, "unexpected history %+v", history)
+
+	failIfFalseFmt(t, SendChat(tokenFirst, " ") != nil, "expected error sending empty message")
+	failIfFalseFmt(t, SendChat(tokenFirst, strings.Repeat("a", 281)) != nil, "expected error sending long message")
+	failIfFalseFmt(t, Mute(tokenFirst, "user1") != nil, "expected error muting self")
+
+	for i := 0; i < 4; i++ {
+		failIfError(t, SendChat(tokenFirst, fmt.Sprint(i)))
+	}
+	err = SendChat(tokenFirst, "flood")
+	failIfFalseFmt(t, errors.Is(err, ErrChatThrottled), "unexpected error %v", err)
+
+	current = current.Add(10 * time.Second)
+	failIfError(t, SendChat(tokenFirst, "again"))
+
+	// the chat ends with the game, spectators are freed
+	_, _, err = Resign(tokenSecond)
+	failIfError(t, err)
+
+	err = SendChat(tokenFirst, "gg")
+	failIfFalseFmt(t, errors.Is(err, ErrNotPlaying), "unexpected error %v", err)
+	err = SendChat(tokenFan, "gg")
+	failIfFalseFmt(t, errors.Is(err, ErrNotPlaying), "unexpected error %v", err)
+	failIfFalseFmt(t, StopSpectating(tokenFan) != nil, "expected error stopping spectating a finished game")
+}
+
+func TestSpectate(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	tokenFirst, tokenSecond := startGame(t, "user1", "user2")
+	failIfError(t, RegisterUser("fan", testPassword))
+	tokenFan, err := Login("fan", testPassword)
+	failIfError(t, err)
+
+	_, err = Spectate(tokenFirst, "user2")
+	failIfFalseFmt(t, err != nil, "expected error spectating by a participant")
+	_, err = Spectate(tokenFan, "nobody")
+	failIfFalseFmt(t, errors.Is(err, ErrNotPlaying), "unexpected error %v", err)
+
+	board, err := Spectate(tokenFan, "user1")
+	failIfError(t, err)
+	failIfFalseFmt(t, board.Turn().User() == "user1", "unexpected board %v", board)
+
+	failIfFalseFmt(t, RegisterSelfAsParticipant(tokenFan, SignX) != nil, "expected error waiting while spectating")
+
+	events, cancel, err := Subscribe(tokenFan)
+	failIfError(t, err)
+	defer cancel()
+
+	cell, err := NewCell(0, 0)
+	failIfError(t, err)
+	_, _, err = MakeAMove(tokenFirst, cell)
+	failIfError(t, err)
+
+	e := <-events
+	failIfFalseFmt(t, e.Kind == EventMove && e.User == "user1", "unexpected event %+v", e)
+
+	board, err = CurrentBoard(tokenFan)
+	failIfError(t, err)
+	failIfFalseFmt(t, board.Turn().User() == "user2" && board.Cell(cell) == SignX, "unexpected board %v", board)
+
+	failIfError(t, StopSpectating(tokenFan))
+	failIfFalseFmt(t, StopSpectating(tokenFan) != nil, "expected error stopping twice")
+
+	_, _, err = Resign(tokenSecond)
+	failIfError(t, err)
+	select {
+	case e := <-events:
+		t.Fatalf("unexpected event %+v after spectating stopped", e)
+	default:
+	}
+
+	failIfError(t, RegisterSelfAsParticipant(tokenFan, SignX))
+}
+
+func TestChatFilter(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+	t.Cleanup(func() { SetChatFilter(nil) })
+
+	tokenFirst, tokenSecond := startGame(t, "user1", "user2")
+
+	SetChatFilter(WordFilter("darn", "heck"))
+	failIfError(t, SendChat(tokenFirst, "Darn, what the heck? darning"))
+
+	filter := func(user TypeUser, text string) (string, error) {
+		if strings.Contains(text, "http") {
+			return "", fmt.Errorf("links are not allowed")
+		}
+		return text, nil
+	}
+	SetChatFilter(filter)
+	failIfFalseFmt(t, SendChat(tokenSecond, "see http://spam") != nil, "expected message rejected")
+
+	history, err := ChatHistory(tokenSecond)
+	failIfError(t, err)
+	failIfFalseFmt(t, len(history) == 1 && history[0].Text == "****, what the ****? darning", "unexpected history %+v", history)
+}
@@ -0,0 +1,146 @@
+package xo_test
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	. "github.com/ayzatziko/stuff/x/xo/xo"
+)
+
+// drawMoves play a classic game to a draw, the first player moves first.
+var drawMoves = [][2]int{{0, 0}, {1, 1}, {2, 2}, {0, 1}, {2, 1}, {2, 0}, {0, 2}, {1, 2}, {1, 0}}
+
+type benchGame struct {
+	first, second string
+	tokens        [2]string
+	moves         int
+	finished      int
+}
+
+func newBenchGame(tb testing.TB, i int) *benchGame {
+	tb.Helper()
+
+	g := &benchGame{first: fmt.Sprintf("user-%d-x", i), second: fmt.Sprintf("user-%d-o", i)}
+	g.tokens[0], g.tokens[1] = startGameWithRules(tb, g.first, g.second, Classic())
+
+	return g
+}
+
+// step makes the next move of the game, and starts a new game after a draw.
+func (g *benchGame) step() error {
+	if g.moves == len(drawMoves) {
+		if err := RegisterSelfAsParticipant(g.tokens[0], SignX); err != nil {
+			return err
+		}
+		g.moves = 0
+		return StartPlayingWithWaitingOpponent(g.tokens[1], SignO, TypeUser(g.first))
+	}
+
+	cell, err := NewCell(drawMoves[g.moves][0], drawMoves[g.moves][1])
+	if err != nil {
+		return err
+	}
+
+	_, msg, err := MakeAMove(g.tokens[g.moves%2], cell)
+	if err != nil {
+		return err
+	}
+
+	g.moves++
+	if g.moves == len(drawMoves) {
+		if msg != "draw" {
+			return fmt.Errorf("unexpected result %q of %s", msg, g.first)
+		}
+		g.finished++
+	}
+
+	return nil
+}
+
+func TestConcurrentGames(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	moderator := loginAs(t, "boss", RoleModerator)
+
+	const games, rounds = 200, 3
+
+	all := make([]*benchGame, games)
+	for i := range all {
+		all[i] = newBenchGame(t, i)
+	}
+
+	var wg sync.WaitGroup
+	for _, g := range all {
+		wg.Add(1)
+		go func(g *benchGame) {
+			defer wg.Done()
+
+			for g.finished < rounds {
+				if err := g.step(); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(g)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		for i := 0; i < 50; i++ {
+			SearchOpponents()
+			if _, err := Sessions(moderator); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	wg.Wait()
+	<-done
+
+	sessions, err := Sessions(moderator)
+	failIfError(t, err)
+	failIfFalseFmt(t, len(sessions) == 2*games+1, "unexpected sessions %d", len(sessions))
+	for _, s := range sessions {
+		failIfFalseFmt(t, !s.Playing && !s.Waiting, "unexpected session %+v", s)
+	}
+}
+
+// BenchmarkParallelGames plays moves in thousands of running games, every
+// goroutine plays its own games. Run it with -cpu to see the throughput
+// scaling with the number of goroutines.
+func BenchmarkParallelGames(b *testing.B) {
+	b.Cleanup(CleanDatabase)
+
+	const games = 2000
+
+	all := make([]*benchGame, games)
+	for i := range all {
+		all[i] = newBenchGame(b, i)
+	}
+
+	workers := runtime.GOMAXPROCS(0)
+	var nextWorker atomic.Int64
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		worker := int(nextWorker.Add(1)-1) % workers
+
+		var own []*benchGame
+		for i := worker; i < games; i += workers {
+			own = append(own, all[i])
+		}
+
+		for i := 0; pb.Next(); i++ {
+			if err := own[i%len(own)].step(); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,52 @@
+package xo
+
+import (
+	"context"
+	"time"
+)
+
+// Functions on the state of users and games have variants with the Context
+// suffix. They give up waiting for locks and storage when the context is
+// done, returning its error, and record the values of the context set by
+// WithTraceID and WithClientAddress in the audit log. An operation is not
+// interrupted once it has changed the state.
+
+type typeContextKey int
+
+const (
+	contextKeyTraceID typeContextKey = iota
+	contextKeyClientAddress
+)
+
+// WithTraceID returns a copy of ctx carrying the ID of the request tracing
+// it across services.
+func WithTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, contextKeyTraceID, traceID)
+}
+
+func TraceID(ctx context.Context) string {
+	id, _ := ctx.Value(contextKeyTraceID).(string)
+	return id
+}
+
+// WithClientAddress returns a copy of ctx carrying the address of the
+// client, failed logins are throttled by it.
+func WithClientAddress(ctx context.Context, address string) context.Context {
+	return context.WithValue(ctx, contextKeyClientAddress, address)
+}
+
+func ClientAddress(ctx context.Context) string {
+	address, _ := ctx.Value(contextKeyClientAddress).(string)
+	return address
+}
+
+// detachedContext keeps the values of a context without its deadline and
+// cancellation, the consequences of a done change like a forfeit or an
+// audit record are not cancelled.
+type detachedContext struct{ context.Context }
+
+func detach(ctx context.Context) context.Context { return detachedContext{ctx} }
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
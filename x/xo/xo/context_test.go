@@ -0,0 +1,61 @@
+package xo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/ayzatziko/stuff/x/xo/xo"
+)
+
+func TestContextLockWait(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	token := loginAs(t, "user1", RolePlayer)
+
+	unlock := LockLobby()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := RegisterSelfAsParticipantContext(ctx, token, SignX, Classic())
+	failIfFalseFmt(t, errors.Is(err, context.DeadlineExceeded), "unexpected error %v", err)
+
+	_, err = SearchOpponentsForContext(ctx, token)
+	failIfFalseFmt(t, errors.Is(err, context.DeadlineExceeded), "unexpected error %v", err)
+	unlock()
+
+	failIfError(t, RegisterSelfAsParticipantContext(context.Background(), token, SignX, Classic()))
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = MakeAMoveContext(canceled, token, TypeCell{}, "")
+	failIfFalseFmt(t, errors.Is(err, context.Canceled), "unexpected error %v", err)
+}
+
+func TestContextAudit(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	admin := loginAs(t, "boss", RoleAdmin)
+	failIfError(t, RegisterUser("user1", testPassword))
+
+	ctx := WithTraceID(WithClientAddress(context.Background(), "192.0.2.1"), "trace-1")
+	_, err := LoginContext(ctx, "user1", "wrong")
+	failIfFalseFmt(t, errors.Is(err, ErrWrongPassword), "unexpected error %v", err)
+	_, err = LoginContext(ctx, "user1", testPassword)
+	failIfError(t, err)
+
+	records, err := AuditLogContext(ctx, admin, "user1", time.Time{}, time.Time{})
+	failIfError(t, err)
+	failIfFalseFmt(t, len(records) == 3, "unexpected records %+v", records)
+	for _, r := range records[1:] {
+		failIfFalseFmt(t, r.TraceID == "trace-1" && r.Address == "192.0.2.1", "unexpected record %+v", r)
+	}
+
+	all, err := AuditLog(admin, "", time.Time{}, time.Time{})
+	failIfError(t, err)
+	failIfError(t, VerifyAudit(all))
+
+	changed := append([]TypeAuditRecord(nil), all...)
+	changed[len(changed)-1].Address = "192.0.2.2"
+	failIfFalseFmt(t, errors.Is(VerifyAudit(changed), ErrAuditTampered), "changed address is not detected")
+}
@@ -0,0 +1,213 @@
+package xo
+
+import (
+	"context"
+
+	"github.com/ayzatziko/stuff/xerrors"
+)
+
+type TypeEventKind string
+
+const (
+	// EventGameStarted is sent when the game starts, User moves first.
+	EventGameStarted TypeEventKind = "start"
+	// EventMove is sent after User makes a move to Cell.
+	EventMove TypeEventKind = "move"
+	// EventDrawOffered is sent when User offers a draw.
+	EventDrawOffered TypeEventKind = "draw-offer"
+	// EventDrawDeclined is sent when User declines a draw offer.
+	EventDrawDeclined TypeEventKind = "draw-decline"
+	// EventGameFinished is sent when the game is over, Message holds the
+	// result.
+	EventGameFinished TypeEventKind = "end"
+	// EventChat is sent when User says Message in the chat of the game.
+	EventChat TypeEventKind = "chat"
+)
+
+// TypeEvent is a notification about a game the subscribed user plays or
+// watches.
+type TypeEvent struct {
+	Kind TypeEventKind
+	User TypeUser
+	Cell TypeCell
+	// Sign placed by the move, it differs from the sign of the mover in
+	// variants like wild and notakto.
+	Sign        TypeSign
+	Message     string
+	Termination TypeTermination
+
+	// Participants of the game, the first moves first.
+	Participants [constUsersNum]typeUserSign
+	// Rules of the game.
+	Rules Rules
+}
+
+// subscriptionBuffer is the number of events kept for a subscriber, a slow
+// subscriber misses events beyond it.
+const subscriptionBuffer = 64
+
+type typeSubscription struct {
+	token  string
+	events chan TypeEvent
+	// closed is closed with events.
+	closed chan struct{}
+}
+
+// Subscribe delivers events of games of the session user until cancel is
+// called or the session ends, then the channel is closed.
+func Subscribe(sessionToken string) (<-chan TypeEvent, func(), error) {
+	return SubscribeContext(context.Background(), sessionToken)
+}
+
+// SubscribeContext is Subscribe cancelled also when ctx is done.
+func SubscribeContext(ctx context.Context, sessionToken string) (_ <-chan TypeEvent, cancel func(), err error) {
+	user, err := userOf(ctx, sessionToken)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer xerrors.Wrap(&err, "Subscribe(%s)", user)
+
+	shard := userShardOf(user)
+	if err := shard.mu.LockContext(ctx); err != nil {
+		return nil, nil, err
+	}
+	defer shard.mu.Unlock()
+
+	st, ok := shard.users[user]
+	if !ok || st.token != sessionToken {
+		return nil, nil, ErrSessionNotFound
+	}
+
+	sub := &typeSubscription{token: sessionToken, events: make(chan TypeEvent, subscriptionBuffer), closed: make(chan struct{})}
+	st.subs[sub] = struct{}{}
+
+	cancel = func() {
+		shard.mu.Lock()
+		defer shard.mu.Unlock()
+
+		if st, ok := shard.users[user]; ok {
+			if _, ok := st.subs[sub]; ok {
+				unsubscribeLocked(st, sub)
+				shard.pruneLocked(user, st)
+			}
+		}
+	}
+
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				cancel()
+			case <-sub.closed:
+			}
+		}()
+	}
+
+	return sub.events, cancel, nil
+}
+
+// unsubscribeLocked closes sub, the caller holds the shard of the user.
+func unsubscribeLocked(st *typeUserState, sub *typeSubscription) {
+	delete(st.subs, sub)
+	close(sub.events)
+	close(sub.closed)
+}
+
+// closeSubscriptionsLocked closes subscriptions of the ended session.
+func closeSubscriptionsLocked(st *typeUserState, sessionToken string) {
+	for sub := range st.subs {
+		if sub.token == sessionToken {
+			unsubscribeLocked(st, sub)
+		}
+	}
+}
+
+// audienceLocked returns the participants and spectators of the game, the
+// caller holds the lock of the game.
+func (game *typeGame) audienceLocked() []TypeUser {
+	users := []TypeUser{game.board.participants[0].user, game.board.participants[1].user}
+	for user := range game.spectators {
+		users = append(users, user)
+	}
+
+	return users
+}
+
+// publishLocked sends event to the participants and spectators of the game,
+// chat messages are not sent to users who muted the author. The caller
+// holds the lock of the game, so events of a game are ordered.
+func publishLocked(game *typeGame, event TypeEvent) {
+	board := game.board
+	event.Participants = [constUsersNum]typeUserSign{board.first, opponentOf(board, board.first.user)}
+	event.Rules = board.rules
+
+	users := game.audienceLocked()
+	states, unlock := lockUsers(users...)
+	defer unlock()
+
+	for i, st := range states {
+		if st == nil || event.Kind == EventChat && game.mutedLocked(users[i], event.User) {
+			continue
+		}
+
+		st.notifyLocked()
+		for sub := range st.subs {
+			select {
+			case sub.events <- event:
+			default:
+			}
+		}
+	}
+}
+
+// WaitForTurn waits until the session user is to move in a game of more
+// than sinceMove moves or the game is over, and returns a copy of the board.
+// sinceMove is the number of moves of the board last seen by the caller, -1
+// for a new game. A user waiting for an opponent waits for the game to
+// start, the finished game is returned until the user waits for a new one.
+func WaitForTurn(ctx context.Context, sessionToken string, sinceMove int) (_ TypeBoard, err error) {
+	user, err := userOf(ctx, sessionToken)
+	if err != nil {
+		return TypeBoard{}, err
+	}
+
+	defer xerrors.Wrap(&err, "WaitForTurn(%s, %d)", user, sinceMove)
+
+	shard := userShardOf(user)
+	for {
+		if err := shard.mu.LockContext(ctx); err != nil {
+			return TypeBoard{}, err
+		}
+		st, ok := shard.users[user]
+		if !ok || st.token != sessionToken {
+			shard.mu.Unlock()
+			return TypeBoard{}, ErrSessionNotFound
+		}
+		game, changed := st.game, st.changed
+		if game == nil {
+			game = st.last
+		}
+		shard.mu.Unlock()
+
+		if game != nil {
+			if err := game.mu.LockContext(ctx); err != nil {
+				return TypeBoard{}, err
+			}
+			board := game.board
+			ready := board.winnerSet || board.Turn().user == user && board.MoveCount() > sinceMove
+			clone := board.clone()
+			game.mu.Unlock()
+
+			if ready {
+				return clone, nil
+			}
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return TypeBoard{}, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package xo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/ayzatziko/stuff/x/xo/xo"
+)
+
+func TestSubscribe(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	failIfError(t, RegisterUser("user1", testPassword))
+	tokenFirst, err := Login("user1", testPassword)
+	failIfError(t, err)
+
+	events, cancel, err := Subscribe(tokenFirst)
+	failIfError(t, err)
+	defer cancel()
+
+	failIfError(t, RegisterSelfAsParticipant(tokenFirst, SignX))
+	failIfError(t, RegisterUser("user2", testPassword))
+	tokenSecond, err := Login("user2", testPassword)
+	failIfError(t, err)
+	failIfError(t, StartPlayingWithWaitingOpponent(tokenSecond, SignO, "user1"))
+
+	e := <-events
+	failIfFalseFmt(t, e.Kind == EventGameStarted && e.User == "user1", "unexpected event %+v", e)
+	failIfFalseFmt(t, e.Participants[1].User() == "user2", "unexpected participants %v", e.Participants)
+
+	cell, err := NewCell(1, 1)
+	failIfError(t, err)
+	_, _, err = MakeAMove(tokenFirst, cell)
+	failIfError(t, err)
+
+	e = <-events
+	failIfFalseFmt(t, e.Kind == EventMove && e.User == "user1" && e.Cell == cell, "unexpected event %+v", e)
+
+	failIfError(t, OfferDraw(tokenSecond))
+	e = <-events
+	failIfFalseFmt(t, e.Kind == EventDrawOffered && e.User == "user2", "unexpected event %+v", e)
+
+	// logging in elsewhere forfeits the game and ends the subscription
+	_, err = Login("user1", testPassword)
+	failIfError(t, err)
+
+	e = <-events
+	failIfFalseFmt(t, e.Kind == EventGameFinished && e.Message == "user2 wins user1", "unexpected event %+v", e)
+	failIfFalseFmt(t, e.Termination == TerminationForfeit, "unexpected termination %q", e.Termination)
+
+	_, ok := <-events
+	failIfFalseFmt(t, !ok, "expected subscription is closed")
+}
+
+func TestWaitForTurn(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	tokenFirst, tokenSecond := startGame(t, "user1", "user2")
+
+	board, err := WaitForTurn(context.Background(), tokenFirst, -1)
+	failIfError(t, err)
+	failIfFalseFmt(t, board.Turn().User() == "user1" && board.MoveCount() == 0, "unexpected board %v", board)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = WaitForTurn(ctx, tokenSecond, -1)
+	failIfFalseFmt(t, errors.Is(err, context.DeadlineExceeded), "unexpected error %v", err)
+
+	type waited struct {
+		board TypeBoard
+		err   error
+	}
+	wait := func(token string, sinceMove int) <-chan waited {
+		c := make(chan waited, 1)
+		go func() {
+			board, err := WaitForTurn(context.Background(), token, sinceMove)
+			c <- waited{board, err}
+		}()
+		return c
+	}
+
+	second := wait(tokenSecond, 0)
+	cell, err := NewCell(1, 1)
+	failIfError(t, err)
+	_, _, err = MakeAMove(tokenFirst, cell)
+	failIfError(t, err)
+
+	w := <-second
+	failIfError(t, w.err)
+	failIfFalseFmt(t, w.board.Turn().User() == "user2" && w.board.MoveCount() == 1, "unexpected board %v", w.board)
+
+	// the game ends on the turn of the opponent
+	first := wait(tokenFirst, 1)
+	_, _, err = Resign(tokenSecond)
+	failIfError(t, err)
+
+	w = <-first
+	failIfError(t, w.err)
+	won, over := w.board.Winner("user1")
+	failIfFalseFmt(t, won && over, "expected user1 wins, board %v", w.board)
+
+	// the finished game is returned until a new one is awaited
+	board, err = WaitForTurn(context.Background(), tokenSecond, 5)
+	failIfError(t, err)
+	_, over = board.Winner("user1")
+	failIfFalseFmt(t, over, "expected the finished game, board %v", board)
+
+	failIfError(t, RegisterSelfAsParticipant(tokenSecond, SignX))
+	second = wait(tokenSecond, -1)
+	failIfError(t, StartPlayingWithWaitingOpponent(tokenFirst, SignO, "user2"))
+
+	w = <-second
+	failIfError(t, w.err)
+	failIfFalseFmt(t, w.board.Turn().User() == "user2" && w.board.MoveCount() == 0, "unexpected board %v", w.board)
+
+	// the end of the session wakes the waiter
+	first = wait(tokenFirst, -1)
+	failIfError(t, Logout(tokenFirst))
+
+	w = <-first
+	failIfFalseFmt(t, errors.Is(w.err, ErrSessionNotFound), "unexpected error %v", w.err)
+}
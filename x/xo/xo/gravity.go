@@ -0,0 +1,104 @@
+package xo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// gravity is k-in-a-row where a sign drops to the lowest free cell of the
+// chosen column.
+type gravity struct {
+	*kInARow
+}
+
+// constGravitySizeMax limits the width and the height of gravity boards,
+// line tables grow with the area of the board.
+const constGravitySizeMax = 16
+
+var connectFour = newGravity(7, 6, 4)
+
+// ConnectFour is the gravity variant on 7 columns and 6 rows won by four in a
+// row.
+func ConnectFour() Rules { return connectFour }
+
+// Gravity returns the gravity variant on board of width columns and height
+// rows won by k in a row. Its name is "gravity-WxH-K" and RulesByName
+// accepts such names for sizes up to 16.
+func Gravity(width, height, k int) (Rules, error) {
+	if width < 1 || height < 1 || width > constGravitySizeMax || height > constGravitySizeMax || k < 2 || k > width && k > height {
+		return nil, fmt.Errorf("%w: gravity %d×%d with %d in a row", ErrUnknownVariant, width, height, k)
+	}
+
+	return newGravity(width, height, k), nil
+}
+
+func newGravity(width, height, k int) gravity {
+	return gravity{newKInARow(fmt.Sprintf("gravity-%dx%d-%d", width, height, k), width, height, 1, k)}
+}
+
+func parseGravity(name string) (Rules, bool) {
+	if !strings.HasPrefix(name, "gravity-") {
+		return nil, false
+	}
+
+	var width, height, k int
+	if n, err := fmt.Sscanf(name, "gravity-%dx%d-%d", &width, &height, &k); n != 3 || err != nil {
+		return nil, false
+	}
+
+	rules, err := Gravity(width, height, k)
+	if err != nil || rules.Name() != name {
+		return nil, false
+	}
+
+	return rules, true
+}
+
+// NewColumn returns a cell of col for gravity variants, they take only the
+// column of a move.
+func NewColumn(col int) (TypeCell, error) { return NewCell(0, col) }
+
+// landing returns the lowest free cell of column col, rows count from the
+// top.
+func (r gravity) landing(pos *TypePosition, col int) (TypeCell, bool) {
+	for y := r.height - 1; y >= 0; y-- {
+		if cell := (TypeCell{x: col, y: y}); pos.At(cell) == signNull {
+			return cell, true
+		}
+	}
+
+	return TypeCell{}, false
+}
+
+func (r gravity) LegalMoves(pos *TypePosition) []TypeMove {
+	if r.Terminal(pos) {
+		return nil
+	}
+
+	var moves []TypeMove
+	for col := 0; col < r.width; col++ {
+		if cell, ok := r.landing(pos, col); ok {
+			moves = append(moves, TypeMove{Cell: cell})
+		}
+	}
+
+	return moves
+}
+
+// ApplyMove drops the sign in the column of the cell of move, the row of the
+// cell is ignored.
+func (r gravity) ApplyMove(pos *TypePosition, move TypeMove) error {
+	if move.Cell.x < 0 || move.Cell.x >= r.width || move.Cell.z != 0 {
+		return fmt.Errorf("%w: column %d", ErrInvalidCell, move.Cell.x)
+	} else if r.Terminal(pos) {
+		return fmt.Errorf("%w: game is finished", ErrIllegalMove)
+	}
+
+	cell, ok := r.landing(pos, move.Cell.x)
+	if !ok {
+		return fmt.Errorf("%w: column %d is full", ErrIllegalMove, move.Cell.x)
+	}
+
+	pos.Play(TypeMove{Cell: cell, Sign: move.Sign})
+	return nil
+}
@@ -0,0 +1,96 @@
+package xo_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/ayzatziko/stuff/x/xo/xo"
+)
+
+func TestGravityDrops(t *testing.T) {
+	rules, err := Gravity(3, 2, 2)
+	failIfError(t, err)
+	pos := rules.NewPosition()
+
+	col, err := NewColumn(1)
+	failIfError(t, err)
+
+	failIfError(t, rules.ApplyMove(pos, TypeMove{Cell: col, Sign: SignX}))
+	failIfError(t, rules.ApplyMove(pos, TypeMove{Cell: col, Sign: SignO}))
+
+	bottom, err := NewCell(1, 1)
+	failIfError(t, err)
+	top, err := NewCell(0, 1)
+	failIfError(t, err)
+	failIfFalseFmt(t, pos.At(bottom) == SignX && pos.At(top) == SignO, "expected signs stacked in the column")
+
+	err = rules.ApplyMove(pos, TypeMove{Cell: col, Sign: SignX})
+	failIfFalseFmt(t, errors.Is(err, ErrIllegalMove), "expected full column error, got %v", err)
+	failIfFalseFmt(t, len(rules.LegalMoves(pos)) == 2, "expected moves to 2 columns, got %v", rules.LegalMoves(pos))
+
+	outer, err := NewColumn(3)
+	failIfError(t, err)
+	err = rules.ApplyMove(pos, TypeMove{Cell: outer, Sign: SignX})
+	failIfFalseFmt(t, errors.Is(err, ErrInvalidCell), "expected invalid column error, got %v", err)
+}
+
+func TestGravityByName(t *testing.T) {
+	rules, err := RulesByName("gravity-8x7-5")
+	failIfError(t, err)
+
+	pos := rules.NewPosition()
+	width, height, _ := pos.Size()
+	failIfFalseFmt(t, width == 8 && height == 7, "unexpected size %d×%d", width, height)
+
+	for _, name := range []string{"gravity-8x7", "gravity-0x7-4", "gravity-3x3-9", "gravity-07x6-4", "gravity-17x6-4", "gravity-7x17-4", "gravity-2000x2000-2"} {
+		_, err := RulesByName(name)
+		failIfFalseFmt(t, errors.Is(err, ErrUnknownVariant), "%s: unexpected error %v", name, err)
+	}
+}
+
+func TestGravityMaxSize(t *testing.T) {
+	_, err := Gravity(16, 16, 5)
+	failIfError(t, err)
+
+	_, err = Gravity(17, 6, 4)
+	failIfFalseFmt(t, errors.Is(err, ErrUnknownVariant), "unexpected error %v", err)
+}
+
+func TestConnectFourThroughSession(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	failIfError(t, RegisterUser("user1", testPassword))
+	tokenFirst, err := Login("user1", testPassword)
+	failIfError(t, err)
+	failIfError(t, RegisterSelfAsParticipantWithRules(tokenFirst, SignX, ConnectFour()))
+
+	failIfError(t, RegisterUser("user2", testPassword))
+	tokenSecond, err := Login("user2", testPassword)
+	failIfError(t, err)
+	failIfError(t, StartPlayingWithWaitingOpponent(tokenSecond, SignO, "user1"))
+
+	board, err := CurrentBoard(tokenFirst)
+	failIfError(t, err)
+	rows, cols, layers := board.Dimensions()
+	failIfFalseFmt(t, rows == 6 && cols == 7 && layers == 1, "unexpected dimensions %d×%d×%d", rows, cols, layers)
+
+	// x stacks four in the first column
+	for i, col := range []int{0, 1, 0, 1, 0, 1, 0} {
+		token := []string{tokenFirst, tokenSecond}[i%2]
+
+		cell, err := NewColumn(col)
+		failIfError(t, err)
+
+		b, msg, err := MakeAMove(token, cell)
+		failIfError(t, err)
+
+		if i < 6 {
+			failIfFalseFmt(t, b == nil, "unexpected end of the game %q", msg)
+			continue
+		}
+
+		failIfFalseFmt(t, msg == "user1 wins user2", "unexpected result %q", msg)
+	}
+
+	failIfFalseFmt(t, LastHistoryVariant() == "gravity-7x6-4", "unexpected variant %q", LastHistoryVariant())
+}
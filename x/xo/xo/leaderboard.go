@@ -0,0 +1,289 @@
+package xo
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/ayzatziko/stuff/xerrors"
+)
+
+// Leaderboards and profiles are maintained while the history grows, every
+// finished game updates the all-time, monthly and variant leaderboards of
+// its players. Every leaderboard rates its players by Elo from scratch, so
+// a monthly rating is the rating earned in the month.
+
+const (
+	constInitialRating = 1500
+	// constRatingK is the maximum rating change by a game.
+	constRatingK = 32
+	// constRecentGames is the number of games in profiles.
+	constRecentGames = 10
+	// constLeaderboardLimit is the default and constLeaderboardMaxLimit the
+	// maximum number of entries of a leaderboard.
+	constLeaderboardLimit    = 10
+	constLeaderboardMaxLimit = 100
+)
+
+// typeLeaderboardKey identifies a leaderboard, empty fields do not select.
+type typeLeaderboardKey struct {
+	variant string
+	// month like 2024-01
+	month string
+}
+
+type typePlayerStats struct {
+	games, wins, draws, losses int
+	rating                     float64
+}
+
+// typePlayerRecord is the profile data of a user beyond the all-time stats.
+type typePlayerRecord struct {
+	signs map[TypeSign]int
+	// recent games as indexes of playsHistory, the oldest first
+	recent []int
+}
+
+// leaderboards and players are guarded by historyMu.
+var (
+	leaderboards = map[typeLeaderboardKey]map[string]*typePlayerStats{}
+	players      = map[string]*typePlayerRecord{}
+)
+
+func monthOf(t time.Time) string { return t.UTC().Format("2006-01") }
+
+// appendHistoryLocked records the game and updates leaderboards, unless the
+// game is unrated, and profiles of its players, the caller holds historyMu.
+func appendHistoryLocked(r typeHistoryRecord) {
+	playsHistory = append(playsHistory, r)
+
+	month := monthOf(r.finishedAt)
+	keys := []typeLeaderboardKey{{}, {variant: r.variant}, {month: month}, {r.variant, month}}
+	if r.unrated {
+		keys = nil
+	}
+	for _, key := range keys {
+		board := leaderboards[key]
+		if board == nil {
+			board = map[string]*typePlayerStats{}
+			leaderboards[key] = board
+		}
+
+		rate(statsOf(board, r.mayBeWinner), statsOf(board, r.user2), r.result)
+	}
+
+	for i, user := range []string{r.mayBeWinner, r.user2} {
+		p := players[user]
+		if p == nil {
+			p = &typePlayerRecord{signs: map[TypeSign]int{}}
+			players[user] = p
+		}
+
+		p.signs[r.signs[i]]++
+		p.recent = append(p.recent, len(playsHistory)-1)
+		if len(p.recent) > constRecentGames {
+			p.recent = p.recent[len(p.recent)-constRecentGames:]
+		}
+	}
+}
+
+func statsOf(board map[string]*typePlayerStats, user string) *typePlayerStats {
+	stats := board[user]
+	if stats == nil {
+		stats = &typePlayerStats{rating: constInitialRating}
+		board[user] = stats
+	}
+
+	return stats
+}
+
+// rate counts the game of first and second, result tells whether the first
+// has won, otherwise it is a draw.
+func rate(first, second *typePlayerStats, result typeResult) {
+	score := 0.5
+	first.games++
+	second.games++
+	if result == typeResultFirstWon {
+		score = 1
+		first.wins++
+		second.losses++
+	} else {
+		first.draws++
+		second.draws++
+	}
+
+	expected := 1 / (1 + math.Pow(10, (second.rating-first.rating)/400))
+	delta := constRatingK * (score - expected)
+	first.rating += delta
+	second.rating -= delta
+}
+
+// forgetPlayerLocked removes the deleted user from leaderboards and
+// profiles, the caller holds historyMu.
+func forgetPlayerLocked(username string) {
+	for _, board := range leaderboards {
+		delete(board, username)
+	}
+	delete(players, username)
+}
+
+type TypeGameRecord struct {
+	Opponent TypeUser
+	Sign     TypeSign
+	// Result is "win", "draw" or "loss".
+	Result      string
+	Termination TypeTermination
+	Variant     string
+	Finished    time.Time
+}
+
+type TypeProfile struct {
+	User   TypeUser
+	Joined time.Time
+
+	Games, Wins, Draws, Losses int
+	// WinRate is the share of won games, zero without games.
+	WinRate float64
+	Rating  int
+	// FavoriteSign is the sign of most games, empty without games.
+	FavoriteSign TypeSign
+	// Recent games, the last first.
+	Recent []TypeGameRecord
+}
+
+func Profile(username string) (TypeProfile, error) {
+	return ProfileContext(context.Background(), username)
+}
+
+// ProfileContext returns the public profile of the user.
+func ProfileContext(ctx context.Context, username string) (_ TypeProfile, err error) {
+	defer xerrors.Wrap(&err, "Profile(%s)", username)
+
+	if err := accountsMu.RLockContext(ctx); err != nil {
+		return TypeProfile{}, err
+	}
+	defer accountsMu.RUnlock()
+
+	account, ok := registeredUser[username]
+	if !ok {
+		return TypeProfile{}, fmt.Errorf("%w: %q", ErrUserNotFound, username)
+	}
+
+	if err := historyMu.LockContext(ctx); err != nil {
+		return TypeProfile{}, err
+	}
+	defer historyMu.Unlock()
+
+	profile := TypeProfile{User: TypeUser(username), Joined: account.registeredAt, Rating: constInitialRating}
+	if stats, ok := leaderboards[typeLeaderboardKey{}][username]; ok {
+		profile.Games, profile.Wins, profile.Draws, profile.Losses = stats.games, stats.wins, stats.draws, stats.losses
+		profile.WinRate = float64(stats.wins) / float64(stats.games)
+		profile.Rating = int(math.Round(stats.rating))
+	}
+
+	p, ok := players[username]
+	if !ok {
+		return profile, nil
+	}
+
+	for _, sign := range []TypeSign{SignX, SignO} {
+		if n := p.signs[sign]; n > p.signs[profile.FavoriteSign] {
+			profile.FavoriteSign = sign
+		}
+	}
+
+	for i := len(p.recent) - 1; i >= 0; i-- {
+		r := playsHistory[p.recent[i]]
+		game := TypeGameRecord{Opponent: TypeUser(r.user2), Sign: r.signs[0], Result: "draw", Termination: r.termination, Variant: r.variant, Finished: r.finishedAt}
+		if r.result == typeResultFirstWon {
+			game.Result = "win"
+		}
+		if r.mayBeWinner != username {
+			game.Opponent, game.Sign = TypeUser(r.mayBeWinner), r.signs[1]
+			if r.result == typeResultFirstWon {
+				game.Result = "loss"
+			}
+		}
+		profile.Recent = append(profile.Recent, game)
+	}
+
+	return profile, nil
+}
+
+type TypeLeaderboardEntry struct {
+	Rank                       int
+	User                       TypeUser
+	Rating                     int
+	Games, Wins, Draws, Losses int
+}
+
+// TypeLeaderboardQuery selects a leaderboard, the all-time one when empty.
+// Limit is the number of entries, 10 by default and 100 at most.
+type TypeLeaderboardQuery struct {
+	Variant string
+	// Month selects the games finished in the month of the time in UTC.
+	Month time.Time
+	Limit int
+}
+
+func Leaderboard(query TypeLeaderboardQuery) ([]TypeLeaderboardEntry, error) {
+	return LeaderboardContext(context.Background(), query)
+}
+
+// LeaderboardContext returns the best players of the leaderboard by rating,
+// then by the number of wins.
+func LeaderboardContext(ctx context.Context, query TypeLeaderboardQuery) (_ []TypeLeaderboardEntry, err error) {
+	defer xerrors.Wrap(&err, "Leaderboard(%q, %s)", query.Variant, query.Month.Format("2006-01"))
+
+	key := typeLeaderboardKey{variant: query.Variant}
+	if query.Variant != "" {
+		if _, err := RulesByName(query.Variant); err != nil {
+			return nil, err
+		}
+	}
+	if !query.Month.IsZero() {
+		key.month = monthOf(query.Month)
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = constLeaderboardLimit
+	} else if limit > constLeaderboardMaxLimit {
+		limit = constLeaderboardMaxLimit
+	}
+
+	if err := historyMu.LockContext(ctx); err != nil {
+		return nil, err
+	}
+	defer historyMu.Unlock()
+
+	board := leaderboards[key]
+	entries := make([]TypeLeaderboardEntry, 0, len(board))
+	ratings := make(map[TypeUser]float64, len(board))
+	for user, stats := range board {
+		entries = append(entries, TypeLeaderboardEntry{User: TypeUser(user), Rating: int(math.Round(stats.rating)), Games: stats.games, Wins: stats.wins, Draws: stats.draws, Losses: stats.losses})
+		ratings[TypeUser(user)] = stats.rating
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if ratings[a.User] != ratings[b.User] {
+			return ratings[a.User] > ratings[b.User]
+		} else if a.Wins != b.Wins {
+			return a.Wins > b.Wins
+		}
+
+		return a.User < b.User
+	})
+
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	for i := range entries {
+		entries[i].Rank = i + 1
+	}
+
+	return entries, nil
+}
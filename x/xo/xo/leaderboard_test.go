@@ -0,0 +1,102 @@
+package xo_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/ayzatziko/stuff/x/xo/xo"
+)
+
+func TestLeaderboards(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	january := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	current := january
+	t.Cleanup(SetNow(func() time.Time { return current }))
+
+	// user1 wins user2 in classic in January
+	tokenFirst, tokenSecond := startGame(t, "user1", "user2")
+	_, _, err := Resign(tokenSecond)
+	failIfError(t, err)
+
+	// user1 draws with user3 in qubic in February
+	current = current.AddDate(0, 1, 0)
+	qubic, err := RulesByName("qubic")
+	failIfError(t, err)
+	failIfError(t, RegisterUser("user3", testPassword))
+	tokenThird, err := Login("user3", testPassword)
+	failIfError(t, err)
+	failIfError(t, RegisterSelfAsParticipantWithRules(tokenThird, SignX, qubic))
+	failIfError(t, StartPlayingWithWaitingOpponent(tokenFirst, SignO, "user3"))
+	failIfError(t, OfferDraw(tokenThird))
+	_, _, err = AcceptDraw(tokenFirst)
+	failIfError(t, err)
+
+	profile, err := Profile("user1")
+	failIfError(t, err)
+	failIfFalseFmt(t, profile.Joined.Equal(january), "unexpected join date %s", profile.Joined)
+	failIfFalseFmt(t, profile.Games == 2 && profile.Wins == 1 && profile.Draws == 1 && profile.WinRate == 0.5, "unexpected profile %+v", profile)
+	failIfFalseFmt(t, profile.Rating == 1515 && profile.FavoriteSign == SignX, "unexpected profile %+v", profile)
+	failIfFalseFmt(t, len(profile.Recent) == 2, "unexpected recent games %+v", profile.Recent)
+	failIfFalseFmt(t, profile.Recent[0] == TypeGameRecord{Opponent: "user3", Sign: SignO, Result: "draw", Termination: TerminationAgreedDraw, Variant: "qubic", Finished: current}, "unexpected game %+v", profile.Recent[0])
+	failIfFalseFmt(t, profile.Recent[1].Opponent == "user2" && profile.Recent[1].Result == "win", "unexpected game %+v", profile.Recent[1])
+
+	profile, err = Profile("user2")
+	failIfError(t, err)
+	failIfFalseFmt(t, profile.Losses == 1 && profile.Rating == 1484 && profile.FavoriteSign == SignO, "unexpected profile %+v", profile)
+	failIfFalseFmt(t, profile.Recent[0].Result == "loss" && profile.Recent[0].Termination == TerminationResignation, "unexpected game %+v", profile.Recent[0])
+
+	failIfError(t, RegisterUser("newbie", testPassword))
+	profile, err = Profile("newbie")
+	failIfError(t, err)
+	failIfFalseFmt(t, profile.Games == 0 && profile.Rating == 1500 && profile.FavoriteSign == "" && profile.Recent == nil, "unexpected profile %+v", profile)
+
+	_, err = Profile("nobody")
+	failIfFalseFmt(t, errors.Is(err, ErrUserNotFound), "unexpected error %v", err)
+
+	users := func(query TypeLeaderboardQuery) []TypeUser {
+		t.Helper()
+
+		entries, err := Leaderboard(query)
+		failIfError(t, err)
+
+		var users []TypeUser
+		for i, e := range entries {
+			failIfFalseFmt(t, e.Rank == i+1, "unexpected rank of %+v", e)
+			users = append(users, e.User)
+		}
+		return users
+	}
+
+	failIfFalseFmt(t, equalUsers(users(TypeLeaderboardQuery{}), "user1", "user3", "user2"), "unexpected all-time leaderboard")
+	failIfFalseFmt(t, equalUsers(users(TypeLeaderboardQuery{Limit: 1}), "user1"), "unexpected limited leaderboard")
+	failIfFalseFmt(t, equalUsers(users(TypeLeaderboardQuery{Month: january}), "user1", "user2"), "unexpected January leaderboard")
+	failIfFalseFmt(t, equalUsers(users(TypeLeaderboardQuery{Variant: "qubic"}), "user1", "user3"), "unexpected qubic leaderboard")
+	failIfFalseFmt(t, equalUsers(users(TypeLeaderboardQuery{Variant: "qubic", Month: january})), "unexpected qubic January leaderboard")
+
+	_, err = Leaderboard(TypeLeaderboardQuery{Variant: "no-such-variant"})
+	failIfFalseFmt(t, errors.Is(err, ErrUnknownVariant), "unexpected error %v", err)
+
+	// deleted users leave leaderboards, their games stay anonymous
+	failIfError(t, DeleteAccount(tokenSecond, testPassword))
+	failIfFalseFmt(t, equalUsers(users(TypeLeaderboardQuery{Month: january}), "user1"), "unexpected leaderboard after deletion")
+
+	profile, err = Profile("user1")
+	failIfError(t, err)
+	failIfFalseFmt(t, profile.Recent[1].Opponent == "anonymous", "unexpected game %+v", profile.Recent[1])
+}
+
+func equalUsers(got []TypeUser, want ...TypeUser) bool {
+	if len(got) != len(want) {
+		return false
+	}
+
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+
+	return true
+}
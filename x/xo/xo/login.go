@@ -0,0 +1,233 @@
+package xo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ayzatziko/stuff/xerrors"
+)
+
+// TypeLoginLimits throttle failed logins per username and per client
+// address. After FreeAttempts failures every next attempt waits Backoff
+// doubled for every further failure up to BackoffMax, after LockoutAttempts
+// failures the username or the address is locked for LockoutDuration.
+// Failures are forgotten after a successful login or LockoutDuration after
+// the last one.
+type TypeLoginLimits struct {
+	FreeAttempts    int
+	Backoff         time.Duration
+	BackoffMax      time.Duration
+	LockoutAttempts int
+	LockoutDuration time.Duration
+}
+
+// DefaultLoginLimits are the limits of logins unless SetLoginLimits changes
+// them.
+var DefaultLoginLimits = TypeLoginLimits{
+	FreeAttempts:    3,
+	Backoff:         time.Second,
+	BackoffMax:      time.Minute,
+	LockoutAttempts: 10,
+	LockoutDuration: 15 * time.Minute,
+}
+
+var (
+	loginLimits = DefaultLoginLimits
+
+	userAttempts    = map[string]*typeAttempts{}
+	addressAttempts = map[string]*typeAttempts{}
+)
+
+// SetLoginLimits changes the limits of failed logins, the zero limits
+// disable throttling. Other limits need a positive LockoutDuration.
+func SetLoginLimits(limits TypeLoginLimits) error {
+	if limits != (TypeLoginLimits{}) && limits.LockoutDuration <= 0 {
+		return fmt.Errorf("SetLoginLimits: lockout duration %s is not positive, failures would be forgotten at once", limits.LockoutDuration)
+	}
+
+	accountsMu.Lock()
+	defer accountsMu.Unlock()
+
+	loginLimits = limits
+
+	return nil
+}
+
+// typeAttempts are failed logins of a username or an address.
+type typeAttempts struct {
+	failures    int
+	lastFailure time.Time
+	retryAt     time.Time
+	lockedUntil time.Time
+}
+
+// checkAttemptsLocked returns an error if the next attempt of key must
+// wait.
+func checkAttemptsLocked(attempts map[string]*typeAttempts, key, kind string) error {
+	a, ok := attempts[key]
+	if !ok {
+		return nil
+	}
+
+	t := now()
+	if t.Sub(a.lastFailure) >= loginLimits.LockoutDuration {
+		delete(attempts, key)
+		return nil
+	}
+
+	if t.Before(a.lockedUntil) {
+		return fmt.Errorf("%w: %s %s for %s", ErrLoginLocked, kind, key, a.lockedUntil.Sub(t))
+	} else if t.Before(a.retryAt) {
+		return fmt.Errorf("%w: %s %s may retry in %s", ErrLoginThrottled, kind, key, a.retryAt.Sub(t))
+	}
+
+	return nil
+}
+
+func failAttemptLocked(attempts map[string]*typeAttempts, key string) {
+	if loginLimits == (TypeLoginLimits{}) {
+		return
+	}
+
+	a, ok := attempts[key]
+	if !ok {
+		a = &typeAttempts{}
+		attempts[key] = a
+	}
+
+	t := now()
+	a.failures++
+	a.lastFailure = t
+
+	if loginLimits.LockoutAttempts > 0 && a.failures >= loginLimits.LockoutAttempts {
+		a.lockedUntil = t.Add(loginLimits.LockoutDuration)
+	}
+
+	if extra := a.failures - loginLimits.FreeAttempts; extra >= 0 {
+		backoff := loginLimits.Backoff
+		for i := 0; i < extra && backoff < loginLimits.BackoffMax; i++ {
+			backoff *= 2
+		}
+		if backoff > loginLimits.BackoffMax {
+			backoff = loginLimits.BackoffMax
+		}
+		a.retryAt = t.Add(backoff)
+	}
+}
+
+// LoginFrom logs in like Login a user connected from the client address,
+// failed attempts are throttled by the username and by the address. An
+// empty address is not throttled.
+func LoginFrom(username, password, address string) (string, error) {
+	return LoginContext(WithClientAddress(context.Background(), address), username, password)
+}
+
+// LoginContext is LoginFrom the client address of ctx.
+func LoginContext(ctx context.Context, username, password string) (_ string, err error) {
+	// usernames that cannot be registered are quoted in errors and in the
+	// audit log
+	user := TypeUser(username)
+	if checkUsername(username) != nil {
+		user = TypeUser(quoteUsername(username))
+	}
+
+	defer xerrors.Wrap(&err, "Login(%s, *****)", user)
+
+	if err := accountsMu.LockContext(ctx); err != nil {
+		return "", err
+	}
+	defer accountsMu.Unlock()
+
+	address := ClientAddress(ctx)
+	defer func() {
+		if err != nil {
+			metricLoginFailures.Inc()
+			audit(ctx, user, AuditLoginFailed, "", err.Error())
+		}
+	}()
+
+	if err := checkAttemptsLocked(userAttempts, username, "user"); err != nil {
+		return "", err
+	} else if err := checkAttemptsLocked(addressAttempts, address, "address"); err != nil {
+		return "", err
+	}
+
+	var sessionToken string
+	if user == TypeUser(username) {
+		sessionToken, err = loginLocked(ctx, username, password)
+	} else {
+		err = fmt.Errorf("%w: %s", ErrUserNotFound, user)
+	}
+	switch {
+	case err == nil:
+		delete(userAttempts, username)
+		delete(addressAttempts, address)
+		audit(ctx, TypeUser(username), AuditLogin, "", "")
+		metricLogins.Inc()
+	case errors.Is(err, ErrWrongPassword) || errors.Is(err, ErrUserNotFound):
+		if address != "" {
+			failAttemptLocked(addressAttempts, address)
+		}
+		if _, ok := registeredUser[username]; ok {
+			failAttemptLocked(userAttempts, username)
+		}
+	}
+
+	return sessionToken, err
+}
+
+// UnlockUser forgets failed logins of username, lifting its lockout. It is
+// allowed to moderators.
+func UnlockUser(sessionToken, username string) error {
+	return UnlockUserContext(context.Background(), sessionToken, username)
+}
+
+func UnlockUserContext(ctx context.Context, sessionToken, username string) (err error) {
+	if err := accountsMu.LockContext(ctx); err != nil {
+		return err
+	}
+	defer accountsMu.Unlock()
+
+	operator, err := authorizeLocked(ctx, sessionToken, RoleModerator)
+	if err != nil {
+		return err
+	}
+
+	defer xerrors.Wrap(&err, "UnlockUser(%s, %s)", operator, username)
+
+	if _, ok := registeredUser[username]; !ok {
+		return fmt.Errorf("%w: %q", ErrUserNotFound, username)
+	}
+
+	delete(userAttempts, username)
+	audit(ctx, operator, AuditUnlock, TypeUser(username), "")
+
+	return nil
+}
+
+// UnlockAddress forgets failed logins from the client address. It is allowed
+// to moderators.
+func UnlockAddress(sessionToken, address string) error {
+	return UnlockAddressContext(context.Background(), sessionToken, address)
+}
+
+func UnlockAddressContext(ctx context.Context, sessionToken, address string) (err error) {
+	if err := accountsMu.LockContext(ctx); err != nil {
+		return err
+	}
+	defer accountsMu.Unlock()
+
+	operator, err := authorizeLocked(ctx, sessionToken, RoleModerator)
+	if err != nil {
+		return err
+	}
+
+	defer xerrors.Wrap(&err, "UnlockAddress(%s, %s)", operator, address)
+
+	delete(addressAttempts, address)
+	audit(ctx, operator, AuditUnlock, "", "address "+address)
+
+	return nil
+}
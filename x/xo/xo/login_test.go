@@ -0,0 +1,129 @@
+package xo_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/ayzatziko/stuff/x/xo/xo"
+)
+
+func TestLoginBackoff(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	current := time.Now()
+	t.Cleanup(SetNow(func() time.Time { return current }))
+
+	failIfError(t, RegisterUser("user1", testPassword))
+
+	for i := 0; i < DefaultLoginLimits.FreeAttempts; i++ {
+		_, err := LoginFrom("user1", "wrong", "10.0.0.1")
+		failIfFalseFmt(t, errors.Is(err, ErrWrongPassword), "attempt %d: unexpected error %v", i, err)
+	}
+
+	// even the right password waits for the backoff
+	_, err := LoginFrom("user1", testPassword, "10.0.0.2")
+	failIfFalseFmt(t, errors.Is(err, ErrLoginThrottled), "expected throttled user, got %v", err)
+
+	current = current.Add(DefaultLoginLimits.Backoff)
+	_, err = LoginFrom("user1", "wrong", "10.0.0.2")
+	failIfFalseFmt(t, errors.Is(err, ErrWrongPassword), "unexpected error %v", err)
+
+	// the backoff doubles
+	current = current.Add(DefaultLoginLimits.Backoff)
+	_, err = Login("user1", testPassword)
+	failIfFalseFmt(t, errors.Is(err, ErrLoginThrottled), "expected doubled backoff, got %v", err)
+
+	current = current.Add(DefaultLoginLimits.Backoff)
+	_, err = Login("user1", testPassword)
+	failIfError(t, err)
+
+	// success forgets failures
+	_, err = Login("user1", "wrong")
+	failIfFalseFmt(t, errors.Is(err, ErrWrongPassword), "unexpected error %v", err)
+	_, err = Login("user1", testPassword)
+	failIfError(t, err)
+}
+
+func TestLoginLockout(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	current := time.Now()
+	t.Cleanup(SetNow(func() time.Time { return current }))
+
+	moderator := loginAs(t, "mod1", RoleModerator)
+	failIfError(t, RegisterUser("user1", testPassword))
+
+	for i := 0; i < DefaultLoginLimits.LockoutAttempts; i++ {
+		current = current.Add(DefaultLoginLimits.BackoffMax)
+		_, err := Login("user1", "wrong")
+		failIfFalseFmt(t, errors.Is(err, ErrWrongPassword), "attempt %d: unexpected error %v", i, err)
+	}
+
+	current = current.Add(DefaultLoginLimits.BackoffMax)
+	_, err := Login("user1", testPassword)
+	failIfFalseFmt(t, errors.Is(err, ErrLoginLocked), "expected locked user, got %v", err)
+
+	player := loginAs(t, "user2", RolePlayer)
+	err = UnlockUser(player, "user1")
+	failIfFalseFmt(t, errors.Is(err, ErrPermissionDenied), "unexpected error %v", err)
+
+	failIfError(t, UnlockUser(moderator, "user1"))
+	_, err = Login("user1", testPassword)
+	failIfError(t, err)
+
+	records, err := AuditLog(moderator, "user1", time.Time{}, time.Time{})
+	failIfError(t, err)
+	unlocked := false
+	for _, r := range records {
+		unlocked = unlocked || r.Action == AuditUnlock && r.User == "mod1" && r.Target == "user1"
+	}
+	failIfFalseFmt(t, unlocked, "unlock is not audited %+v", records)
+
+	for i := 0; i < DefaultLoginLimits.LockoutAttempts; i++ {
+		current = current.Add(DefaultLoginLimits.BackoffMax)
+		Login("user1", "wrong")
+	}
+
+	current = current.Add(DefaultLoginLimits.LockoutDuration)
+	_, err = Login("user1", testPassword)
+	failIfError(t, err)
+
+	err = UnlockUser(moderator, "nobody")
+	failIfFalseFmt(t, errors.Is(err, ErrUserNotFound), "unexpected error %v", err)
+}
+
+func TestLoginAddress(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+	t.Cleanup(func() { SetLoginLimits(DefaultLoginLimits) })
+
+	failIfError(t, SetLoginLimits(TypeLoginLimits{FreeAttempts: 2, Backoff: time.Hour, BackoffMax: time.Hour, LockoutDuration: time.Hour}))
+
+	moderator := loginAs(t, "mod1", RoleModerator)
+	failIfError(t, RegisterUser("user1", testPassword))
+
+	// guessing usernames is throttled by the address
+	for _, user := range []string{"nobody1", "nobody2"} {
+		_, err := LoginFrom(user, testPassword, "10.0.0.1")
+		failIfFalseFmt(t, errors.Is(err, ErrUserNotFound), "unexpected error %v", err)
+	}
+
+	_, err := LoginFrom("user1", testPassword, "10.0.0.1")
+	failIfFalseFmt(t, errors.Is(err, ErrLoginThrottled), "expected throttled address, got %v", err)
+	_, err = LoginFrom("user1", testPassword, "10.0.0.2")
+	failIfError(t, err)
+
+	failIfError(t, UnlockAddress(moderator, "10.0.0.1"))
+	_, err = LoginFrom("user1", testPassword, "10.0.0.1")
+	failIfError(t, err)
+
+	// limits forgetting failures at once are rejected
+	err = SetLoginLimits(TypeLoginLimits{FreeAttempts: 2, Backoff: time.Hour})
+	failIfFalseFmt(t, err != nil, "expected error setting limits without lockout duration")
+
+	failIfError(t, SetLoginLimits(TypeLoginLimits{}))
+	for i := 0; i < 10; i++ {
+		_, err = LoginFrom("user1", "wrong", "10.0.0.1")
+		failIfFalseFmt(t, errors.Is(err, ErrWrongPassword), "unexpected error %v without limits", err)
+	}
+}
@@ -0,0 +1,136 @@
+package xo
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ayzatziko/stuff/x/xo/xometrics"
+)
+
+var (
+	metricRegistrations = xometrics.NewCounter("xo_registrations_total", "Registered users.")
+	metricLogins        = xometrics.NewCounter("xo_logins_total", "Successful logins.")
+	metricLoginFailures = xometrics.NewCounter("xo_login_failures_total", "Failed logins.")
+	metricMoves         = xometrics.NewCounter("xo_moves_total", "Played moves.")
+	metricGamesFinished = xometrics.NewCounter("xo_games_finished_total", "Finished games.")
+	metricAuditFailures = xometrics.NewCounter("xo_audit_failures_total", "Failed appends of audit records, they are retried.")
+	metricAuditDropped  = xometrics.NewCounter("xo_audit_dropped_total", "Audit records dropped while the queue of the sink was full.")
+
+	metricGameDuration = xometrics.NewHistogram("xo_game_duration_seconds", "Durations of finished games.",
+		xometrics.ExponentialBuckets(5, 2, 10))
+	metricLockWait = xometrics.NewHistogram("xo_lock_wait_seconds", "Time waited for the locks of the xo state.",
+		xometrics.ExponentialBuckets(1e-6, 4, 10))
+	metricLockHeld = xometrics.NewHistogram("xo_lock_held_seconds", "Time the locks of the xo state are held by writers.",
+		xometrics.ExponentialBuckets(1e-6, 4, 10))
+)
+
+func init() {
+	xometrics.NewGauge("xo_sessions", "Logged in users.", func() float64 {
+		n := 0
+		for i := range tokenShards {
+			shard := &tokenShards[i]
+			shard.mu.RLock()
+			n += len(shard.tokens)
+			shard.mu.RUnlock()
+		}
+
+		return float64(n)
+	})
+	xometrics.NewGauge("xo_waiting_opponents", "Users waiting in the lobby.", func() float64 {
+		lobbyMu.Lock()
+		defer lobbyMu.Unlock()
+
+		return float64(len(waitingOpponents))
+	})
+	xometrics.NewGauge("xo_boards", "Running games.", func() float64 {
+		return float64(runningGames.Load())
+	})
+	xometrics.NewGauge("xo_audit_pending", "Audit records waiting to be appended to the sink.", func() float64 {
+		auditMu.RLock()
+		defer auditMu.RUnlock()
+
+		return float64(len(auditQueue))
+	})
+}
+
+// typeMutex measures the time waited for the lock and the time it is held
+// by writers, the real clock is used regardless of now.
+type typeMutex struct {
+	sync.RWMutex
+	lockedAt time.Time
+}
+
+func (m *typeMutex) Lock() {
+	start := time.Now()
+	m.RWMutex.Lock()
+	m.lockedAt = time.Now()
+
+	metricLockWait.Observe(m.lockedAt.Sub(start).Seconds())
+}
+
+func (m *typeMutex) Unlock() {
+	held := time.Since(m.lockedAt)
+	m.RWMutex.Unlock()
+
+	metricLockHeld.Observe(held.Seconds())
+}
+
+// LockContext locks m unless ctx is done first.
+func (m *typeMutex) LockContext(ctx context.Context) error {
+	start := time.Now()
+	if err := lockContext(ctx, m.RWMutex.TryLock, m.RWMutex.Lock, m.RWMutex.Unlock); err != nil {
+		return err
+	}
+	m.lockedAt = time.Now()
+
+	metricLockWait.Observe(m.lockedAt.Sub(start).Seconds())
+	return nil
+}
+
+func (m *typeMutex) RLockContext(ctx context.Context) error {
+	start := time.Now()
+	if err := lockContext(ctx, m.RWMutex.TryRLock, m.RWMutex.RLock, m.RWMutex.RUnlock); err != nil {
+		return err
+	}
+
+	metricLockWait.Observe(time.Since(start).Seconds())
+	return nil
+}
+
+// lockContext waits for lock in another goroutine unless ctx is done, a lock
+// taken after ctx is done is released.
+func lockContext(ctx context.Context, tryLock func() bool, lock, unlock func()) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	} else if tryLock() {
+		return nil
+	} else if ctx.Done() == nil {
+		lock()
+		return nil
+	}
+
+	locked := make(chan struct{})
+	go func() {
+		lock()
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+		return nil
+	case <-ctx.Done():
+		go func() {
+			<-locked
+			unlock()
+		}()
+		return ctx.Err()
+	}
+}
+
+func (m *typeMutex) RLock() {
+	start := time.Now()
+	m.RWMutex.RLock()
+
+	metricLockWait.Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,62 @@
+package xo_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	. "github.com/ayzatziko/stuff/x/xo/xo"
+	"github.com/ayzatziko/stuff/x/xo/xometrics"
+)
+
+type metricValues struct {
+	Registrations float64 `json:"xo_registrations_total"`
+	Logins        float64 `json:"xo_logins_total"`
+	LoginFailures float64 `json:"xo_login_failures_total"`
+	Moves         float64 `json:"xo_moves_total"`
+	Sessions      float64 `json:"xo_sessions"`
+	Waiting       float64 `json:"xo_waiting_opponents"`
+	Boards        float64 `json:"xo_boards"`
+	GameDuration  struct {
+		Count uint64
+		Sum   float64
+	} `json:"xo_game_duration_seconds"`
+	LockWait struct{ Count uint64 } `json:"xo_lock_wait_seconds"`
+}
+
+func readMetrics(t *testing.T) metricValues {
+	t.Helper()
+
+	var values metricValues
+	failIfError(t, json.Unmarshal([]byte(xometrics.Default.Expvar().String()), &values))
+
+	return values
+}
+
+func TestMetrics(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	current := time.Now()
+	t.Cleanup(SetNow(func() time.Time { return current }))
+
+	before := readMetrics(t)
+
+	tokenFirst, tokenSecond := startGame(t, "user1", "user2")
+	Login("user1", "wrong")
+	running := readMetrics(t)
+	failIfFalseFmt(t, running.Sessions == 2 && running.Boards == 1 && running.Waiting == 0, "unexpected gauges %+v", running)
+	failIfFalseFmt(t, running.Registrations-before.Registrations == 2, "unexpected registrations %+v", running)
+	failIfFalseFmt(t, running.Logins-before.Logins == 2 && running.LoginFailures-before.LoginFailures == 1, "unexpected logins %+v", running)
+
+	current = current.Add(time.Minute)
+	cell, _ := NewCell(0, 0)
+	_, _, err := MakeAMove(tokenFirst, cell)
+	failIfError(t, err)
+	_, _, err = Resign(tokenSecond)
+	failIfError(t, err)
+
+	after := readMetrics(t)
+	failIfFalseFmt(t, after.Moves-before.Moves == 1 && after.Boards == 0, "unexpected moves %+v", after)
+	failIfFalseFmt(t, after.GameDuration.Count-before.GameDuration.Count == 1 && after.GameDuration.Sum-before.GameDuration.Sum == 60, "unexpected game duration %+v", after.GameDuration)
+	failIfFalseFmt(t, after.LockWait.Count > running.LockWait.Count, "lock waits are not observed %+v", after.LockWait)
+}
@@ -0,0 +1,38 @@
+package xo
+
+import "strings"
+
+// misere turns rules around: the side completing a line loses.
+type misere struct {
+	Rules
+}
+
+// Misere returns the misère variant of rules named "misere-" followed by the
+// name of rules, RulesByName accepts such names for registered rules.
+func Misere(rules Rules) Rules { return misere{rules} }
+
+func (r misere) Name() string { return "misere-" + r.Rules.Name() }
+
+func (r misere) Winner(pos *TypePosition) (int, bool) {
+	side, ok := r.Rules.Winner(pos)
+	if !ok {
+		return 0, false
+	}
+
+	return (side + 1) % constUsersNum, true
+}
+
+func (r misere) choosesSign() bool { return choosesSign(r.Rules) }
+
+func parseMisereLocked(name string) (Rules, bool) {
+	if !strings.HasPrefix(name, "misere-") {
+		return nil, false
+	}
+
+	rules, err := rulesByNameLocked(strings.TrimPrefix(name, "misere-"))
+	if err != nil {
+		return nil, false
+	}
+
+	return Misere(rules), true
+}
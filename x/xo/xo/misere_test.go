@@ -0,0 +1,67 @@
+package xo_test
+
+import (
+	"testing"
+
+	. "github.com/ayzatziko/stuff/x/xo/xo"
+)
+
+func TestMisereLineLoses(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	rules, err := RulesByName("misere-classic")
+	failIfError(t, err)
+
+	tokenFirst, tokenSecond := startGameWithRules(t, "user1", "user2", rules)
+
+	// user1 completes the first row
+	moves := []struct {
+		token string
+		x, y  int
+	}{
+		{tokenFirst, 0, 0}, {tokenSecond, 1, 0},
+		{tokenFirst, 0, 1}, {tokenSecond, 1, 1},
+		{tokenFirst, 0, 2},
+	}
+	for i, m := range moves {
+		cell, err := NewCell(m.x, m.y)
+		failIfError(t, err)
+
+		b, msg, err := MakeAMove(m.token, cell)
+		failIfError(t, err)
+
+		if i < len(moves)-1 {
+			failIfFalseFmt(t, b == nil, "unexpected end of the game %q", msg)
+			continue
+		}
+
+		failIfFalseFmt(t, msg == "user2 wins user1", "unexpected result %q", msg)
+	}
+
+	mayBeWinner, _, firstWon, _ := LastHistoryRecord()
+	failIfFalseFmt(t, mayBeWinner == "user2" && firstWon, "unexpected history record %q %v", mayBeWinner, firstWon)
+	failIfFalseFmt(t, LastHistoryVariant() == "misere-classic", "unexpected variant %q", LastHistoryVariant())
+}
+
+func TestMisereByName(t *testing.T) {
+	rules, err := RulesByName("misere-gravity-7x6-4")
+	failIfError(t, err)
+	failIfFalseFmt(t, rules.Name() == "misere-gravity-7x6-4", "unexpected name %q", rules.Name())
+
+	_, err = RulesByName("misere-unknown")
+	failIfFalseFmt(t, err != nil, "expected unknown variant")
+}
+
+func TestMisereHardBotNeverLoses(t *testing.T) {
+	for _, opponent := range []TypeBotLevel{BotLevelEasy, BotLevelMedium} {
+		for i := 0; i < 3; i++ {
+			if winner := playBotsWithRules(t, Misere(Classic()), BotLevelHard, opponent); winner == "second" {
+				t.Fatalf("hard bot moving first lost to %s bot", opponent)
+			}
+
+			if winner := playBotsWithRules(t, Misere(Classic()), opponent, BotLevelHard); winner == "first" {
+				t.Fatalf("hard bot moving second lost to %s bot", opponent)
+			}
+		}
+	}
+}
@@ -0,0 +1,435 @@
+package xo
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ayzatziko/stuff/xerrors"
+)
+
+// TypeRole grants privileged operations: moderators moderate players,
+// admins moderate moderators and grant roles.
+type TypeRole string
+
+const (
+	RolePlayer    TypeRole = "player"
+	RoleModerator TypeRole = "moderator"
+	RoleAdmin     TypeRole = "admin"
+)
+
+func (role TypeRole) rank() int {
+	switch role {
+	case RoleModerator:
+		return 1
+	case RoleAdmin:
+		return 2
+	}
+
+	return 0
+}
+
+func parseRole(role TypeRole) error {
+	if role != RolePlayer && role != RoleModerator && role != RoleAdmin {
+		return fmt.Errorf("unknown role %q, valid roles %q, %q and %q", role, RolePlayer, RoleModerator, RoleAdmin)
+	}
+
+	return nil
+}
+
+type typeBan struct {
+	reason string
+	// until is zero for a permanent ban.
+	until time.Time
+}
+
+// activeLocked reports whether the ban is not expired.
+func (ban *typeBan) activeLocked() bool {
+	return ban != nil && (ban.until.IsZero() || now().Before(ban.until))
+}
+
+func (ban *typeBan) Error() string {
+	if ban.until.IsZero() {
+		return fmt.Sprintf("%s permanently: %s", ErrBanned, ban.reason)
+	}
+
+	return fmt.Sprintf("%s until %s: %s", ErrBanned, ban.until.Format(time.RFC3339), ban.reason)
+}
+
+func (ban *typeBan) Unwrap() error { return ErrBanned }
+
+// SetRole sets the role of a registered user without authorization, it is
+// meant for the operator of the server to appoint the first admin.
+func SetRole(username string, role TypeRole) error {
+	return SetRoleContext(context.Background(), username, role)
+}
+
+func SetRoleContext(ctx context.Context, username string, role TypeRole) error {
+	if err := parseRole(role); err != nil {
+		return err
+	}
+
+	if err := accountsMu.LockContext(ctx); err != nil {
+		return err
+	}
+	defer accountsMu.Unlock()
+
+	account, ok := registeredUser[username]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUserNotFound, username)
+	}
+
+	account.role = role
+	registeredUser[username] = account
+	audit(ctx, "", AuditRoleChange, TypeUser(username), string(role))
+
+	return nil
+}
+
+// authorize returns the user of the session having at least role.
+func authorize(ctx context.Context, sessionToken string, role TypeRole) (TypeUser, error) {
+	if err := accountsMu.LockContext(ctx); err != nil {
+		return "", err
+	}
+	defer accountsMu.Unlock()
+
+	return authorizeLocked(ctx, sessionToken, role)
+}
+
+// authorizeLocked is authorize for the caller holding accountsMu.
+func authorizeLocked(ctx context.Context, sessionToken string, role TypeRole) (TypeUser, error) {
+	user, err := userOf(ctx, sessionToken)
+	if err != nil {
+		return "", err
+	}
+
+	if registeredUser[string(user)].role.rank() < role.rank() {
+		return "", fmt.Errorf("%w: %s is not %s", ErrPermissionDenied, user, role)
+	}
+
+	return user, nil
+}
+
+// checkOutranksLocked returns an error unless the role of operator is
+// higher than the role of the registered user.
+func checkOutranksLocked(operator, user TypeUser) error {
+	account, ok := registeredUser[string(user)]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUserNotFound, user)
+	} else if registeredUser[string(operator)].role.rank() <= account.role.rank() {
+		return fmt.Errorf("%w: %s is %s", ErrPermissionDenied, user, account.role)
+	}
+
+	return nil
+}
+
+// checkOutranksPlayersLocked returns an error unless operator outranks both
+// players of board and so does not play the game.
+func checkOutranksPlayersLocked(operator TypeUser, board *TypeBoard) error {
+	for _, p := range board.participants {
+		if p.user == operator {
+			return fmt.Errorf("%w: %s plays the game", ErrPermissionDenied, operator)
+		} else if err := checkOutranksLocked(operator, p.user); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GrantRole sets the role of a user, it is allowed to admins for
+// non-admins.
+func GrantRole(sessionToken string, username string, role TypeRole) error {
+	return GrantRoleContext(context.Background(), sessionToken, username, role)
+}
+
+func GrantRoleContext(ctx context.Context, sessionToken string, username string, role TypeRole) (err error) {
+	if err := accountsMu.LockContext(ctx); err != nil {
+		return err
+	}
+	defer accountsMu.Unlock()
+
+	operator, err := authorizeLocked(ctx, sessionToken, RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	defer xerrors.Wrap(&err, "GrantRole(%s, %s, %s)", operator, username, role)
+
+	if err := parseRole(role); err != nil {
+		return err
+	} else if err := checkOutranksLocked(operator, TypeUser(username)); err != nil {
+		return err
+	}
+
+	account := registeredUser[username]
+	account.role = role
+	registeredUser[username] = account
+	audit(ctx, operator, AuditRoleChange, TypeUser(username), string(role))
+
+	return nil
+}
+
+type TypeSession struct {
+	User    TypeUser
+	Role    TypeRole
+	Playing bool
+	Waiting bool
+}
+
+// Sessions returns the logged in users sorted by name, it is allowed to
+// moderators.
+func Sessions(sessionToken string) ([]TypeSession, error) {
+	return SessionsContext(context.Background(), sessionToken)
+}
+
+func SessionsContext(ctx context.Context, sessionToken string) ([]TypeSession, error) {
+	if err := accountsMu.LockContext(ctx); err != nil {
+		return nil, err
+	}
+	defer accountsMu.Unlock()
+
+	if _, err := authorizeLocked(ctx, sessionToken, RoleModerator); err != nil {
+		return nil, err
+	}
+
+	if err := lobbyMu.LockContext(ctx); err != nil {
+		return nil, err
+	}
+	defer lobbyMu.Unlock()
+
+	sessions := []TypeSession{}
+	for i := range userShards {
+		shard := &userShards[i]
+		shard.mu.Lock()
+		for user, st := range shard.users {
+			if st.token == "" {
+				continue
+			}
+
+			sessions = append(sessions, TypeSession{
+				User:    user,
+				Role:    registeredUser[string(user)].role,
+				Playing: st.game != nil,
+				Waiting: waitingLocked(user),
+			})
+		}
+		shard.mu.Unlock()
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].User < sessions[j].User })
+
+	return sessions, nil
+}
+
+// ForceLogout ends the session of user like Logout, it is allowed to the
+// users of higher roles.
+func ForceLogout(sessionToken string, user TypeUser) error {
+	return ForceLogoutContext(context.Background(), sessionToken, user)
+}
+
+func ForceLogoutContext(ctx context.Context, sessionToken string, user TypeUser) (err error) {
+	if err := accountsMu.LockContext(ctx); err != nil {
+		return err
+	}
+	defer accountsMu.Unlock()
+
+	operator, err := authorizeLocked(ctx, sessionToken, RoleModerator)
+	if err != nil {
+		return err
+	}
+
+	defer xerrors.Wrap(&err, "ForceLogout(%s, %s)", operator, user)
+
+	if err := checkOutranksLocked(operator, user); err != nil {
+		return err
+	}
+
+	token, ok := tokenOf(user)
+	if !ok {
+		return ErrSessionNotFound
+	}
+
+	audit(ctx, operator, AuditForceLogout, user, "")
+	endSession(ctx, user, token, "")
+
+	return nil
+}
+
+// Ban ends the session of user and denies logins for duration, forever if
+// duration is not positive. It is allowed to the users of higher roles.
+func Ban(sessionToken string, user TypeUser, reason string, duration time.Duration) error {
+	return BanContext(context.Background(), sessionToken, user, reason, duration)
+}
+
+func BanContext(ctx context.Context, sessionToken string, user TypeUser, reason string, duration time.Duration) (err error) {
+	if err := accountsMu.LockContext(ctx); err != nil {
+		return err
+	}
+	defer accountsMu.Unlock()
+
+	operator, err := authorizeLocked(ctx, sessionToken, RoleModerator)
+	if err != nil {
+		return err
+	}
+
+	defer xerrors.Wrap(&err, "Ban(%s, %s, %q, %s)", operator, user, reason, duration)
+
+	if err := checkOutranksLocked(operator, user); err != nil {
+		return err
+	}
+
+	ban := &typeBan{reason: reason}
+	if duration > 0 {
+		ban.until = now().Add(duration)
+	}
+
+	account := registeredUser[string(user)]
+	account.ban = ban
+	registeredUser[string(user)] = account
+	audit(ctx, operator, AuditBan, user, ban.Error())
+
+	if token, ok := tokenOf(user); ok {
+		endSession(ctx, user, token, "")
+	}
+
+	return nil
+}
+
+func Unban(sessionToken string, user TypeUser) error {
+	return UnbanContext(context.Background(), sessionToken, user)
+}
+
+func UnbanContext(ctx context.Context, sessionToken string, user TypeUser) (err error) {
+	if err := accountsMu.LockContext(ctx); err != nil {
+		return err
+	}
+	defer accountsMu.Unlock()
+
+	operator, err := authorizeLocked(ctx, sessionToken, RoleModerator)
+	if err != nil {
+		return err
+	}
+
+	defer xerrors.Wrap(&err, "Unban(%s, %s)", operator, user)
+
+	if err := checkOutranksLocked(operator, user); err != nil {
+		return err
+	}
+
+	account := registeredUser[string(user)]
+	account.ban = nil
+	registeredUser[string(user)] = account
+	audit(ctx, operator, AuditUnban, user, "")
+
+	return nil
+}
+
+// AbortGame ends the game of user without a result and without a record in
+// the history, it is allowed to moderators outranking both players.
+func AbortGame(sessionToken string, user TypeUser) (string, error) {
+	return AbortGameContext(context.Background(), sessionToken, user)
+}
+
+func AbortGameContext(ctx context.Context, sessionToken string, user TypeUser) (_ string, err error) {
+	if err := accountsMu.LockContext(ctx); err != nil {
+		return "", err
+	}
+	defer accountsMu.Unlock()
+
+	operator, err := authorizeLocked(ctx, sessionToken, RoleModerator)
+	if err != nil {
+		return "", err
+	}
+
+	defer xerrors.Wrap(&err, "AbortGame(%s, %s)", operator, user)
+
+	game, err := lockGameOf(ctx, user)
+	if err != nil {
+		return "", err
+	}
+	defer game.mu.Unlock()
+
+	if err := checkOutranksPlayersLocked(operator, game.board); err != nil {
+		return "", err
+	}
+
+	audit(ctx, operator, AuditGameAbort, user, game.board.rules.Name())
+	return finishGameLocked(game, "", TerminationAborted), nil
+}
+
+// Adjudicate ends the game of user with winner, a draw if winner is empty.
+// It is allowed to moderators outranking both players.
+func Adjudicate(sessionToken string, user, winner TypeUser) (string, error) {
+	return AdjudicateContext(context.Background(), sessionToken, user, winner)
+}
+
+func AdjudicateContext(ctx context.Context, sessionToken string, user, winner TypeUser) (_ string, err error) {
+	if err := accountsMu.LockContext(ctx); err != nil {
+		return "", err
+	}
+	defer accountsMu.Unlock()
+
+	operator, err := authorizeLocked(ctx, sessionToken, RoleModerator)
+	if err != nil {
+		return "", err
+	}
+
+	defer xerrors.Wrap(&err, "Adjudicate(%s, %s, %s)", operator, user, winnerString(winner))
+
+	game, err := lockGameOf(ctx, user)
+	if err != nil {
+		return "", err
+	}
+	defer game.mu.Unlock()
+
+	board := game.board
+	if err := checkOutranksPlayersLocked(operator, board); err != nil {
+		return "", err
+	} else if winner != "" && winner != board.participants[0].user && winner != board.participants[1].user {
+		return "", fmt.Errorf("%s does not play the game of %s", winner, user)
+	}
+
+	msg := finishGameLocked(game, winner, TerminationAdjudication)
+	audit(ctx, operator, AuditAdjudication, user, msg)
+
+	return msg, nil
+}
+
+// PurgeWaiting removes users from the waiting list and closes their rooms,
+// all waiting users if none is given, and returns the number of removed
+// users. It is allowed to moderators.
+func PurgeWaiting(sessionToken string, users ...TypeUser) (int, error) {
+	return PurgeWaitingContext(context.Background(), sessionToken, users...)
+}
+
+func PurgeWaitingContext(ctx context.Context, sessionToken string, users ...TypeUser) (int, error) {
+	operator, err := authorize(ctx, sessionToken, RoleModerator)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := lobbyMu.LockContext(ctx); err != nil {
+		return 0, err
+	}
+	defer lobbyMu.Unlock()
+
+	if len(users) == 0 {
+		for user := range waitingOpponents {
+			users = append(users, TypeUser(user))
+		}
+		for user := range hosts {
+			users = append(users, user)
+		}
+	}
+
+	n := 0
+	for _, user := range users {
+		if leaveLobbyLocked(user) {
+			audit(ctx, operator, AuditPurge, user, "")
+			n++
+		}
+	}
+
+	return n, nil
+}
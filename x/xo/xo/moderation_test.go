@@ -0,0 +1,168 @@
+package xo_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/ayzatziko/stuff/x/xo/xo"
+)
+
+// loginAs registers and logs in a user of role.
+func loginAs(t *testing.T, username string, role TypeRole) string {
+	t.Helper()
+
+	failIfError(t, RegisterUser(username, testPassword))
+	failIfError(t, SetRole(username, role))
+	token, err := Login(username, testPassword)
+	failIfError(t, err)
+
+	return token
+}
+
+func TestRoles(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	admin := loginAs(t, "boss", RoleAdmin)
+	moderator := loginAs(t, "mod1", RoleModerator)
+	player := loginAs(t, "player1", RolePlayer)
+	loginAs(t, "mod2", RoleModerator)
+
+	_, err := Sessions(player)
+	failIfFalseFmt(t, errors.Is(err, ErrPermissionDenied), "unexpected error %v", err)
+	err = ForceLogout(moderator, "mod2")
+	failIfFalseFmt(t, errors.Is(err, ErrPermissionDenied), "moderator logged out moderator: %v", err)
+	err = GrantRole(moderator, "player1", RoleModerator)
+	failIfFalseFmt(t, errors.Is(err, ErrPermissionDenied), "moderator granted role: %v", err)
+	err = GrantRole(admin, "player1", "king")
+	failIfFalseFmt(t, err != nil, "expected error of unknown role")
+	err = SetRole("nobody", RoleAdmin)
+	failIfFalseFmt(t, errors.Is(err, ErrUserNotFound), "unexpected error %v", err)
+
+	sessions, err := Sessions(moderator)
+	failIfError(t, err)
+	failIfFalseFmt(t, len(sessions) == 4 && sessions[0] == TypeSession{User: "boss", Role: RoleAdmin}, "unexpected sessions %+v", sessions)
+
+	failIfError(t, ForceLogout(admin, "mod2"))
+	_, err = Sessions(moderator)
+	failIfError(t, err)
+	failIfError(t, GrantRole(admin, "mod1", RolePlayer))
+	_, err = Sessions(moderator)
+	failIfFalseFmt(t, errors.Is(err, ErrPermissionDenied), "unexpected error %v", err)
+
+	failIfError(t, ForceLogout(admin, "player1"))
+	_, err = CurrentBoard(player)
+	failIfFalseFmt(t, errors.Is(err, ErrSessionNotFound), "unexpected error %v", err)
+}
+
+func TestBan(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	current := time.Now()
+	t.Cleanup(SetNow(func() time.Time { return current }))
+
+	moderator := loginAs(t, "mod1", RoleModerator)
+	tokenFirst, _ := startGame(t, "user1", "user2")
+
+	failIfError(t, Ban(moderator, "user1", "abuse", time.Hour))
+	winner, _, _, termination := LastHistoryRecord()
+	failIfFalseFmt(t, winner == "user2" && termination == TerminationForfeit, "unexpected history %q %q", winner, termination)
+	_, err := CurrentBoard(tokenFirst)
+	failIfFalseFmt(t, errors.Is(err, ErrSessionNotFound), "unexpected error %v", err)
+
+	_, err = Login("user1", testPassword)
+	failIfFalseFmt(t, errors.Is(err, ErrBanned), "unexpected error %v", err)
+	_, err = Login("user1", "wrong")
+	failIfFalseFmt(t, errors.Is(err, ErrWrongPassword), "ban is revealed without password: %v", err)
+
+	current = current.Add(time.Hour)
+	_, err = Login("user1", testPassword)
+	failIfError(t, err)
+
+	failIfError(t, Ban(moderator, "user1", "abuse", 0))
+	current = current.Add(24 * 365 * time.Hour)
+	_, err = Login("user1", testPassword)
+	failIfFalseFmt(t, errors.Is(err, ErrBanned), "unexpected error %v", err)
+
+	failIfError(t, Unban(moderator, "user1"))
+	_, err = Login("user1", testPassword)
+	failIfError(t, err)
+
+	err = Ban(moderator, "nobody", "", 0)
+	failIfFalseFmt(t, errors.Is(err, ErrUserNotFound), "unexpected error %v", err)
+}
+
+func TestAbortAndAdjudicate(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	moderator := loginAs(t, "mod1", RoleModerator)
+	tokenFirst, tokenSecond := startGame(t, "user1", "user2")
+	events, _, err := Subscribe(tokenFirst)
+	failIfError(t, err)
+
+	_, err = Adjudicate(moderator, "user1", "mod1")
+	failIfFalseFmt(t, err != nil, "expected error adjudicating to outsider")
+
+	msg, err := AbortGame(moderator, "user2")
+	failIfError(t, err)
+	failIfFalseFmt(t, msg == "aborted", "unexpected message %q", msg)
+	e := <-events
+	failIfFalseFmt(t, e.Kind == EventGameFinished && e.Termination == TerminationAborted, "unexpected event %+v", e)
+	_, err = CurrentBoard(tokenFirst)
+	failIfFalseFmt(t, errors.Is(err, ErrNotPlaying), "unexpected error %v", err)
+	_, err = AbortGame(moderator, "user2")
+	failIfFalseFmt(t, errors.Is(err, ErrNotPlaying), "unexpected error %v", err)
+
+	failIfError(t, RegisterSelfAsParticipant(tokenFirst, SignX))
+	failIfError(t, StartPlayingWithWaitingOpponent(tokenSecond, SignO, "user1"))
+	msg, err = Adjudicate(moderator, "user1", "user2")
+	failIfError(t, err)
+	failIfFalseFmt(t, msg == "user2 wins user1", "unexpected message %q", msg)
+	winner, _, _, termination := LastHistoryRecord()
+	failIfFalseFmt(t, winner == "user2" && termination == TerminationAdjudication, "unexpected history %q %q", winner, termination)
+
+	_, err = CurrentBoard(tokenSecond)
+	failIfFalseFmt(t, errors.Is(err, ErrNotPlaying), "unexpected error %v", err)
+}
+
+func TestAbortAndAdjudicateRanks(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	moderator := loginAs(t, "mod1", RoleModerator)
+	player := loginAs(t, "mod2", RoleModerator)
+	failIfError(t, RegisterSelfAsParticipant(player, SignX))
+	opponent := loginAs(t, "user1", RolePlayer)
+	failIfError(t, StartPlayingWithWaitingOpponent(opponent, SignO, "mod2"))
+
+	// moderators do not judge games of their peers
+	_, err := AbortGame(moderator, "user1")
+	failIfFalseFmt(t, errors.Is(err, ErrPermissionDenied), "unexpected error %v", err)
+	_, err = Adjudicate(moderator, "user1", "user1")
+	failIfFalseFmt(t, errors.Is(err, ErrPermissionDenied), "unexpected error %v", err)
+
+	// nor their own games
+	_, err = Adjudicate(player, "user1", "mod2")
+	failIfFalseFmt(t, errors.Is(err, ErrPermissionDenied), "unexpected error %v", err)
+	_, err = AbortGame(player, "mod2")
+	failIfFalseFmt(t, errors.Is(err, ErrPermissionDenied), "unexpected error %v", err)
+
+	_, err = CurrentBoard(opponent)
+	failIfError(t, err)
+}
+
+func TestPurgeWaiting(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	moderator := loginAs(t, "mod1", RoleModerator)
+	for _, user := range []string{"user1", "user2", "user3"} {
+		failIfError(t, RegisterSelfAsParticipant(loginAs(t, user, RolePlayer), SignX))
+	}
+
+	n, err := PurgeWaiting(moderator, "user1", "nobody")
+	failIfError(t, err)
+	failIfFalseFmt(t, n == 1 && len(SearchOpponents()) == 2, "unexpected purge of %d users", n)
+
+	n, err = PurgeWaiting(moderator)
+	failIfError(t, err)
+	failIfFalseFmt(t, n == 2 && len(SearchOpponents()) == 0, "unexpected purge of %d users", n)
+}
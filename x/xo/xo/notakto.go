@@ -0,0 +1,163 @@
+package xo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// notakto is played on boards 3×3 kept as layers of the position. Both sides
+// place x, a board with a line of three is dead and the side completing a
+// line on the last alive board loses, so there are no draws.
+type notakto struct {
+	name   string
+	boards int
+	lines  typeLines
+	// boardLines are lines of every board as indexes of the cells.
+	boardLines [][][]int
+}
+
+// constNotaktoBoardsMax limits the number of boards of notakto.
+const constNotaktoBoardsMax = 8
+
+var notaktoSingle = newNotakto(1)
+
+func newNotakto(boards int) *notakto {
+	name := "notakto"
+	if boards > 1 {
+		name = fmt.Sprintf("notakto-%d", boards)
+	}
+
+	pos := NewPosition3D(constBoardSizeMax, constBoardSizeMax, boards)
+
+	var lines [][]TypeCell
+	boardLines := make([][][]int, boards)
+	for _, line := range linesOf(constBoardSizeMax, constBoardSizeMax, 1, constBoardSizeMax) {
+		for z := range boardLines {
+			cells, indexes := make([]TypeCell, len(line)), make([]int, len(line))
+			for i, cell := range line {
+				cells[i] = TypeCell{x: cell.x, y: cell.y, z: z}
+				indexes[i] = pos.index(cells[i])
+			}
+
+			lines = append(lines, cells)
+			boardLines[z] = append(boardLines[z], indexes)
+		}
+	}
+
+	return &notakto{name: name, boards: boards, lines: newLines(pos, lines), boardLines: boardLines}
+}
+
+// Notakto is notakto on a single board.
+func Notakto() Rules { return notaktoSingle }
+
+// NotaktoBoards returns notakto on the number of boards, its name is
+// "notakto-N" and RulesByName accepts such names for up to 8 boards.
+func NotaktoBoards(boards int) (Rules, error) {
+	if boards < 1 || boards > constNotaktoBoardsMax {
+		return nil, fmt.Errorf("%w: notakto on %d boards", ErrUnknownVariant, boards)
+	} else if boards == 1 {
+		return notaktoSingle, nil
+	}
+
+	return newNotakto(boards), nil
+}
+
+func parseNotakto(name string) (Rules, bool) {
+	if !strings.HasPrefix(name, "notakto-") {
+		return nil, false
+	}
+
+	var boards int
+	if n, err := fmt.Sscanf(name, "notakto-%d", &boards); n != 1 || err != nil {
+		return nil, false
+	}
+
+	rules, err := NotaktoBoards(boards)
+	if err != nil || rules.Name() != name {
+		return nil, false
+	}
+
+	return rules, true
+}
+
+func (r *notakto) Name() string { return r.name }
+
+func (r *notakto) NewPosition() *TypePosition {
+	return NewPosition3D(constBoardSizeMax, constBoardSizeMax, r.boards)
+}
+
+// dead reports whether there is a line on board.
+func (r *notakto) dead(pos *TypePosition, board int) bool {
+	for _, line := range r.boardLines[board] {
+		full := true
+		for _, i := range line {
+			if pos.cells[i] == signNull {
+				full = false
+				break
+			}
+		}
+
+		if full {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *notakto) LegalMoves(pos *TypePosition) []TypeMove {
+	var moves []TypeMove
+	for board := 0; board < r.boards; board++ {
+		if r.dead(pos, board) {
+			continue
+		}
+
+		for y := 0; y < constBoardSizeMax; y++ {
+			for x := 0; x < constBoardSizeMax; x++ {
+				if cell := (TypeCell{x: x, y: y, z: board}); pos.At(cell) == signNull {
+					moves = append(moves, TypeMove{Cell: cell})
+				}
+			}
+		}
+	}
+
+	return moves
+}
+
+// ApplyMove places x whatever the sign of move is.
+func (r *notakto) ApplyMove(pos *TypePosition, move TypeMove) error {
+	if !pos.Contains(move.Cell) {
+		return fmt.Errorf("%w %s", ErrInvalidCell, move.Cell)
+	} else if curSign := pos.At(move.Cell); curSign != signNull {
+		return fmt.Errorf("%w: cell %s has already value %v, cannot overwrite it", ErrIllegalMove, move.Cell, curSign)
+	} else if r.dead(pos, move.Cell.z) {
+		return fmt.Errorf("%w: board %d is dead", ErrIllegalMove, move.Cell.z+1)
+	}
+
+	pos.Play(TypeMove{Cell: move.Cell, Sign: SignX})
+	return nil
+}
+
+func (r *notakto) Terminal(pos *TypePosition) bool {
+	if !r.lines.throughLastMove(pos) {
+		// boards die only by moves completing lines
+		return false
+	}
+
+	for board := 0; board < r.boards; board++ {
+		if !r.dead(pos, board) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Winner returns the side that has not completed the last line.
+func (r *notakto) Winner(pos *TypePosition) (int, bool) {
+	if !r.Terminal(pos) {
+		return 0, false
+	}
+
+	return pos.Side(), true
+}
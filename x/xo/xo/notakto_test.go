@@ -0,0 +1,76 @@
+package xo_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/ayzatziko/stuff/x/xo/xo"
+)
+
+func TestNotakto(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	rules, err := RulesByName("notakto-2")
+	failIfError(t, err)
+
+	tokenFirst, tokenSecond := startGameWithRules(t, "user1", "user2", rules)
+
+	// user2 kills the first board by the first column, user1 kills the
+	// second one and loses
+	moves := []struct {
+		token   string
+		x, y, z int
+	}{
+		{tokenFirst, 0, 0, 0}, {tokenSecond, 1, 0, 0},
+		{tokenFirst, 2, 2, 1}, {tokenSecond, 2, 0, 0},
+		{tokenFirst, 1, 1, 1},
+	}
+	for _, m := range moves {
+		cell, err := NewCell3D(m.x, m.y, m.z)
+		failIfError(t, err)
+
+		b, msg, err := MakeAMove(m.token, cell)
+		failIfError(t, err)
+		failIfFalseFmt(t, b == nil, "unexpected end of the game %q", msg)
+	}
+
+	board, err := CurrentBoard(tokenFirst)
+	failIfError(t, err)
+	for _, cell := range board.Position().Cells() {
+		sign := board.Cell(cell)
+		failIfFalseFmt(t, sign == "" || sign == SignX, "unexpected sign %q in %s", sign, cell)
+	}
+
+	dead, err := NewCell3D(1, 1, 0)
+	failIfError(t, err)
+	_, _, err = MakeAMove(tokenSecond, dead)
+	failIfFalseFmt(t, errors.Is(err, ErrIllegalMove), "expected move to the dead board to fail, got %v", err)
+
+	last, err := NewCell3D(0, 0, 1)
+	failIfError(t, err)
+	b, msg, err := MakeAMove(tokenSecond, last)
+	failIfError(t, err)
+	failIfFalseFmt(t, b != nil && msg == "user1 wins user2", "unexpected result %q", msg)
+	failIfFalseFmt(t, LastHistoryVariant() == "notakto-2", "unexpected variant %q", LastHistoryVariant())
+}
+
+func TestNotaktoHardBotFirstWins(t *testing.T) {
+	// the first player wins notakto on a single board by the center
+	for _, opponent := range []TypeBotLevel{BotLevelEasy, BotLevelMedium, BotLevelHard} {
+		for i := 0; i < 3; i++ {
+			if winner := playBotsWithRules(t, Notakto(), BotLevelHard, opponent); winner != "first" {
+				t.Fatalf("hard bot moving first did not win %s bot: %q", opponent, winner)
+			}
+		}
+	}
+}
+
+func TestNotaktoBoardsMax(t *testing.T) {
+	_, err := RulesByName("notakto-8")
+	failIfError(t, err)
+
+	for _, name := range []string{"notakto-0", "notakto-9", "notakto-200000"} {
+		_, err := RulesByName(name)
+		failIfFalseFmt(t, errors.Is(err, ErrUnknownVariant), "%s: unexpected error %v", name, err)
+	}
+}
@@ -0,0 +1,73 @@
+package xo_test
+
+import (
+	"testing"
+
+	. "github.com/ayzatziko/stuff/x/xo/xo"
+)
+
+func TestLinesCount(t *testing.T) {
+	for _, tt := range []struct {
+		width, height, depth, k int
+		lines                   int
+	}{
+		{3, 3, 1, 3, 8},
+		{4, 4, 4, 4, 76},
+		{3, 3, 3, 3, 49},
+		{7, 6, 1, 4, 69},
+	} {
+		if got := LinesCount(tt.width, tt.height, tt.depth, tt.k); got != tt.lines {
+			t.Errorf("%d×%d×%d, %d in a row: got %d lines, want %d", tt.width, tt.height, tt.depth, tt.k, got, tt.lines)
+		}
+	}
+}
+
+func TestQubicSpaceDiagonal(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	rules, err := RulesByName("qubic")
+	failIfError(t, err)
+
+	failIfError(t, RegisterUser("user1", testPassword))
+	tokenFirst, err := Login("user1", testPassword)
+	failIfError(t, err)
+	failIfError(t, RegisterSelfAsParticipantWithRules(tokenFirst, SignX, rules))
+
+	failIfError(t, RegisterUser("user2", testPassword))
+	tokenSecond, err := Login("user2", testPassword)
+	failIfError(t, err)
+	failIfError(t, StartPlayingWithWaitingOpponent(tokenSecond, SignO, "user1"))
+
+	board, err := CurrentBoard(tokenFirst)
+	failIfError(t, err)
+	failIfFalseFmt(t, board.Size() == 4 && board.Layers() == 4, "unexpected board %d×%d", board.Size(), board.Layers())
+
+	// x goes along the diagonal of the cube from the corner {0, 0, 0}, o
+	// plays the first layer
+	moves := []struct {
+		token   string
+		x, y, z int
+	}{
+		{tokenFirst, 0, 0, 0}, {tokenSecond, 0, 1, 0},
+		{tokenFirst, 1, 1, 1}, {tokenSecond, 0, 2, 0},
+		{tokenFirst, 2, 2, 2}, {tokenSecond, 0, 3, 0},
+		{tokenFirst, 3, 3, 3},
+	}
+	for i, m := range moves {
+		cell, err := NewCell3D(m.x, m.y, m.z)
+		failIfError(t, err)
+
+		b, msg, err := MakeAMove(m.token, cell)
+		failIfError(t, err)
+
+		if i < len(moves)-1 {
+			failIfFalseFmt(t, b == nil, "unexpected end of the game %q", msg)
+			continue
+		}
+
+		failIfFalseFmt(t, msg == "user1 wins user2", "unexpected result %q", msg)
+		failIfFalseFmt(t, b.Cell(cell) == SignX, "expected x in %s", cell)
+	}
+
+	failIfFalseFmt(t, LastHistoryVariant() == "qubic", "unexpected variant %q", LastHistoryVariant())
+}
@@ -0,0 +1,234 @@
+package xo
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ayzatziko/stuff/xerrors"
+)
+
+// A private room waits for an opponent like the lobby, but it is hidden
+// from SearchOpponents and joined only with its code.
+
+const (
+	// constRoomTTL is the time a room waits for an opponent.
+	constRoomTTL = 10 * time.Minute
+	// constRoomCodeLength is the length of codes from constRoomCodeAlphabet,
+	// which has no look-alike characters like 0 and O.
+	constRoomCodeLength   = 6
+	constRoomCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	// constRoomMissRate is the number of wrong codes a user may try within
+	// constRoomMissWindow, codes are not guessed by brute force.
+	constRoomMissRate   = 5
+	constRoomMissWindow = time.Minute
+)
+
+type typeRoom struct {
+	typeWaitingOpponent
+	expiresAt time.Time
+}
+
+// rooms by codes, codes of rooms by hosts and times of wrong codes by users
+// are guarded by lobbyMu.
+var (
+	rooms      = map[string]typeRoom{}
+	hosts      = map[TypeUser]string{}
+	roomMisses = map[TypeUser][]time.Time{}
+)
+
+func CreateRoom(sessionToken string, sign TypeSign, rules Rules) (string, error) {
+	return CreateRoomContext(context.Background(), sessionToken, sign, rules)
+}
+
+// CreateRoomContext opens a private room where the session user waits for
+// an opponent to play the variant defined by rules, and returns its join
+// code. The room is closed when nobody joins it in 10 minutes.
+func CreateRoomContext(ctx context.Context, sessionToken string, sign TypeSign, rules Rules) (_ string, err error) {
+	user, err := userOf(ctx, sessionToken)
+	if err != nil {
+		return "", err
+	}
+
+	defer xerrors.Wrap(&err, "CreateRoom(%s, %s)", user, sign)
+
+	if rules == nil {
+		return "", fmt.Errorf("no rules")
+	}
+
+	userSign, err := newUserSign(user, sign)
+	if err != nil {
+		return "", err
+	}
+
+	if err := lobbyMu.LockContext(ctx); err != nil {
+		return "", err
+	}
+	defer lobbyMu.Unlock()
+
+	expireRoomsLocked()
+
+	states, unlock := lockUsers(user)
+	defer unlock()
+
+	if st := states[0]; st == nil || st.token != sessionToken {
+		return "", ErrSessionNotFound
+	} else if st.game != nil {
+		return "", fmt.Errorf("already playing with %s", opponentOf(st.game.board, user))
+	} else if st.watching != nil {
+		return "", errWatching(st.watching)
+	} else if _, ok := waitingOpponents[string(user)]; ok {
+		return "", fmt.Errorf("waiting for an opponent")
+	} else {
+		st.last = nil
+	}
+
+	code, err := newRoomCodeLocked()
+	if err != nil {
+		return "", err
+	}
+
+	// a new room of the host replaces the previous one
+	leaveLobbyLocked(user)
+	rooms[code] = typeRoom{typeWaitingOpponent{userSign, rules}, now().Add(constRoomTTL)}
+	hosts[user] = code
+
+	return code, nil
+}
+
+// newRoomCodeLocked returns a random code of no room.
+func newRoomCodeLocked() (string, error) {
+	for {
+		b := make([]byte, constRoomCodeLength)
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+
+		for i := range b {
+			b[i] = constRoomCodeAlphabet[int(b[i])%len(constRoomCodeAlphabet)]
+		}
+
+		if code := string(b); !hasKey(rooms, code) {
+			return code, nil
+		}
+	}
+}
+
+// expireRoomsLocked closes the rooms nobody joined in time.
+func expireRoomsLocked() {
+	t := now()
+	for code, room := range rooms {
+		if !t.Before(room.expiresAt) {
+			delete(rooms, code)
+			delete(hosts, room.user)
+		}
+	}
+}
+
+func JoinRoom(sessionToken, code string, sign TypeSign) error {
+	return JoinRoomContext(context.Background(), sessionToken, code, sign)
+}
+
+// JoinRoomContext starts the game with the host of the room, who moves
+// first. Codes are case insensitive, a user tries at most 5 wrong codes a
+// minute.
+func JoinRoomContext(ctx context.Context, sessionToken, code string, sign TypeSign) (err error) {
+	user, err := userOf(ctx, sessionToken)
+	if err != nil {
+		return err
+	}
+
+	code = strings.ToUpper(strings.TrimSpace(code))
+	defer xerrors.Wrap(&err, "JoinRoom(%s, %s, %s)", user, code, sign)
+
+	if err := lobbyMu.LockContext(ctx); err != nil {
+		return err
+	}
+	defer lobbyMu.Unlock()
+
+	expireRoomsLocked()
+
+	// the attempt counts only when the code is wrong
+	misses, retry := throttle(roomMisses[user], now(), constRoomMissRate, constRoomMissWindow)
+	if retry > 0 {
+		roomMisses[user] = misses
+		return fmt.Errorf("%w: retry in %s", ErrRoomThrottled, retry)
+	}
+
+	room, ok := rooms[code]
+	if !ok {
+		roomMisses[user] = misses
+		return fmt.Errorf("%w: %s", ErrRoomNotFound, code)
+	} else if room.user == user {
+		return fmt.Errorf("cannot join own room")
+	}
+
+	// blocked users cannot play each other
+	if err := socialMu.RLockContext(ctx); err != nil {
+		return err
+	}
+	blocked := blockedLocked(user, room.user)
+	socialMu.RUnlock()
+	if blocked {
+		roomMisses[user] = misses
+		return fmt.Errorf("%w: %s", ErrRoomNotFound, code)
+	}
+
+	return startGameLocked(user, sessionToken, sign, room.typeWaitingOpponent)
+}
+
+func CloseRoom(sessionToken string) error {
+	return CloseRoomContext(context.Background(), sessionToken)
+}
+
+// CloseRoomContext closes the room of the session user.
+func CloseRoomContext(ctx context.Context, sessionToken string) (err error) {
+	user, err := userOf(ctx, sessionToken)
+	if err != nil {
+		return err
+	}
+
+	defer xerrors.Wrap(&err, "CloseRoom(%s)", user)
+
+	if err := lobbyMu.LockContext(ctx); err != nil {
+		return err
+	}
+	defer lobbyMu.Unlock()
+
+	expireRoomsLocked()
+
+	if _, ok := hosts[user]; !ok {
+		return fmt.Errorf("%w: no room of %s", ErrRoomNotFound, user)
+	}
+	leaveLobbyLocked(user)
+
+	return nil
+}
+
+// waitingLocked reports whether user waits for an opponent in the lobby or
+// in a room, the caller holds lobbyMu.
+func waitingLocked(user TypeUser) bool {
+	if _, ok := waitingOpponents[string(user)]; ok {
+		return true
+	}
+
+	code, ok := hosts[user]
+	return ok && now().Before(rooms[code].expiresAt)
+}
+
+// leaveLobbyLocked removes user from the waiting opponents and closes the
+// room of user, it reports whether user was waiting. The caller holds
+// lobbyMu.
+func leaveLobbyLocked(user TypeUser) bool {
+	waiting := waitingLocked(user)
+
+	delete(waitingOpponents, string(user))
+	if code, ok := hosts[user]; ok {
+		delete(rooms, code)
+		delete(hosts, user)
+	}
+
+	return waiting
+}
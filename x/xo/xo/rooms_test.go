@@ -0,0 +1,108 @@
+package xo_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/ayzatziko/stuff/x/xo/xo"
+)
+
+func TestRooms(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	tokenFirst := loginAs(t, "user1", RolePlayer)
+	tokenSecond := loginAs(t, "user2", RolePlayer)
+	tokenThird := loginAs(t, "user3", RolePlayer)
+
+	code, err := CreateRoom(tokenFirst, SignX, Classic())
+	failIfError(t, err)
+	failIfFalseFmt(t, len(code) == 6 && strings.ToUpper(code) == code, "unexpected code %q", code)
+
+	failIfFalseFmt(t, len(SearchOpponents()) == 0, "room is in the lobby %v", SearchOpponents())
+	presence, err := Presence(tokenSecond, "user1")
+	failIfError(t, err)
+	failIfFalseFmt(t, presence == PresenceInLobby, "unexpected presence %s", presence)
+
+	failIfFalseFmt(t, RegisterSelfAsParticipant(tokenFirst, SignX) != nil, "expected error waiting in the lobby with a room")
+	failIfFalseFmt(t, JoinRoom(tokenFirst, code, SignO) != nil, "expected error joining own room")
+	err = JoinRoom(tokenSecond, "NOSUCH", SignO)
+	failIfFalseFmt(t, errors.Is(err, ErrRoomNotFound), "unexpected error %v", err)
+
+	// blocked users cannot join
+	failIfError(t, Block(tokenFirst, "user3"))
+	err = JoinRoom(tokenThird, code, SignO)
+	failIfFalseFmt(t, errors.Is(err, ErrRoomNotFound), "unexpected error %v", err)
+
+	failIfError(t, JoinRoom(tokenSecond, strings.ToLower(code), SignO))
+	board, err := CurrentBoard(tokenSecond)
+	failIfError(t, err)
+	failIfFalseFmt(t, board.Turn().User() == "user1", "unexpected board %v", board)
+
+	err = JoinRoom(tokenThird, code, SignO)
+	failIfFalseFmt(t, errors.Is(err, ErrRoomNotFound), "unexpected error joining a started room %v", err)
+}
+
+func TestRoomExpires(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	current := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t.Cleanup(SetNow(func() time.Time { return current }))
+
+	tokenFirst := loginAs(t, "user1", RolePlayer)
+	tokenSecond := loginAs(t, "user2", RolePlayer)
+
+	code, err := CreateRoom(tokenFirst, SignX, Classic())
+	failIfError(t, err)
+
+	current = current.Add(10 * time.Minute)
+	presence, err := Presence(tokenSecond, "user1")
+	failIfError(t, err)
+	failIfFalseFmt(t, presence == PresenceOnline, "unexpected presence %s", presence)
+
+	err = JoinRoom(tokenSecond, code, SignO)
+	failIfFalseFmt(t, errors.Is(err, ErrRoomNotFound), "unexpected error %v", err)
+	err = CloseRoom(tokenFirst)
+	failIfFalseFmt(t, errors.Is(err, ErrRoomNotFound), "unexpected error %v", err)
+
+	// closing a room and logging out
+	code, err = CreateRoom(tokenFirst, SignX, Classic())
+	failIfError(t, err)
+	failIfError(t, CloseRoom(tokenFirst))
+	failIfFalseFmt(t, JoinRoom(tokenSecond, code, SignO) != nil, "expected error joining a closed room")
+
+	code, err = CreateRoom(tokenFirst, SignX, Classic())
+	failIfError(t, err)
+	failIfError(t, Logout(tokenFirst))
+	failIfFalseFmt(t, JoinRoom(tokenSecond, code, SignO) != nil, "expected error joining a room of a logged out user")
+
+	// an expired room does not keep the host out of the lobby
+	_, err = CreateRoom(tokenSecond, SignX, Classic())
+	failIfError(t, err)
+	current = current.Add(10 * time.Minute)
+	failIfError(t, RegisterSelfAsParticipant(tokenSecond, SignX))
+}
+
+func TestRoomThrottled(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	current := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t.Cleanup(SetNow(func() time.Time { return current }))
+
+	tokenFirst := loginAs(t, "user1", RolePlayer)
+	tokenSecond := loginAs(t, "user2", RolePlayer)
+
+	code, err := CreateRoom(tokenFirst, SignX, Classic())
+	failIfError(t, err)
+
+	for i := 0; i < 5; i++ {
+		err = JoinRoom(tokenSecond, "NOSUCH", SignO)
+		failIfFalseFmt(t, errors.Is(err, ErrRoomNotFound), "unexpected error %v", err)
+	}
+	err = JoinRoom(tokenSecond, code, SignO)
+	failIfFalseFmt(t, errors.Is(err, ErrRoomThrottled), "unexpected error %v", err)
+
+	current = current.Add(time.Minute)
+	failIfError(t, JoinRoom(tokenSecond, code, SignO))
+}
@@ -0,0 +1,381 @@
+package xo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Rules define a variant of the game. Rules keep no state, the state of a
+// game is kept by TypePosition, so a single Rules value serves any number of
+// games.
+type Rules interface {
+	// Name identifies the variant in the lobby and in the history.
+	Name() string
+	NewPosition() *TypePosition
+	LegalMoves(pos *TypePosition) []TypeMove
+	// ApplyMove validates move and plays it on pos. Sign of move is the sign
+	// of the mover.
+	ApplyMove(pos *TypePosition, move TypeMove) error
+	Terminal(pos *TypePosition) bool
+	// Winner returns the side that has won the finished game, side 0 makes
+	// the first move. Draws and unfinished games have no winner.
+	Winner(pos *TypePosition) (side int, ok bool)
+}
+
+type TypeMove struct {
+	Cell TypeCell
+	Sign TypeSign
+}
+
+func (m TypeMove) String() string { return fmt.Sprintf("%s@%s", m.Sign, m.Cell) }
+
+// TypePosition is a grid of signs of width columns, height rows and depth
+// layers with the moves played on it.
+type TypePosition struct {
+	width, height, depth int
+
+	cells []TypeSign
+	moves []TypeMove
+}
+
+// NewPosition returns a flat position of a single layer.
+func NewPosition(width, height int) *TypePosition { return NewPosition3D(width, height, 1) }
+
+func NewPosition3D(width, height, depth int) *TypePosition {
+	return &TypePosition{
+		width:  width,
+		height: height,
+		depth:  depth,
+		cells:  make([]TypeSign, width*height*depth),
+	}
+}
+
+func (pos *TypePosition) Size() (width, height, depth int) { return pos.width, pos.height, pos.depth }
+
+func (pos *TypePosition) Contains(cell TypeCell) bool {
+	return cell.x >= 0 && cell.x < pos.width && cell.y >= 0 && cell.y < pos.height && cell.z >= 0 && cell.z < pos.depth
+}
+
+func (pos *TypePosition) index(cell TypeCell) int {
+	return (cell.z*pos.height+cell.y)*pos.width + cell.x
+}
+
+// At returns the sign in cell, empty for free and outer cells.
+func (pos *TypePosition) At(cell TypeCell) TypeSign {
+	if !pos.Contains(cell) {
+		return signNull
+	}
+
+	return pos.cells[pos.index(cell)]
+}
+
+// Play puts the sign of move to its cell and records the move, the caller
+// validates the move.
+func (pos *TypePosition) Play(move TypeMove) {
+	pos.cells[pos.index(move.Cell)] = move.Sign
+	pos.moves = append(pos.moves, move)
+}
+
+func (pos *TypePosition) Moves() []TypeMove { return append([]TypeMove(nil), pos.moves...) }
+
+// LastMove returns the last played move.
+func (pos *TypePosition) LastMove() (TypeMove, bool) {
+	if len(pos.moves) == 0 {
+		return TypeMove{}, false
+	}
+
+	return pos.moves[len(pos.moves)-1], true
+}
+
+// Side returns the side to move, 0 makes the first move.
+func (pos *TypePosition) Side() int { return len(pos.moves) % constUsersNum }
+
+// Cells returns all cells of the grid.
+func (pos *TypePosition) Cells() []TypeCell {
+	cells := make([]TypeCell, 0, len(pos.cells))
+	for z := 0; z < pos.depth; z++ {
+		for y := 0; y < pos.height; y++ {
+			for x := 0; x < pos.width; x++ {
+				cells = append(cells, TypeCell{x: x, y: y, z: z})
+			}
+		}
+	}
+
+	return cells
+}
+
+func (pos *TypePosition) Clone() *TypePosition {
+	clone := *pos
+	clone.cells = append([]TypeSign(nil), pos.cells...)
+	clone.moves = append([]TypeMove(nil), pos.moves...)
+
+	return &clone
+}
+
+// Key identifies the position for memoization: the signs, the side to move
+// and the last move, that some variants depend on.
+func (pos *TypePosition) Key() string {
+	var b strings.Builder
+	for _, sign := range pos.cells {
+		if sign == signNull {
+			b.WriteByte('.')
+		} else {
+			b.WriteString(string(sign))
+		}
+	}
+
+	fmt.Fprintf(&b, "|%d", pos.Side())
+	if last, ok := pos.LastMove(); ok {
+		fmt.Fprintf(&b, "|%d", pos.index(last.Cell))
+	}
+
+	return b.String()
+}
+
+// kInARow is won by the first who places k signs in a row in any direction.
+type kInARow struct {
+	name                    string
+	width, height, depth, k int
+	lines                   typeLines
+	lineCells               [][]TypeCell
+}
+
+func newKInARow(name string, width, height, depth, k int) *kInARow {
+	lines := linesOf(width, height, depth, k)
+
+	return &kInARow{
+		name:      name,
+		width:     width,
+		height:    height,
+		depth:     depth,
+		k:         k,
+		lines:     newLines(NewPosition3D(width, height, depth), lines),
+		lineCells: lines,
+	}
+}
+
+var (
+	classic = newKInARow("classic", constBoardSizeMax, constBoardSizeMax, 1, constBoardSizeMax)
+	qubic   = newKInARow("qubic", 4, 4, 4, 4)
+	qubic3  = newKInARow("qubic-3", 3, 3, 3, 3)
+)
+
+// Classic is tic-tac-toe on 3×3 board.
+func Classic() Rules { return classic }
+
+func (r *kInARow) Name() string { return r.name }
+
+// Qubic is three-dimensional tic-tac-toe on 4×4×4 board, won by four in a
+// row along any of 76 lines including the diagonals of the cube.
+func Qubic() Rules { return qubic }
+
+// Qubic3 is three-dimensional tic-tac-toe on 3×3×3 board.
+func Qubic3() Rules { return qubic3 }
+
+func (r *kInARow) NewPosition() *TypePosition { return NewPosition3D(r.width, r.height, r.depth) }
+
+func (r *kInARow) LegalMoves(pos *TypePosition) []TypeMove {
+	if r.Terminal(pos) {
+		return nil
+	}
+
+	var moves []TypeMove
+	for _, cell := range pos.Cells() {
+		if pos.At(cell) == signNull {
+			moves = append(moves, TypeMove{Cell: cell})
+		}
+	}
+
+	return moves
+}
+
+func (r *kInARow) ApplyMove(pos *TypePosition, move TypeMove) error {
+	if !pos.Contains(move.Cell) {
+		return fmt.Errorf("%w %s", ErrInvalidCell, move.Cell)
+	} else if curSign := pos.At(move.Cell); curSign != signNull {
+		return fmt.Errorf("%w: cell %s has already value %v, cannot overwrite it", ErrIllegalMove, move.Cell, curSign)
+	} else if r.Terminal(pos) {
+		return fmt.Errorf("%w: game is finished", ErrIllegalMove)
+	}
+
+	pos.Play(move)
+	return nil
+}
+
+func (r *kInARow) Terminal(pos *TypePosition) bool {
+	return len(pos.moves) == len(pos.cells) || r.lines.throughLastMove(pos)
+}
+
+func (r *kInARow) Winner(pos *TypePosition) (int, bool) {
+	if !r.lines.throughLastMove(pos) {
+		return 0, false
+	}
+
+	// the line is completed by the last move
+	return (len(pos.moves) - 1) % constUsersNum, true
+}
+
+// typeLines are lines of a grid as indexes of the cells, grouped by the
+// cells they go through.
+type typeLines [][][]int
+
+func newLines(pos *TypePosition, lines [][]TypeCell) typeLines {
+	through := make(typeLines, len(pos.cells))
+	for _, line := range lines {
+		indexes := make([]int, len(line))
+		for i, cell := range line {
+			indexes[i] = pos.index(cell)
+		}
+
+		for _, i := range indexes {
+			through[i] = append(through[i], indexes)
+		}
+	}
+
+	return through
+}
+
+// throughLastMove reports whether there is a line of equal signs going
+// through the cell of the last move.
+func (lines typeLines) throughLastMove(pos *TypePosition) bool {
+	last, ok := pos.LastMove()
+	if !ok {
+		return false
+	}
+
+	for _, line := range lines[pos.index(last.Cell)] {
+		full := true
+		for _, i := range line {
+			if pos.cells[i] != last.Sign {
+				full = false
+				break
+			}
+		}
+
+		if full {
+			return true
+		}
+	}
+
+	return false
+}
+
+// linesOf returns all lines of k cells in a row of the grid in every
+// direction: along the axes, along the diagonals of the planes and along the
+// diagonals of the space.
+func linesOf(width, height, depth, k int) [][]TypeCell {
+	var lines [][]TypeCell
+	for _, d := range directions3D() {
+		dx, dy, dz := d[0], d[1], d[2]
+		for z := 0; z < depth; z++ {
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					endX, endY, endZ := x+dx*(k-1), y+dy*(k-1), z+dz*(k-1)
+					if endX < 0 || endX >= width || endY < 0 || endY >= height || endZ < 0 || endZ >= depth {
+						continue
+					}
+
+					line := make([]TypeCell, k)
+					for i := range line {
+						line[i] = TypeCell{x: x + dx*i, y: y + dy*i, z: z + dz*i}
+					}
+					lines = append(lines, line)
+				}
+			}
+		}
+	}
+
+	return lines
+}
+
+// directions3D returns 13 directions of lines, the opposite directions give
+// the same lines.
+func directions3D() [][3]int {
+	var directions [][3]int
+	for dz := -1; dz <= 1; dz++ {
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				// the first non-zero component is positive
+				if dz > 0 || dz == 0 && (dy > 0 || dy == 0 && dx > 0) {
+					directions = append(directions, [3]int{dx, dy, dz})
+				}
+			}
+		}
+	}
+
+	return directions
+}
+
+var (
+	variantsMu sync.RWMutex
+	variants   = map[string]Rules{}
+)
+
+func init() {
+	RegisterRules(Classic())
+	RegisterRules(Ultimate())
+	RegisterRules(Qubic())
+	RegisterRules(Qubic3())
+	RegisterRules(ConnectFour())
+	RegisterRules(Misere(Classic()))
+	RegisterRules(Wild())
+	RegisterRules(Notakto())
+}
+
+// RegisterRules makes rules selectable by name, the last registration of a
+// name wins.
+func RegisterRules(rules Rules) {
+	variantsMu.Lock()
+	defer variantsMu.Unlock()
+
+	variants[rules.Name()] = rules
+}
+
+// registered reports whether rules are registered under their name, caches
+// of parametrized variants would grow with every name.
+func registered(rules Rules) bool {
+	variantsMu.RLock()
+	defer variantsMu.RUnlock()
+
+	_, ok := variants[rules.Name()]
+	return ok
+}
+
+// RulesByName returns registered rules or rules of a parametrized variant
+// like "gravity-8x7-4", "notakto-3" or "misere-qubic".
+func RulesByName(name string) (Rules, error) {
+	variantsMu.RLock()
+	defer variantsMu.RUnlock()
+
+	return rulesByNameLocked(name)
+}
+
+func rulesByNameLocked(name string) (Rules, error) {
+	if rules, ok := variants[name]; ok {
+		return rules, nil
+	} else if rules, ok := parseGravity(name); ok {
+		return rules, nil
+	} else if rules, ok := parseNotakto(name); ok {
+		return rules, nil
+	} else if rules, ok := parseMisereLocked(name); ok {
+		return rules, nil
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnknownVariant, name)
+}
+
+// Variants returns sorted names of registered rules.
+func Variants() []string {
+	variantsMu.RLock()
+	defer variantsMu.RUnlock()
+
+	names := make([]string, 0, len(variants))
+	for name := range variants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,120 @@
+package xo_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/ayzatziko/stuff/x/xo/xo"
+)
+
+// lastCellWins is played on a single row, the one who takes the last cell
+// wins.
+type lastCellWins struct{ cells int }
+
+func (r lastCellWins) Name() string { return "last-cell-wins" }
+
+func (r lastCellWins) NewPosition() *TypePosition { return NewPosition(r.cells, 1) }
+
+func (r lastCellWins) LegalMoves(pos *TypePosition) []TypeMove {
+	var moves []TypeMove
+	for _, cell := range pos.Cells() {
+		if pos.At(cell) == "" {
+			moves = append(moves, TypeMove{Cell: cell})
+		}
+	}
+
+	return moves
+}
+
+func (r lastCellWins) ApplyMove(pos *TypePosition, move TypeMove) error {
+	if !pos.Contains(move.Cell) || pos.At(move.Cell) != "" {
+		return ErrIllegalMove
+	}
+
+	pos.Play(move)
+	return nil
+}
+
+func (r lastCellWins) Terminal(pos *TypePosition) bool { return len(pos.Moves()) == r.cells }
+
+func (r lastCellWins) Winner(pos *TypePosition) (int, bool) {
+	if !r.Terminal(pos) {
+		return 0, false
+	}
+
+	return (r.cells - 1) % 2, true
+}
+
+func TestCustomRules(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	rules := lastCellWins{cells: 3}
+	RegisterRules(rules)
+
+	got, err := RulesByName("last-cell-wins")
+	failIfError(t, err)
+	failIfFalseFmt(t, got == Rules(rules), "unexpected rules %v", got)
+
+	_, err = RulesByName("no-such-variant")
+	failIfFalseFmt(t, errors.Is(err, ErrUnknownVariant), "unexpected error %v", err)
+
+	failIfError(t, RegisterUser("user1", testPassword))
+	tokenFirst, err := Login("user1", testPassword)
+	failIfError(t, err)
+	failIfError(t, RegisterSelfAsParticipantWithRules(tokenFirst, SignX, rules))
+
+	opponents := SearchOpponents()
+	failIfFalseFmt(t, len(opponents) == 1 && opponents[0].Rules().Name() == "last-cell-wins", "unexpected opponents %v", opponents)
+
+	failIfError(t, RegisterUser("user2", testPassword))
+	tokenSecond, err := Login("user2", testPassword)
+	failIfError(t, err)
+	failIfError(t, StartPlayingWithWaitingOpponent(tokenSecond, SignO, "user1"))
+
+	for i, token := range []string{tokenFirst, tokenSecond, tokenFirst} {
+		cell, err := NewCell(0, i)
+		failIfError(t, err)
+
+		b, msg, err := MakeAMove(token, cell)
+		failIfError(t, err)
+
+		if i < 2 {
+			failIfFalseFmt(t, b == nil, "unexpected end of the game %q", msg)
+			continue
+		}
+
+		failIfFalseFmt(t, msg == "user1 wins user2", "unexpected result %q", msg)
+	}
+
+	cell, err := NewCell(3, 3)
+	failIfError(t, err)
+	_, _, err = MakeAMove(tokenFirst, cell)
+	failIfFalseFmt(t, err != nil, "expected error moving after the game")
+}
+
+func TestClassicRules(t *testing.T) {
+	rules := Classic()
+	pos := rules.NewPosition()
+	failIfFalseFmt(t, len(rules.LegalMoves(pos)) == 9, "expected 9 legal moves")
+
+	cell, err := NewCell(3, 0)
+	failIfError(t, err)
+	err = rules.ApplyMove(pos, TypeMove{Cell: cell, Sign: SignX})
+	failIfFalseFmt(t, errors.Is(err, ErrInvalidCell), "unexpected error %v", err)
+
+	// x takes the anti-diagonal
+	for _, m := range []struct {
+		x, y int
+		sign TypeSign
+	}{{0, 2, SignX}, {0, 0, SignO}, {1, 1, SignX}, {0, 1, SignO}, {2, 0, SignX}} {
+		failIfFalseFmt(t, !rules.Terminal(pos), "unexpected end of the game")
+
+		cell, err := NewCell(m.x, m.y)
+		failIfError(t, err)
+		failIfError(t, rules.ApplyMove(pos, TypeMove{Cell: cell, Sign: m.sign}))
+	}
+
+	side, ok := rules.Winner(pos)
+	failIfFalseFmt(t, rules.Terminal(pos) && ok && side == 0, "expected the first side has won")
+	failIfFalseFmt(t, len(rules.LegalMoves(pos)) == 0, "expected no legal moves after the game")
+}
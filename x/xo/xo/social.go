@@ -0,0 +1,369 @@
+package xo
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/ayzatziko/stuff/xerrors"
+)
+
+// TypePresence is derived from the session and the games of a user.
+type TypePresence string
+
+const (
+	PresenceOffline TypePresence = "offline"
+	PresenceOnline  TypePresence = "online"
+	PresenceInLobby TypePresence = "lobby"
+	PresenceInGame  TypePresence = "game"
+)
+
+// typeRelations are the friends, friend requests and blocks of a user, a
+// relation is kept by both users.
+type typeRelations struct {
+	friends map[TypeUser]struct{}
+	// incoming are requests to the user, outgoing are requests of the user.
+	incoming, outgoing map[TypeUser]struct{}
+	blocked, blockedBy map[TypeUser]struct{}
+}
+
+// relations are guarded by socialMu.
+var (
+	socialMu  typeMutex
+	relations = map[TypeUser]*typeRelations{}
+)
+
+func relationsOfLocked(user TypeUser) *typeRelations {
+	r := relations[user]
+	if r == nil {
+		r = &typeRelations{
+			friends:   map[TypeUser]struct{}{},
+			incoming:  map[TypeUser]struct{}{},
+			outgoing:  map[TypeUser]struct{}{},
+			blocked:   map[TypeUser]struct{}{},
+			blockedBy: map[TypeUser]struct{}{},
+		}
+		relations[user] = r
+	}
+
+	return r
+}
+
+// blockedLocked reports whether either user blocked the other, the caller
+// holds socialMu.
+func blockedLocked(user, other TypeUser) bool {
+	r, ok := relations[user]
+	return ok && (hasKey(r.blocked, other) || hasKey(r.blockedBy, other))
+}
+
+// unfriendLocked removes the friendship and requests between the users.
+func unfriendLocked(user, other TypeUser) {
+	r, o := relationsOfLocked(user), relationsOfLocked(other)
+	delete(r.friends, other)
+	delete(o.friends, user)
+	delete(r.incoming, other)
+	delete(o.outgoing, user)
+	delete(r.outgoing, other)
+	delete(o.incoming, user)
+}
+
+// forgetRelationsLocked removes the deleted user from relations of others,
+// the caller holds socialMu.
+func forgetRelationsLocked(user TypeUser) {
+	r, ok := relations[user]
+	if !ok {
+		return
+	}
+
+	for _, others := range []map[TypeUser]struct{}{r.friends, r.incoming, r.outgoing, r.blocked, r.blockedBy} {
+		for other := range others {
+			unfriendLocked(user, other)
+			delete(relations[other].blocked, user)
+			delete(relations[other].blockedBy, user)
+		}
+	}
+	delete(relations, user)
+}
+
+// socialOp checks the session and the other user of a relation and calls f
+// holding socialMu.
+func socialOp(ctx context.Context, op, sessionToken string, other TypeUser, f func(user TypeUser) error) (err error) {
+	user, err := userOf(ctx, sessionToken)
+	if err != nil {
+		return err
+	}
+
+	defer xerrors.Wrap(&err, "%s(%s, %s)", op, user, other)
+
+	if other == user {
+		return fmt.Errorf("the user is self")
+	}
+
+	if err := accountsMu.RLockContext(ctx); err != nil {
+		return err
+	}
+	defer accountsMu.RUnlock()
+
+	if _, ok := registeredUser[string(other)]; !ok {
+		return fmt.Errorf("%w: %q", ErrUserNotFound, other)
+	}
+
+	if err := socialMu.LockContext(ctx); err != nil {
+		return err
+	}
+	defer socialMu.Unlock()
+
+	return f(user)
+}
+
+func RequestFriend(sessionToken string, other TypeUser) error {
+	return RequestFriendContext(context.Background(), sessionToken, other)
+}
+
+// RequestFriendContext asks other for friendship, a request to a user who
+// has asked the session user accepts it.
+func RequestFriendContext(ctx context.Context, sessionToken string, other TypeUser) error {
+	return socialOp(ctx, "RequestFriend", sessionToken, other, func(user TypeUser) error {
+		r := relationsOfLocked(user)
+		if hasKey(r.friends, other) {
+			return fmt.Errorf("already friends")
+		} else if blockedLocked(user, other) {
+			return fmt.Errorf("blocked")
+		} else if hasKey(r.incoming, other) {
+			return befriendLocked(user, other)
+		}
+
+		r.outgoing[other] = struct{}{}
+		relationsOfLocked(other).incoming[user] = struct{}{}
+
+		return nil
+	})
+}
+
+func AcceptFriend(sessionToken string, other TypeUser) error {
+	return AcceptFriendContext(context.Background(), sessionToken, other)
+}
+
+// AcceptFriendContext accepts the friend request of other.
+func AcceptFriendContext(ctx context.Context, sessionToken string, other TypeUser) error {
+	return socialOp(ctx, "AcceptFriend", sessionToken, other, func(user TypeUser) error {
+		if !hasKey(relationsOfLocked(user).incoming, other) {
+			return fmt.Errorf("no friend request from %s", other)
+		}
+
+		return befriendLocked(user, other)
+	})
+}
+
+func befriendLocked(user, other TypeUser) error {
+	unfriendLocked(user, other)
+	relationsOfLocked(user).friends[other] = struct{}{}
+	relationsOfLocked(other).friends[user] = struct{}{}
+
+	return nil
+}
+
+func RemoveFriend(sessionToken string, other TypeUser) error {
+	return RemoveFriendContext(context.Background(), sessionToken, other)
+}
+
+// RemoveFriendContext ends the friendship with other, or declines or
+// withdraws a friend request.
+func RemoveFriendContext(ctx context.Context, sessionToken string, other TypeUser) error {
+	return socialOp(ctx, "RemoveFriend", sessionToken, other, func(user TypeUser) error {
+		r := relationsOfLocked(user)
+		if !hasKey(r.friends, other) && !hasKey(r.incoming, other) && !hasKey(r.outgoing, other) {
+			return fmt.Errorf("not friends with %s", other)
+		}
+
+		unfriendLocked(user, other)
+		return nil
+	})
+}
+
+func Block(sessionToken string, other TypeUser) error {
+	return BlockContext(context.Background(), sessionToken, other)
+}
+
+// BlockContext ends the friendship with other, and hides the session user
+// from other in the lobby and from challenges of other until unblocked.
+func BlockContext(ctx context.Context, sessionToken string, other TypeUser) error {
+	return socialOp(ctx, "Block", sessionToken, other, func(user TypeUser) error {
+		unfriendLocked(user, other)
+		relationsOfLocked(user).blocked[other] = struct{}{}
+		relationsOfLocked(other).blockedBy[user] = struct{}{}
+
+		return nil
+	})
+}
+
+func Unblock(sessionToken string, other TypeUser) error {
+	return UnblockContext(context.Background(), sessionToken, other)
+}
+
+func UnblockContext(ctx context.Context, sessionToken string, other TypeUser) error {
+	return socialOp(ctx, "Unblock", sessionToken, other, func(user TypeUser) error {
+		if !hasKey(relationsOfLocked(user).blocked, other) {
+			return fmt.Errorf("%s is not blocked", other)
+		}
+
+		delete(relations[user].blocked, other)
+		delete(relations[other].blockedBy, user)
+
+		return nil
+	})
+}
+
+type TypeFriend struct {
+	User     TypeUser
+	Presence TypePresence
+}
+
+type TypeFriends struct {
+	Friends []TypeFriend
+	// Incoming are friend requests to the user, Outgoing are requests of
+	// the user.
+	Incoming, Outgoing []TypeUser
+	Blocked            []TypeUser
+}
+
+func Friends(sessionToken string) (TypeFriends, error) {
+	return FriendsContext(context.Background(), sessionToken)
+}
+
+// FriendsContext returns the friends of the session user with their
+// presence, friend requests and blocked users, sorted by user.
+func FriendsContext(ctx context.Context, sessionToken string) (_ TypeFriends, err error) {
+	user, err := userOf(ctx, sessionToken)
+	if err != nil {
+		return TypeFriends{}, err
+	}
+
+	defer xerrors.Wrap(&err, "Friends(%s)", user)
+
+	if err := lobbyMu.LockContext(ctx); err != nil {
+		return TypeFriends{}, err
+	}
+	defer lobbyMu.Unlock()
+
+	if err := socialMu.RLockContext(ctx); err != nil {
+		return TypeFriends{}, err
+	}
+	defer socialMu.RUnlock()
+
+	friends := TypeFriends{Friends: []TypeFriend{}, Incoming: []TypeUser{}, Outgoing: []TypeUser{}, Blocked: []TypeUser{}}
+	r, ok := relations[user]
+	if !ok {
+		return friends, nil
+	}
+
+	for _, friend := range sortedUsers(r.friends) {
+		friends.Friends = append(friends.Friends, TypeFriend{friend, presenceLocked(friend)})
+	}
+	friends.Incoming = sortedUsers(r.incoming)
+	friends.Outgoing = sortedUsers(r.outgoing)
+	friends.Blocked = sortedUsers(r.blocked)
+
+	return friends, nil
+}
+
+func sortedUsers(set map[TypeUser]struct{}) []TypeUser {
+	users := make([]TypeUser, 0, len(set))
+	for user := range set {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i] < users[j] })
+
+	return users
+}
+
+func Presence(sessionToken string, user TypeUser) (TypePresence, error) {
+	return PresenceContext(context.Background(), sessionToken, user)
+}
+
+// PresenceContext returns the presence of the user to the session user,
+// users blocking or blocked by the session user are offline to it.
+func PresenceContext(ctx context.Context, sessionToken string, user TypeUser) (_ TypePresence, err error) {
+	viewer, err := userOf(ctx, sessionToken)
+	if err != nil {
+		return "", err
+	}
+
+	defer xerrors.Wrap(&err, "Presence(%s, %s)", viewer, user)
+
+	if err := accountsMu.RLockContext(ctx); err != nil {
+		return "", err
+	}
+	defer accountsMu.RUnlock()
+
+	if _, ok := registeredUser[string(user)]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrUserNotFound, user)
+	}
+
+	if err := lobbyMu.LockContext(ctx); err != nil {
+		return "", err
+	}
+	defer lobbyMu.Unlock()
+
+	if err := socialMu.RLockContext(ctx); err != nil {
+		return "", err
+	}
+	defer socialMu.RUnlock()
+
+	if blockedLocked(viewer, user) {
+		return PresenceOffline, nil
+	}
+
+	return presenceLocked(user), nil
+}
+
+// presenceLocked returns the presence of user, the caller holds lobbyMu.
+func presenceLocked(user TypeUser) TypePresence {
+	shard := userShardOf(user)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if st, ok := shard.users[user]; !ok || st.token == "" {
+		return PresenceOffline
+	} else if st.game != nil {
+		return PresenceInGame
+	} else if waitingLocked(user) {
+		return PresenceInLobby
+	}
+
+	return PresenceOnline
+}
+
+func SearchOpponentsFor(sessionToken string) ([]typeWaitingOpponent, error) {
+	return SearchOpponentsForContext(context.Background(), sessionToken)
+}
+
+// SearchOpponentsForContext returns the waiting opponents of the session
+// user, except for users blocking or blocked by the user.
+func SearchOpponentsForContext(ctx context.Context, sessionToken string) (_ []typeWaitingOpponent, err error) {
+	user, err := userOf(ctx, sessionToken)
+	if err != nil {
+		return nil, err
+	}
+
+	defer xerrors.Wrap(&err, "SearchOpponents(%s)", user)
+
+	if err := lobbyMu.LockContext(ctx); err != nil {
+		return nil, err
+	}
+	defer lobbyMu.Unlock()
+
+	if err := socialMu.RLockContext(ctx); err != nil {
+		return nil, err
+	}
+	defer socialMu.RUnlock()
+
+	opponents := make([]typeWaitingOpponent, 0, len(waitingOpponents))
+	for _, opponent := range waitingOpponents {
+		if !blockedLocked(user, opponent.user) {
+			opponents = append(opponents, opponent)
+		}
+	}
+
+	return opponents, nil
+}
@@ -0,0 +1,147 @@
+package xo_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/ayzatziko/stuff/x/xo/xo"
+)
+
+func TestFriends(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	tokenFirst := loginAs(t, "user1", RolePlayer)
+	tokenSecond := loginAs(t, "user2", RolePlayer)
+	tokenThird := loginAs(t, "user3", RolePlayer)
+
+	failIfError(t, RequestFriend(tokenFirst, "user2"))
+	failIfError(t, RequestFriend(tokenFirst, "user3"))
+	failIfFalseFmt(t, RequestFriend(tokenFirst, "user1") != nil, "expected error befriending self")
+	err := RequestFriend(tokenFirst, "nobody")
+	failIfFalseFmt(t, errors.Is(err, ErrUserNotFound), "unexpected error %v", err)
+
+	friends, err := Friends(tokenSecond)
+	failIfError(t, err)
+	failIfFalseFmt(t, equalUsers(friends.Incoming, "user1") && len(friends.Friends) == 0, "unexpected friends %+v", friends)
+
+	failIfError(t, AcceptFriend(tokenSecond, "user1"))
+	failIfFalseFmt(t, AcceptFriend(tokenSecond, "user1") != nil, "expected error accepting twice")
+	// a request to a user who asked first accepts it
+	failIfError(t, RequestFriend(tokenThird, "user1"))
+
+	friends, err = Friends(tokenFirst)
+	failIfError(t, err)
+	failIfFalseFmt(t, len(friends.Friends) == 2 && len(friends.Outgoing) == 0, "unexpected friends %+v", friends)
+	failIfFalseFmt(t, friends.Friends[0] == TypeFriend{User: "user2", Presence: PresenceOnline}, "unexpected friend %+v", friends.Friends[0])
+
+	failIfError(t, RemoveFriend(tokenSecond, "user1"))
+	failIfFalseFmt(t, RemoveFriend(tokenSecond, "user1") != nil, "expected error removing twice")
+	friends, err = Friends(tokenFirst)
+	failIfError(t, err)
+	failIfFalseFmt(t, len(friends.Friends) == 1 && friends.Friends[0].User == "user3", "unexpected friends %+v", friends)
+
+	// declining a request
+	failIfError(t, RequestFriend(tokenSecond, "user3"))
+	failIfError(t, RemoveFriend(tokenThird, "user2"))
+	friends, err = Friends(tokenSecond)
+	failIfError(t, err)
+	failIfFalseFmt(t, len(friends.Outgoing) == 0, "unexpected friends %+v", friends)
+
+	// deleted users leave friends lists
+	failIfError(t, DeleteAccount(tokenThird, testPassword))
+	friends, err = Friends(tokenFirst)
+	failIfError(t, err)
+	failIfFalseFmt(t, len(friends.Friends) == 0, "unexpected friends %+v", friends)
+}
+
+func TestBlock(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	tokenFirst := loginAs(t, "user1", RolePlayer)
+	tokenSecond := loginAs(t, "user2", RolePlayer)
+	tokenThird := loginAs(t, "user3", RolePlayer)
+
+	failIfError(t, RequestFriend(tokenFirst, "user2"))
+	failIfError(t, AcceptFriend(tokenSecond, "user1"))
+	failIfError(t, Block(tokenFirst, "user2"))
+	failIfFalseFmt(t, RequestFriend(tokenSecond, "user1") != nil, "expected error befriending a blocking user")
+
+	friends, err := Friends(tokenFirst)
+	failIfError(t, err)
+	failIfFalseFmt(t, len(friends.Friends) == 0 && equalUsers(friends.Blocked, "user2"), "unexpected friends %+v", friends)
+
+	failIfError(t, RegisterSelfAsParticipant(tokenFirst, SignX))
+
+	waitingUsers := func(token string) []TypeUser {
+		t.Helper()
+
+		opponents, err := SearchOpponentsFor(token)
+		failIfError(t, err)
+
+		var users []TypeUser
+		for _, o := range opponents {
+			users = append(users, o.User())
+		}
+		return users
+	}
+	failIfFalseFmt(t, len(waitingUsers(tokenSecond)) == 0, "blocked user sees the blocking one")
+	failIfFalseFmt(t, equalUsers(waitingUsers(tokenThird), "user1"), "unexpected lobby of user3")
+
+	err = StartPlayingWithWaitingOpponent(tokenSecond, SignO, "user1")
+	failIfFalseFmt(t, errors.Is(err, ErrOpponentNotFound), "unexpected error %v", err)
+
+	// blocking works both ways
+	failIfError(t, RegisterSelfAsParticipant(tokenSecond, SignX))
+	failIfFalseFmt(t, len(waitingUsers(tokenThird)) == 2, "unexpected lobby of user3")
+	err = StartPlayingWithWaitingOpponent(tokenFirst, SignO, "user2")
+	failIfFalseFmt(t, errors.Is(err, ErrOpponentNotFound), "unexpected error %v", err)
+
+	failIfError(t, Unblock(tokenFirst, "user2"))
+	failIfFalseFmt(t, Unblock(tokenFirst, "user2") != nil, "expected error unblocking twice")
+	failIfError(t, StartPlayingWithWaitingOpponent(tokenSecond, SignO, "user1"))
+}
+
+func TestPresence(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	viewer := loginAs(t, "user3", RolePlayer)
+	presence := func(user TypeUser) TypePresence {
+		t.Helper()
+
+		p, err := Presence(viewer, user)
+		failIfError(t, err)
+		return p
+	}
+
+	failIfError(t, RegisterUser("user1", testPassword))
+	failIfFalseFmt(t, presence("user1") == PresenceOffline, "unexpected presence %s", presence("user1"))
+
+	token, err := Login("user1", testPassword)
+	failIfError(t, err)
+	failIfFalseFmt(t, presence("user1") == PresenceOnline, "unexpected presence %s", presence("user1"))
+
+	failIfError(t, RegisterSelfAsParticipant(token, SignX))
+	failIfFalseFmt(t, presence("user1") == PresenceInLobby, "unexpected presence %s", presence("user1"))
+
+	failIfError(t, RegisterUser("user2", testPassword))
+	tokenSecond, err := Login("user2", testPassword)
+	failIfError(t, err)
+	failIfError(t, StartPlayingWithWaitingOpponent(tokenSecond, SignO, "user1"))
+	failIfFalseFmt(t, presence("user1") == PresenceInGame, "unexpected presence %s", presence("user1"))
+
+	failIfError(t, Logout(token))
+	failIfFalseFmt(t, presence("user1") == PresenceOffline, "unexpected presence %s", presence("user1"))
+	failIfFalseFmt(t, presence("user2") == PresenceOnline, "unexpected presence %s", presence("user2"))
+
+	// presence is hidden from blocked users both ways
+	failIfError(t, Block(tokenSecond, "user3"))
+	failIfFalseFmt(t, presence("user2") == PresenceOffline, "unexpected presence %s", presence("user2"))
+	failIfError(t, Unblock(tokenSecond, "user3"))
+	failIfError(t, Block(viewer, "user2"))
+	failIfFalseFmt(t, presence("user2") == PresenceOffline, "unexpected presence %s", presence("user2"))
+
+	_, err = Presence(viewer, "nobody")
+	failIfFalseFmt(t, errors.Is(err, ErrUserNotFound), "unexpected error %v", err)
+	_, err = Presence("no such session", "user2")
+	failIfFalseFmt(t, errors.Is(err, ErrSessionNotFound), "unexpected error %v", err)
+}
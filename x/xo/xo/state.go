@@ -0,0 +1,414 @@
+package xo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// The state is split between locks, so games and sessions of different
+// users do not wait for each other. A lock is never taken while a lock
+// later in this order is held:
+//
+//	accountsMu    registered users, failed logins and policies
+//	lobbyMu       waiting opponents and rooms
+//	socialMu      friends and blocks
+//	typeGame.mu   a game, at most one at a time
+//	userShards    sessions, games and subscriptions of users, in the order
+//	              of shards
+//	tokenShards   users of session tokens
+//	historyMu     history of games, leaderboards and profiles
+//	auditMu       queue of audit records, the sink is called without locks
+var (
+	accountsMu typeMutex
+	lobbyMu    typeMutex
+	historyMu  typeMutex
+)
+
+// typeGame is a game owned by its lock, done is set when the game is over
+// and the participants and spectators are freed.
+type typeGame struct {
+	mu    typeMutex
+	board *TypeBoard
+	done  bool
+
+	spectators map[TypeUser]struct{}
+	chat       []TypeChatMessage
+	// chatSent is the times of recent messages of users, for rate limiting.
+	chatSent map[TypeUser][]time.Time
+	// muted is the users muted by a user.
+	muted map[TypeUser]map[TypeUser]struct{}
+}
+
+// constShards is the number of shards of sessions, a power of two.
+const constShards = 64
+
+// typeUserState is the session of a user, token is empty between the end of
+// the session and the forfeit of its game.
+type typeUserState struct {
+	token    string
+	game     *typeGame
+	watching *typeGame
+	// last is the finished game of user until user waits for a new one.
+	last *typeGame
+	subs map[*typeSubscription]struct{}
+	// changed is closed when the session or the games of user change.
+	changed chan struct{}
+}
+
+// notifyLocked wakes the waiters for changes of the state.
+func (st *typeUserState) notifyLocked() {
+	close(st.changed)
+	st.changed = make(chan struct{})
+}
+
+type typeUserShard struct {
+	mu    typeMutex
+	users map[TypeUser]*typeUserState
+}
+
+type typeTokenShard struct {
+	mu     typeMutex
+	tokens map[string]TypeUser
+}
+
+var (
+	userShards  [constShards]typeUserShard
+	tokenShards [constShards]typeTokenShard
+
+	// runningGames is the number of games not done.
+	runningGames atomic.Int64
+)
+
+func init() {
+	for i := range userShards {
+		userShards[i].users = map[TypeUser]*typeUserState{}
+		tokenShards[i].tokens = map[string]TypeUser{}
+	}
+}
+
+// shardOf returns the shard index of key by FNV-1a.
+func shardOf(key string) int {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+
+	return int(h & (constShards - 1))
+}
+
+func userShardOf(user TypeUser) *typeUserShard { return &userShards[shardOf(string(user))] }
+
+func tokenShardOf(token string) *typeTokenShard { return &tokenShards[shardOf(token)] }
+
+// pruneLocked forgets the state of user when it has no session, games and
+// subscriptions.
+func (shard *typeUserShard) pruneLocked(user TypeUser, st *typeUserState) {
+	if st.token == "" && st.game == nil && st.watching == nil && len(st.subs) == 0 {
+		delete(shard.users, user)
+	}
+}
+
+// lockUsers locks the shards of users in the order of shards and returns
+// their states, missing states are nil.
+func lockUsers(users ...TypeUser) (states []*typeUserState, unlock func()) {
+	var locked [constShards]bool
+	for _, user := range users {
+		locked[shardOf(string(user))] = true
+	}
+
+	for i := range locked {
+		if locked[i] {
+			userShards[i].mu.Lock()
+		}
+	}
+
+	states = make([]*typeUserState, len(users))
+	for i, user := range users {
+		states[i] = userShardOf(user).users[user]
+	}
+
+	return states, func() {
+		for i := len(locked) - 1; i >= 0; i-- {
+			if locked[i] {
+				userShards[i].mu.Unlock()
+			}
+		}
+	}
+}
+
+// constTokenBytes is the number of random bytes of a session token.
+const constTokenBytes = 16
+
+// newToken returns a random session token, tokens authorize moderation, so
+// they must not be guessed.
+func newToken() (string, error) {
+	b := make([]byte, constTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// userOf returns the user of the session.
+func userOf(ctx context.Context, sessionToken string) (TypeUser, error) {
+	shard := tokenShardOf(sessionToken)
+	if err := shard.mu.RLockContext(ctx); err != nil {
+		return "", err
+	}
+	defer shard.mu.RUnlock()
+
+	user, ok := shard.tokens[sessionToken]
+	if !ok {
+		return "", ErrSessionNotFound
+	}
+
+	return user, nil
+}
+
+// tokenOf returns the session token of user.
+func tokenOf(user TypeUser) (string, bool) {
+	shard := userShardOf(user)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if st, ok := shard.users[user]; ok && st.token != "" {
+		return st.token, true
+	}
+
+	return "", false
+}
+
+// gameOf returns the game of user, nil if user is not playing. With
+// watching it returns the game watched by user when user is not playing.
+func gameOf(user TypeUser, watching bool) *typeGame {
+	shard := userShardOf(user)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if st, ok := shard.users[user]; !ok {
+		return nil
+	} else if st.game == nil && watching {
+		return st.watching
+	} else {
+		return st.game
+	}
+}
+
+// lockGameOf locks and returns the running game of user, the caller unlocks
+// it.
+func lockGameOf(ctx context.Context, user TypeUser) (*typeGame, error) {
+	return lockRunningGame(ctx, user, false)
+}
+
+// lockViewedGameOf locks and returns the running game user is playing or
+// watching, the caller unlocks it.
+func lockViewedGameOf(ctx context.Context, user TypeUser) (*typeGame, error) {
+	return lockRunningGame(ctx, user, true)
+}
+
+func lockRunningGame(ctx context.Context, user TypeUser, watching bool) (*typeGame, error) {
+	for {
+		game := gameOf(user, watching)
+		if game == nil {
+			return nil, fmt.Errorf("user %s is %w", user, ErrNotPlaying)
+		}
+
+		if err := game.mu.LockContext(ctx); err != nil {
+			return nil, err
+		}
+		if !game.done {
+			return game, nil
+		}
+		// the game is over, user may be in a new one
+		game.mu.Unlock()
+	}
+}
+
+// lockSessionGame locks and returns the running game of the session user,
+// the caller unlocks it.
+func lockSessionGame(ctx context.Context, sessionToken string) (TypeUser, *typeGame, error) {
+	user, err := userOf(ctx, sessionToken)
+	if err != nil {
+		return "", nil, err
+	}
+
+	game, err := lockGameOf(ctx, user)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return user, game, nil
+}
+
+// startSession makes sessionToken the session of user ending the previous
+// one, the caller holds accountsMu.
+func startSession(ctx context.Context, user TypeUser, sessionToken string) {
+	if existingToken, ok := tokenOf(user); ok {
+		audit(ctx, user, AuditSessionTakeover, "", "")
+		endSession(ctx, user, existingToken, "")
+	}
+
+	tokens := tokenShardOf(sessionToken)
+	tokens.mu.Lock()
+	tokens.tokens[sessionToken] = user
+	tokens.mu.Unlock()
+
+	shard := userShardOf(user)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	st, ok := shard.users[user]
+	if !ok {
+		st = &typeUserState{subs: map[*typeSubscription]struct{}{}, changed: make(chan struct{})}
+		shard.users[user] = st
+	}
+	st.token, st.last = sessionToken, nil
+}
+
+// rotateSession replaces sessionToken of user by a new token keeping the
+// session, the old token stops working.
+func rotateSession(user TypeUser, sessionToken string) (string, error) {
+	newSessionToken, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	shard := userShardOf(user)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	st, ok := shard.users[user]
+	if !ok || st.token != sessionToken {
+		return "", ErrSessionNotFound
+	}
+	st.token = newSessionToken
+	for sub := range st.subs {
+		if sub.token == sessionToken {
+			sub.token = newSessionToken
+		}
+	}
+	st.notifyLocked()
+
+	tokens := tokenShardOf(sessionToken)
+	tokens.mu.Lock()
+	delete(tokens.tokens, sessionToken)
+	tokens.mu.Unlock()
+
+	tokens = tokenShardOf(newSessionToken)
+	tokens.mu.Lock()
+	tokens.tokens[newSessionToken] = user
+	tokens.mu.Unlock()
+
+	return newSessionToken, nil
+}
+
+// endSession ends the session of user unless it has ended already, the
+// opponent immediately wins the game of user. The action is audited after
+// the session is ended by this call, unless it is empty. Once the session
+// is ended, ctx is not waited for.
+func endSession(ctx context.Context, user TypeUser, sessionToken string, action string) bool {
+	shard := userShardOf(user)
+	shard.mu.Lock()
+	st, ok := shard.users[user]
+	if !ok || st.token != sessionToken {
+		shard.mu.Unlock()
+		return false
+	}
+	st.token = ""
+	st.notifyLocked()
+	shard.mu.Unlock()
+
+	tokens := tokenShardOf(sessionToken)
+	tokens.mu.Lock()
+	delete(tokens.tokens, sessionToken)
+	tokens.mu.Unlock()
+
+	if action != "" {
+		audit(ctx, user, action, "", "")
+	}
+
+	forfeit(detach(ctx), user)
+	if game := gameOf(user, true); game != nil {
+		game.mu.Lock()
+		unwatchLocked(game, user)
+		game.mu.Unlock()
+	}
+
+	// subscriptions are closed after the forfeit delivers the end of the game
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if st, ok := shard.users[user]; ok {
+		closeSubscriptionsLocked(st, sessionToken)
+		shard.pruneLocked(user, st)
+	}
+
+	return true
+}
+
+func cleanDatabase() {
+	accountsMu.Lock()
+	defer accountsMu.Unlock()
+	lobbyMu.Lock()
+	defer lobbyMu.Unlock()
+
+	dropLocked(registeredUser)
+	dropLocked(foldedUsernames)
+	dropLocked(userAttempts)
+	dropLocked(addressAttempts)
+	dropLocked(waitingOpponents)
+	dropLocked(rooms)
+	dropLocked(hosts)
+	dropLocked(roomMisses)
+
+	socialMu.Lock()
+	dropLocked(relations)
+	socialMu.Unlock()
+
+	for i := range userShards {
+		shard := &userShards[i]
+		shard.mu.Lock()
+		for user, st := range shard.users {
+			for sub := range st.subs {
+				unsubscribeLocked(st, sub)
+			}
+			delete(shard.users, user)
+		}
+		shard.mu.Unlock()
+	}
+	for i := range tokenShards {
+		shard := &tokenShards[i]
+		shard.mu.Lock()
+		dropLocked(shard.tokens)
+		shard.mu.Unlock()
+	}
+	runningGames.Store(0)
+
+	historyMu.Lock()
+	playsHistory = playsHistory[:0]
+	dropLocked(leaderboards)
+	dropLocked(players)
+	historyMu.Unlock()
+
+	auditMu.Lock()
+	auditSink, auditLast, auditQueue, auditErr, auditDropped = &MemoryAuditSink{}, TypeAuditRecord{}, nil, nil, 0
+	close(auditChanged)
+	auditChanged = make(chan struct{})
+	auditMu.Unlock()
+
+	analysesMu.Lock()
+	dropLocked(analysesRequested)
+	analysesMu.Unlock()
+}
+
+func dropLocked[K comparable, V any](m map[K]V) {
+	for k := range m {
+		delete(m, k)
+	}
+}
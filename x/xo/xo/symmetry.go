@@ -0,0 +1,78 @@
+package xo
+
+// typeSymmetry maps a cell of a layer of width×height to the cell it takes
+// under a rotation or a reflection of the layer, layers stay in place.
+type typeSymmetry func(cell TypeCell, width, height int) TypeCell
+
+var (
+	symmetryIdentity = func(c TypeCell, w, h int) TypeCell { return c }
+	symmetryFlipX    = func(c TypeCell, w, h int) TypeCell { return TypeCell{x: w - 1 - c.x, y: c.y, z: c.z} }
+	symmetryFlipY    = func(c TypeCell, w, h int) TypeCell { return TypeCell{x: c.x, y: h - 1 - c.y, z: c.z} }
+	symmetryRotate   = func(c TypeCell, w, h int) TypeCell { return TypeCell{x: w - 1 - c.x, y: h - 1 - c.y, z: c.z} }
+
+	// the rest keep only square layers in place
+	symmetryTranspose     = func(c TypeCell, w, h int) TypeCell { return TypeCell{x: c.y, y: c.x, z: c.z} }
+	symmetryAntiTranspose = func(c TypeCell, w, h int) TypeCell { return TypeCell{x: h - 1 - c.y, y: w - 1 - c.x, z: c.z} }
+	symmetryRotateLeft    = func(c TypeCell, w, h int) TypeCell { return TypeCell{x: c.y, y: w - 1 - c.x, z: c.z} }
+	symmetryRotateRight   = func(c TypeCell, w, h int) TypeCell { return TypeCell{x: h - 1 - c.y, y: c.x, z: c.z} }
+)
+
+var (
+	// squareSymmetries are the 8 symmetries of a square.
+	squareSymmetries = []typeSymmetry{
+		symmetryIdentity, symmetryFlipX, symmetryFlipY, symmetryRotate,
+		symmetryTranspose, symmetryAntiTranspose, symmetryRotateLeft, symmetryRotateRight,
+	}
+	rectangleSymmetries = []typeSymmetry{symmetryIdentity, symmetryFlipX, symmetryFlipY, symmetryRotate}
+	mirrorSymmetries    = []typeSymmetry{symmetryIdentity, symmetryFlipX}
+)
+
+// typeSymmetric is implemented by rules that do not change under the
+// symmetries, the solver takes symmetric positions as one.
+type typeSymmetric interface {
+	symmetries() []typeSymmetry
+}
+
+// symmetriesOf returns the symmetries of rules, rules that do not declare
+// them have the identity only.
+func symmetriesOf(rules Rules) []typeSymmetry {
+	if symmetric, ok := rules.(typeSymmetric); ok {
+		return symmetric.symmetries()
+	}
+
+	return []typeSymmetry{symmetryIdentity}
+}
+
+// typeMemoryless is implemented by rules whose positions depend only on the
+// signs and the side to move, not on the order of the moves.
+type typeMemoryless interface {
+	memoryless() bool
+}
+
+func memoryless(rules Rules) bool {
+	m, ok := rules.(typeMemoryless)
+	return ok && m.memoryless()
+}
+
+func (r *kInARow) symmetries() []typeSymmetry {
+	if r.width == r.height {
+		return squareSymmetries
+	}
+
+	return rectangleSymmetries
+}
+
+// memoryless is true as a line ends the game at once, so it is always
+// completed by the last move.
+func (r *kInARow) memoryless() bool { return true }
+
+// symmetries of gravity keep the bottom in place.
+func (r gravity) symmetries() []typeSymmetry { return mirrorSymmetries }
+
+func (ultimate) symmetries() []typeSymmetry { return squareSymmetries }
+
+func (r *notakto) symmetries() []typeSymmetry { return squareSymmetries }
+func (r *notakto) memoryless() bool           { return true }
+
+func (r misere) symmetries() []typeSymmetry { return symmetriesOf(r.Rules) }
+func (r misere) memoryless() bool           { return memoryless(r.Rules) }
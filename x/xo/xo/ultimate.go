@@ -0,0 +1,185 @@
+package xo
+
+import "fmt"
+
+// ultimateSize is the number of rows and columns of sub-boards and of cells
+// in a sub-board.
+const ultimateSize = constBoardSizeMax
+
+// Ultimate is played on nine 3×3 sub-boards arranged in 3×3. The cell of a
+// move within its sub-board dictates the sub-board of the next move. A
+// sub-board is completed when it is won or full, no moves are allowed there
+// and a player sent to a completed sub-board moves on any open one. The game
+// is won by three won sub-boards in a row.
+//
+// Cells are addressed on the whole 9×9 grid, see NewUltimateCell.
+func Ultimate() Rules { return ultimate{} }
+
+type ultimate struct{}
+
+// NewUltimateCell returns the cell of the 9×9 grid located at cell of
+// sub-board, both are coordinates of a 3×3 board.
+func NewUltimateCell(subBoard, cell TypeCell) (TypeCell, error) {
+	if subBoard.x >= ultimateSize || subBoard.y >= ultimateSize || cell.x >= ultimateSize || cell.y >= ultimateSize {
+		return TypeCell{}, fmt.Errorf("%w: sub-board %s, cell %s", ErrInvalidCell, subBoard, cell)
+	}
+
+	return TypeCell{x: subBoard.x*ultimateSize + cell.x, y: subBoard.y*ultimateSize + cell.y}, nil
+}
+
+// SplitUltimateCell returns the sub-board of the cell of 9×9 grid and the
+// cell within the sub-board.
+func SplitUltimateCell(cell TypeCell) (subBoard, subCell TypeCell) {
+	return TypeCell{x: cell.x / ultimateSize, y: cell.y / ultimateSize},
+		TypeCell{x: cell.x % ultimateSize, y: cell.y % ultimateSize}
+}
+
+func (ultimate) Name() string { return "ultimate" }
+
+func (ultimate) NewPosition() *TypePosition {
+	return NewPosition(ultimateSize*ultimateSize, ultimateSize*ultimateSize)
+}
+
+// typeUltimateState is the state of sub-boards indexed as the cells of the
+// 3×3 board.
+type typeUltimateState struct {
+	winners   [ultimateSize * ultimateSize]TypeSign
+	completed [ultimateSize * ultimateSize]bool
+}
+
+func ultimateStateOf(pos *TypePosition) typeUltimateState {
+	var state typeUltimateState
+	for i := range state.winners {
+		sub := TypeCell{x: i % ultimateSize, y: i / ultimateSize}
+		state.winners[i] = subBoardWinner(pos, sub)
+
+		full := true
+		for y := 0; y < ultimateSize; y++ {
+			for x := 0; x < ultimateSize; x++ {
+				c, _ := NewUltimateCell(sub, TypeCell{x: x, y: y})
+				full = full && pos.At(c) != signNull
+			}
+		}
+		state.completed[i] = full || state.winners[i] != signNull
+	}
+
+	return state
+}
+
+func subBoardWinner(pos *TypePosition, subBoard TypeCell) TypeSign {
+	for _, line := range classic.lineCells {
+		var signs [ultimateSize]TypeSign
+		for i, cell := range line {
+			c, _ := NewUltimateCell(subBoard, cell)
+			signs[i] = pos.At(c)
+		}
+
+		if signs[0] != signNull && signs[0] == signs[1] && signs[1] == signs[2] {
+			return signs[0]
+		}
+	}
+
+	return signNull
+}
+
+// winner returns the sign having three won sub-boards in a row.
+func (state *typeUltimateState) winner() TypeSign {
+	for _, line := range classic.lineCells {
+		first := state.winners[line[0].y*ultimateSize+line[0].x]
+		won := first != signNull
+		for _, cell := range line[1:] {
+			won = won && state.winners[cell.y*ultimateSize+cell.x] == first
+		}
+
+		if won {
+			return first
+		}
+	}
+
+	return signNull
+}
+
+func (state *typeUltimateState) terminal() bool {
+	if state.winner() != signNull {
+		return true
+	}
+
+	for _, completed := range state.completed {
+		if !completed {
+			return false
+		}
+	}
+
+	return true
+}
+
+// allowed reports whether the next move may be played on sub-board i.
+func (state *typeUltimateState) allowed(pos *TypePosition, i int) bool {
+	if state.completed[i] {
+		return false
+	}
+
+	last, ok := pos.LastMove()
+	if !ok {
+		return true
+	}
+
+	_, target := SplitUltimateCell(last.Cell)
+	targetIndex := target.y*ultimateSize + target.x
+
+	return targetIndex == i || state.completed[targetIndex]
+}
+
+func (ultimate) LegalMoves(pos *TypePosition) []TypeMove {
+	state := ultimateStateOf(pos)
+	if state.terminal() {
+		return nil
+	}
+
+	var moves []TypeMove
+	for _, cell := range pos.Cells() {
+		sub, _ := SplitUltimateCell(cell)
+		if pos.At(cell) == signNull && state.allowed(pos, sub.y*ultimateSize+sub.x) {
+			moves = append(moves, TypeMove{Cell: cell})
+		}
+	}
+
+	return moves
+}
+
+func (ultimate) ApplyMove(pos *TypePosition, move TypeMove) error {
+	state := ultimateStateOf(pos)
+	sub, _ := SplitUltimateCell(move.Cell)
+
+	if !pos.Contains(move.Cell) {
+		return fmt.Errorf("%w %s", ErrInvalidCell, move.Cell)
+	} else if curSign := pos.At(move.Cell); curSign != signNull {
+		return fmt.Errorf("%w: cell %s has already value %v, cannot overwrite it", ErrIllegalMove, move.Cell, curSign)
+	} else if state.terminal() {
+		return fmt.Errorf("%w: game is finished", ErrIllegalMove)
+	} else if i := sub.y*ultimateSize + sub.x; state.completed[i] {
+		return fmt.Errorf("%w: sub-board %s is completed", ErrIllegalMove, sub)
+	} else if !state.allowed(pos, i) {
+		last, _ := pos.LastMove()
+		_, target := SplitUltimateCell(last.Cell)
+		return fmt.Errorf("%w: move must be on sub-board %s", ErrIllegalMove, target)
+	}
+
+	pos.Play(move)
+	return nil
+}
+
+func (ultimate) Terminal(pos *TypePosition) bool {
+	state := ultimateStateOf(pos)
+	return state.terminal()
+}
+
+func (ultimate) Winner(pos *TypePosition) (int, bool) {
+	state := ultimateStateOf(pos)
+	if state.winner() == signNull {
+		return 0, false
+	}
+
+	// the line is completed by the last move
+	return (len(pos.moves) - 1) % constUsersNum, true
+}
@@ -0,0 +1,123 @@
+package xo_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/ayzatziko/stuff/x/xo/xo"
+)
+
+func TestUltimateSendsToSubBoard(t *testing.T) {
+	rules := Ultimate()
+	pos := rules.NewPosition()
+	failIfFalseFmt(t, len(rules.LegalMoves(pos)) == 81, "expected any cell for the first move")
+
+	// x plays the center cell of the top left sub-board, o is sent to the
+	// center sub-board
+	playUltimate(t, rules, pos, SignX, 0, 0, 1, 1)
+	failIfFalseFmt(t, len(rules.LegalMoves(pos)) == 9, "expected moves on one sub-board, got %d", len(rules.LegalMoves(pos)))
+
+	cell := ultimateCell(t, 0, 0, 0, 0)
+	err := rules.ApplyMove(pos, TypeMove{Cell: cell, Sign: SignO})
+	failIfFalseFmt(t, errors.Is(err, ErrIllegalMove), "expected illegal move to other sub-board, got %v", err)
+
+	for _, m := range rules.LegalMoves(pos) {
+		sub, _ := SplitUltimateCell(m.Cell)
+		failIfFalseFmt(t, sub.Row() == 1 && sub.Col() == 1, "unexpected legal move %s", m.Cell)
+	}
+}
+
+func TestUltimateCompletedSubBoard(t *testing.T) {
+	rules := Ultimate()
+	pos := rules.NewPosition()
+
+	// x wins the top left sub-board by its middle column, o sends x there
+	playUltimate(t, rules, pos, SignX, 0, 0, 1, 1)
+	playUltimate(t, rules, pos, SignO, 1, 1, 0, 0)
+	playUltimate(t, rules, pos, SignX, 0, 0, 0, 1)
+	playUltimate(t, rules, pos, SignO, 0, 1, 0, 0)
+	playUltimate(t, rules, pos, SignX, 0, 0, 2, 1)
+	playUltimate(t, rules, pos, SignO, 2, 1, 0, 0)
+
+	// x is sent to the won sub-board and moves on any open one
+	moves := rules.LegalMoves(pos)
+	for _, m := range moves {
+		sub, _ := SplitUltimateCell(m.Cell)
+		failIfFalseFmt(t, sub.Row() != 0 || sub.Col() != 0, "unexpected legal move %s on completed sub-board", m.Cell)
+	}
+	failIfFalseFmt(t, len(moves) == 81-9-3, "expected moves on every open sub-board, got %d", len(moves))
+
+	err := rules.ApplyMove(pos, TypeMove{Cell: ultimateCell(t, 0, 0, 1, 2), Sign: SignX})
+	failIfFalseFmt(t, errors.Is(err, ErrIllegalMove), "expected illegal move to completed sub-board, got %v", err)
+}
+
+func TestUltimateWin(t *testing.T) {
+	rules := Ultimate()
+	pos := rules.NewPosition()
+
+	// x wins the left column of sub-boards by their middle columns
+	for _, m := range [][4]int{
+		{0, 0, 1, 1}, {1, 1, 0, 0}, {0, 0, 0, 1}, {0, 1, 0, 0}, {0, 0, 2, 1},
+		{2, 1, 1, 0}, {1, 0, 1, 1}, {1, 1, 1, 0}, {1, 0, 0, 1}, {0, 1, 1, 0}, {1, 0, 2, 1},
+		{2, 1, 2, 0}, {2, 0, 1, 1}, {1, 1, 2, 0}, {2, 0, 0, 1}, {0, 1, 2, 0},
+	} {
+		failIfFalseFmt(t, !rules.Terminal(pos), "unexpected end of the game")
+
+		sign := []TypeSign{SignX, SignO}[pos.Side()]
+		playUltimate(t, rules, pos, sign, m[0], m[1], m[2], m[3])
+	}
+
+	failIfFalseFmt(t, !rules.Terminal(pos), "unexpected end of the game")
+	playUltimate(t, rules, pos, SignX, 2, 0, 2, 1)
+
+	side, ok := rules.Winner(pos)
+	failIfFalseFmt(t, rules.Terminal(pos) && ok && side == 0, "expected x has won")
+}
+
+func TestUltimateThroughSession(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	failIfError(t, RegisterUser("user1", testPassword))
+	tokenFirst, err := Login("user1", testPassword)
+	failIfError(t, err)
+	failIfError(t, RegisterSelfAsParticipantWithRules(tokenFirst, SignX, Ultimate()))
+
+	failIfError(t, RegisterUser("user2", testPassword))
+	tokenSecond, err := Login("user2", testPassword)
+	failIfError(t, err)
+	failIfError(t, StartPlayingWithWaitingOpponent(tokenSecond, SignO, "user1"))
+
+	board, err := CurrentBoard(tokenFirst)
+	failIfError(t, err)
+	failIfFalseFmt(t, board.Size() == 9 && board.Rules().Name() == "ultimate", "unexpected board")
+
+	_, _, err = MakeAMove(tokenFirst, ultimateCell(t, 1, 1, 0, 2))
+	failIfError(t, err)
+	_, _, err = MakeAMove(tokenSecond, ultimateCell(t, 1, 1, 0, 0))
+	failIfFalseFmt(t, errors.Is(err, ErrIllegalMove), "expected move on sub-board {0, 2} only, got %v", err)
+	_, _, err = MakeAMove(tokenSecond, ultimateCell(t, 0, 2, 0, 0))
+	failIfError(t, err)
+
+	_, _, err = Resign(tokenFirst)
+	failIfError(t, err)
+	failIfFalseFmt(t, LastHistoryVariant() == "ultimate", "unexpected variant %q", LastHistoryVariant())
+}
+
+func ultimateCell(t *testing.T, subRow, subCol, row, col int) TypeCell {
+	t.Helper()
+
+	sub, err := NewCell(subRow, subCol)
+	failIfError(t, err)
+	cell, err := NewCell(row, col)
+	failIfError(t, err)
+	c, err := NewUltimateCell(sub, cell)
+	failIfError(t, err)
+
+	return c
+}
+
+func playUltimate(t *testing.T, rules Rules, pos *TypePosition, sign TypeSign, subRow, subCol, row, col int) {
+	t.Helper()
+
+	failIfError(t, rules.ApplyMove(pos, TypeMove{Cell: ultimateCell(t, subRow, subCol, row, col), Sign: sign}))
+}
@@ -0,0 +1,46 @@
+package xo
+
+import "fmt"
+
+// typeSignChooser is implemented by rules letting the mover choose the sign
+// of every move.
+type typeSignChooser interface {
+	choosesSign() bool
+}
+
+func choosesSign(rules Rules) bool {
+	chooser, ok := rules.(typeSignChooser)
+	return ok && chooser.choosesSign()
+}
+
+// wild is tic-tac-toe where every move places x or o by the choice of the
+// mover, the first to complete a line of either sign wins.
+type wild struct {
+	*kInARow
+}
+
+var wildClassic = wild{newKInARow("wild", constBoardSizeMax, constBoardSizeMax, 1, constBoardSizeMax)}
+
+// Wild is wild tic-tac-toe on 3×3 board, moves are made with
+// MakeAMoveWithSign.
+func Wild() Rules { return wildClassic }
+
+func (wild) choosesSign() bool { return true }
+
+// LegalMoves returns two moves for every free cell, one for each sign.
+func (r wild) LegalMoves(pos *TypePosition) []TypeMove {
+	var moves []TypeMove
+	for _, move := range r.kInARow.LegalMoves(pos) {
+		moves = append(moves, TypeMove{Cell: move.Cell, Sign: SignX}, TypeMove{Cell: move.Cell, Sign: SignO})
+	}
+
+	return moves
+}
+
+func (r wild) ApplyMove(pos *TypePosition, move TypeMove) error {
+	if move.Sign != SignX && move.Sign != SignO {
+		return fmt.Errorf("%w %q, valid signs %q and %q", ErrInvalidSign, move.Sign, SignO, SignX)
+	}
+
+	return r.kInARow.ApplyMove(pos, move)
+}
@@ -0,0 +1,97 @@
+package xo_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/ayzatziko/stuff/x/xo/xo"
+)
+
+func TestWildAnySign(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	tokenFirst, tokenSecond := startGameWithRules(t, "user1", "user2", Wild())
+
+	// user2 places x twice and user1 completes the column of x with o sign
+	// being of user2
+	moves := []struct {
+		token string
+		x, y  int
+		sign  TypeSign
+	}{
+		{tokenFirst, 0, 0, SignO}, {tokenSecond, 1, 1, SignX},
+		{tokenFirst, 0, 2, SignO}, {tokenSecond, 2, 1, SignX},
+		{tokenFirst, 0, 1, SignX},
+	}
+	for i, m := range moves {
+		cell, err := NewCell(m.x, m.y)
+		failIfError(t, err)
+
+		b, msg, err := MakeAMoveWithSign(m.token, cell, m.sign)
+		failIfError(t, err)
+
+		if i < len(moves)-1 {
+			failIfFalseFmt(t, b == nil, "unexpected end of the game %q", msg)
+			continue
+		}
+
+		failIfFalseFmt(t, msg == "user1 wins user2", "unexpected result %q", msg)
+		failIfFalseFmt(t, b.Cell(cell) == SignX, "expected x in %s", cell)
+	}
+}
+
+func TestWildSignOfOtherVariants(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	tokenFirst, _ := startGame(t, "user1", "user2")
+
+	cell, err := NewCell(0, 0)
+	failIfError(t, err)
+
+	_, _, err = MakeAMoveWithSign(tokenFirst, cell, SignO)
+	failIfFalseFmt(t, errors.Is(err, ErrInvalidSign), "expected invalid sign error, got %v", err)
+
+	_, _, err = MakeAMoveWithSign(tokenFirst, cell, SignX)
+	failIfError(t, err)
+}
+
+func TestWildBot(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	tokenFirst, tokenSecond := startGameWithRules(t, "user1", "user2", Wild())
+
+	// x x . in the first row is won by x of the bot whatever its sign is
+	for _, m := range []struct {
+		token string
+		y     int
+	}{{tokenFirst, 0}, {tokenSecond, 1}} {
+		cell, err := NewCell(0, m.y)
+		failIfError(t, err)
+
+		_, _, err = MakeAMoveWithSign(m.token, cell, SignX)
+		failIfError(t, err)
+	}
+
+	board, err := CurrentBoard(tokenFirst)
+	failIfError(t, err)
+
+	cell, sign, err := BotMoveWithSign(board, BotLevelMedium)
+	failIfError(t, err)
+	failIfFalseFmt(t, cell.Row() == 0 && cell.Col() == 2 && sign == SignX, "unexpected bot move %s %s", sign, cell)
+
+	_, msg, err := MakeAMoveWithSign(tokenFirst, cell, sign)
+	failIfError(t, err)
+	failIfFalseFmt(t, msg == "user1 wins user2", "unexpected result %q", msg)
+}
+
+func TestWildHardBotNeverLoses(t *testing.T) {
+	for _, opponent := range []TypeBotLevel{BotLevelEasy, BotLevelMedium} {
+		if winner := playBotsWithRules(t, Wild(), BotLevelHard, opponent); winner == "second" {
+			t.Fatalf("hard bot moving first lost to %s bot", opponent)
+		}
+
+		if winner := playBotsWithRules(t, Wild(), opponent, BotLevelHard); winner == "first" {
+			t.Fatalf("hard bot moving second lost to %s bot", opponent)
+		}
+	}
+}
@@ -1,12 +1,41 @@
 package xo
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"sync"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/ayzatziko/stuff/xerrors"
 )
 
+var (
+	ErrSessionNotFound   = errors.New("session not found")
+	ErrUserNotFound      = errors.New("user not found")
+	ErrUserExists        = errors.New("user already exists")
+	ErrWrongPassword     = errors.New("password does not match")
+	ErrNotPlaying        = errors.New("not playing")
+	ErrOpponentNotFound  = errors.New("opponent not found")
+	ErrInvalidSign       = errors.New("invalid sign")
+	ErrInvalidCell       = errors.New("invalid cell")
+	ErrIllegalMove       = errors.New("illegal move")
+	ErrUnknownVariant    = errors.New("unknown variant")
+	ErrSearchLimit       = errors.New("search limit exceeded")
+	ErrLoginThrottled    = errors.New("too many failed logins")
+	ErrLoginLocked       = errors.New("locked after failed logins")
+	ErrInvalidUsername   = errors.New("invalid username")
+	ErrWeakPassword      = errors.New("password does not meet the policy")
+	ErrPermissionDenied  = errors.New("permission denied")
+	ErrBanned            = errors.New("banned")
+	ErrAuditTampered     = errors.New("audit log is tampered")
+	ErrChatThrottled     = errors.New("too many chat messages")
+	ErrRoomNotFound      = errors.New("room not found")
+	ErrAnalysisThrottled = errors.New("too many analyses")
+	ErrRoomThrottled     = errors.New("too many wrong room codes")
+)
+
 type TypeSign string
 
 const (
@@ -50,8 +79,8 @@ func (userSign typeUserSign) String() string {
 func validateSignOfUserSign(userSign typeUserSign) error {
 	if userSign.sign != SignO && userSign.sign != SignX {
 		return fmt.Errorf(
-			"invalid user sign %s, valid signs %q and %q",
-			userSign, SignO, SignX,
+			"%w of user %s, valid signs %q and %q",
+			ErrInvalidSign, userSign, SignO, SignX,
 		)
 	}
 
@@ -59,26 +88,56 @@ func validateSignOfUserSign(userSign typeUserSign) error {
 }
 
 func NewCell(x, y int) (TypeCell, error) {
-	c := TypeCell{y, x}
+	c := TypeCell{x: y, y: x}
 	return c, validateCell(c)
 }
 
-type TypeCell struct{ x, y int }
+// NewCell3D returns the cell of layer z of three-dimensional boards.
+func NewCell3D(x, y, z int) (TypeCell, error) {
+	c := TypeCell{x: y, y: x, z: z}
+	return c, validateCell(c)
+}
+
+type TypeCell struct{ x, y, z int }
+
+func (c TypeCell) String() string {
+	if c.z != 0 {
+		return fmt.Sprintf("{y: %v, x: %v, z: %v}", c.y, c.x, c.z)
+	}
+
+	return fmt.Sprintf("{y: %v, x: %v}", c.y, c.x)
+}
 
-func (c TypeCell) String() string { return fmt.Sprintf("{y: %v, x: %v}", c.y, c.x) }
+// Row, Col and Layer are the first, the second and the third arguments of
+// NewCell3D.
+func (c TypeCell) Row() int   { return c.y }
+func (c TypeCell) Col() int   { return c.x }
+func (c TypeCell) Layer() int { return c.z }
 
+// validateCell checks coordinates are not negative, the rules of the game
+// check the cell is on the board.
 func validateCell(cell TypeCell) error {
-	if constBoardSizeMax > cell.y && cell.y >= 0 && cell.x >= 0 && constBoardSizeMax > cell.x {
+	if cell.y >= 0 && cell.x >= 0 && cell.z >= 0 {
 		return nil
 	}
 
-	return fmt.Errorf("invalid cell %s", cell)
+	return fmt.Errorf("%w %s", ErrInvalidCell, cell)
 }
 
 type TypeBoard struct {
-	rows             [constBoardSizeMax][constBoardSizeMax]TypeSign
+	rules            Rules
+	position         *TypePosition
 	participants     [constUsersNum]typeUserSign
+	first            typeUserSign
 	lastMoveIsDoneBy TypeUser
+	lastMoveAt       time.Time
+	startedAt        time.Time
+	drawOfferedBy    TypeUser
+	// unrated is set by a hint to a player, the game does not count on
+	// leaderboards.
+	unrated bool
+	// timeLimit is the move time limit when the board is copied
+	timeLimit time.Duration
 
 	winnerSet bool
 	winner    TypeUser
@@ -92,10 +151,70 @@ func (board *TypeBoard) Draw(user TypeUser) (bool, bool) {
 	return board.winner == "", board.winnerSet
 }
 
-func newBoard(user1, user2 typeUserSign, first typeUserSign) (_ *TypeBoard, err error) {
+func (board *TypeBoard) Cell(cell TypeCell) TypeSign { return board.position.At(cell) }
+
+// Size returns the number of rows and columns of a square board.
+func (board *TypeBoard) Size() int {
+	width, _, _ := board.position.Size()
+	return width
+}
+
+// Layers returns the number of layers of a board, flat boards have one.
+func (board *TypeBoard) Layers() int {
+	_, _, depth := board.position.Size()
+	return depth
+}
+
+func (board *TypeBoard) Dimensions() (rows, cols, layers int) {
+	width, height, depth := board.position.Size()
+	return height, width, depth
+}
+
+func (board *TypeBoard) Rules() Rules { return board.rules }
+
+// Rated reports whether the game counts on leaderboards, it does not after
+// a player has asked for a hint.
+func (board *TypeBoard) Rated() bool { return !board.unrated }
+
+// Position returns a copy of the position on the board.
+func (board *TypeBoard) Position() *TypePosition { return board.position.Clone() }
+
+func (board *TypeBoard) clone() TypeBoard {
+	clone := *board
+	clone.position = board.position.Clone()
+	clone.timeLimit = time.Duration(moveTimeLimit.Load())
+
+	return clone
+}
+
+func (board *TypeBoard) Participants() [constUsersNum]typeUserSign { return board.participants }
+
+// Turn returns the participant who makes the next move.
+func (board *TypeBoard) Turn() typeUserSign {
+	return opponentOf(board, board.lastMoveIsDoneBy)
+}
+
+func (board *TypeBoard) DrawOfferedBy() TypeUser { return board.drawOfferedBy }
+
+// MoveCount returns the number of moves played on the board.
+func (board *TypeBoard) MoveCount() int { return len(board.position.moves) }
+
+// TimeLeft returns the time left for the current move of a copy of the
+// board, false if games are played without time limit.
+func (board *TypeBoard) TimeLeft() (time.Duration, bool) {
+	if board.timeLimit == 0 {
+		return 0, false
+	}
+
+	return board.timeLimit - now().Sub(board.lastMoveAt), true
+}
+
+func newBoard(rules Rules, user1, user2 typeUserSign, first typeUserSign) (_ *TypeBoard, err error) {
 	defer xerrors.Wrap(&err, "NewBoard(user1: %s, user2: %s, first: %s)", user1, user2, first)
 
-	if err := validateSignOfUserSign(user1); err != nil {
+	if rules == nil {
+		return nil, fmt.Errorf("no rules")
+	} else if err := validateSignOfUserSign(user1); err != nil {
 		return nil, fmt.Errorf("invalid first user: %v", err)
 	} else if err := validateSignOfUserSign(user2); err != nil {
 		return nil, fmt.Errorf("invalid second user: %v", err)
@@ -113,182 +232,117 @@ func newBoard(user1, user2 typeUserSign, first typeUserSign) (_ *TypeBoard, err
 	}
 
 	board := TypeBoard{
+		rules:            rules,
+		position:         rules.NewPosition(),
 		participants:     [2]typeUserSign{user1, user2},
+		first:            first,
 		lastMoveIsDoneBy: last.user,
+		lastMoveAt:       now(),
+		startedAt:        now(),
 	}
 
 	return &board, nil
 }
 
-func move(board *TypeBoard, cell TypeCell, user TypeUser) (err error) {
+// move plays cell for user, empty sign stands for the sign of user.
+func move(board *TypeBoard, cell TypeCell, sign TypeSign, user TypeUser) (err error) {
 	if err := validateBoard(board); err != nil {
 		return err
 	} else if err := validateCell(cell); err != nil {
 		return err
-	} else if curSign := board.rows[cell.y][cell.x]; curSign != signNull {
-		return fmt.Errorf("cell %s has already value %v, cannot overwrite it", cell, curSign)
 	} else if board.participants[0].user != user && board.participants[1].user != user {
-		return fmt.Errorf("user %q is not a participant of current game", user)
+		return fmt.Errorf("%w: user %q is not a participant of current game", ErrIllegalMove, user)
 	} else if board.lastMoveIsDoneBy == user {
-		return fmt.Errorf("it is not allowed to make second move in a row, user %q", user)
+		return fmt.Errorf("%w: it is not allowed to make second move in a row, user %q", ErrIllegalMove, user)
 	} else if board.winnerSet {
-		return fmt.Errorf("game is finished, %q is the winner", winnerString(board.winner))
+		return fmt.Errorf("%w: game is finished, %q is the winner", ErrIllegalMove, winnerString(board.winner))
 	}
 
-	var sign TypeSign
-	if board.participants[0].user == user {
-		sign = board.participants[0].sign
-	} else {
-		sign = board.participants[1].sign
+	userSign := board.participants[0].sign
+	if board.participants[1].user == user {
+		userSign = board.participants[1].sign
 	}
 
-	board.rows[cell.y][cell.x] = sign
-	board.lastMoveIsDoneBy = user
+	if sign == signNull {
+		sign = userSign
+	} else if sign != userSign && !choosesSign(board.rules) {
+		return fmt.Errorf("%w %q, variant %s places the sign of the mover %q", ErrInvalidSign, sign, board.rules.Name(), userSign)
+	}
 
-	// check is winner
-	for _, comb := range winnerCombinations {
-		ok := true
-		for _, cell := range comb {
-			if board.rows[cell.y][cell.x] != sign {
-				ok = false
-			}
-		}
+	if err := board.rules.ApplyMove(board.position, TypeMove{Cell: cell, Sign: sign}); err != nil {
+		return err
+	}
 
-		if ok {
-			board.winnerSet = true
-			board.winner = user
-			break
-		}
+	board.lastMoveIsDoneBy = user
+	board.lastMoveAt = now()
+	metricMoves.Inc()
+	if board.drawOfferedBy != user {
+		// answering with a move declines the pending offer
+		board.drawOfferedBy = ""
 	}
 
-	if board.winnerSet {
+	if !board.rules.Terminal(board.position) {
 		return nil
 	}
 
-	end := true
-	for _, row := range board.rows {
-		for _, boardSign := range row {
-			if boardSign == signNull {
-				end = false
-			}
-		}
+	board.winnerSet = true
+	if side, ok := board.rules.Winner(board.position); ok {
+		board.winner = board.sideUser(side)
 	}
 
-	if end {
-		board.winnerSet = true
+	return nil
+}
+
+// sideUser returns the participant moving on side, side 0 moves first.
+func (board *TypeBoard) sideUser(side int) TypeUser {
+	if side == 0 {
+		return board.first.user
 	}
 
-	return nil
+	return opponentOf(board, board.first.user).user
 }
 
 func validateBoard(b *TypeBoard) error {
 	if b == nil {
 		return fmt.Errorf("nil board")
-	} else if rowsn := len(b.rows); rowsn != constBoardSizeMax {
-		return fmt.Errorf("rows number is %d, required to be %d", rowsn, constBoardSizeMax)
-	} else if colsn := len(b.rows[0]); colsn != constBoardSizeMax {
-		return fmt.Errorf("columns number is %d, required to be %d", colsn, constBoardSizeMax)
+	} else if b.rules == nil || b.position == nil {
+		return fmt.Errorf("board without rules")
 	}
 
 	return nil
 }
 
-// can be optimized by using a tree or graph data structure.
-var winnerCombinations = [...][constBoardSizeMax]TypeCell{
-	/*
-		xxx
-		___
-		___
-	*/
-	{{0, 0}, {0, 1}, {0, 2}},
-
-	/*
-		___
-		xxx
-		___
-	*/
-	{{1, 0}, {1, 1}, {1, 2}},
-
-	/*
-		___
-		___
-		xxx
-	*/
-	{{2, 0}, {2, 1}, {2, 2}},
-
-	/*
-		x__
-		x__
-		x__
-	*/
-	{{0, 0}, {1, 0}, {2, 0}},
-
-	/*
-		_x_
-		_x_
-		_x_
-	*/
-	{{0, 1}, {1, 1}, {2, 1}},
-
-	/*
-		__x
-		__x
-		__x
-	*/
-	{{0, 2}, {1, 2}, {2, 2}},
-
-	/*
-		x__
-		_x_
-		__x
-	*/
-	{{0, 0}, {1, 1}, {2, 2}},
-
-	/*
-		__x
-		_x_
-		x__
-	*/
-	{{0, 2}, {1, 1}, {2, 0}},
-}
-
-// storages
 var (
-	mu sync.Mutex
-
-	waitingOpponents = map[string]typeUserSign{}
-	userBoard        = map[string]*TypeBoard{}
-	activeUserToken  = map[string]string{}
-	activeTokenUser  = map[string]TypeUser{}
-
-	playsHistory = []typeHistoryRecord{}
-
-	registeredUser = map[string]typeLoginPass{}
+	waitingOpponents = map[string]typeWaitingOpponent{}
+	playsHistory     = []typeHistoryRecord{}
+	registeredUser   = map[string]typeLoginPass{}
 )
 
-func cleanDatabase() {
-	mu.Lock()
-	defer mu.Unlock()
-
-	dropLocked(waitingOpponents)
-	dropLocked(userBoard)
-	dropLocked(activeTokenUser)
-	dropLocked(activeUserToken)
-	playsHistory = playsHistory[:0]
-	dropLocked(registeredUser)
-}
-
-func dropLocked[K comparable, V any](m map[K]V) {
-	for k := range m {
-		delete(m, k)
-	}
-}
-
 type typeHistoryRecord struct {
 	mayBeWinner, user2 string
-	result             typeResult
+	// signs of mayBeWinner and user2
+	signs       [constUsersNum]TypeSign
+	result      typeResult
+	termination TypeTermination
+	variant     string
+	finishedAt  time.Time
+	unrated     bool
 }
 
+type TypeTermination string
+
+const (
+	TerminationNormal      TypeTermination = "normal"
+	TerminationResignation TypeTermination = "resignation"
+	TerminationAgreedDraw  TypeTermination = "agreed draw"
+	TerminationForfeit     TypeTermination = "forfeit"
+	TerminationTimeout     TypeTermination = "timeout"
+	// TerminationAborted ends a game without a result, it is not recorded in
+	// the history.
+	TerminationAborted      TypeTermination = "aborted"
+	TerminationAdjudication TypeTermination = "adjudication"
+)
+
 type typeResult bool
 
 const (
@@ -296,42 +350,64 @@ const (
 	typeResultDraw     = false
 )
 
-func RegisterSelfAsParticipant(sessionToken string, sign TypeSign) (err error) {
-	mu.Lock()
-	defer mu.Unlock()
+type typeWaitingOpponent struct {
+	typeUserSign
+	rules Rules
+}
 
-	user, ok := activeTokenUser[sessionToken]
-	if !ok {
-		return fmt.Errorf("session is not found")
+func (opponent typeWaitingOpponent) Rules() Rules { return opponent.rules }
+
+func RegisterSelfAsParticipant(sessionToken string, sign TypeSign) error {
+	return RegisterSelfAsParticipantWithRules(sessionToken, sign, Classic())
+}
+
+// RegisterSelfAsParticipantWithRules waits for an opponent to play the
+// variant defined by rules.
+func RegisterSelfAsParticipantWithRules(sessionToken string, sign TypeSign, rules Rules) error {
+	return RegisterSelfAsParticipantContext(context.Background(), sessionToken, sign, rules)
+}
+
+func RegisterSelfAsParticipantContext(ctx context.Context, sessionToken string, sign TypeSign, rules Rules) (err error) {
+	user, err := userOf(ctx, sessionToken)
+	if err != nil {
+		return err
 	}
 
 	defer xerrors.Wrap(&err, "RegisterSelfAsParticipant(%s, %s)", user, sign)
 
+	if rules == nil {
+		return fmt.Errorf("no rules")
+	}
+
 	userSign, err := newUserSign(user, sign)
 	if err != nil {
 		return err
 	}
 
-	if err := validateSignOfUserSign(userSign); err != nil {
+	if err := lobbyMu.LockContext(ctx); err != nil {
 		return err
-	} else if board, ok := userBoard[string(userSign.user)]; ok {
-		opponent := board.participants[0]
-		if board.participants[1].user != userSign.user {
-			opponent = board.participants[1]
-		}
-
-		return fmt.Errorf("already playing with %s", opponent)
 	}
+	defer lobbyMu.Unlock()
 
-	waitingOpponents[string(userSign.user)] = userSign
-	return nil
-}
+	expireRoomsLocked()
+
+	states, unlock := lockUsers(user)
+	defer unlock()
 
-func SearchOpponents() []typeUserSign {
-	mu.Lock()
-	defer mu.Unlock()
+	if st := states[0]; st == nil || st.token != sessionToken {
+		return ErrSessionNotFound
+	} else if st.game != nil {
+		return fmt.Errorf("already playing with %s", opponentOf(st.game.board, user))
+	} else if st.watching != nil {
+		return errWatching(st.watching)
+	} else if _, ok := hosts[user]; ok {
+		return fmt.Errorf("hosting a room, close it first")
+	} else {
+		st.last = nil
+	}
 
-	return valuesOfMap(waitingOpponents)
+	waitingOpponents[string(userSign.user)] = typeWaitingOpponent{userSign, rules}
+	return nil
 }
 
 func valuesOfMap[K comparable, V any](m map[K]V) []V {
@@ -342,190 +418,432 @@ func valuesOfMap[K comparable, V any](m map[K]V) []V {
 	return values
 }
 
-func StartPlayingWithWaitingOpponent(sessionToken string, sign TypeSign, opponentUser TypeUser) (err error) {
-	mu.Lock()
-	defer mu.Unlock()
+func StartPlayingWithWaitingOpponent(sessionToken string, sign TypeSign, opponentUser TypeUser) error {
+	return StartPlayingWithWaitingOpponentContext(context.Background(), sessionToken, sign, opponentUser)
+}
 
-	user, ok := activeTokenUser[sessionToken]
-	if !ok {
-		return fmt.Errorf("session is not found")
+func StartPlayingWithWaitingOpponentContext(ctx context.Context, sessionToken string, sign TypeSign, opponentUser TypeUser) (err error) {
+	user, err := userOf(ctx, sessionToken)
+	if err != nil {
+		return err
 	}
 
 	defer xerrors.Wrap(&err, "StartPlayingWithWaitingOpponent(%s, %s, %s)", user, sign, opponentUser)
 
-	opponentUserSign, ok := waitingOpponents[string(opponentUser)]
+	if err := lobbyMu.LockContext(ctx); err != nil {
+		return err
+	}
+	defer lobbyMu.Unlock()
+
+	opponent, ok := waitingOpponents[string(opponentUser)]
 	if !ok {
-		return fmt.Errorf("opponent %s not found", opponentUser)
+		return fmt.Errorf("%w: %s", ErrOpponentNotFound, opponentUser)
 	}
 
+	// blocked users do not see each other in the lobby
+	if err := socialMu.RLockContext(ctx); err != nil {
+		return err
+	}
+	blocked := blockedLocked(user, opponentUser)
+	socialMu.RUnlock()
+	if blocked {
+		return fmt.Errorf("%w: %s", ErrOpponentNotFound, opponentUser)
+	}
+
+	return startGameLocked(user, sessionToken, sign, opponent)
+}
+
+// startGameLocked starts the game of user with the waiting opponent, who
+// moves first, and removes both from the lobby. The caller holds lobbyMu.
+func startGameLocked(user TypeUser, sessionToken string, sign TypeSign, opponent typeWaitingOpponent) error {
+	opponentUser := opponent.user
 	firstUserSign, err := newUserSign(user, sign)
 	if err != nil {
 		return err
 	}
 
-	board, err := newBoard(firstUserSign, opponentUserSign, opponentUserSign)
+	board, err := newBoard(opponent.rules, firstUserSign, opponent.typeUserSign, opponent.typeUserSign)
 	if err != nil {
 		return err
 	}
 
-	delete(waitingOpponents, string(firstUserSign.user))
-	delete(waitingOpponents, string(opponentUser))
+	// the game is locked until the start is published, so events of moves
+	// follow it
+	game := &typeGame{board: board}
+	game.mu.Lock()
+	defer game.mu.Unlock()
+
+	states, unlock := lockUsers(user, opponentUser)
+	if states[0] == nil || states[0].token != sessionToken {
+		unlock()
+		return ErrSessionNotFound
+	} else if states[0].game != nil {
+		unlock()
+		return fmt.Errorf("already playing with %s", opponentOf(states[0].game.board, user))
+	} else if states[0].watching != nil {
+		unlock()
+		return errWatching(states[0].watching)
+	} else if states[1] == nil || states[1].token == "" || states[1].game != nil {
+		unlock()
+		return fmt.Errorf("%w: %s", ErrOpponentNotFound, opponentUser)
+	}
+	states[0].game, states[1].game = game, game
+	unlock()
+
+	leaveLobbyLocked(user)
+	leaveLobbyLocked(opponentUser)
+	runningGames.Add(1)
 
-	userBoard[string(firstUserSign.user)] = board
-	userBoard[string(opponentUser)] = board
+	publishLocked(game, TypeEvent{Kind: EventGameStarted, User: board.first.user})
 
 	return nil
 }
 
-func MakeAMove(sessionToken string, cell TypeCell) (_ *TypeBoard, _ string, err error) {
-	mu.Lock()
-	defer mu.Unlock()
+// CurrentBoard returns a copy of the board the session user is playing on
+// or watching.
+func CurrentBoard(sessionToken string) (TypeBoard, error) {
+	return CurrentBoardContext(context.Background(), sessionToken)
+}
 
-	user, ok := activeTokenUser[sessionToken]
-	if !ok {
-		return nil, "", fmt.Errorf("session not found")
+func CurrentBoardContext(ctx context.Context, sessionToken string) (_ TypeBoard, err error) {
+	user, err := userOf(ctx, sessionToken)
+	if err != nil {
+		return TypeBoard{}, err
 	}
 
-	defer xerrors.Wrap(&err, "MakeAMove(%s, %s)", user, cell)
+	game, err := lockViewedGameOf(ctx, user)
+	if err != nil {
+		return TypeBoard{}, err
+	}
+	defer game.mu.Unlock()
 
-	board, ok := userBoard[string(user)]
-	if !ok {
-		return nil, "", fmt.Errorf("user %s does not participate in any play", user)
+	defer xerrors.Wrap(&err, "CurrentBoard(%s)", user)
+
+	return game.board.clone(), nil
+}
+
+func MakeAMove(sessionToken string, cell TypeCell) (*TypeBoard, string, error) {
+	return MakeAMoveWithSign(sessionToken, cell, signNull)
+}
+
+// MakeAMoveWithSign makes a move placing sign, variants like wild let the
+// mover choose the sign of every move, others accept only the sign of the
+// mover. Empty sign is the sign of the mover.
+func MakeAMoveWithSign(sessionToken string, cell TypeCell, sign TypeSign) (*TypeBoard, string, error) {
+	return MakeAMoveContext(context.Background(), sessionToken, cell, sign)
+}
+
+// MakeAMoveContext is MakeAMoveWithSign with a context.
+func MakeAMoveContext(ctx context.Context, sessionToken string, cell TypeCell, sign TypeSign) (_ *TypeBoard, _ string, err error) {
+	user, err := userOf(ctx, sessionToken)
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer xerrors.Wrap(&err, "MakeAMove(%s, %s, %q)", user, cell, sign)
+
+	game, err := lockGameOf(ctx, user)
+	if err != nil {
+		return nil, "", err
 	}
+	defer game.mu.Unlock()
 
-	if err = move(board, cell, user); err != nil {
+	board := game.board
+	if err = move(board, cell, sign, user); err != nil {
 		return nil, "", err
 	}
 
-	if board.winnerSet && board.winner != "" {
-		winner, loser := board.participants[0].user, board.participants[1].user
-		if loser == user {
-			winner, loser = board.participants[1].user, board.participants[0].user
+	last, _ := board.position.LastMove()
+	publishLocked(game, TypeEvent{Kind: EventMove, User: user, Cell: last.Cell, Sign: last.Sign})
+
+	if board.winnerSet {
+		return board, finishGameLocked(game, board.winner, TerminationNormal), nil
+	}
+
+	return nil, "", nil
+}
+
+// finishGameLocked ends the game, records it to the history and frees both
+// participants. Empty winner means a draw. The caller holds the lock of
+// the game.
+func finishGameLocked(game *typeGame, winner TypeUser, termination TypeTermination) string {
+	board := game.board
+	board.winnerSet = true
+	board.winner = winner
+	board.drawOfferedBy = ""
+	game.done = true
+
+	users := game.audienceLocked()
+	states, unlock := lockUsers(users...)
+	for i, user := range users {
+		st := states[i]
+		if st == nil {
+			continue
+		} else if st.game == game {
+			st.game, st.last = nil, game
+		} else if st.watching == game {
+			st.watching = nil
 		}
+		userShardOf(user).pruneLocked(user, st)
+	}
+	unlock()
+	runningGames.Add(-1)
 
-		delete(userBoard, string(user))
-		delete(userBoard, string(loser))
+	first, second := board.participants[0], board.participants[1]
+	if winner == second.user {
+		first, second = second, first
+	}
 
-		playsHistory = append(playsHistory, typeHistoryRecord{mayBeWinner: string(winner), user2: string(loser), result: typeResultFirstWon})
+	msg := "draw"
+	record := typeHistoryRecord{
+		mayBeWinner: string(first.user), user2: string(second.user), signs: [constUsersNum]TypeSign{first.sign, second.sign},
+		result: typeResultDraw, termination: termination, variant: board.rules.Name(), finishedAt: now(),
+		unrated: board.unrated,
+	}
+	if termination == TerminationAborted {
+		msg = "aborted"
+	} else if winner != "" {
+		record.result = typeResultFirstWon
+		msg = fmt.Sprintf("%s wins %s", winner, second.user)
+	}
 
-		return board, fmt.Sprintf("%s wins %s", winner, loser), nil
-	} else if board.winnerSet {
-		user1, user2 := string(board.participants[0].user), string(board.participants[1].user)
-		delete(userBoard, string(user1))
-		delete(userBoard, string(user2))
+	if termination != TerminationAborted {
+		historyMu.Lock()
+		appendHistoryLocked(record)
+		historyMu.Unlock()
+	}
+
+	publishLocked(game, TypeEvent{Kind: EventGameFinished, User: winner, Message: msg, Termination: termination})
+	metricGamesFinished.Inc()
+	metricGameDuration.Observe(now().Sub(board.startedAt).Seconds())
 
-		playsHistory = append(playsHistory, typeHistoryRecord{mayBeWinner: user1, user2: user2, result: typeResultDraw})
+	return msg
+}
 
-		return board, "draw", nil
+func opponentOf(board *TypeBoard, user TypeUser) typeUserSign {
+	if board.participants[0].user == user {
+		return board.participants[1]
 	}
 
-	return nil, "", nil
+	return board.participants[0]
 }
 
-type typeLoginPass struct {
-	username string
-	password string // use bcrypt
+// forfeit makes the opponent of user a winner if user is playing, and
+// removes user from the lobby closing the room of user.
+func forfeit(ctx context.Context, user TypeUser) {
+	lobbyMu.Lock()
+	leaveLobbyLocked(user)
+	lobbyMu.Unlock()
+
+	game, err := lockGameOf(ctx, user)
+	if err != nil {
+		return
+	}
+	defer game.mu.Unlock()
+
+	opponent := opponentOf(game.board, user).user
+	audit(ctx, user, AuditForfeit, opponent, game.board.rules.Name())
+	finishGameLocked(game, opponent, TerminationForfeit)
 }
 
-func RegisterUser(username, password string) error {
-	mu.Lock()
-	defer mu.Unlock()
+func Resign(sessionToken string) (*TypeBoard, string, error) {
+	return ResignContext(context.Background(), sessionToken)
+}
 
-	_, ok := registeredUser[username]
-	if ok {
-		return fmt.Errorf("user %q already exists", username)
+func ResignContext(ctx context.Context, sessionToken string) (_ *TypeBoard, _ string, err error) {
+	user, game, err := lockSessionGame(ctx, sessionToken)
+	if err != nil {
+		return nil, "", err
 	}
+	defer game.mu.Unlock()
 
-	registeredUser[username] = typeLoginPass{username: username, password: password}
+	defer xerrors.Wrap(&err, "Resign(%s)", user)
 
-	return nil
+	return game.board, finishGameLocked(game, opponentOf(game.board, user).user, TerminationResignation), nil
+}
+
+func OfferDraw(sessionToken string) error {
+	return OfferDrawContext(context.Background(), sessionToken)
 }
 
-func Login(username, password string) (_ string, err error) {
-	defer xerrors.Wrap(&err, "Login(%s, *****)", username)
+func OfferDrawContext(ctx context.Context, sessionToken string) (err error) {
+	user, game, err := lockSessionGame(ctx, sessionToken)
+	if err != nil {
+		return err
+	}
+	defer game.mu.Unlock()
+
+	defer xerrors.Wrap(&err, "OfferDraw(%s)", user)
 
-	mu.Lock()
-	defer mu.Unlock()
+	board := game.board
+	if board.drawOfferedBy == user {
+		return fmt.Errorf("draw is already offered")
+	} else if board.drawOfferedBy != "" {
+		return fmt.Errorf("opponent %q has already offered a draw, accept or decline it", board.drawOfferedBy)
+	}
 
-	user, ok := registeredUser[username]
-	if !ok {
-		return "", fmt.Errorf("user %q not found", username)
+	board.drawOfferedBy = user
+	publishLocked(game, TypeEvent{Kind: EventDrawOffered, User: user})
+
+	return nil
+}
+
+func AcceptDraw(sessionToken string) (*TypeBoard, string, error) {
+	return AcceptDrawContext(context.Background(), sessionToken)
+}
+
+func AcceptDrawContext(ctx context.Context, sessionToken string) (_ *TypeBoard, _ string, err error) {
+	user, game, err := lockSessionGame(ctx, sessionToken)
+	if err != nil {
+		return nil, "", err
 	}
+	defer game.mu.Unlock()
 
-	if user.password != password {
-		return "", fmt.Errorf("password does not match")
+	defer xerrors.Wrap(&err, "AcceptDraw(%s)", user)
+
+	if game.board.drawOfferedBy == "" || game.board.drawOfferedBy == user {
+		return nil, "", fmt.Errorf("no draw offer from opponent")
 	}
 
-	sessionToken := randomStringLocked()
+	return game.board, finishGameLocked(game, "", TerminationAgreedDraw), nil
+}
 
-	// deregister from other session
-	existingToken, ok := activeUserToken[username]
-	if ok {
-		delete(activeUserToken, username)
-		delete(activeTokenUser, existingToken)
+func DeclineDraw(sessionToken string) error {
+	return DeclineDrawContext(context.Background(), sessionToken)
+}
 
-		// immediately make an opponent a winner
-		board, boardExists := userBoard[username]
-		_, waitingAPlay := waitingOpponents[username]
-		if boardExists {
-			// the same logic as in make a move, abstarct
-			winner, loser := board.participants[0].user, board.participants[1].user
-			if string(winner) == username {
-				winner, loser = loser, winner
-			}
+func DeclineDrawContext(ctx context.Context, sessionToken string) (err error) {
+	user, game, err := lockSessionGame(ctx, sessionToken)
+	if err != nil {
+		return err
+	}
+	defer game.mu.Unlock()
 
-			delete(userBoard, string(winner))
-			delete(userBoard, string(loser))
+	defer xerrors.Wrap(&err, "DeclineDraw(%s)", user)
 
-			playsHistory = append(playsHistory, typeHistoryRecord{mayBeWinner: string(winner), user2: string(loser), result: typeResultFirstWon})
-		} else if waitingAPlay {
-			delete(waitingOpponents, username)
-		}
+	board := game.board
+	if board.drawOfferedBy == "" || board.drawOfferedBy == user {
+		return fmt.Errorf("no draw offer from opponent")
 	}
 
-	activeTokenUser[sessionToken] = TypeUser(username)
-	activeUserToken[username] = sessionToken
+	board.drawOfferedBy = ""
+	publishLocked(game, TypeEvent{Kind: EventDrawDeclined, User: user})
 
-	return sessionToken, nil
+	return nil
 }
 
-func Logout(sessionToken string) error {
-	mu.Lock()
-	defer mu.Unlock()
+// moveTimeLimit is the time a player has for a move, zero disables the limit.
+var moveTimeLimit atomic.Int64
 
-	user, ok := activeTokenUser[sessionToken]
-	if !ok {
-		return fmt.Errorf("session not found")
+func SetMoveTimeLimit(d time.Duration) { moveTimeLimit.Store(int64(d)) }
+
+// ClaimTimeout wins the game for the caller if the opponent has not moved
+// within the move time limit.
+func ClaimTimeout(sessionToken string) (*TypeBoard, string, error) {
+	return ClaimTimeoutContext(context.Background(), sessionToken)
+}
+
+func ClaimTimeoutContext(ctx context.Context, sessionToken string) (_ *TypeBoard, _ string, err error) {
+	user, game, err := lockSessionGame(ctx, sessionToken)
+	if err != nil {
+		return nil, "", err
 	}
-	username := string(user)
+	defer game.mu.Unlock()
 
-	delete(activeUserToken, username)
-	delete(activeTokenUser, sessionToken)
+	defer xerrors.Wrap(&err, "ClaimTimeout(%s)", user)
 
-	// immediately make an opponent a winner
-	board, boardExists := userBoard[username]
-	_, waitingAPlay := waitingOpponents[username]
-	if boardExists { // same as login, abstract
-		// the same logic as in make a move, abstarct
-		winner, loser := board.participants[0].user, board.participants[1].user
-		if winner == user {
-			winner, loser = loser, winner
-		}
+	board, limit := game.board, time.Duration(moveTimeLimit.Load())
+	if limit == 0 {
+		return nil, "", fmt.Errorf("games are played without time limit")
+	} else if board.lastMoveIsDoneBy != user {
+		return nil, "", fmt.Errorf("it is your move")
+	} else if spent := now().Sub(board.lastMoveAt); spent <= limit {
+		return nil, "", fmt.Errorf("opponent has %s left", limit-spent)
+	}
 
-		delete(userBoard, string(winner))
-		delete(userBoard, string(loser))
+	return board, finishGameLocked(game, user, TerminationTimeout), nil
+}
 
-		playsHistory = append(playsHistory, typeHistoryRecord{mayBeWinner: string(winner), user2: string(loser), result: typeResultFirstWon})
-	} else if waitingAPlay {
-		delete(waitingOpponents, username)
+var now = time.Now
+
+type typeLoginPass struct {
+	username     string
+	password     string // use bcrypt
+	role         TypeRole
+	ban          *typeBan
+	registeredAt time.Time
+	// local users are registered by LoginLocal and have no password.
+	local bool
+}
+
+// RegisterUser registers a user, usernames are unique regardless of case.
+func RegisterUser(username, password string) error {
+	return RegisterUserContext(context.Background(), username, password)
+}
+
+func RegisterUserContext(ctx context.Context, username, password string) (err error) {
+	defer xerrors.Wrap(&err, "RegisterUser(%s, *****)", username)
+
+	if err := checkUsername(username); err != nil {
+		return err
 	}
 
+	if err := accountsMu.LockContext(ctx); err != nil {
+		return err
+	}
+	defer accountsMu.Unlock()
+
+	if existing, ok := foldedUsernames[strings.ToLower(username)]; ok {
+		return fmt.Errorf("%w: %q", ErrUserExists, existing)
+	} else if err := checkPasswordLocked(username, password); err != nil {
+		return err
+	}
+
+	registeredUser[username] = typeLoginPass{username: username, password: password, role: RolePlayer, registeredAt: now()}
+	foldedUsernames[strings.ToLower(username)] = username
+	audit(ctx, TypeUser(username), AuditRegister, "", "")
+	metricRegistrations.Inc()
+
 	return nil
 }
 
-var incToken int
+// Login logs in the user, failed attempts are throttled by the username.
+func Login(username, password string) (string, error) {
+	return LoginContext(context.Background(), username, password)
+}
+
+// loginLocked starts a session of the user ending the previous one, the
+// caller holds accountsMu.
+func loginLocked(ctx context.Context, username, password string) (string, error) {
+	user, ok := registeredUser[username]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUserNotFound, username)
+	}
+
+	if user.local || user.password != password {
+		return "", ErrWrongPassword
+	} else if user.ban.activeLocked() {
+		return "", user.ban
+	}
+
+	sessionToken, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	startSession(ctx, TypeUser(username), sessionToken)
+
+	return sessionToken, nil
+}
+
+func Logout(sessionToken string) error { return LogoutContext(context.Background(), sessionToken) }
+
+func LogoutContext(ctx context.Context, sessionToken string) error {
+	user, err := userOf(ctx, sessionToken)
+	if err != nil {
+		return err
+	} else if !endSession(ctx, user, sessionToken, AuditLogout) {
+		return ErrSessionNotFound
+	}
 
-func randomStringLocked() string {
-	incToken++
-	return fmt.Sprintf("%d", incToken)
+	return nil
 }
@@ -1,3 +1,60 @@
 package xo
 
+import (
+	"context"
+	"time"
+)
+
 var CleanDatabase = cleanDatabase
+
+const AuditQueueMax = constAuditQueueMax
+
+// SearchOpponents returns all waiting opponents regardless of blocks.
+func SearchOpponents() []typeWaitingOpponent {
+	lobbyMu.Lock()
+	defer lobbyMu.Unlock()
+
+	return valuesOfMap(waitingOpponents)
+}
+
+// Audit records the action like the operations do.
+func Audit(user TypeUser, action string) { audit(context.Background(), user, action, "", "") }
+
+func LastHistoryRecord() (mayBeWinner, user2 string, firstWon bool, termination TypeTermination) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	r := playsHistory[len(playsHistory)-1]
+	return r.mayBeWinner, r.user2, bool(r.result), r.termination
+}
+
+func SetNow(f func() time.Time) (restore func()) {
+	old := now
+	now = f
+	return func() { now = old }
+}
+
+func LastHistoryVariant() string {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	return playsHistory[len(playsHistory)-1].variant
+}
+
+func LinesCount(width, height, depth, k int) int { return len(linesOf(width, height, depth, k)) }
+
+// LockLobby holds the lock of waiting opponents until unlock is called.
+func LockLobby() (unlock func()) {
+	lobbyMu.Lock()
+	return lobbyMu.Unlock
+}
+
+// CachedSolvers returns the number of shared solvers and hashers.
+func CachedSolvers() (solversNum, hashersNum int) {
+	solversMu.Lock()
+	defer solversMu.Unlock()
+	hashersMu.Lock()
+	defer hashersMu.Unlock()
+
+	return len(solvers), len(hashers)
+}
@@ -1,27 +1,32 @@
 package xo_test
 
 import (
+	"encoding/hex"
 	"testing"
+	"time"
 
 	. "github.com/ayzatziko/stuff/x/xo/xo"
 )
 
+// testPassword is the password of users registered by tests.
+const testPassword = "password"
+
 func TestFlowTestPlayWithWaitingOpponent(t *testing.T) {
 	t.Cleanup(CleanDatabase)
 
 	first, second := "user1", "user2"
 
-	err := RegisterUser(first, "")
+	err := RegisterUser(first, testPassword)
 	failIfError(t, err)
-	tokenFirst, err := Login(first, "")
+	tokenFirst, err := Login(first, testPassword)
 	failIfError(t, err)
 
 	err = RegisterSelfAsParticipant(tokenFirst, SignO)
 	failIfError(t, err)
 
-	err = RegisterUser(second, "")
+	err = RegisterUser(second, testPassword)
 	failIfError(t, err)
-	tokenSecond, err := Login(second, "")
+	tokenSecond, err := Login(second, testPassword)
 	failIfError(t, err)
 
 	opponents := SearchOpponents()
@@ -61,12 +66,135 @@ func TestFlowTestPlayWithWaitingOpponent(t *testing.T) {
 	failIfFalseFmt(t, ok, "expected first player has won")
 }
 
+func TestResign(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	tokenFirst, tokenSecond := startGame(t, "user1", "user2")
+
+	b, msg, err := Resign(tokenSecond)
+	failIfError(t, err)
+	failIfFalseFmt(t, msg == "user1 wins user2", "unexpected message %q", msg)
+
+	ok, end := b.Winner("user1")
+	failIfFalseFmt(t, ok && end, "expected first player has won")
+
+	winner, loser, firstWon, termination := LastHistoryRecord()
+	failIfFalseFmt(t, winner == "user1" && loser == "user2" && firstWon, "unexpected history record %s %s", winner, loser)
+	failIfFalseFmt(t, termination == TerminationResignation, "unexpected termination %q", termination)
+
+	_, _, err = Resign(tokenFirst)
+	failIfFalseFmt(t, err != nil, "expected error resigning finished game")
+}
+
+func TestDrawOffer(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	tokenFirst, tokenSecond := startGame(t, "user1", "user2")
+
+	_, _, err := AcceptDraw(tokenSecond)
+	failIfFalseFmt(t, err != nil, "expected error accepting absent offer")
+
+	failIfError(t, OfferDraw(tokenFirst))
+	failIfFalseFmt(t, OfferDraw(tokenFirst) != nil, "expected error offering draw twice")
+	failIfFalseFmt(t, DeclineDraw(tokenFirst) != nil, "expected error declining own offer")
+	failIfError(t, DeclineDraw(tokenSecond))
+
+	// opponent's move declines a pending offer
+	failIfError(t, OfferDraw(tokenSecond))
+	cell, err := NewCell(0, 0)
+	failIfError(t, err)
+	_, _, err = MakeAMove(tokenFirst, cell)
+	failIfError(t, err)
+	_, _, err = AcceptDraw(tokenFirst)
+	failIfFalseFmt(t, err != nil, "expected offer is declined by the move")
+
+	failIfError(t, OfferDraw(tokenFirst))
+	b, msg, err := AcceptDraw(tokenSecond)
+	failIfError(t, err)
+	failIfFalseFmt(t, msg == "draw", "unexpected message %q", msg)
+
+	draw, end := b.Draw("user1")
+	failIfFalseFmt(t, draw && end, "expected draw")
+
+	_, _, firstWon, termination := LastHistoryRecord()
+	failIfFalseFmt(t, !firstWon && termination == TerminationAgreedDraw, "unexpected history record %v %q", firstWon, termination)
+}
+
+func TestForfeitByLogout(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	tokenFirst, _ := startGame(t, "user1", "user2")
+	failIfError(t, Logout(tokenFirst))
+
+	winner, _, firstWon, termination := LastHistoryRecord()
+	failIfFalseFmt(t, winner == "user2" && firstWon, "unexpected winner %q", winner)
+	failIfFalseFmt(t, termination == TerminationForfeit, "unexpected termination %q", termination)
+}
+
+func TestClaimTimeout(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	current := time.Now()
+	t.Cleanup(SetNow(func() time.Time { return current }))
+
+	tokenFirst, tokenSecond := startGame(t, "user1", "user2")
+
+	_, _, err := ClaimTimeout(tokenSecond)
+	failIfFalseFmt(t, err != nil, "expected error without time limit")
+
+	SetMoveTimeLimit(time.Minute)
+	t.Cleanup(func() { SetMoveTimeLimit(0) })
+
+	_, _, err = ClaimTimeout(tokenFirst)
+	failIfFalseFmt(t, err != nil, "expected error claiming on own move")
+	_, _, err = ClaimTimeout(tokenSecond)
+	failIfFalseFmt(t, err != nil, "expected error before time is out")
+
+	current = current.Add(20 * time.Second)
+	board, err := CurrentBoard(tokenFirst)
+	failIfError(t, err)
+	left, ok := board.TimeLeft()
+	failIfFalseFmt(t, ok && left == 40*time.Second, "unexpected time left %s", left)
+
+	current = current.Add(2 * time.Minute)
+	_, msg, err := ClaimTimeout(tokenSecond)
+	failIfError(t, err)
+	failIfFalseFmt(t, msg == "user2 wins user1", "unexpected message %q", msg)
+
+	_, _, _, termination := LastHistoryRecord()
+	failIfFalseFmt(t, termination == TerminationTimeout, "unexpected termination %q", termination)
+}
+
+// startGame registers first and second, and starts a game where first moves
+// first.
+func startGame(t *testing.T, first, second string) (tokenFirst, tokenSecond string) {
+	t.Helper()
+
+	return startGameWithRules(t, first, second, Classic())
+}
+
+func startGameWithRules(t testing.TB, first, second string, rules Rules) (tokenFirst, tokenSecond string) {
+	t.Helper()
+
+	failIfError(t, RegisterUser(first, testPassword))
+	tokenFirst, err := Login(first, testPassword)
+	failIfError(t, err)
+	failIfError(t, RegisterSelfAsParticipantWithRules(tokenFirst, SignX, rules))
+
+	failIfError(t, RegisterUser(second, testPassword))
+	tokenSecond, err = Login(second, testPassword)
+	failIfError(t, err)
+	failIfError(t, StartPlayingWithWaitingOpponent(tokenSecond, SignO, TypeUser(first)))
+
+	return tokenFirst, tokenSecond
+}
+
 var oppositeSign = map[TypeSign]TypeSign{
 	SignO: SignX,
 	SignX: SignO,
 }
 
-func failIfFalseFmt(t *testing.T, ok bool, msg string, args ...any) {
+func failIfFalseFmt(t testing.TB, ok bool, msg string, args ...any) {
 	t.Helper()
 
 	if ok {
@@ -76,7 +204,7 @@ func failIfFalseFmt(t *testing.T, ok bool, msg string, args ...any) {
 	t.Fatalf(msg, args...)
 }
 
-func failIfError(t *testing.T, err error) {
+func failIfError(t testing.TB, err error) {
 	t.Helper()
 
 	if err == nil {
@@ -85,3 +213,14 @@ func failIfError(t *testing.T, err error) {
 
 	t.Fatal(err)
 }
+
+func TestSessionTokensAreRandom(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	first := loginAs(t, "user1", RolePlayer)
+	second := loginAs(t, "user2", RolePlayer)
+	failIfFalseFmt(t, len(first) == 32 && len(second) == 32 && first != second, "unexpected tokens %q and %q", first, second)
+
+	_, err := hex.DecodeString(first)
+	failIfError(t, err)
+}
@@ -0,0 +1,206 @@
+package xo
+
+import "sync"
+
+// typeHasher computes Zobrist hashes of positions of a variant, equal for
+// positions symmetric by the rules. A hash of a position is kept for every
+// symmetry and updated by moves, the least of them is the canonical one.
+type typeHasher struct {
+	permutations [][]int
+	// cells keeps keys of the signs in every cell, the sign of the first
+	// move goes first unless the mover chooses the sign
+	cells       [][2]uint64
+	side        uint64
+	last        []uint64
+	memoryless  bool
+	choosesSign bool
+}
+
+var (
+	hashersMu sync.Mutex
+	hashers   = map[string]*typeHasher{}
+)
+
+// hasherOf returns the hasher of rules shared by the variant if it is
+// registered, or a new one.
+func hasherOf(rules Rules) *typeHasher {
+	if !registered(rules) {
+		return newHasher(rules)
+	}
+
+	hashersMu.Lock()
+	defer hashersMu.Unlock()
+
+	h, ok := hashers[rules.Name()]
+	if !ok {
+		h = newHasher(rules)
+		hashers[rules.Name()] = h
+	}
+
+	return h
+}
+
+func newHasher(rules Rules) *typeHasher {
+	pos := rules.NewPosition()
+	width, height, _ := pos.Size()
+
+	h := typeHasher{
+		cells:       make([][2]uint64, len(pos.cells)),
+		last:        make([]uint64, len(pos.cells)),
+		memoryless:  memoryless(rules),
+		choosesSign: choosesSign(rules),
+	}
+
+	// the keys do not depend on the run, so hashes may be stored
+	seed := uint64(len(pos.cells))
+	for i := range h.cells {
+		h.cells[i] = [2]uint64{splitMix64(&seed), splitMix64(&seed)}
+		h.last[i] = splitMix64(&seed)
+	}
+	h.side = splitMix64(&seed)
+
+	for _, symmetry := range symmetriesOf(rules) {
+		permutation := make([]int, len(pos.cells))
+		for _, cell := range pos.Cells() {
+			permutation[pos.index(cell)] = pos.index(symmetry(cell, width, height))
+		}
+		h.permutations = append(h.permutations, permutation)
+	}
+
+	return &h
+}
+
+// splitMix64 returns the next number of the sequence of seed.
+func splitMix64(seed *uint64) uint64 {
+	*seed += 0x9e3779b97f4a7c15
+	z := *seed
+	z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+	z = (z ^ z>>27) * 0x94d049bb133111eb
+	return z ^ z>>31
+}
+
+// slot returns the index of the key of sign in pos.
+func (h *typeHasher) slot(pos *TypePosition, sign TypeSign) int {
+	first := SignX
+	if len(pos.moves) > 0 && !h.choosesSign {
+		first = pos.moves[0].Sign
+	}
+
+	if sign == first {
+		return 0
+	}
+
+	return 1
+}
+
+// hashes returns hashes of the signs of pos for every symmetry.
+func (h *typeHasher) hashes(pos *TypePosition) []uint64 {
+	hashes := make([]uint64, len(h.permutations))
+	for i, sign := range pos.cells {
+		if sign == signNull {
+			continue
+		}
+
+		slot := h.slot(pos, sign)
+		for s, permutation := range h.permutations {
+			hashes[s] ^= h.cells[permutation[i]][slot]
+		}
+	}
+
+	return hashes
+}
+
+// played returns hashes updated by the last move of pos.
+func (h *typeHasher) played(hashes []uint64, pos *TypePosition) []uint64 {
+	last, ok := pos.LastMove()
+	if !ok {
+		return hashes
+	}
+
+	i, slot := pos.index(last.Cell), h.slot(pos, last.Sign)
+
+	next := make([]uint64, len(hashes))
+	for s, permutation := range h.permutations {
+		next[s] = hashes[s] ^ h.cells[permutation[i]][slot]
+	}
+
+	return next
+}
+
+// canonical returns the least of hashes completed by the side to move and
+// the last move if the variant depends on it.
+func (h *typeHasher) canonical(hashes []uint64, pos *TypePosition) uint64 {
+	side := uint64(0)
+	if pos.Side() == 1 {
+		side = h.side
+	}
+
+	last, hasLast := pos.LastMove()
+	hasLast = hasLast && !h.memoryless
+
+	var best uint64
+	for s, permutation := range h.permutations {
+		hash := hashes[s] ^ side
+		if hasLast {
+			hash ^= h.last[permutation[pos.index(last.Cell)]]
+		}
+
+		if s == 0 || hash < best {
+			best = hash
+		}
+	}
+
+	return best
+}
+
+// Hash returns the Zobrist hash of pos, a position of rules. Hashes are
+// equal for positions symmetric by the rules and do not change between runs.
+func Hash(rules Rules, pos *TypePosition) uint64 {
+	h := hasherOf(rules)
+	return h.canonical(h.hashes(pos), pos)
+}
+
+// Hash returns the hash of the position of board, see Hash.
+func (board *TypeBoard) Hash() uint64 { return Hash(board.rules, board.position) }
+
+// typeTable is a transposition table of a fixed number of slots, an entry
+// replaces the entry of another position in its slot.
+type typeTable[V any] struct {
+	slots []typeTableSlot[V]
+}
+
+type typeTableSlot[V any] struct {
+	hash  uint64
+	used  bool
+	value V
+}
+
+// newTable returns a table of size rounded up to a power of two slots.
+func newTable[V any](size int) *typeTable[V] {
+	n := 1
+	for n < size {
+		n <<= 1
+	}
+
+	return &typeTable[V]{slots: make([]typeTableSlot[V], n)}
+}
+
+func (t *typeTable[V]) get(hash uint64) (V, bool) {
+	slot := &t.slots[hash&uint64(len(t.slots)-1)]
+	if !slot.used || slot.hash != hash {
+		var zero V
+		return zero, false
+	}
+
+	return slot.value, true
+}
+
+func (t *typeTable[V]) put(hash uint64, value V) {
+	t.slots[hash&uint64(len(t.slots)-1)] = typeTableSlot[V]{hash: hash, used: true, value: value}
+}
+
+func (t *typeTable[V]) clear() {
+	for i := range t.slots {
+		t.slots[i] = typeTableSlot[V]{}
+	}
+}
@@ -0,0 +1,136 @@
+package xo_test
+
+import (
+	"testing"
+
+	. "github.com/ayzatziko/stuff/x/xo/xo"
+)
+
+func hashOf(t *testing.T, rules Rules, position string) uint64 {
+	t.Helper()
+
+	pos, err := ParsePosition(rules, position)
+	failIfError(t, err)
+
+	return Hash(rules, pos)
+}
+
+func TestHashSymmetries(t *testing.T) {
+	for _, tt := range []struct {
+		rules    Rules
+		position string
+		same     []string
+		other    []string
+	}{
+		{Classic(), "x0,0 o1,0", []string{"x0,2 o0,1", "x2,2 o1,2", "x2,0 o2,1", "o0,0 x1,0"}, []string{"x0,0 o0,2", "x0,1 o1,0"}},
+		{Wild(), "x0,0", []string{"x2,2"}, []string{"o0,0"}},
+		{ConnectFour(), "x5,0 o5,1", []string{"x5,6 o5,5"}, []string{"x5,0 o5,2"}},
+		{Qubic(), "x0,0,1 o1,1,1", []string{"x3,3,1 o2,2,1", "x0,3,1 o1,2,1"}, []string{"x0,0,2 o1,1,2"}},
+	} {
+		hash := hashOf(t, tt.rules, tt.position)
+		for _, position := range tt.same {
+			if other := hashOf(t, tt.rules, position); other != hash {
+				t.Errorf("%s: hashes of %q and %q differ", tt.rules.Name(), tt.position, position)
+			}
+		}
+
+		for _, position := range tt.other {
+			if other := hashOf(t, tt.rules, position); other == hash {
+				t.Errorf("%s: hashes of %q and %q are equal", tt.rules.Name(), tt.position, position)
+			}
+		}
+	}
+}
+
+func TestHashLastMove(t *testing.T) {
+	// the sub-board to play in is chosen by the last move in ultimate
+	a := hashOf(t, Ultimate(), "x1,1 o5,5 x6,8 o0,6")
+	b := hashOf(t, Ultimate(), "x6,8 o0,6 x1,1 o5,5")
+	failIfFalseFmt(t, a != b, "equal hashes of positions with different last moves")
+
+	// not in classic
+	a = hashOf(t, Classic(), "x0,0 o0,1 x1,1")
+	b = hashOf(t, Classic(), "x1,1 o0,1 x0,0")
+	failIfFalseFmt(t, a == b, "different hashes of equal positions")
+}
+
+func TestBoardHash(t *testing.T) {
+	t.Cleanup(CleanDatabase)
+
+	tokenFirst, _ := startGame(t, "user1", "user2")
+
+	cell, err := NewCell(1, 1)
+	failIfError(t, err)
+	_, _, err = MakeAMove(tokenFirst, cell)
+	failIfError(t, err)
+
+	board, err := CurrentBoard(tokenFirst)
+	failIfError(t, err)
+	failIfFalseFmt(t, board.Hash() == hashOf(t, Classic(), "x1,1"), "unexpected hash of the board")
+
+	// hashes are kept between runs
+	failIfFalseFmt(t, board.Hash() == 0xbe36f621653c618b, "hash %#x has changed", board.Hash())
+}
+
+var benchmarkPositions = []struct {
+	name     string
+	rules    Rules
+	position string
+}{
+	{"classic", Classic(), "x1,1 o0,0 x2,2"},
+	{"connect-four", ConnectFour(), "x5,3 o5,2 x4,3 o5,4 x3,3 o2,3"},
+	{"qubic", Qubic(), "x0,0,0 o1,1,1 x2,2,2 o3,3,3 x0,3,0 o3,0,3"},
+	{"ultimate", Ultimate(), "x4,4 o3,3 x0,0 o1,1 x4,5"},
+}
+
+func BenchmarkHash(b *testing.B) {
+	for _, bb := range benchmarkPositions {
+		pos, err := ParsePosition(bb.rules, bb.position)
+		failIfError(b, err)
+
+		b.Run(bb.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				Hash(bb.rules, pos)
+			}
+		})
+	}
+}
+
+func BenchmarkKey(b *testing.B) {
+	for _, bb := range benchmarkPositions {
+		pos, err := ParsePosition(bb.rules, bb.position)
+		failIfError(b, err)
+
+		b.Run(bb.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_ = pos.Key()
+			}
+		})
+	}
+}
+
+func BenchmarkBotHard(b *testing.B) {
+	for _, bb := range benchmarkPositions {
+		b.Run(bb.name, func(b *testing.B) {
+			defer CleanDatabase()
+
+			pos, err := ParsePosition(bb.rules, bb.position)
+			failIfError(b, err)
+
+			tokenFirst, tokenSecond := startGameWithRules(b, "user1", "user2", bb.rules)
+			for i, move := range pos.Moves() {
+				_, _, err := MakeAMove([]string{tokenFirst, tokenSecond}[i%2], move.Cell)
+				failIfError(b, err)
+			}
+
+			board, err := CurrentBoard(tokenFirst)
+			failIfError(b, err)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err := BotMove(board, BotLevelHard)
+				failIfError(b, err)
+			}
+		})
+	}
+}
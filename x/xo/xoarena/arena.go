@@ -0,0 +1,254 @@
+// Package xoarena plays games between xo players to compare their strength
+// and to regression-test rules: built-in bots, external engines and a random
+// mover.
+package xoarena
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/ayzatziko/stuff/x/xo/xo"
+	"github.com/ayzatziko/stuff/x/xo/xoengine"
+	"github.com/ayzatziko/stuff/xerrors"
+)
+
+// Player chooses moves of games, it is called by the parallel games at once.
+type Player interface {
+	Name() string
+	// Move returns a move placing sign in pos of rules.
+	Move(rules xo.Rules, pos *xo.TypePosition, sign xo.TypeSign) (xo.TypeMove, error)
+}
+
+type botPlayer struct {
+	name  string
+	level xo.TypeBotLevel
+}
+
+// Bot plays by the built-in bot of level.
+func Bot(level xo.TypeBotLevel) Player { return botPlayer{level.String(), level} }
+
+// Random plays random legal moves.
+func Random() Player { return botPlayer{"random", xo.BotLevelEasy} }
+
+func (p botPlayer) Name() string { return p.name }
+
+func (p botPlayer) Move(rules xo.Rules, pos *xo.TypePosition, sign xo.TypeSign) (xo.TypeMove, error) {
+	return xo.BotMoveAt(rules, pos, sign, p.level)
+}
+
+type enginePlayer struct {
+	name    string
+	engines chan *xoengine.Engine
+}
+
+// Engines plays by a pool of engines, a game takes an engine for a move, so
+// parallel games need as many engines.
+func Engines(engines ...*xoengine.Engine) Player {
+	pool := make(chan *xoengine.Engine, len(engines))
+	for _, e := range engines {
+		pool <- e
+	}
+
+	return enginePlayer{name: engines[0].Name, engines: pool}
+}
+
+func (p enginePlayer) Name() string { return p.name }
+
+func (p enginePlayer) Move(rules xo.Rules, pos *xo.TypePosition, sign xo.TypeSign) (xo.TypeMove, error) {
+	e := <-p.engines
+	defer func() { p.engines <- e }()
+
+	return e.Move(rules, pos, sign, 0)
+}
+
+// TypeGame is a played game, the players are the first and the second of
+// Run by Players.
+type TypeGame struct {
+	Index int
+	// First is the index of the player moving first.
+	First int
+	Signs [2]xo.TypeSign
+	// Winner is the index of the winner, -1 for a draw.
+	Winner int
+	Moves  []xo.TypeMove
+	// Err is the failure forfeiting the game.
+	Err error
+}
+
+// TypeReport sums up games from the view of the first player.
+type TypeReport struct {
+	Players              [2]string
+	Wins, Draws, Losses  int
+	Games                []TypeGame
+	threeDimensionalLogs bool
+}
+
+// Run plays games of rules between players at most parallel at once. The
+// players alternate the first move every game and the signs every two
+// games.
+func Run(rules xo.Rules, first, second Player, games, parallel int) (_ TypeReport, err error) {
+	defer xerrors.Wrap(&err, "Run(%s, %s, %s)", rules.Name(), first.Name(), second.Name())
+
+	if games < 1 {
+		return TypeReport{}, fmt.Errorf("no games")
+	} else if parallel < 1 {
+		parallel = 1
+	}
+
+	_, _, depth := rules.NewPosition().Size()
+	report := TypeReport{
+		Players:              [2]string{first.Name(), second.Name()},
+		Games:                make([]TypeGame, games),
+		threeDimensionalLogs: depth > 1,
+	}
+
+	var (
+		wg      sync.WaitGroup
+		indexes = make(chan int)
+	)
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				report.Games[i] = play(rules, [2]Player{first, second}, i)
+			}
+		}()
+	}
+
+	for i := 0; i < games; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	for _, g := range report.Games {
+		switch g.Winner {
+		case 0:
+			report.Wins++
+		case 1:
+			report.Losses++
+		default:
+			report.Draws++
+		}
+	}
+
+	return report, nil
+}
+
+// play plays game i, a player failing to move loses.
+func play(rules xo.Rules, players [2]Player, i int) TypeGame {
+	g := TypeGame{Index: i, First: i % 2, Winner: -1}
+	g.Signs[g.First], g.Signs[1-g.First] = xo.SignX, xo.SignO
+	if i/2%2 == 1 {
+		g.Signs[0], g.Signs[1] = g.Signs[1], g.Signs[0]
+	}
+
+	pos := rules.NewPosition()
+	for !rules.Terminal(pos) {
+		// sides of the position count from the first move
+		player := (g.First + pos.Side()) % 2
+
+		move, err := players[player].Move(rules, pos.Clone(), g.Signs[player])
+		if err == nil {
+			if move.Sign == "" {
+				move.Sign = g.Signs[player]
+			}
+			err = rules.ApplyMove(pos, move)
+		}
+
+		if err != nil {
+			g.Winner, g.Err = 1-player, fmt.Errorf("%s: %w", players[player].Name(), err)
+			g.Moves = pos.Moves()
+			return g
+		}
+	}
+
+	if side, ok := rules.Winner(pos); ok {
+		g.Winner = (g.First + side) % 2
+	}
+	g.Moves = pos.Moves()
+
+	return g
+}
+
+// constZ is the quantile of the normal distribution for 95% confidence.
+const constZ = 1.96
+
+// Interval returns the 95% Wilson score interval of the rate of k outcomes
+// of n games.
+func Interval(k, n int) (low, high float64) {
+	if n == 0 {
+		return 0, 1
+	}
+
+	p, nf := float64(k)/float64(n), float64(n)
+	denominator := 1 + constZ*constZ/nf
+	center := (p + constZ*constZ/(2*nf)) / denominator
+	margin := constZ * math.Sqrt(p*(1-p)/nf+constZ*constZ/(4*nf*nf)) / denominator
+
+	return math.Max(0, center-margin), math.Min(1, center+margin)
+}
+
+// Score returns the share of points of the first player, a draw is half a
+// point, with the 95% confidence interval of the normal approximation.
+func (r TypeReport) Score() (score, low, high float64) {
+	n := float64(len(r.Games))
+	score = (float64(r.Wins) + float64(r.Draws)/2) / n
+
+	// variance of the points of a game
+	variance := (float64(r.Wins)*(1-score)*(1-score) + float64(r.Draws)*(0.5-score)*(0.5-score) + float64(r.Losses)*score*score) / n
+	margin := constZ * math.Sqrt(variance/n)
+
+	return score, math.Max(0, score-margin), math.Min(1, score+margin)
+}
+
+func (r TypeReport) String() string {
+	n := len(r.Games)
+	rate := func(name string, k int) string {
+		low, high := Interval(k, n)
+		return fmt.Sprintf("%-6s %5d %6.1f%% [%5.1f%%, %5.1f%%]\n", name, k, 100*float64(k)/float64(n), 100*low, 100*high)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s vs %s, %d games\n", r.Players[0], r.Players[1], n)
+	b.WriteString(rate("wins", r.Wins))
+	b.WriteString(rate("draws", r.Draws))
+	b.WriteString(rate("losses", r.Losses))
+
+	score, low, high := r.Score()
+	fmt.Fprintf(&b, "score  %12.1f%% [%5.1f%%, %5.1f%%]\n", 100*score, 100*low, 100*high)
+
+	return b.String()
+}
+
+// WriteLog writes a line of every game with the moves and the result.
+func (r TypeReport) WriteLog(w io.Writer) error {
+	for _, g := range r.Games {
+		moves := make([]string, len(g.Moves))
+		for i, m := range g.Moves {
+			moves[i] = xo.FormatMove(m, r.threeDimensionalLogs)
+		}
+
+		result := "draw"
+		if g.Winner >= 0 {
+			result = r.Players[g.Winner] + " wins"
+		}
+		if g.Err != nil {
+			result += " by forfeit: " + g.Err.Error()
+		}
+
+		first, second := g.First, 1-g.First
+		_, err := fmt.Fprintf(w, "game %d: %s(%s) %s(%s): %s: %s\n",
+			g.Index+1, r.Players[first], g.Signs[first], r.Players[second], g.Signs[second], strings.Join(moves, " "), result)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
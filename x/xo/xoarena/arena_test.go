@@ -0,0 +1,139 @@
+package xoarena_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ayzatziko/stuff/x/xo/xo"
+	"github.com/ayzatziko/stuff/x/xo/xoarena"
+	"github.com/ayzatziko/stuff/x/xo/xoengine"
+)
+
+func TestRun(t *testing.T) {
+	report, err := xoarena.Run(xo.Classic(), xoarena.Bot(xo.BotLevelHard), xoarena.Random(), 40, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Losses != 0 {
+		t.Fatalf("hard bot lost to random mover:\n%s", report)
+	} else if report.Wins+report.Draws != 40 || report.Wins == 0 {
+		t.Fatalf("unexpected report:\n%s", report)
+	}
+
+	var first, x [2]int
+	for i, g := range report.Games {
+		if g.Index != i || g.Err != nil || len(g.Moves) < 5 {
+			t.Fatalf("unexpected game %+v", g)
+		}
+		first[g.First]++
+		if g.Signs[0] == xo.SignX {
+			x[0]++
+		}
+	}
+	if first[0] != 20 || x[0] != 20 {
+		t.Fatalf("first moves %v and signs x %v are not alternated", first, x)
+	}
+
+	var log bytes.Buffer
+	if err := report.WriteLog(&log); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(log.String()), "\n")
+	if len(lines) != 40 || !strings.HasPrefix(lines[1], "game 2: random(x) hard(o): x") {
+		t.Fatalf("unexpected log:\n%s", log.String())
+	}
+}
+
+// failing player makes the illegal move to the first cell.
+type failing struct{}
+
+func (failing) Name() string { return "failing" }
+
+func (failing) Move(rules xo.Rules, pos *xo.TypePosition, sign xo.TypeSign) (xo.TypeMove, error) {
+	cell, err := xo.NewCell(0, 0)
+	return xo.TypeMove{Cell: cell, Sign: sign}, err
+}
+
+func TestForfeit(t *testing.T) {
+	report, err := xoarena.Run(xo.Classic(), failing{}, xoarena.Random(), 4, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Losses != 4 {
+		t.Fatalf("failing player has not forfeited:\n%s", report)
+	}
+	for _, g := range report.Games {
+		if g.Err == nil || !strings.HasPrefix(g.Err.Error(), "failing: ") {
+			t.Fatalf("unexpected error %v", g.Err)
+		}
+	}
+}
+
+func TestEngines(t *testing.T) {
+	engines := make([]*xoengine.Engine, 2)
+	for i := range engines {
+		engineIn, adapterOut := io.Pipe()
+		adapterIn, engineOut := io.Pipe()
+		go func() {
+			xoengine.Serve(engineIn, engineOut, "engine", xoengine.BotChooser(xo.BotLevelMedium))
+			engineOut.Close()
+		}()
+
+		e, err := xoengine.NewEngine(adapterIn, adapterOut)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.MoveTime = time.Second
+		t.Cleanup(func() { e.Close() })
+		engines[i] = e
+	}
+
+	report, err := xoarena.Run(xo.ConnectFour(), xoarena.Engines(engines...), xoarena.Bot(xo.BotLevelEasy), 4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Players != [2]string{"engine", "easy"} || report.Wins+report.Draws+report.Losses != 4 {
+		t.Fatalf("unexpected report:\n%s", report)
+	}
+	for _, g := range report.Games {
+		if g.Err != nil {
+			t.Fatal(g.Err)
+		}
+	}
+}
+
+func TestInterval(t *testing.T) {
+	for _, tt := range []struct {
+		k, n      int
+		low, high float64
+	}{
+		{5, 10, 0.2366, 0.7634},
+		{0, 10, 0, 0.2775},
+		{10, 10, 0.7225, 1},
+		{0, 0, 0, 1},
+	} {
+		low, high := xoarena.Interval(tt.k, tt.n)
+		if math.Abs(low-tt.low) > 1e-4 || math.Abs(high-tt.high) > 1e-4 {
+			t.Errorf("Interval(%d, %d) = %.4f, %.4f, want %.4f, %.4f", tt.k, tt.n, low, high, tt.low, tt.high)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	report := xoarena.TypeReport{Wins: 2, Draws: 2, Games: make([]xoarena.TypeGame, 4)}
+	if score, low, high := report.Score(); score != 0.75 || low >= score || math.Abs(high-0.995) > 1e-3 {
+		t.Fatalf("unexpected score %v [%v, %v]", score, low, high)
+	}
+
+	if s := fmt.Sprint(report); !strings.Contains(s, "draws      2   50.0%") {
+		t.Fatalf("unexpected report:\n%s", s)
+	}
+}
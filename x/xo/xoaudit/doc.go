@@ -0,0 +1,3 @@
+// Package xoaudit stores the xo audit log, see xo.SetAuditSink, in a file of
+// JSON lines or in a database table.
+package xoaudit
@@ -0,0 +1,113 @@
+package xoaudit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ayzatziko/stuff/x/xo/xo"
+	"github.com/ayzatziko/stuff/xerrors"
+)
+
+// FileSink appends records to a file as JSON lines, every record is synced
+// to the disk.
+type FileSink struct {
+	mu   sync.Mutex
+	f    *os.File
+	last xo.TypeAuditRecord
+	ok   bool
+}
+
+// OpenFile opens or creates the log file at path.
+func OpenFile(path string) (_ *FileSink, err error) {
+	defer xerrors.Wrap(&err, "xoaudit: OpenFile(%s)", path)
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &FileSink{f: f}
+	err = s.scan(context.Background(), func(r xo.TypeAuditRecord) { s.last, s.ok = r, true })
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// scan calls f with every record of the file unless ctx is done.
+func (s *FileSink) scan(ctx context.Context, f func(xo.TypeAuditRecord)) error {
+	if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	// records are decoded as a stream, lines are not limited in length
+	dec := json.NewDecoder(bufio.NewReader(s.f))
+	for n := 1; ; n++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var r xo.TypeAuditRecord
+		if err := dec.Decode(&r); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("record %d: %w", n, err)
+		}
+		f(r)
+	}
+}
+
+func (s *FileSink) Append(_ context.Context, record xo.TypeAuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.f.Write(append(data, '\n')); err != nil {
+		return err
+	} else if err := s.f.Sync(); err != nil {
+		return err
+	}
+
+	s.last, s.ok = record, true
+
+	return nil
+}
+
+func (s *FileSink) Last(context.Context) (xo.TypeAuditRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.last, s.ok, nil
+}
+
+func (s *FileSink) Query(ctx context.Context, user xo.TypeUser, from, to time.Time) ([]xo.TypeAuditRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var records []xo.TypeAuditRecord
+	err := s.scan(ctx, func(r xo.TypeAuditRecord) {
+		if xo.MatchAudit(r, user, from, to) {
+			records = append(records, r)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("xoaudit: Query(%s): %w", user, err)
+	}
+
+	return records, nil
+}
+
+func (s *FileSink) Close() error { return s.f.Close() }
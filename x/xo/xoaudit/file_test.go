@@ -0,0 +1,122 @@
+package xoaudit_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ayzatziko/stuff/x/xo/xo"
+	"github.com/ayzatziko/stuff/x/xo/xoaudit"
+)
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	sink, err := xoaudit.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := xo.SetAuditSink(sink); err != nil {
+		t.Fatal(err)
+	}
+
+	register(t, "audit1")
+	if err := xo.FlushAudit(); err != nil {
+		t.Fatal(err)
+	}
+	sink.Close()
+
+	// the log continues after reopening
+	sink, err = xoaudit.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sink.Close() })
+	if err := xo.SetAuditSink(sink); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { xo.SetAuditSink(&xo.MemoryAuditSink{}) })
+
+	register(t, "audit2")
+	if _, err := xo.Login(strings.Repeat("a", 40000), "x"); !errors.Is(err, xo.ErrUserNotFound) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := xo.Login("audit2", "password"); err != nil {
+		t.Fatal(err)
+	} else if err := xo.FlushAudit(); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := sink.Query(context.Background(), "", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(records) != 4 {
+		t.Fatalf("got %d records, want 4: %+v", len(records), records)
+	} else if err := xo.VerifyAudit(records); err != nil {
+		t.Fatal(err)
+	} else if failed := records[2]; failed.Action != xo.AuditLoginFailed || len(failed.User) > 64 || len(failed.Detail) > 256 {
+		t.Fatalf("unexpected record of failed login %+v", failed)
+	}
+
+	records, err = sink.Query(context.Background(), "audit2", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(records) != 2 || records[1].Action != xo.AuditLogin {
+		t.Fatalf("unexpected records %+v", records)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := strings.Replace(string(data), `"user":"audit1"`, `"user":"audit3"`, 1)
+	if err := os.WriteFile(path, []byte(tampered), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err = sink.Query(context.Background(), "", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	} else if err := xo.VerifyAudit(records); !errors.Is(err, xo.ErrAuditTampered) {
+		t.Fatalf("tampering is not detected: %v", err)
+	}
+}
+
+func TestFileLongRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	sink, err := xoaudit.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := xo.TypeAuditRecord{Action: "note", Detail: strings.Repeat("d", 1<<17)}
+	if err := sink.Append(context.Background(), record); err != nil {
+		t.Fatal(err)
+	}
+	sink.Close()
+
+	sink, err = xoaudit.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sink.Close() })
+
+	records, err := sink.Query(context.Background(), "", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(records) != 1 || records[0].Detail != record.Detail {
+		t.Fatalf("unexpected records of %d", len(records))
+	}
+}
+
+func register(t *testing.T, user string) {
+	t.Helper()
+
+	if err := xo.RegisterUser(user, "password"); err != nil {
+		t.Fatal(err)
+	}
+}
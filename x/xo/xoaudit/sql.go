@@ -0,0 +1,116 @@
+package xoaudit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ayzatziko/stuff/x/xo/xo"
+)
+
+// SQLSink stores records in the xo_audit table of a PostgreSQL database,
+// times are kept in nanoseconds to keep the hashes valid.
+type SQLSink struct {
+	DB *sql.DB
+}
+
+// Migrate creates the xo_audit table.
+func Migrate(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `create table if not exists xo_audit(
+	seq bigint primary key,
+	time_ns bigint not null,
+	username text not null,
+	action text not null,
+	target text not null,
+	detail text not null,
+	trace_id text not null,
+	address text not null,
+	prev text not null,
+	hash text not null
+);
+create index if not exists xo_audit_username on xo_audit(username);
+create index if not exists xo_audit_target on xo_audit(target);`)
+	if err != nil {
+		return fmt.Errorf("xoaudit: Migrate: %w", err)
+	}
+
+	return nil
+}
+
+const sqlColumns = `seq, time_ns, username, action, target, detail, trace_id, address, prev, hash`
+
+func (s SQLSink) Append(ctx context.Context, r xo.TypeAuditRecord) error {
+	_, err := s.DB.ExecContext(ctx, `insert into xo_audit(`+sqlColumns+`) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		int64(r.Seq), r.Time.UnixNano(), string(r.User), r.Action, string(r.Target), r.Detail, r.TraceID, r.Address, r.Prev, r.Hash)
+	if err != nil {
+		return fmt.Errorf("xoaudit: Append(%d): %w", r.Seq, err)
+	}
+
+	return nil
+}
+
+func (s SQLSink) Last(ctx context.Context) (xo.TypeAuditRecord, bool, error) {
+	records, err := s.query(ctx, `select `+sqlColumns+` from xo_audit order by seq desc limit 1`)
+	if err != nil || len(records) == 0 {
+		return xo.TypeAuditRecord{}, false, err
+	}
+
+	return records[0], true, nil
+}
+
+func (s SQLSink) Query(ctx context.Context, user xo.TypeUser, from, to time.Time) ([]xo.TypeAuditRecord, error) {
+	var (
+		conditions []string
+		args       []any
+	)
+	if user != "" {
+		args = append(args, string(user))
+		conditions = append(conditions, fmt.Sprintf("(username = $%d or target = $%[1]d)", len(args)))
+	}
+	if !from.IsZero() {
+		args = append(args, from.UnixNano())
+		conditions = append(conditions, fmt.Sprintf("time_ns >= $%d", len(args)))
+	}
+	if !to.IsZero() {
+		args = append(args, to.UnixNano())
+		conditions = append(conditions, fmt.Sprintf("time_ns < $%d", len(args)))
+	}
+
+	query := `select ` + sqlColumns + ` from xo_audit`
+	if len(conditions) > 0 {
+		query += ` where ` + strings.Join(conditions, " and ")
+	}
+
+	return s.query(ctx, query+` order by seq`, args...)
+}
+
+func (s SQLSink) query(ctx context.Context, query string, args ...any) (_ []xo.TypeAuditRecord, err error) {
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("xoaudit: %w", err)
+	}
+	defer rows.Close()
+
+	var records []xo.TypeAuditRecord
+	for rows.Next() {
+		var (
+			r            xo.TypeAuditRecord
+			seq, timeNs  int64
+			user, target string
+		)
+		if err := rows.Scan(&seq, &timeNs, &user, &r.Action, &target, &r.Detail, &r.TraceID, &r.Address, &r.Prev, &r.Hash); err != nil {
+			return nil, fmt.Errorf("xoaudit: %w", err)
+		}
+
+		r.Seq, r.Time, r.User, r.Target = uint64(seq), time.Unix(0, timeNs), xo.TypeUser(user), xo.TypeUser(target)
+		records = append(records, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("xoaudit: %w", err)
+	}
+
+	return records, nil
+}
@@ -0,0 +1,273 @@
+package xoaudit_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ayzatziko/stuff/x/xo/xo"
+	"github.com/ayzatziko/stuff/x/xo/xoaudit"
+)
+
+func TestSQL(t *testing.T) {
+	database := &fakeDatabase{}
+	db := sql.OpenDB(database)
+	t.Cleanup(func() { db.Close() })
+
+	if err := xoaudit.Migrate(context.Background(), db); err != nil {
+		t.Fatal(err)
+	} else if err := xoaudit.Migrate(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+
+	sink := xoaudit.SQLSink{DB: db}
+	if err := xo.SetAuditSink(sink); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { xo.SetAuditSink(&xo.MemoryAuditSink{}) })
+
+	ctx := xo.WithClientAddress(xo.WithTraceID(context.Background(), "trace1"), "192.0.2.1")
+	if err := xo.RegisterUserContext(ctx, "sql1", "password"); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	register(t, "sql2")
+	if _, err := xo.Login("sql2", "password"); err != nil {
+		t.Fatal(err)
+	} else if err := xo.FlushAudit(); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := sink.Query(context.Background(), "", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(records) != 3 {
+		t.Fatalf("got %d records, want 3: %+v", len(records), records)
+	} else if err := xo.VerifyAudit(records); err != nil {
+		t.Fatal(err)
+	} else if r := records[0]; r.User != "sql1" || r.TraceID != "trace1" || r.Address != "192.0.2.1" {
+		t.Fatalf("unexpected record %+v", r)
+	}
+
+	last, ok, err := sink.Last(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	} else if !ok || last != records[2] {
+		t.Fatalf("got last record %+v, want %+v", last, records[2])
+	}
+
+	records, err = sink.Query(context.Background(), "sql2", start, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(records) != 2 || records[1].Action != xo.AuditLogin {
+		t.Fatalf("unexpected records %+v", records)
+	}
+
+	records, err = sink.Query(context.Background(), "", time.Time{}, start)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(records) != 1 || records[0].User != "sql1" {
+		t.Fatalf("unexpected records %+v", records)
+	}
+
+	// a record is appended once
+	if err := sink.Append(context.Background(), last); err == nil {
+		t.Fatal("duplicate record is appended")
+	}
+
+	// the record hashes the trace ID and the address
+	database.mu.Lock()
+	database.rows[0][6] = "trace2"
+	database.mu.Unlock()
+	records, err = sink.Query(context.Background(), "", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	} else if err := xo.VerifyAudit(records); !errors.Is(err, xo.ErrAuditTampered) {
+		t.Fatalf("tampering is not detected: %v", err)
+	}
+}
+
+// fakeDatabase is an in-memory database/sql driver which understands the
+// statements of SQLSink only.
+type fakeDatabase struct {
+	mu      sync.Mutex
+	columns []string
+	rows    [][]driver.Value
+}
+
+var (
+	createPattern = regexp.MustCompile(`(?s)^create table if not exists xo_audit\((.*?)\);`)
+	insertPattern = regexp.MustCompile(`^insert into xo_audit\((.*?)\) values`)
+	selectPattern = regexp.MustCompile(`^select (.*?) from xo_audit(?: where (.*?))? order by seq( desc limit 1)?$`)
+	userPattern   = regexp.MustCompile(`^\(username = \$(\d+) or target = \$(\d+)\)$`)
+	timePattern   = regexp.MustCompile(`^time_ns (>=|<) \$(\d+)$`)
+)
+
+func (d *fakeDatabase) Connect(context.Context) (driver.Conn, error) { return fakeConn{d}, nil }
+
+func (d *fakeDatabase) Driver() driver.Driver { return nil }
+
+type fakeConn struct{ d *fakeDatabase }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{c.d, query}, nil }
+
+func (fakeConn) Close() error { return nil }
+
+func (fakeConn) Begin() (driver.Tx, error) { return nil, errors.New("transactions are not supported") }
+
+type fakeStmt struct {
+	d     *fakeDatabase
+	query string
+}
+
+func (fakeStmt) Close() error { return nil }
+
+func (fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if m := createPattern.FindStringSubmatch(s.query); m != nil {
+		if strings.Contains(s.query, "alter table") {
+			return nil, errors.New("columns are added to the created table")
+		}
+
+		var columns []string
+		for _, definition := range strings.Split(m[1], ",") {
+			columns = append(columns, strings.Fields(definition)[0])
+		}
+		if s.d.columns != nil && !equal(s.d.columns, columns) {
+			return nil, fmt.Errorf("table exists with columns %q", s.d.columns)
+		}
+		s.d.columns = columns
+
+		return driver.RowsAffected(0), nil
+	}
+
+	m := insertPattern.FindStringSubmatch(s.query)
+	if m == nil {
+		return nil, fmt.Errorf("unexpected statement %q", s.query)
+	} else if s.d.columns == nil {
+		return nil, errors.New("no such table")
+	} else if columns := strings.Split(m[1], ", "); !equal(columns, s.d.columns) || len(args) != len(columns) {
+		return nil, fmt.Errorf("unexpected columns %q", columns)
+	}
+
+	for _, row := range s.d.rows {
+		if row[0] == args[0] {
+			return nil, fmt.Errorf("duplicate key seq = %v", args[0])
+		}
+	}
+	s.d.rows = append(s.d.rows, append([]driver.Value(nil), args...))
+
+	return driver.RowsAffected(1), nil
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	m := selectPattern.FindStringSubmatch(s.query)
+	if m == nil {
+		return nil, fmt.Errorf("unexpected statement %q", s.query)
+	} else if columns := strings.Split(m[1], ", "); !equal(columns, s.d.columns) {
+		return nil, fmt.Errorf("unexpected columns %q", columns)
+	}
+
+	var conditions []func(row []driver.Value) bool
+	if m[2] != "" {
+		for _, condition := range strings.Split(m[2], " and ") {
+			f, err := parseCondition(condition, args)
+			if err != nil {
+				return nil, err
+			}
+			conditions = append(conditions, f)
+		}
+	}
+
+	rows := &fakeRows{columns: s.d.columns}
+	for _, row := range s.d.rows {
+		matched := true
+		for _, f := range conditions {
+			matched = matched && f(row)
+		}
+		if matched {
+			rows.rows = append(rows.rows, append([]driver.Value(nil), row...))
+		}
+	}
+
+	// rows are appended in the order of seq
+	if m[3] != "" && len(rows.rows) > 0 {
+		rows.rows = rows.rows[len(rows.rows)-1:]
+	}
+
+	return rows, nil
+}
+
+func parseCondition(condition string, args []driver.Value) (func(row []driver.Value) bool, error) {
+	arg := func(n string) driver.Value {
+		i, _ := strconv.Atoi(n)
+		if i < 1 || i > len(args) {
+			return nil
+		}
+		return args[i-1]
+	}
+
+	if m := userPattern.FindStringSubmatch(condition); m != nil {
+		user := arg(m[1])
+		return func(row []driver.Value) bool { return row[2] == user || row[4] == user }, nil
+	} else if m := timePattern.FindStringSubmatch(condition); m != nil {
+		t, ok := arg(m[2]).(int64)
+		if !ok {
+			return nil, fmt.Errorf("unexpected argument of %q", condition)
+		} else if m[1] == ">=" {
+			return func(row []driver.Value) bool { return row[1].(int64) >= t }, nil
+		}
+		return func(row []driver.Value) bool { return row[1].(int64) < t }, nil
+	}
+
+	return nil, fmt.Errorf("unexpected condition %q", condition)
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
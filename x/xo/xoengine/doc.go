@@ -0,0 +1,30 @@
+// Package xoengine runs xo bots written in any language as subprocesses
+// talking a line-oriented protocol over stdin and stdout, like UCI of chess
+// engines.
+//
+// The adapter sends commands to the engine, one per line:
+//
+//	xo                               starts the session, the engine replies
+//	                                 with optional id lines and xook:
+//	                                 id name <name>
+//	                                 id author <author>
+//	                                 xook
+//	isready                          the engine replies with readyok when it
+//	                                 has processed the previous commands
+//	position <variant> [moves <move>...]
+//	                                 sets the position by the moves played
+//	                                 from the start, moves are formatted like
+//	                                 xo.FormatMove: x0,0 o1,1 x2,2,3
+//	go sign <sign> [timeleft <ms>] [movetime <ms>]
+//	                                 asks for a move placing sign, timeleft is
+//	                                 the time left for the move by the game
+//	                                 clock, movetime is the time the adapter
+//	                                 waits for the reply:
+//	                                 bestmove <move>
+//	quit                             ends the session
+//
+// Rows, columns and layers count from zero. The sign of bestmove is the sign
+// of go unless the variant lets the mover choose it. An engine failing to
+// choose a move replies with bestmove none. Engines may send info lines at
+// any time, they are ignored like other unknown lines.
+package xoengine
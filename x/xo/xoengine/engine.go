@@ -0,0 +1,242 @@
+package xoengine
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ayzatziko/stuff/x/xo/xo"
+	"github.com/ayzatziko/stuff/xerrors"
+)
+
+var (
+	ErrTimeout = errors.New("engine timed out")
+	ErrClosed  = errors.New("engine closed")
+)
+
+const (
+	// constHandshakeTimeout is the time an engine has to reply with xook.
+	constHandshakeTimeout = 5 * time.Second
+	// constMoveTime is the time an engine has for a move when the game is
+	// played without time limit.
+	constMoveTime = 10 * time.Second
+	// constQuitTimeout is the time an engine has to exit after quit.
+	constQuitTimeout = time.Second
+)
+
+// Engine is the adapter of an engine process. Engines that time out or
+// break the protocol are not asked for moves anymore.
+type Engine struct {
+	// Name is sent by the engine in the handshake.
+	Name string
+	// MoveTime bounds the time for a move, the game clock may leave less.
+	MoveTime time.Duration
+
+	cmd *exec.Cmd
+	w   io.WriteCloser
+	// lines of the engine, closed when its output ends
+	lines chan string
+	done  chan struct{}
+
+	mu     sync.Mutex
+	err    error
+	closed bool
+}
+
+// Start spawns the engine command and makes the handshake.
+func Start(name string, args ...string) (_ *Engine, err error) {
+	defer xerrors.Wrap(&err, "Start(%s)", name)
+
+	cmd := exec.Command(name, args...)
+
+	w, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	e, err := newEngine(r, w)
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, err
+	}
+	e.cmd = cmd
+
+	return e, nil
+}
+
+// NewEngine makes the handshake with an engine reading w and writing r,
+// e.g. one running in the same process.
+func NewEngine(r io.Reader, w io.WriteCloser) (_ *Engine, err error) {
+	defer xerrors.Wrap(&err, "NewEngine")
+
+	return newEngine(r, w)
+}
+
+func newEngine(r io.Reader, w io.WriteCloser) (*Engine, error) {
+	e := &Engine{MoveTime: constMoveTime, w: w, lines: make(chan string), done: make(chan struct{})}
+	go e.read(r)
+
+	if err := e.send("xo"); err != nil {
+		return nil, err
+	}
+
+	for {
+		line, err := e.receive(constHandshakeTimeout)
+		if err != nil {
+			return nil, err
+		}
+
+		if line == "xook" {
+			return e, nil
+		} else if strings.HasPrefix(line, "id name ") {
+			e.Name = strings.TrimPrefix(line, "id name ")
+		}
+	}
+}
+
+func (e *Engine) read(r io.Reader) {
+	defer close(e.lines)
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		select {
+		case e.lines <- strings.TrimSpace(s.Text()):
+		case <-e.done:
+			return
+		}
+	}
+}
+
+func (e *Engine) send(line string) error {
+	_, err := io.WriteString(e.w, line+"\n")
+	return err
+}
+
+// receive returns the next line of the engine waiting up to timeout.
+func (e *Engine) receive(timeout time.Duration) (string, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case line, ok := <-e.lines:
+		if !ok {
+			return "", ErrClosed
+		}
+
+		return line, nil
+	case <-timer.C:
+		return "", fmt.Errorf("%w after %s", ErrTimeout, timeout)
+	}
+}
+
+// Move asks the engine for a move placing sign in pos of rules. timeLeft is
+// the time left by the game clock, zero for games without time limit.
+func (e *Engine) Move(rules xo.Rules, pos *xo.TypePosition, sign xo.TypeSign, timeLeft time.Duration) (_ xo.TypeMove, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	defer xerrors.Wrap(&err, "Move(%s, %s)", e.Name, rules.Name())
+
+	if e.err != nil {
+		return xo.TypeMove{}, e.err
+	}
+
+	move, err := e.move(rules, pos, sign, timeLeft)
+	if errors.Is(err, ErrTimeout) || errors.Is(err, ErrClosed) {
+		// a late reply would answer the next request
+		e.err = err
+	}
+
+	return move, err
+}
+
+func (e *Engine) move(rules xo.Rules, pos *xo.TypePosition, sign xo.TypeSign, timeLeft time.Duration) (xo.TypeMove, error) {
+	position := "position " + rules.Name()
+	if moves := xo.FormatPosition(pos); moves != "" {
+		position += " moves " + moves
+	}
+
+	moveTime := e.MoveTime
+	if timeLeft > 0 && timeLeft < moveTime {
+		moveTime = timeLeft
+	}
+
+	goCmd := fmt.Sprintf("go sign %s movetime %d", sign, moveTime.Milliseconds())
+	if timeLeft > 0 {
+		goCmd += fmt.Sprintf(" timeleft %d", timeLeft.Milliseconds())
+	}
+
+	if err := e.send(position); err != nil {
+		return xo.TypeMove{}, err
+	} else if err := e.send(goCmd); err != nil {
+		return xo.TypeMove{}, err
+	}
+
+	deadline := time.Now().Add(moveTime)
+	for {
+		line, err := e.receive(time.Until(deadline))
+		if err != nil {
+			return xo.TypeMove{}, err
+		}
+
+		if !strings.HasPrefix(line, "bestmove ") {
+			continue
+		}
+
+		reply := strings.TrimPrefix(line, "bestmove ")
+		if reply == "none" {
+			return xo.TypeMove{}, fmt.Errorf("engine has no move")
+		}
+
+		return xo.ParseMove(reply)
+	}
+}
+
+// Close ends the session and waits for the engine process to exit, it is
+// killed if it does not exit in time.
+func (e *Engine) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+
+	if !errors.Is(e.err, ErrClosed) {
+		e.send("quit")
+	}
+	e.w.Close()
+	e.err = ErrClosed
+	close(e.done)
+
+	if e.cmd == nil {
+		return nil
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- e.cmd.Wait() }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(constQuitTimeout):
+		e.cmd.Process.Kill()
+		return <-done
+	}
+}
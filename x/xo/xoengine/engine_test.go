@@ -0,0 +1,234 @@
+package xoengine_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ayzatziko/stuff/x/xo/xo"
+	"github.com/ayzatziko/stuff/x/xo/xoengine"
+)
+
+// TestMain runs the test binary as the reference engine for the tests
+// spawning it.
+func TestMain(m *testing.M) {
+	if os.Getenv("XOENGINE_REFERENCE") == "" {
+		os.Exit(m.Run())
+	}
+
+	delay, _ := time.ParseDuration(os.Getenv("XOENGINE_DELAY"))
+	choose := xoengine.BotChooser(xo.BotLevelMedium)
+	err := xoengine.Serve(os.Stdin, os.Stdout, "reference", func(rules xo.Rules, pos *xo.TypePosition, sign xo.TypeSign, timeLeft time.Duration) (xo.TypeMove, error) {
+		time.Sleep(delay)
+		return choose(rules, pos, sign, timeLeft)
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func startEngine(t *testing.T, delay time.Duration) *xoengine.Engine {
+	t.Helper()
+
+	t.Setenv("XOENGINE_REFERENCE", "1")
+	t.Setenv("XOENGINE_DELAY", delay.String())
+
+	e, err := xoengine.Start(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { e.Close() })
+
+	return e
+}
+
+func position(t *testing.T, rules xo.Rules, s string) *xo.TypePosition {
+	t.Helper()
+
+	pos, err := xo.ParsePosition(rules, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pos
+}
+
+func TestMove(t *testing.T) {
+	e := startEngine(t, 0)
+	if e.Name != "reference" {
+		t.Fatalf("unexpected engine name %q", e.Name)
+	}
+
+	move, err := e.Move(xo.Classic(), position(t, xo.Classic(), "x0,0 o1,0 x0,1 o1,1"), xo.SignX, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	} else if got := xo.FormatMove(move, false); got != "x0,2" {
+		t.Fatalf("got move %s, want winning x0,2", got)
+	}
+
+	move, err = e.Move(xo.Qubic(), position(t, xo.Qubic(), "x0,0,0 o3,3,3 x0,0,1 o3,3,2 x0,0,2"), xo.SignO, 0)
+	if err != nil {
+		t.Fatal(err)
+	} else if got := xo.FormatMove(move, true); got != "o0,0,3" {
+		t.Fatalf("got move %s, want blocking o0,0,3", got)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	e := startEngine(t, time.Second)
+	e.MoveTime = 50 * time.Millisecond
+
+	_, err := e.Move(xo.Classic(), xo.Classic().NewPosition(), xo.SignX, 0)
+	if !errors.Is(err, xoengine.ErrTimeout) {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+
+	_, err = e.Move(xo.Classic(), xo.Classic().NewPosition(), xo.SignX, 0)
+	if !errors.Is(err, xoengine.ErrTimeout) {
+		t.Fatalf("expected the engine to stay failed, got %v", err)
+	}
+}
+
+func TestTimeLeft(t *testing.T) {
+	e := startEngine(t, 200*time.Millisecond)
+
+	_, err := e.Move(xo.Classic(), xo.Classic().NewPosition(), xo.SignX, 50*time.Millisecond)
+	if !errors.Is(err, xoengine.ErrTimeout) {
+		t.Fatalf("expected timeout by the game clock, got %v", err)
+	}
+}
+
+func TestInProcess(t *testing.T) {
+	engineIn, adapterOut := io.Pipe()
+	adapterIn, engineOut := io.Pipe()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- xoengine.Serve(engineIn, engineOut, "failing", func(xo.Rules, *xo.TypePosition, xo.TypeSign, time.Duration) (xo.TypeMove, error) {
+			return xo.TypeMove{}, fmt.Errorf("no idea")
+		})
+		engineOut.Close()
+	}()
+
+	e, err := xoengine.NewEngine(adapterIn, adapterOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.Move(xo.Classic(), xo.Classic().NewPosition(), xo.SignX, 0); err == nil {
+		t.Fatalf("expected error of the engine without moves")
+	}
+
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	} else if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+var uniqueCounter int
+
+func unique(name string) string {
+	uniqueCounter++
+	return fmt.Sprintf("%s%d-%d", name, os.Getpid(), uniqueCounter)
+}
+
+func login(t *testing.T, user string) string {
+	t.Helper()
+
+	if err := xo.RegisterUser(user, "password"); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := xo.Login(user, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { xo.Logout(token) })
+
+	return token
+}
+
+func TestPlayerInLobby(t *testing.T) {
+	robot, human := xo.TypeUser(unique("robot")), xo.TypeUser(unique("human"))
+
+	p := xoengine.Player{
+		Engine: startEngine(t, 0),
+		User:   robot,
+		Token:  login(t, string(robot)),
+		Rules:  xo.Classic(),
+		Sign:   xo.SignO,
+	}
+
+	stop, done := make(chan struct{}), make(chan error, 1)
+	go func() { done <- p.Run(stop) }()
+	defer func() {
+		close(stop)
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}()
+
+	token := login(t, string(human))
+	events, cancel, err := xo.Subscribe(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	for i := 0; i < 2; i++ {
+		waitInLobby(t, token, robot)
+		if err := xo.StartPlayingWithWaitingOpponent(token, xo.SignX, robot); err != nil {
+			t.Fatal(err)
+		}
+
+		// the robot moves first, the human takes the first free cell
+		for event := range events {
+			if event.Kind == xo.EventGameFinished {
+				break
+			} else if event.Kind != xo.EventMove || event.User != robot {
+				continue
+			}
+
+			board, err := xo.CurrentBoard(token)
+			if errors.Is(err, xo.ErrNotPlaying) {
+				// the move has finished the game
+				continue
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, cell := range board.Position().Cells() {
+				if board.Cell(cell) == "" {
+					if _, _, err := xo.MakeAMove(token, cell); err != nil {
+						t.Fatal(err)
+					}
+					break
+				}
+			}
+		}
+	}
+}
+
+func waitInLobby(t *testing.T, token string, user xo.TypeUser) {
+	t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		opponents, err := xo.SearchOpponentsFor(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, opponent := range opponents {
+			if opponent.User() == user {
+				return
+			}
+		}
+	}
+
+	t.Fatalf("%s is not in the lobby", user)
+}
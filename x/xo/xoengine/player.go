@@ -0,0 +1,104 @@
+package xoengine
+
+import (
+	"errors"
+
+	"github.com/ayzatziko/stuff/x/xo/xo"
+	"github.com/ayzatziko/stuff/xerrors"
+)
+
+// Player plays the games of a logged in user by the moves of Engine, the
+// user is a regular one to the other users. The player resigns the games
+// the engine fails to move in.
+type Player struct {
+	Engine *Engine
+	User   xo.TypeUser
+	Token  string
+
+	// Rules and Sign, when set, make the player wait in the lobby for the
+	// next game after every game.
+	Rules xo.Rules
+	Sign  xo.TypeSign
+}
+
+// Run plays until stop is closed or the session ends.
+func (p *Player) Run(stop <-chan struct{}) (err error) {
+	defer xerrors.Wrap(&err, "Run(%s)", p.User)
+
+	events, cancel, err := xo.Subscribe(p.Token)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	if err := p.wait(); err != nil {
+		return err
+	} else if err := p.turn(); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+
+			switch event.Kind {
+			case xo.EventGameStarted, xo.EventMove:
+				err = p.turn()
+			case xo.EventDrawOffered:
+				if event.User != p.User {
+					err = xo.DeclineDraw(p.Token)
+				}
+			case xo.EventGameFinished:
+				err = p.wait()
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// wait waits in the lobby if the player is not in a game.
+func (p *Player) wait() error {
+	if p.Rules == nil {
+		return nil
+	} else if _, err := xo.CurrentBoard(p.Token); err == nil {
+		return nil
+	}
+
+	return xo.RegisterSelfAsParticipantWithRules(p.Token, p.Sign, p.Rules)
+}
+
+// turn moves if it is the turn of the player.
+func (p *Player) turn() error {
+	board, err := xo.CurrentBoard(p.Token)
+	if errors.Is(err, xo.ErrNotPlaying) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if board.Turn().User() != p.User {
+		return nil
+	}
+
+	timeLeft, _ := board.TimeLeft()
+	move, err := p.Engine.Move(board.Rules(), board.Position(), board.Turn().Sign(), timeLeft)
+	if err != nil {
+		xo.Resign(p.Token)
+		return err
+	}
+
+	if _, _, err := xo.MakeAMoveWithSign(p.Token, move.Cell, move.Sign); err != nil {
+		xo.Resign(p.Token)
+		return err
+	}
+
+	return nil
+}
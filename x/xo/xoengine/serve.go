@@ -0,0 +1,112 @@
+package xoengine
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ayzatziko/stuff/x/xo/xo"
+)
+
+// Chooser chooses a move placing sign in pos of rules, timeLeft is the time
+// the engine has for the move.
+type Chooser func(rules xo.Rules, pos *xo.TypePosition, sign xo.TypeSign, timeLeft time.Duration) (xo.TypeMove, error)
+
+// Serve is the engine side of the protocol for bots written in Go, it reads
+// commands from r and writes replies to w until quit or the end of r.
+func Serve(r io.Reader, w io.Writer, name string, choose Chooser) error {
+	var (
+		rules xo.Rules
+		pos   *xo.TypePosition
+	)
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		var reply []string
+		switch fields[0] {
+		case "xo":
+			reply = []string{"id name " + name, "xook"}
+		case "isready":
+			reply = []string{"readyok"}
+		case "position":
+			var err error
+			if rules, pos, err = parsePosition(fields[1:]); err != nil {
+				reply = []string{"info error " + err.Error()}
+			}
+		case "go":
+			reply = goReply(rules, pos, fields[1:], choose)
+		case "quit":
+			return nil
+		}
+
+		for _, line := range reply {
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.Err()
+}
+
+func parsePosition(args []string) (xo.Rules, *xo.TypePosition, error) {
+	if len(args) == 0 {
+		return nil, nil, fmt.Errorf("no variant")
+	}
+
+	rules, err := xo.RulesByName(args[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	moves := args[1:]
+	if len(moves) > 0 && moves[0] == "moves" {
+		moves = moves[1:]
+	}
+
+	pos, err := xo.ParsePosition(rules, strings.Join(moves, " "))
+	return rules, pos, err
+}
+
+func goReply(rules xo.Rules, pos *xo.TypePosition, args []string, choose Chooser) []string {
+	if pos == nil {
+		return []string{"info error no position", "bestmove none"}
+	}
+
+	sign := xo.SignX
+	timeLeft := constMoveTime
+	for i := 0; i+1 < len(args); i += 2 {
+		switch args[i] {
+		case "sign":
+			sign = xo.TypeSign(args[i+1])
+		case "movetime":
+			if ms, err := strconv.Atoi(args[i+1]); err == nil {
+				timeLeft = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+
+	move, err := choose(rules, pos, sign, timeLeft)
+	if err != nil {
+		return []string{"info error " + err.Error(), "bestmove none"}
+	}
+
+	_, _, depth := pos.Size()
+	return []string{"bestmove " + xo.FormatMove(move, depth > 1)}
+}
+
+// BotChooser chooses moves by the built-in bot of level, it is the
+// reference engine.
+func BotChooser(level xo.TypeBotLevel) Chooser {
+	return func(rules xo.Rules, pos *xo.TypePosition, sign xo.TypeSign, _ time.Duration) (xo.TypeMove, error) {
+		return xo.BotMoveAt(rules, pos, sign, level)
+	}
+}
@@ -0,0 +1,254 @@
+// Package xometrics keeps counters, gauges and histograms of the xo server
+// and exposes them in the Prometheus text format and by expvar.
+package xometrics
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+type metric interface {
+	name() string
+	writePrometheus(w io.Writer) error
+	value() any
+}
+
+// Registry is a set of metrics with unique names.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]metric
+}
+
+// Default is the registry of the metrics created by NewCounter, NewGauge
+// and NewHistogram.
+var Default = &Registry{}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.metrics == nil {
+		r.metrics = map[string]metric{}
+	}
+	if _, ok := r.metrics[m.name()]; ok {
+		panic(fmt.Sprintf("xometrics: metric %s is already registered", m.name()))
+	}
+
+	r.metrics[m.name()] = m
+}
+
+func (r *Registry) sorted() []metric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	metrics := make([]metric, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		metrics = append(metrics, m)
+	}
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].name() < metrics[j].name() })
+
+	return metrics
+}
+
+// WritePrometheus writes the metrics sorted by name in the Prometheus text
+// format.
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	for _, m := range r.sorted() {
+		if err := m.writePrometheus(w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WritePrometheus(w)
+	})
+}
+
+// Expvar returns the metrics as a map by name for expvar.Publish, a
+// histogram is a map of its count, sum and cumulative buckets.
+func (r *Registry) Expvar() expvar.Var {
+	return expvar.Func(func() any {
+		values := map[string]any{}
+		for _, m := range r.sorted() {
+			values[m.name()] = m.value()
+		}
+
+		return values
+	})
+}
+
+type typeDesc struct {
+	metricName, help string
+}
+
+func (d typeDesc) name() string { return d.metricName }
+
+func (d typeDesc) writeHeader(w io.Writer, kind string) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.metricName, d.help, d.metricName, kind)
+	return err
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Counter is a count of events.
+type Counter struct {
+	typeDesc
+	v atomic.Uint64
+}
+
+func NewCounter(name, help string) *Counter {
+	c := &Counter{typeDesc: typeDesc{name, help}}
+	Default.register(c)
+
+	return c
+}
+
+func (c *Counter) Inc()          { c.v.Add(1) }
+func (c *Counter) Value() uint64 { return c.v.Load() }
+
+func (c *Counter) value() any { return c.Value() }
+
+func (c *Counter) writePrometheus(w io.Writer) error {
+	if err := c.writeHeader(w, "counter"); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "%s %d\n", c.metricName, c.Value())
+	return err
+}
+
+// Gauge is a value computed when the metrics are read.
+type Gauge struct {
+	typeDesc
+	f func() float64
+}
+
+func NewGauge(name, help string, f func() float64) *Gauge {
+	g := &Gauge{typeDesc: typeDesc{name, help}, f: f}
+	Default.register(g)
+
+	return g
+}
+
+func (g *Gauge) value() any { return g.f() }
+
+func (g *Gauge) writePrometheus(w io.Writer) error {
+	if err := g.writeHeader(w, "gauge"); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "%s %s\n", g.metricName, formatFloat(g.f()))
+	return err
+}
+
+// Histogram counts observed values in buckets by their upper bounds. It is
+// updated without locks, a snapshot taken during observations may lag behind
+// by the observations in progress.
+type Histogram struct {
+	typeDesc
+	bounds []float64
+
+	counts []atomic.Uint64
+	count  atomic.Uint64
+	// sum holds the bits of the float64 sum.
+	sum atomic.Uint64
+}
+
+// NewHistogram returns a histogram of buckets with sorted upper bounds, the
+// bucket of +Inf is implied.
+func NewHistogram(name, help string, bounds []float64) *Histogram {
+	h := &Histogram{typeDesc: typeDesc{name, help}, bounds: bounds, counts: make([]atomic.Uint64, len(bounds))}
+	Default.register(h)
+
+	return h
+}
+
+// ExponentialBuckets returns n bounds from start multiplied by factor.
+func ExponentialBuckets(start, factor float64, n int) []float64 {
+	bounds := make([]float64, n)
+	for i := range bounds {
+		bounds[i] = start
+		start *= factor
+	}
+
+	return bounds
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+
+	if i < len(h.counts) {
+		h.counts[i].Add(1)
+	}
+	h.count.Add(1)
+
+	for {
+		old := h.sum.Load()
+		if h.sum.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// snapshot returns cumulative counts of the buckets, the count and the sum.
+func (h *Histogram) snapshot() ([]uint64, uint64, float64) {
+	count, sum := h.count.Load(), math.Float64frombits(h.sum.Load())
+
+	cumulative := make([]uint64, len(h.counts))
+	var total uint64
+	for i := range h.counts {
+		total += h.counts[i].Load()
+		cumulative[i] = total
+	}
+	if count < total {
+		count = total
+	}
+
+	return cumulative, count, sum
+}
+
+func (h *Histogram) value() any {
+	cumulative, count, sum := h.snapshot()
+
+	buckets := map[string]uint64{"+Inf": count}
+	for i, c := range cumulative {
+		buckets[formatFloat(h.bounds[i])] = c
+	}
+
+	return map[string]any{"count": count, "sum": sum, "buckets": buckets}
+}
+
+func (h *Histogram) writePrometheus(w io.Writer) error {
+	if err := h.writeHeader(w, "histogram"); err != nil {
+		return err
+	}
+
+	cumulative, count, sum := h.snapshot()
+	for i, c := range cumulative {
+		if _, err := fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", h.metricName, formatFloat(h.bounds[i]), c); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n%s_sum %s\n%s_count %d\n", h.metricName, count, h.metricName, formatFloat(sum), h.metricName, count)
+	return err
+}
@@ -0,0 +1,87 @@
+package xometrics_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ayzatziko/stuff/x/xo/xometrics"
+)
+
+var (
+	testCounter   = xometrics.NewCounter("test_events_total", "Test events.")
+	testGauge     = xometrics.NewGauge("test_level", "Test level.", func() float64 { return 1.5 })
+	testHistogram = xometrics.NewHistogram("test_seconds", "Test durations.", xometrics.ExponentialBuckets(1, 10, 3))
+)
+
+func TestPrometheus(t *testing.T) {
+	testCounter.Inc()
+	testCounter.Inc()
+	for _, v := range []float64{0.5, 1, 50, 1000} {
+		testHistogram.Observe(v)
+	}
+
+	srv := httptest.NewServer(xometrics.Default.Handler())
+	t.Cleanup(srv.Close)
+
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"# HELP test_events_total Test events.\n# TYPE test_events_total counter\ntest_events_total 2\n",
+		"# TYPE test_level gauge\ntest_level 1.5\n",
+		`# TYPE test_seconds histogram
+test_seconds_bucket{le="1"} 2
+test_seconds_bucket{le="10"} 2
+test_seconds_bucket{le="100"} 3
+test_seconds_bucket{le="+Inf"} 4
+test_seconds_sum 1051.5
+test_seconds_count 4
+`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("%q is not found in\n%s", want, data)
+		}
+	}
+
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+}
+
+func TestExpvar(t *testing.T) {
+	var values struct {
+		Level   float64 `json:"test_level"`
+		Seconds struct {
+			Count   uint64
+			Buckets map[string]uint64
+		} `json:"test_seconds"`
+	}
+	if err := json.Unmarshal([]byte(xometrics.Default.Expvar().String()), &values); err != nil {
+		t.Fatal(err)
+	}
+
+	if values.Level != 1.5 || values.Seconds.Buckets["+Inf"] != values.Seconds.Count {
+		t.Fatalf("unexpected values %+v", values)
+	}
+}
+
+func TestDuplicate(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected panic registering a metric twice")
+		}
+	}()
+
+	xometrics.NewCounter("test_events_total", "Test events.")
+}
@@ -0,0 +1,612 @@
+package xorpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ayzatziko/stuff/x/xo/xo"
+)
+
+// method runs a request in the context carrying the client address and the
+// trace ID.
+type method func(ctx context.Context, params json.RawMessage) (any, error)
+
+var methods map[string]method
+
+// maxWaitTimeout limits WaitForTurn, requests of a TCP connection run one by
+// one.
+const maxWaitTimeout = 5 * time.Minute
+
+func init() {
+	methods = map[string]method{
+		"RegisterUser": newMethod([]string{"username", "password"}, func(ctx context.Context, p struct{ Username, Password string }) (any, error) {
+			return nil, xo.RegisterUserContext(ctx, p.Username, p.Password)
+		}),
+		"Login": newMethod([]string{"username", "password"}, func(ctx context.Context, p struct{ Username, Password string }) (any, error) {
+			return xo.LoginContext(ctx, p.Username, p.Password)
+		}),
+		"Logout": newMethod([]string{"sessionToken"}, func(ctx context.Context, p sessionParams) (any, error) {
+			return nil, xo.LogoutContext(ctx, p.SessionToken)
+		}),
+		"ChangePassword": newMethod([]string{"sessionToken", "oldPassword", "newPassword"}, func(ctx context.Context, p struct{ SessionToken, OldPassword, NewPassword string }) (any, error) {
+			return xo.ChangePasswordContext(ctx, p.SessionToken, p.OldPassword, p.NewPassword)
+		}),
+		"DeleteAccount": newMethod([]string{"sessionToken", "password"}, func(ctx context.Context, p struct{ SessionToken, Password string }) (any, error) {
+			return nil, xo.DeleteAccountContext(ctx, p.SessionToken, p.Password)
+		}),
+		"RegisterSelfAsParticipant": newMethod([]string{"sessionToken", "sign", "[variant]"}, func(ctx context.Context, p struct {
+			SessionToken string
+			Sign         xo.TypeSign
+			Variant      string
+		}) (any, error) {
+			rules, err := rulesOf(p.Variant)
+			if err != nil {
+				return nil, err
+			}
+
+			return nil, xo.RegisterSelfAsParticipantContext(ctx, p.SessionToken, p.Sign, rules)
+		}),
+		"SearchOpponents": newMethod([]string{"sessionToken"}, func(ctx context.Context, p sessionParams) (any, error) {
+			return newOpponents(xo.SearchOpponentsForContext(ctx, p.SessionToken))
+		}),
+		"Variants": newMethod(nil, func(context.Context, struct{}) (any, error) {
+			return xo.Variants(), nil
+		}),
+		"StartPlayingWithWaitingOpponent": newMethod([]string{"sessionToken", "sign", "opponent"}, func(ctx context.Context, p struct {
+			SessionToken string
+			Sign         xo.TypeSign
+			Opponent     xo.TypeUser
+		}) (any, error) {
+			return nil, xo.StartPlayingWithWaitingOpponentContext(ctx, p.SessionToken, p.Sign, p.Opponent)
+		}),
+		"CreateRoom": newMethod([]string{"sessionToken", "sign", "[variant]"}, func(ctx context.Context, p struct {
+			SessionToken string
+			Sign         xo.TypeSign
+			Variant      string
+		}) (any, error) {
+			rules, err := rulesOf(p.Variant)
+			if err != nil {
+				return nil, err
+			}
+
+			return xo.CreateRoomContext(ctx, p.SessionToken, p.Sign, rules)
+		}),
+		"JoinRoom": newMethod([]string{"sessionToken", "code", "sign"}, func(ctx context.Context, p struct {
+			SessionToken string
+			Code         string
+			Sign         xo.TypeSign
+		}) (any, error) {
+			return nil, xo.JoinRoomContext(ctx, p.SessionToken, p.Code, p.Sign)
+		}),
+		"CloseRoom": newMethod([]string{"sessionToken"}, func(ctx context.Context, p sessionParams) (any, error) {
+			return nil, xo.CloseRoomContext(ctx, p.SessionToken)
+		}),
+		"MakeAMove": newMethod([]string{"sessionToken", "row", "col", "[layer]", "[sign]"}, func(ctx context.Context, p struct {
+			SessionToken    string
+			Row, Col, Layer int
+			Sign            xo.TypeSign
+		}) (any, error) {
+			cell, err := xo.NewCell3D(p.Row, p.Col, p.Layer)
+			if err != nil {
+				return nil, err
+			}
+
+			return newResult(xo.MakeAMoveContext(ctx, p.SessionToken, cell, p.Sign))
+		}),
+		"CurrentBoard": newMethod([]string{"sessionToken"}, func(ctx context.Context, p sessionParams) (any, error) {
+			board, err := xo.CurrentBoardContext(ctx, p.SessionToken)
+			if err != nil {
+				return nil, err
+			}
+
+			return newBoardState(&board), nil
+		}),
+		"WaitForTurn": newMethod([]string{"sessionToken", "sinceMove", "[timeout]"}, func(ctx context.Context, p struct {
+			SessionToken string
+			SinceMove    int
+			Timeout      string
+		}) (any, error) {
+			timeout := maxWaitTimeout
+			if p.Timeout != "" {
+				var err error
+				if timeout, err = time.ParseDuration(p.Timeout); err != nil {
+					return nil, &Error{CodeInvalidParams, err.Error()}
+				} else if timeout > maxWaitTimeout {
+					timeout = maxWaitTimeout
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			board, err := xo.WaitForTurn(ctx, p.SessionToken, p.SinceMove)
+			if err != nil {
+				return nil, err
+			}
+
+			return newBoardState(&board), nil
+		}),
+		"Spectate": newMethod([]string{"sessionToken", "player"}, func(ctx context.Context, p struct {
+			SessionToken string
+			Player       xo.TypeUser
+		}) (any, error) {
+			board, err := xo.SpectateContext(ctx, p.SessionToken, p.Player)
+			if err != nil {
+				return nil, err
+			}
+
+			return newBoardState(&board), nil
+		}),
+		"StopSpectating": newMethod([]string{"sessionToken"}, func(ctx context.Context, p sessionParams) (any, error) {
+			return nil, xo.StopSpectatingContext(ctx, p.SessionToken)
+		}),
+		"SendChat": newMethod([]string{"sessionToken", "text"}, func(ctx context.Context, p struct{ SessionToken, Text string }) (any, error) {
+			return nil, xo.SendChatContext(ctx, p.SessionToken, p.Text)
+		}),
+		"ChatHistory": newMethod([]string{"sessionToken"}, func(ctx context.Context, p sessionParams) (any, error) {
+			history, err := xo.ChatHistoryContext(ctx, p.SessionToken)
+			if err != nil {
+				return nil, err
+			}
+
+			messages := make([]chatMessage, 0, len(history))
+			for _, m := range history {
+				messages = append(messages, chatMessage{m.User, m.Text, m.Time, m.Spectator})
+			}
+
+			return messages, nil
+		}),
+		"Mute": newMethod([]string{"sessionToken", "user"}, func(ctx context.Context, p userParams) (any, error) {
+			return nil, xo.MuteContext(ctx, p.SessionToken, p.User)
+		}),
+		"Unmute": newMethod([]string{"sessionToken", "user"}, func(ctx context.Context, p userParams) (any, error) {
+			return nil, xo.UnmuteContext(ctx, p.SessionToken, p.User)
+		}),
+		"Profile": newMethod([]string{"username"}, func(ctx context.Context, p struct{ Username string }) (any, error) {
+			profile, err := xo.ProfileContext(ctx, p.Username)
+			if err != nil {
+				return nil, err
+			}
+
+			r := playerProfile{
+				User: profile.User, Joined: profile.Joined, Games: profile.Games, Wins: profile.Wins, Draws: profile.Draws, Losses: profile.Losses,
+				WinRate: profile.WinRate, Rating: profile.Rating, FavoriteSign: profile.FavoriteSign, Recent: []gameRecord{},
+			}
+			for _, g := range profile.Recent {
+				r.Recent = append(r.Recent, gameRecord{g.Opponent, g.Sign, g.Result, g.Termination, g.Variant, g.Finished})
+			}
+
+			return r, nil
+		}),
+		"Leaderboard": newMethod([]string{"[variant]", "[month]", "[limit]"}, func(ctx context.Context, p struct {
+			Variant, Month string
+			Limit          int
+		}) (any, error) {
+			query := xo.TypeLeaderboardQuery{Variant: p.Variant, Limit: p.Limit}
+			if p.Month != "" {
+				var err error
+				if query.Month, err = time.Parse("2006-01", p.Month); err != nil {
+					return nil, &Error{CodeInvalidParams, err.Error()}
+				}
+			}
+
+			entries, err := xo.LeaderboardContext(ctx, query)
+			if err != nil {
+				return nil, err
+			}
+
+			r := make([]leaderboardEntry, 0, len(entries))
+			for _, e := range entries {
+				r = append(r, leaderboardEntry{e.Rank, e.User, e.Rating, e.Games, e.Wins, e.Draws, e.Losses})
+			}
+
+			return r, nil
+		}),
+		"RequestFriend": newMethod([]string{"sessionToken", "user"}, func(ctx context.Context, p userParams) (any, error) {
+			return nil, xo.RequestFriendContext(ctx, p.SessionToken, p.User)
+		}),
+		"AcceptFriend": newMethod([]string{"sessionToken", "user"}, func(ctx context.Context, p userParams) (any, error) {
+			return nil, xo.AcceptFriendContext(ctx, p.SessionToken, p.User)
+		}),
+		"RemoveFriend": newMethod([]string{"sessionToken", "user"}, func(ctx context.Context, p userParams) (any, error) {
+			return nil, xo.RemoveFriendContext(ctx, p.SessionToken, p.User)
+		}),
+		"Block": newMethod([]string{"sessionToken", "user"}, func(ctx context.Context, p userParams) (any, error) {
+			return nil, xo.BlockContext(ctx, p.SessionToken, p.User)
+		}),
+		"Unblock": newMethod([]string{"sessionToken", "user"}, func(ctx context.Context, p userParams) (any, error) {
+			return nil, xo.UnblockContext(ctx, p.SessionToken, p.User)
+		}),
+		"Friends": newMethod([]string{"sessionToken"}, func(ctx context.Context, p sessionParams) (any, error) {
+			f, err := xo.FriendsContext(ctx, p.SessionToken)
+			if err != nil {
+				return nil, err
+			}
+
+			r := friendsList{Friends: []friend{}, Incoming: f.Incoming, Outgoing: f.Outgoing, Blocked: f.Blocked}
+			for _, fr := range f.Friends {
+				r.Friends = append(r.Friends, friend{fr.User, fr.Presence})
+			}
+
+			return r, nil
+		}),
+		"Presence": newMethod([]string{"sessionToken", "user"}, func(ctx context.Context, p userParams) (any, error) {
+			return xo.PresenceContext(ctx, p.SessionToken, p.User)
+		}),
+		"Hint": newMethod([]string{"sessionToken"}, func(ctx context.Context, p sessionParams) (any, error) {
+			return newAnalysis(xo.HintContext(ctx, p.SessionToken))
+		}),
+		"Analyze": newMethod([]string{"sessionToken", "variant", "position"}, func(ctx context.Context, p struct{ SessionToken, Variant, Position string }) (any, error) {
+			rules, err := xo.RulesByName(p.Variant)
+			if err != nil {
+				return nil, err
+			}
+
+			pos, err := xo.ParsePosition(rules, p.Position)
+			if err != nil {
+				return nil, err
+			}
+
+			return newAnalysis(xo.AnalyzeForContext(ctx, p.SessionToken, rules, pos))
+		}),
+		"Resign": newMethod([]string{"sessionToken"}, func(ctx context.Context, p sessionParams) (any, error) {
+			return newResult(xo.ResignContext(ctx, p.SessionToken))
+		}),
+		"OfferDraw": newMethod([]string{"sessionToken"}, func(ctx context.Context, p sessionParams) (any, error) {
+			return nil, xo.OfferDrawContext(ctx, p.SessionToken)
+		}),
+		"AcceptDraw": newMethod([]string{"sessionToken"}, func(ctx context.Context, p sessionParams) (any, error) {
+			return newResult(xo.AcceptDrawContext(ctx, p.SessionToken))
+		}),
+		"DeclineDraw": newMethod([]string{"sessionToken"}, func(ctx context.Context, p sessionParams) (any, error) {
+			return nil, xo.DeclineDrawContext(ctx, p.SessionToken)
+		}),
+		"ClaimTimeout": newMethod([]string{"sessionToken"}, func(ctx context.Context, p sessionParams) (any, error) {
+			return newResult(xo.ClaimTimeoutContext(ctx, p.SessionToken))
+		}),
+		"GrantRole": newMethod([]string{"sessionToken", "username", "role"}, func(ctx context.Context, p struct {
+			SessionToken, Username string
+			Role                   xo.TypeRole
+		}) (any, error) {
+			return nil, xo.GrantRoleContext(ctx, p.SessionToken, p.Username, p.Role)
+		}),
+		"Sessions": newMethod([]string{"sessionToken"}, func(ctx context.Context, p sessionParams) (any, error) {
+			sessions, err := xo.SessionsContext(ctx, p.SessionToken)
+			if err != nil {
+				return nil, err
+			}
+
+			result := make([]session, len(sessions))
+			for i, s := range sessions {
+				result[i] = session(s)
+			}
+
+			return result, nil
+		}),
+		"ForceLogout": newMethod([]string{"sessionToken", "user"}, func(ctx context.Context, p userParams) (any, error) {
+			return nil, xo.ForceLogoutContext(ctx, p.SessionToken, p.User)
+		}),
+		"Ban": newMethod([]string{"sessionToken", "user", "reason", "[duration]"}, func(ctx context.Context, p struct {
+			SessionToken string
+			User         xo.TypeUser
+			Reason       string
+			Duration     string
+		}) (any, error) {
+			var duration time.Duration
+			if p.Duration != "" {
+				var err error
+				if duration, err = time.ParseDuration(p.Duration); err != nil {
+					return nil, &Error{CodeInvalidParams, err.Error()}
+				}
+			}
+
+			return nil, xo.BanContext(ctx, p.SessionToken, p.User, p.Reason, duration)
+		}),
+		"Unban": newMethod([]string{"sessionToken", "user"}, func(ctx context.Context, p userParams) (any, error) {
+			return nil, xo.UnbanContext(ctx, p.SessionToken, p.User)
+		}),
+		"UnlockUser": newMethod([]string{"sessionToken", "user"}, func(ctx context.Context, p userParams) (any, error) {
+			return nil, xo.UnlockUserContext(ctx, p.SessionToken, string(p.User))
+		}),
+		"UnlockAddress": newMethod([]string{"sessionToken", "address"}, func(ctx context.Context, p struct{ SessionToken, Address string }) (any, error) {
+			return nil, xo.UnlockAddressContext(ctx, p.SessionToken, p.Address)
+		}),
+		"AbortGame": newMethod([]string{"sessionToken", "user"}, func(ctx context.Context, p userParams) (any, error) {
+			msg, err := xo.AbortGameContext(ctx, p.SessionToken, p.User)
+			return newResult(nil, msg, err)
+		}),
+		"Adjudicate": newMethod([]string{"sessionToken", "user", "[winner]"}, func(ctx context.Context, p struct {
+			SessionToken string
+			User, Winner xo.TypeUser
+		}) (any, error) {
+			msg, err := xo.AdjudicateContext(ctx, p.SessionToken, p.User, p.Winner)
+			return newResult(nil, msg, err)
+		}),
+		"AuditLog": newMethod([]string{"sessionToken", "[user]", "[from]", "[to]"}, func(ctx context.Context, p struct {
+			SessionToken string
+			User         xo.TypeUser
+			From, To     time.Time
+		}) (any, error) {
+			records, err := xo.AuditLogContext(ctx, p.SessionToken, p.User, p.From, p.To)
+			if records == nil && err == nil {
+				records = []xo.TypeAuditRecord{}
+			}
+
+			return records, err
+		}),
+		"PurgeWaiting": newMethod([]string{"sessionToken", "[users]"}, func(ctx context.Context, p struct {
+			SessionToken string
+			Users        []xo.TypeUser
+		}) (any, error) {
+			return xo.PurgeWaitingContext(ctx, p.SessionToken, p.Users...)
+		}),
+	}
+}
+
+type sessionParams struct{ SessionToken string }
+
+// rulesOf returns the rules of the variant, classic when it is empty.
+func rulesOf(variant string) (xo.Rules, error) {
+	if variant == "" {
+		return xo.Classic(), nil
+	}
+
+	return xo.RulesByName(variant)
+}
+
+type userParams struct {
+	SessionToken string
+	User         xo.TypeUser
+}
+
+type session struct {
+	User    xo.TypeUser `json:"user"`
+	Role    xo.TypeRole `json:"role"`
+	Playing bool        `json:"playing"`
+	Waiting bool        `json:"waiting"`
+}
+
+type waitingOpponent struct {
+	User    xo.TypeUser `json:"user"`
+	Sign    xo.TypeSign `json:"sign"`
+	Variant string      `json:"variant"`
+}
+
+func newOpponents[O interface {
+	User() xo.TypeUser
+	Sign() xo.TypeSign
+	Rules() xo.Rules
+}](waiting []O, err error) (any, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	opponents := []waitingOpponent{}
+	for _, opponent := range waiting {
+		opponents = append(opponents, waitingOpponent{opponent.User(), opponent.Sign(), opponent.Rules().Name()})
+	}
+
+	return opponents, nil
+}
+
+type friend struct {
+	User     xo.TypeUser     `json:"user"`
+	Presence xo.TypePresence `json:"presence"`
+}
+
+type friendsList struct {
+	Friends  []friend      `json:"friends"`
+	Incoming []xo.TypeUser `json:"incoming"`
+	Outgoing []xo.TypeUser `json:"outgoing"`
+	Blocked  []xo.TypeUser `json:"blocked"`
+}
+
+type gameRecord struct {
+	Opponent    xo.TypeUser        `json:"opponent"`
+	Sign        xo.TypeSign        `json:"sign"`
+	Result      string             `json:"result"`
+	Termination xo.TypeTermination `json:"termination"`
+	Variant     string             `json:"variant"`
+	Finished    time.Time          `json:"finished"`
+}
+
+type playerProfile struct {
+	User         xo.TypeUser  `json:"user"`
+	Joined       time.Time    `json:"joined"`
+	Games        int          `json:"games"`
+	Wins         int          `json:"wins"`
+	Draws        int          `json:"draws"`
+	Losses       int          `json:"losses"`
+	WinRate      float64      `json:"win_rate"`
+	Rating       int          `json:"rating"`
+	FavoriteSign xo.TypeSign  `json:"favorite_sign,omitempty"`
+	Recent       []gameRecord `json:"recent"`
+}
+
+type leaderboardEntry struct {
+	Rank   int         `json:"rank"`
+	User   xo.TypeUser `json:"user"`
+	Rating int         `json:"rating"`
+	Games  int         `json:"games"`
+	Wins   int         `json:"wins"`
+	Draws  int         `json:"draws"`
+	Losses int         `json:"losses"`
+}
+
+type chatMessage struct {
+	User      xo.TypeUser `json:"user"`
+	Text      string      `json:"text"`
+	Time      time.Time   `json:"time"`
+	Spectator bool        `json:"spectator,omitempty"`
+}
+
+type boardState struct {
+	Turn   xo.TypeUser `json:"turn"`
+	Moves  int         `json:"moves"`
+	Over   bool        `json:"over,omitempty"`
+	Winner xo.TypeUser `json:"winner,omitempty"`
+	Rows   []string    `json:"rows,omitempty"`
+	Layers [][]string  `json:"layers,omitempty"`
+}
+
+func newBoardState(board *xo.TypeBoard) boardState {
+	state := boardState{Turn: board.Turn().User(), Moves: board.MoveCount()}
+	for _, p := range board.Participants() {
+		if won, over := board.Winner(p.User()); over {
+			state.Over = true
+			if won {
+				state.Winner = p.User()
+			}
+		}
+	}
+	state.Rows, state.Layers = rowsOf(board)
+
+	return state
+}
+
+type result struct {
+	Result string     `json:"result"`
+	Board  []string   `json:"board,omitempty"`
+	Layers [][]string `json:"layers,omitempty"`
+}
+
+func newResult(board *xo.TypeBoard, msg string, err error) (any, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	r := result{Result: msg}
+	if board != nil {
+		r.Board, r.Layers = rowsOf(board)
+	}
+
+	return r, nil
+}
+
+type moveEval struct {
+	Row      int         `json:"row"`
+	Col      int         `json:"col"`
+	Layer    int         `json:"layer,omitempty"`
+	Sign     xo.TypeSign `json:"sign,omitempty"`
+	Value    string      `json:"value"`
+	Distance int         `json:"distance,omitempty"`
+}
+
+type analysis struct {
+	Value    string     `json:"value"`
+	Distance int        `json:"distance,omitempty"`
+	Best     []moveEval `json:"best"`
+	Moves    []moveEval `json:"moves"`
+}
+
+func newAnalysis(a xo.TypeAnalysis, err error) (any, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	evals := func(moves []xo.TypeMoveEval) []moveEval {
+		evals := []moveEval{}
+		for _, m := range moves {
+			evals = append(evals, moveEval{
+				Row:      m.Move.Cell.Row(),
+				Col:      m.Move.Cell.Col(),
+				Layer:    m.Move.Cell.Layer(),
+				Sign:     m.Move.Sign,
+				Value:    m.Value.String(),
+				Distance: m.Distance,
+			})
+		}
+
+		return evals
+	}
+
+	return analysis{Value: a.Value.String(), Distance: a.Distance, Best: evals(a.Best), Moves: evals(a.Moves)}, nil
+}
+
+// rowsOf returns the rows of a flat board or the layers of rows of a
+// three-dimensional one.
+func rowsOf(board *xo.TypeBoard) (rows []string, layers [][]string) {
+	height, width, depth := board.Dimensions()
+	layers = make([][]string, depth)
+	for layer := range layers {
+		layers[layer] = make([]string, height)
+		for row := range layers[layer] {
+			var b strings.Builder
+			for col := 0; col < width; col++ {
+				cell, _ := xo.NewCell3D(row, col, layer)
+				if sign := board.Cell(cell); sign != "" {
+					b.WriteString(string(sign))
+				} else {
+					b.WriteString(".")
+				}
+			}
+			layers[layer][row] = b.String()
+		}
+	}
+
+	if len(layers) == 1 {
+		return layers[0], nil
+	}
+
+	return nil, layers
+}
+
+// newMethod decodes params into P, positional params are matched with names.
+// Names are matched with fields of P case insensitively, names in brackets
+// like "[variant]" are optional, absent params are zero.
+func newMethod[P any](names []string, f func(context.Context, P) (any, error)) method {
+	return func(ctx context.Context, params json.RawMessage) (any, error) {
+		var p P
+
+		params = bytes.TrimSpace(params)
+		if len(params) == 0 || bytes.Equal(params, []byte("null")) {
+			params = []byte("{}")
+		}
+
+		byName := map[string]json.RawMessage{}
+		if params[0] == '[' {
+			var positional []json.RawMessage
+			if err := json.Unmarshal(params, &positional); err != nil {
+				return nil, &Error{CodeInvalidParams, err.Error()}
+			} else if len(positional) > len(names) {
+				return nil, &Error{CodeInvalidParams, fmt.Sprintf("too many params, expected %s", strings.Join(names, ", "))}
+			}
+
+			for i, raw := range positional {
+				byName[strings.Trim(names[i], "[]")] = raw
+			}
+
+			params, _ = json.Marshal(byName)
+		} else if err := json.Unmarshal(params, &byName); err != nil {
+			return nil, &Error{CodeInvalidParams, err.Error()}
+		}
+
+		for _, name := range names {
+			if !strings.HasPrefix(name, "[") && !hasParam(byName, name) {
+				return nil, &Error{CodeInvalidParams, fmt.Sprintf("missing param %s", name)}
+			}
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(params))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&p); err != nil {
+			return nil, &Error{CodeInvalidParams, err.Error()}
+		}
+
+		return f(ctx, p)
+	}
+}
+
+func hasParam(params map[string]json.RawMessage, name string) bool {
+	for key := range params {
+		if strings.EqualFold(key, name) {
+			return true
+		}
+	}
+
+	return false
+}
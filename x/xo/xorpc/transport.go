@@ -0,0 +1,151 @@
+package xorpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/ayzatziko/stuff/x/xo/xo"
+)
+
+// maxRequestSize limits the size of a single request or batch.
+const maxRequestSize = 1 << 20
+
+// Handler serves JSON-RPC requests POSTed over HTTP.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			w.Write(marshal(response{Error: &Error{CodeInvalidRequest, errRequestTooLarge.Error()}, ID: nullID}))
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ctx := xo.WithClientAddress(r.Context(), clientOf(r.RemoteAddr))
+		if id := r.Header.Get("X-Request-Id"); id != "" {
+			ctx = xo.WithTraceID(ctx, id)
+		}
+
+		resp := handle(ctx, data)
+		if resp == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(resp)
+	})
+}
+
+// ServeTCP accepts connections on l, each connection is a stream of
+// JSON-RPC requests and batches, replies are written one per line. It
+// returns when l is closed.
+func ServeTCP(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("xorpc: ServeTCP: %w", err)
+		}
+
+		go serveConn(conn)
+	}
+}
+
+func serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(xo.WithClientAddress(context.Background(), clientOf(conn.RemoteAddr().String())))
+	defer cancel()
+
+	// requests are read while one runs, so a disconnect cancels it
+	requests := make(chan json.RawMessage)
+	var readErr error
+	go func() {
+		defer close(requests)
+		defer cancel()
+
+		r := &requestReader{r: bufio.NewReader(conn)}
+		dec := json.NewDecoder(r)
+		for {
+			var raw json.RawMessage
+			r.n = maxRequestSize
+			if readErr = dec.Decode(&raw); readErr != nil {
+				return
+			}
+
+			select {
+			case requests <- raw:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for raw := range requests {
+		if resp := handle(ctx, raw); resp != nil {
+			if _, err := conn.Write(append(resp, '\n')); err != nil {
+				return
+			}
+		}
+	}
+
+	if errors.Is(readErr, errRequestTooLarge) {
+		resp := marshal(response{Error: &Error{CodeInvalidRequest, readErr.Error()}, ID: nullID})
+		conn.Write(append(resp, '\n'))
+	} else if readErr != nil && !errors.Is(readErr, io.EOF) && !errors.Is(readErr, net.ErrClosed) {
+		// the stream cannot be resynchronized after a syntax error
+		resp := marshal(response{Error: &Error{CodeParseError, readErr.Error()}, ID: nullID})
+		conn.Write(append(resp, '\n'))
+	}
+}
+
+var errRequestTooLarge = fmt.Errorf("request is larger than %d bytes", maxRequestSize)
+
+// requestReader fails reads beyond n bytes, n is reset for every request of
+// a connection.
+type requestReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *requestReader) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, errRequestTooLarge
+	}
+	if int64(len(p)) > r.n {
+		p = p[:r.n]
+	}
+
+	n, err := r.r.Read(p)
+	r.n -= int64(n)
+	return n, err
+}
+
+// clientOf returns the host of a remote address, failed logins are
+// throttled by it.
+func clientOf(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	return host
+}
@@ -0,0 +1,303 @@
+// Package xorpc exposes xo operations as JSON-RPC 2.0 methods over HTTP and
+// raw TCP.
+//
+// Methods are named after xo functions and take params either by name or by
+// position in the order listed, params in brackets are optional. Requests
+// are limited to 1 MB over both transports, larger ones are answered with
+// the invalid request error and status 413 over HTTP:
+//
+//	RegisterUser(username, password)
+//	Login(username, password) -> sessionToken
+//	Logout(sessionToken)
+//	ChangePassword(sessionToken, oldPassword, newPassword) -> sessionToken
+//	DeleteAccount(sessionToken, password)
+//	RegisterSelfAsParticipant(sessionToken, sign, [variant])
+//	SearchOpponents(sessionToken) -> [{user, sign, variant}]
+//	Variants() -> [name]
+//	StartPlayingWithWaitingOpponent(sessionToken, sign, opponent)
+//	CreateRoom(sessionToken, sign, [variant]) -> code
+//	JoinRoom(sessionToken, code, sign)
+//	CloseRoom(sessionToken)
+//	MakeAMove(sessionToken, row, col, [layer], [sign]) -> {result, board}
+//	CurrentBoard(sessionToken) -> {turn, moves, rows}
+//	WaitForTurn(sessionToken, sinceMove, [timeout]) -> {turn, moves, over, winner, rows}
+//	Resign(sessionToken) -> {result, board}
+//	OfferDraw(sessionToken)
+//	AcceptDraw(sessionToken) -> {result, board}
+//	DeclineDraw(sessionToken)
+//	ClaimTimeout(sessionToken) -> {result, board}
+//	Spectate(sessionToken, player) -> {turn, moves, rows}
+//	StopSpectating(sessionToken)
+//	SendChat(sessionToken, text)
+//	ChatHistory(sessionToken) -> [{user, text, time, spectator}]
+//	Mute(sessionToken, user)
+//	Unmute(sessionToken, user)
+//	RequestFriend(sessionToken, user)
+//	AcceptFriend(sessionToken, user)
+//	RemoveFriend(sessionToken, user)
+//	Block(sessionToken, user)
+//	Unblock(sessionToken, user)
+//	Friends(sessionToken) -> {friends: [{user, presence}], incoming, outgoing, blocked}
+//	Presence(sessionToken, user) -> presence
+//	Profile(username) -> {user, joined, games, wins, draws, losses, win_rate, rating, favorite_sign, recent}
+//	Leaderboard([variant], [month], [limit]) -> [{rank, user, rating, games, wins, draws, losses}]
+//	Hint(sessionToken) -> {value, distance, best, moves}
+//	Analyze(sessionToken, variant, position) -> {value, distance, best, moves}
+//
+// Moderators and admins, see xo.TypeRole, call in addition:
+//
+//	Sessions(sessionToken) -> [{user, role, playing, waiting}]
+//	ForceLogout(sessionToken, user)
+//	Ban(sessionToken, user, reason, [duration]) bans forever without duration like "24h"
+//	Unban(sessionToken, user)
+//	UnlockUser(sessionToken, user) forgets failed logins of the user
+//	UnlockAddress(sessionToken, address) forgets failed logins from the address
+//	AbortGame(sessionToken, user) -> {result}
+//	Adjudicate(sessionToken, user, [winner]) -> {result} draws without winner
+//	PurgeWaiting(sessionToken, [users]) -> count purges all without users
+//	GrantRole(sessionToken, username, role) for admins only
+//	AuditLog(sessionToken, [user], [from], [to]) -> [{seq, time, user, action, target, detail, prev, hash}]
+//
+// ForceLogout, Ban, Unban, AbortGame and Adjudicate need a role higher than
+// the roles of the users, of both players for games, so moderators do not
+// judge their own games. Times are formatted as
+// RFC 3339, the audit log is queried from the time inclusive to the time
+// exclusive.
+//
+// Rows, columns and layers count from zero like in xo.NewCell3D. The board
+// is present in results only when the game is over, rows are strings like
+// "x.o". Three-dimensional boards are sent as layers of rows instead. The
+// sign of a move is chosen only in variants like wild.
+//
+// WaitForTurn blocks until the caller is to move in a game of more than
+// sinceMove moves, -1 before the first move, or the game is over. It gives
+// up after the timeout like "30s", 5 minutes at most and by default, and
+// with the request over HTTP or the connection over TCP.
+//
+// The chat belongs to the game played or watched and ends with it, muted
+// users are left out of the history. A message has at most 280 characters,
+// a user sends at most 5 messages in 10 seconds.
+//
+// SearchOpponents leaves out users blocking or blocked by the caller, blocked
+// users cannot start games with each other.
+// RemoveFriend also declines and withdraws friend requests. Presence is
+// "offline", "online", "lobby" or "game", users blocking or blocked by the
+// caller are "offline".
+//
+// A private room is hidden from SearchOpponents and joined with its code,
+// the host moves first. Rooms nobody joins close in 10 minutes. A user tries
+// at most 5 wrong codes a minute.
+//
+// Recent games of profiles are listed from the last one as {opponent, sign,
+// result, termination, variant, finished}, results are "win", "draw" or
+// "loss". Leaderboards are all-time unless selected by the variant and
+// the month like "2024-01", players are ranked by rating.
+//
+// Analyses value the position for the side to move as "win", "draw" or
+// "loss" with the number of moves to the end, positions are formatted like
+// xo.FormatPosition: "x0,0 o1,1". A user requests at most 10 analyses and
+// hints a minute. A game is not rated after a player asks for a hint.
+//
+// Failed logins are throttled by the username and by the address of the
+// client, see xo.LoginFrom. Operations over HTTP are cancelled with their
+// requests, the X-Request-Id header is recorded in the audit log as the
+// trace ID, see xo.WithTraceID.
+//
+// xo errors are reported with the application error codes listed below,
+// other failures of the operations with CodeGameError.
+package xorpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/ayzatziko/stuff/x/xo/xo"
+)
+
+// Standard JSON-RPC 2.0 error codes.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// Application error codes.
+const (
+	CodeGameError         = -32000
+	CodeSessionNotFound   = -32001
+	CodeUserNotFound      = -32002
+	CodeUserExists        = -32003
+	CodeWrongPassword     = -32004
+	CodeNotPlaying        = -32005
+	CodeOpponentNotFound  = -32006
+	CodeIllegalMove       = -32007
+	CodeLoginThrottled    = -32008
+	CodeLoginLocked       = -32009
+	CodePermissionDenied  = -32010
+	CodeBanned            = -32011
+	CodeChatThrottled     = -32012
+	CodeRoomNotFound      = -32013
+	CodeAnalysisThrottled = -32014
+	CodeRoomThrottled     = -32015
+)
+
+var errorCodes = []struct {
+	err  error
+	code int
+}{
+	{xo.ErrSessionNotFound, CodeSessionNotFound},
+	{xo.ErrUserNotFound, CodeUserNotFound},
+	{xo.ErrUserExists, CodeUserExists},
+	{xo.ErrWrongPassword, CodeWrongPassword},
+	{xo.ErrNotPlaying, CodeNotPlaying},
+	{xo.ErrOpponentNotFound, CodeOpponentNotFound},
+	{xo.ErrIllegalMove, CodeIllegalMove},
+	{xo.ErrLoginThrottled, CodeLoginThrottled},
+	{xo.ErrLoginLocked, CodeLoginLocked},
+	{xo.ErrPermissionDenied, CodePermissionDenied},
+	{xo.ErrBanned, CodeBanned},
+	{xo.ErrChatThrottled, CodeChatThrottled},
+	{xo.ErrRoomNotFound, CodeRoomNotFound},
+	{xo.ErrAnalysisThrottled, CodeAnalysisThrottled},
+	{xo.ErrRoomThrottled, CodeRoomThrottled},
+	{xo.ErrInvalidSign, CodeInvalidParams},
+	{xo.ErrInvalidCell, CodeInvalidParams},
+	{xo.ErrUnknownVariant, CodeInvalidParams},
+	{xo.ErrInvalidUsername, CodeInvalidParams},
+	{xo.ErrWeakPassword, CodeInvalidParams},
+}
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+type response struct {
+	JSONRPC version         `json:"jsonrpc"`
+	Result  any             `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// version always marshals to "2.0".
+type version struct{}
+
+func (version) MarshalJSON() ([]byte, error) { return []byte(`"2.0"`), nil }
+
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string { return e.Message }
+
+func errorOf(err error) *Error {
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+
+	for _, c := range errorCodes {
+		if errors.Is(err, c.err) {
+			return &Error{Code: c.code, Message: err.Error()}
+		}
+	}
+
+	return &Error{Code: CodeGameError, Message: err.Error()}
+}
+
+var nullID = json.RawMessage("null")
+
+// handle runs a single request or a batch in ctx, returns nil when there is
+// nothing to reply: all requests are notifications.
+func handle(ctx context.Context, data []byte) []byte {
+	data = []byte(strings.TrimSpace(string(data)))
+	if len(data) > 0 && data[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(data, &batch); err != nil {
+			return marshal(response{Error: &Error{CodeParseError, err.Error()}, ID: nullID})
+		} else if len(batch) == 0 {
+			return marshal(response{Error: &Error{CodeInvalidRequest, "empty batch"}, ID: nullID})
+		}
+
+		var resps []response
+		for _, raw := range batch {
+			if resp, ok := handleOne(ctx, raw); ok {
+				resps = append(resps, resp)
+			}
+		}
+
+		if len(resps) == 0 {
+			return nil
+		}
+
+		return marshal(resps)
+	}
+
+	if resp, ok := handleOne(ctx, data); ok {
+		return marshal(resp)
+	}
+
+	return nil
+}
+
+func handleOne(ctx context.Context, raw json.RawMessage) (_ response, reply bool) {
+	var req request
+	if err := json.Unmarshal(raw, &req); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return response{Error: &Error{CodeParseError, err.Error()}, ID: nullID}, true
+		}
+
+		return response{Error: &Error{CodeInvalidRequest, err.Error()}, ID: nullID}, true
+	}
+
+	id := req.ID
+	if id == nil {
+		id = nullID
+	}
+
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return response{Error: &Error{CodeInvalidRequest, `"jsonrpc" must be "2.0" and "method" is required`}, ID: id}, true
+	}
+
+	var (
+		result any
+		err    error
+	)
+	if m, ok := methods[req.Method]; !ok {
+		err = &Error{CodeMethodNotFound, "method " + req.Method + " not found"}
+	} else {
+		result, err = m(ctx, req.Params)
+	}
+
+	if req.ID == nil {
+		// notification
+		return response{}, false
+	}
+
+	if err != nil {
+		return response{Error: errorOf(err), ID: id}, true
+	}
+
+	if result == nil {
+		result = json.RawMessage("null")
+	}
+
+	return response{Result: result, ID: id}, true
+}
+
+func marshal(v any) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(response{Error: &Error{CodeInternalError, err.Error()}, ID: nullID})
+	}
+
+	return data
+}
@@ -0,0 +1,816 @@
+package xorpc_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ayzatziko/stuff/x/xo/xo"
+	"github.com/ayzatziko/stuff/x/xo/xorpc"
+)
+
+// testPassword is the password of users registered by tests.
+const testPassword = "password"
+
+func TestHTTPGame(t *testing.T) {
+	srv := httptest.NewServer(xorpc.Handler())
+	t.Cleanup(srv.Close)
+
+	first, second := unique("http1"), unique("http2")
+	call := func(method string, params any) json.RawMessage {
+		t.Helper()
+		return post(t, srv.URL, method, params).result(t)
+	}
+
+	call("RegisterUser", map[string]string{"username": first, "password": testPassword})
+	call("RegisterUser", []string{second, testPassword})
+
+	var tokenFirst, tokenSecond string
+	unmarshal(t, call("Login", []string{first, testPassword}), &tokenFirst)
+	unmarshal(t, call("Login", []string{second, testPassword}), &tokenSecond)
+
+	call("RegisterSelfAsParticipant", []string{tokenFirst, "x"})
+
+	var opponents []struct{ User, Sign string }
+	unmarshal(t, call("SearchOpponents", []string{tokenSecond}), &opponents)
+	found := false
+	for _, o := range opponents {
+		found = found || o.User == first && o.Sign == "x"
+	}
+	if !found {
+		t.Fatalf("%s is not found in %v", first, opponents)
+	}
+
+	call("StartPlayingWithWaitingOpponent", map[string]string{"sessionToken": tokenSecond, "sign": "o", "opponent": first})
+
+	if resp := post(t, srv.URL, "WaitForTurn", []any{tokenSecond, -1, "10ms"}); resp.Error == nil || resp.Error.Code != xorpc.CodeGameError {
+		t.Fatalf("unexpected response to waiting for the move of the opponent %+v", resp)
+	}
+
+	var result struct {
+		Result string
+		Board  []string
+	}
+	for i, m := range [][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}, {0, 2}} {
+		token := []string{tokenFirst, tokenSecond}[i%2]
+		unmarshal(t, call("MakeAMove", []any{token, m[0], m[1]}), &result)
+	}
+
+	if want := first + " wins " + second; result.Result != want {
+		t.Fatalf("got result %q, want %q", result.Result, want)
+	} else if strings.Join(result.Board, " ") != "xxx oo. ..." {
+		t.Fatalf("unexpected board %v", result.Board)
+	}
+
+	var state struct {
+		Moves  int
+		Over   bool
+		Winner string
+	}
+	unmarshal(t, call("WaitForTurn", map[string]any{"sessionToken": tokenSecond, "sinceMove": 4}), &state)
+	if state.Moves != 5 || !state.Over || state.Winner != first {
+		t.Fatalf("unexpected state %+v", state)
+	}
+}
+
+func TestHTTPQubic(t *testing.T) {
+	srv := httptest.NewServer(xorpc.Handler())
+	t.Cleanup(srv.Close)
+
+	first, second := unique("qubic1"), unique("qubic2")
+	call := func(method string, params any) json.RawMessage {
+		t.Helper()
+		return post(t, srv.URL, method, params).result(t)
+	}
+
+	var tokenFirst, tokenSecond string
+	call("RegisterUser", []string{first, testPassword})
+	call("RegisterUser", []string{second, testPassword})
+	unmarshal(t, call("Login", []string{first, testPassword}), &tokenFirst)
+	unmarshal(t, call("Login", []string{second, testPassword}), &tokenSecond)
+
+	resp := post(t, srv.URL, "RegisterSelfAsParticipant", []string{tokenFirst, "x", "no-such-variant"})
+	if resp.Error == nil || resp.Error.Code != xorpc.CodeInvalidParams {
+		t.Fatalf("unexpected response to unknown variant %+v", resp)
+	}
+	call("RegisterSelfAsParticipant", map[string]string{"sessionToken": tokenFirst, "sign": "x", "variant": "qubic"})
+
+	var opponents []struct{ User, Variant string }
+	unmarshal(t, call("SearchOpponents", []string{tokenSecond}), &opponents)
+	found := false
+	for _, o := range opponents {
+		found = found || o.User == first && o.Variant == "qubic"
+	}
+	if !found {
+		t.Fatalf("%s is not found in %v", first, opponents)
+	}
+
+	call("StartPlayingWithWaitingOpponent", []string{tokenSecond, "o", first})
+	call("MakeAMove", []any{tokenFirst, 1, 2, 3})
+
+	var board struct {
+		Turn   string
+		Rows   []string
+		Layers [][]string
+	}
+	unmarshal(t, call("CurrentBoard", []string{tokenSecond}), &board)
+	if board.Turn != second || board.Rows != nil || len(board.Layers) != 4 || board.Layers[3][1] != "..x." {
+		t.Fatalf("unexpected board %+v", board)
+	}
+}
+
+func TestHTTPChat(t *testing.T) {
+	srv := httptest.NewServer(xorpc.Handler())
+	t.Cleanup(srv.Close)
+
+	first, second, fan := unique("chat1"), unique("chat2"), unique("chatfan")
+	call := func(method string, params any) json.RawMessage {
+		t.Helper()
+		return post(t, srv.URL, method, params).result(t)
+	}
+
+	var tokenFirst, tokenSecond, tokenFan string
+	for _, u := range []struct {
+		name  string
+		token *string
+	}{{first, &tokenFirst}, {second, &tokenSecond}, {fan, &tokenFan}} {
+		call("RegisterUser", []string{u.name, testPassword})
+		unmarshal(t, call("Login", []string{u.name, testPassword}), u.token)
+	}
+
+	call("RegisterSelfAsParticipant", []string{tokenFirst, "x"})
+	call("StartPlayingWithWaitingOpponent", []string{tokenSecond, "o", first})
+
+	var board struct{ Turn string }
+	unmarshal(t, call("Spectate", []string{tokenFan, first}), &board)
+	if board.Turn != first {
+		t.Fatalf("unexpected board %+v", board)
+	}
+
+	call("SendChat", []string{tokenFan, "hello"})
+	call("Mute", []string{tokenSecond, fan})
+	for i := 0; i < 5; i++ {
+		call("SendChat", map[string]string{"sessionToken": tokenFirst, "text": fmt.Sprint(i)})
+	}
+	if resp := post(t, srv.URL, "SendChat", []string{tokenFirst, "flood"}); resp.Error == nil || resp.Error.Code != xorpc.CodeChatThrottled {
+		t.Fatalf("unexpected response to flood %+v", resp)
+	}
+
+	var messages []struct {
+		User, Text string
+		Spectator  bool
+	}
+	unmarshal(t, call("ChatHistory", []string{tokenFirst}), &messages)
+	if len(messages) != 6 || messages[0].User != fan || !messages[0].Spectator || messages[5].Text != "4" {
+		t.Fatalf("unexpected messages %+v", messages)
+	}
+
+	unmarshal(t, call("ChatHistory", []string{tokenSecond}), &messages)
+	if len(messages) != 5 {
+		t.Fatalf("unexpected messages of muting user %+v", messages)
+	}
+
+	call("StopSpectating", []string{tokenFan})
+	if resp := post(t, srv.URL, "ChatHistory", []string{tokenFan}); resp.Error == nil || resp.Error.Code != xorpc.CodeNotPlaying {
+		t.Fatalf("unexpected response to history after spectating %+v", resp)
+	}
+}
+
+func TestHTTPLeaderboard(t *testing.T) {
+	srv := httptest.NewServer(xorpc.Handler())
+	t.Cleanup(srv.Close)
+
+	first, second := unique("top1"), unique("top2")
+	call := func(method string, params any) json.RawMessage {
+		t.Helper()
+		return post(t, srv.URL, method, params).result(t)
+	}
+
+	var tokenFirst, tokenSecond string
+	call("RegisterUser", []string{first, testPassword})
+	call("RegisterUser", []string{second, testPassword})
+	unmarshal(t, call("Login", []string{first, testPassword}), &tokenFirst)
+	unmarshal(t, call("Login", []string{second, testPassword}), &tokenSecond)
+	call("RegisterSelfAsParticipant", []string{tokenFirst, "x", "misere-classic"})
+	call("StartPlayingWithWaitingOpponent", []string{tokenSecond, "o", first})
+	call("Resign", []string{tokenSecond})
+
+	var profile struct {
+		Games        int
+		WinRate      float64 `json:"win_rate"`
+		Rating       int
+		FavoriteSign string `json:"favorite_sign"`
+		Recent       []struct{ Opponent, Result, Variant string }
+	}
+	unmarshal(t, call("Profile", []string{first}), &profile)
+	if profile.Games != 1 || profile.WinRate != 1 || profile.Rating != 1516 || profile.FavoriteSign != "x" {
+		t.Fatalf("unexpected profile %+v", profile)
+	} else if len(profile.Recent) != 1 || profile.Recent[0].Opponent != second || profile.Recent[0].Result != "win" || profile.Recent[0].Variant != "misere-classic" {
+		t.Fatalf("unexpected recent games %+v", profile.Recent)
+	}
+
+	var entries []struct {
+		Rank   int
+		User   string
+		Rating int
+	}
+	unmarshal(t, call("Leaderboard", map[string]any{"variant": "misere-classic", "month": time.Now().UTC().Format("2006-01"), "limit": 100}), &entries)
+	ranks := map[string]int{}
+	for _, e := range entries {
+		ranks[e.User] = e.Rank
+	}
+	if ranks[first] == 0 || ranks[second] <= ranks[first] {
+		t.Fatalf("unexpected leaderboard %+v", entries)
+	}
+
+	if resp := post(t, srv.URL, "Leaderboard", []string{"", "January"}); resp.Error == nil || resp.Error.Code != xorpc.CodeInvalidParams {
+		t.Fatalf("unexpected response to invalid month %+v", resp)
+	}
+}
+
+func TestHTTPFriends(t *testing.T) {
+	srv := httptest.NewServer(xorpc.Handler())
+	t.Cleanup(srv.Close)
+
+	first, second := unique("friend1"), unique("friend2")
+	call := func(method string, params any) json.RawMessage {
+		t.Helper()
+		return post(t, srv.URL, method, params).result(t)
+	}
+
+	var tokenFirst, tokenSecond string
+	call("RegisterUser", []string{first, testPassword})
+	call("RegisterUser", []string{second, testPassword})
+	unmarshal(t, call("Login", []string{first, testPassword}), &tokenFirst)
+	unmarshal(t, call("Login", []string{second, testPassword}), &tokenSecond)
+
+	call("RequestFriend", []string{tokenFirst, second})
+	call("AcceptFriend", map[string]string{"sessionToken": tokenSecond, "user": first})
+	call("RegisterSelfAsParticipant", []string{tokenSecond, "x"})
+
+	var friends struct {
+		Friends []struct{ User, Presence string }
+		Blocked []string
+	}
+	unmarshal(t, call("Friends", []string{tokenFirst}), &friends)
+	if len(friends.Friends) != 1 || friends.Friends[0].User != second || friends.Friends[0].Presence != "lobby" {
+		t.Fatalf("unexpected friends %+v", friends)
+	}
+
+	call("Block", []string{tokenFirst, second})
+	unmarshal(t, call("Friends", []string{tokenFirst}), &friends)
+	if len(friends.Friends) != 0 || len(friends.Blocked) != 1 {
+		t.Fatalf("unexpected friends after block %+v", friends)
+	}
+
+	var presence string
+	unmarshal(t, call("Presence", []string{tokenSecond, first}), &presence)
+	if presence != "offline" {
+		t.Fatalf("blocking user is %q to the blocked user", presence)
+	}
+
+	var opponents []struct{ User string }
+	unmarshal(t, call("SearchOpponents", []string{tokenFirst}), &opponents)
+	for _, o := range opponents {
+		if o.User == second {
+			t.Fatalf("blocked %s is in the lobby %+v", second, opponents)
+		}
+	}
+	if resp := post(t, srv.URL, "StartPlayingWithWaitingOpponent", []string{tokenFirst, "o", second}); resp.Error == nil || resp.Error.Code != xorpc.CodeOpponentNotFound {
+		t.Fatalf("unexpected response to challenging a blocked user %+v", resp)
+	}
+
+	call("Unblock", []string{tokenFirst, second})
+	call("StartPlayingWithWaitingOpponent", []string{tokenFirst, "o", second})
+
+	unmarshal(t, call("Presence", []string{tokenSecond, first}), &presence)
+	if presence != "game" {
+		t.Fatalf("unexpected presence %q", presence)
+	}
+}
+
+func TestHTTPRoom(t *testing.T) {
+	srv := httptest.NewServer(xorpc.Handler())
+	t.Cleanup(srv.Close)
+
+	first, second := unique("host"), unique("guest")
+	call := func(method string, params any) json.RawMessage {
+		t.Helper()
+		return post(t, srv.URL, method, params).result(t)
+	}
+
+	var tokenFirst, tokenSecond string
+	call("RegisterUser", []string{first, testPassword})
+	call("RegisterUser", []string{second, testPassword})
+	unmarshal(t, call("Login", []string{first, testPassword}), &tokenFirst)
+	unmarshal(t, call("Login", []string{second, testPassword}), &tokenSecond)
+
+	var code string
+	unmarshal(t, call("CreateRoom", []string{tokenFirst, "x", "qubic"}), &code)
+
+	var opponents []struct{ User string }
+	unmarshal(t, call("SearchOpponents", []string{tokenSecond}), &opponents)
+	for _, o := range opponents {
+		if o.User == first {
+			t.Fatalf("host %s is in the lobby %+v", first, opponents)
+		}
+	}
+
+	if resp := post(t, srv.URL, "JoinRoom", []string{tokenSecond, "NOSUCH", "o"}); resp.Error == nil || resp.Error.Code != xorpc.CodeRoomNotFound {
+		t.Fatalf("unexpected response to unknown room %+v", resp)
+	}
+	call("JoinRoom", map[string]string{"sessionToken": tokenSecond, "code": strings.ToLower(code), "sign": "o"})
+
+	var board struct {
+		Turn   string
+		Layers [][]string
+	}
+	unmarshal(t, call("CurrentBoard", []string{tokenSecond}), &board)
+	if board.Turn != first || len(board.Layers) == 0 {
+		t.Fatalf("unexpected board %+v", board)
+	}
+
+	if resp := post(t, srv.URL, "CloseRoom", []string{tokenFirst}); resp.Error == nil || resp.Error.Code != xorpc.CodeRoomNotFound {
+		t.Fatalf("unexpected response to closing a started room %+v", resp)
+	}
+}
+
+func TestHTTPAnalyze(t *testing.T) {
+	srv := httptest.NewServer(xorpc.Handler())
+	t.Cleanup(srv.Close)
+
+	var analysis struct {
+		Value    string
+		Distance int
+		Best     []struct{ Row, Col int }
+		Moves    []struct{ Value string }
+	}
+	user := unique("analyst")
+	post(t, srv.URL, "RegisterUser", []string{user, testPassword}).result(t)
+	var token string
+	unmarshal(t, post(t, srv.URL, "Login", []string{user, testPassword}).result(t), &token)
+
+	unmarshal(t, post(t, srv.URL, "Analyze", []string{token, "classic", "x0,0 o1,0 x0,1 o1,1"}).result(t), &analysis)
+
+	if analysis.Value != "win" || analysis.Distance != 1 || len(analysis.Best) != 1 || analysis.Best[0].Row != 0 || analysis.Best[0].Col != 2 {
+		t.Fatalf("unexpected analysis %+v", analysis)
+	} else if len(analysis.Moves) != 5 {
+		t.Fatalf("unexpected moves %+v", analysis.Moves)
+	}
+
+	for i := 1; i < 10; i++ {
+		post(t, srv.URL, "Analyze", []string{token, "classic", ""}).result(t)
+	}
+	if resp := post(t, srv.URL, "Analyze", []string{token, "classic", ""}); resp.Error == nil || resp.Error.Code != xorpc.CodeAnalysisThrottled {
+		t.Fatalf("unexpected response to the 11th analysis %+v", resp)
+	}
+}
+
+func TestHTTPModeration(t *testing.T) {
+	srv := httptest.NewServer(xorpc.Handler())
+	t.Cleanup(srv.Close)
+
+	moderator, player := unique("moderator"), unique("player")
+	call := func(method string, params any) json.RawMessage {
+		t.Helper()
+		return post(t, srv.URL, method, params).result(t)
+	}
+
+	var tokenModerator, tokenPlayer string
+	call("RegisterUser", []string{moderator, testPassword})
+	call("RegisterUser", []string{player, testPassword})
+	if err := xo.SetRole(moderator, xo.RoleModerator); err != nil {
+		t.Fatal(err)
+	}
+	unmarshal(t, call("Login", []string{moderator, testPassword}), &tokenModerator)
+	unmarshal(t, call("Login", []string{player, testPassword}), &tokenPlayer)
+	call("RegisterSelfAsParticipant", []string{tokenPlayer, "x"})
+
+	if resp := post(t, srv.URL, "Sessions", []string{tokenPlayer}); resp.Error == nil || resp.Error.Code != xorpc.CodePermissionDenied {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+
+	var sessions []struct {
+		User, Role string
+		Waiting    bool
+	}
+	unmarshal(t, call("Sessions", []string{tokenModerator}), &sessions)
+	found := false
+	for _, s := range sessions {
+		found = found || s.User == player && s.Role == "player" && s.Waiting
+	}
+	if !found {
+		t.Fatalf("%s is not found in %+v", player, sessions)
+	}
+
+	var purged int
+	unmarshal(t, call("PurgeWaiting", []any{tokenModerator, []string{player}}), &purged)
+	if purged != 1 {
+		t.Fatalf("purged %d users, want 1", purged)
+	}
+
+	call("Ban", []string{tokenModerator, player, "spam", "1h"})
+	if resp := post(t, srv.URL, "Login", []string{player, testPassword}); resp.Error == nil || resp.Error.Code != xorpc.CodeBanned {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	call("Unban", map[string]string{"sessionToken": tokenModerator, "user": player})
+	call("Login", []string{player, testPassword})
+
+	var records []struct{ User, Action, Target string }
+	unmarshal(t, call("AuditLog", []any{tokenModerator, player, time.Now().Add(-time.Hour).Format(time.RFC3339)}), &records)
+	if len(records) != 7 || records[3].Action != "ban" || records[3].User != moderator {
+		t.Fatalf("unexpected audit log %+v", records)
+	}
+}
+
+func TestHTTPTraceID(t *testing.T) {
+	srv := httptest.NewServer(xorpc.Handler())
+	t.Cleanup(srv.Close)
+
+	moderator, player := unique("moderator"), unique("player")
+	if err := xo.RegisterUser(moderator, testPassword); err != nil {
+		t.Fatal(err)
+	} else if err := xo.SetRole(moderator, xo.RoleModerator); err != nil {
+		t.Fatal(err)
+	}
+	token, err := xo.Login(moderator, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{"jsonrpc": "2.0", "method": "RegisterUser", "params": ["`+player+`", "`+testPassword+`"], "id": 1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Request-Id", "trace-1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	records, err := xo.AuditLog(token, xo.TypeUser(player), time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(records) != 1 || records[0].TraceID != "trace-1" || records[0].Address != "127.0.0.1" {
+		t.Fatalf("unexpected audit log %+v", records)
+	}
+}
+
+func TestHTTPErrors(t *testing.T) {
+	srv := httptest.NewServer(xorpc.Handler())
+	t.Cleanup(srv.Close)
+
+	user := unique("errors")
+	post(t, srv.URL, "RegisterUser", []string{user, testPassword}).result(t)
+
+	for _, tt := range []struct {
+		method string
+		params any
+		code   int
+	}{
+		{"Fly", nil, xorpc.CodeMethodNotFound},
+		{"Login", []string{user, "wrong"}, xorpc.CodeWrongPassword},
+		{"Login", []string{unique("nobody"), ""}, xorpc.CodeUserNotFound},
+		{"RegisterUser", []string{user, ""}, xorpc.CodeUserExists},
+		{"Login", []string{user, "p", "extra"}, xorpc.CodeInvalidParams},
+		{"Login", map[string]int{"username": 1}, xorpc.CodeInvalidParams},
+		{"Logout", []string{"no such session"}, xorpc.CodeSessionNotFound},
+		{"MakeAMove", []any{"no such session", -1, 0}, xorpc.CodeInvalidParams},
+		{"MakeAMove", []any{"no such session"}, xorpc.CodeInvalidParams},
+		{"MakeAMove", map[string]any{"sessionToken": "no such session", "row": 0}, xorpc.CodeInvalidParams},
+		{"Login", nil, xorpc.CodeInvalidParams},
+		{"Analyze", []string{"no such session", "no-such-variant", ""}, xorpc.CodeInvalidParams},
+		{"Analyze", []string{"no such session", "classic", "z0,0"}, xorpc.CodeInvalidParams},
+		{"Analyze", []string{"no such session", "classic", ""}, xorpc.CodeSessionNotFound},
+		{"Analyze", []string{"classic", ""}, xorpc.CodeInvalidParams},
+		{"Hint", []string{"no such session"}, xorpc.CodeSessionNotFound},
+		{"RegisterUser", []string{"x", ""}, xorpc.CodeInvalidParams},
+		{"ChangePassword", []string{"no such session", "", "new"}, xorpc.CodeSessionNotFound},
+		{"DeleteAccount", []string{"no such session", ""}, xorpc.CodeSessionNotFound},
+		{"SearchOpponents", nil, xorpc.CodeInvalidParams},
+		{"SearchOpponents", []string{"no such session"}, xorpc.CodeSessionNotFound},
+		{"Presence", []string{"no such session", user}, xorpc.CodeSessionNotFound},
+	} {
+		resp := post(t, srv.URL, tt.method, tt.params)
+		if resp.Error == nil || resp.Error.Code != tt.code {
+			t.Errorf("%s(%v): got error %+v, want code %d", tt.method, tt.params, resp.Error, tt.code)
+		}
+	}
+
+	for _, tt := range []struct {
+		body string
+		code int
+	}{
+		{`{"jsonrpc": "2.0", "method": `, xorpc.CodeParseError},
+		{`{"jsonrpc": "1.0", "method": "Login", "id": 1}`, xorpc.CodeInvalidRequest},
+		{`[]`, xorpc.CodeInvalidRequest},
+		{`"hello"`, xorpc.CodeInvalidRequest},
+	} {
+		var resp response
+		unmarshal(t, postRaw(t, srv.URL, tt.body), &resp)
+		if resp.Error == nil || resp.Error.Code != tt.code {
+			t.Errorf("%s: got error %+v, want code %d", tt.body, resp.Error, tt.code)
+		}
+	}
+}
+
+func TestHTTPLoginThrottled(t *testing.T) {
+	srv := httptest.NewServer(xorpc.Handler())
+	t.Cleanup(srv.Close)
+
+	user, moderator := unique("throttled"), unique("unlocker")
+	post(t, srv.URL, "RegisterUser", []string{user, testPassword}).result(t)
+	post(t, srv.URL, "RegisterUser", []string{moderator, testPassword}).result(t)
+	if err := xo.SetRole(moderator, xo.RoleModerator); err != nil {
+		t.Fatal(err)
+	}
+	var tokenModerator string
+	unmarshal(t, post(t, srv.URL, "Login", []string{moderator, testPassword}).result(t), &tokenModerator)
+
+	// other tests may have failed logins from the address too
+	var resp response
+	for i := 0; i <= xo.DefaultLoginLimits.FreeAttempts; i++ {
+		if resp = post(t, srv.URL, "Login", []string{user, "wrong"}); resp.Error.Code != xorpc.CodeWrongPassword {
+			break
+		}
+	}
+	if resp.Error.Code != xorpc.CodeLoginThrottled {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+
+	if resp := post(t, srv.URL, "UnlockAddress", []string{"no such session", "127.0.0.1"}); resp.Error == nil || resp.Error.Code != xorpc.CodeSessionNotFound {
+		t.Fatalf("unexpected response to unlocking without a session %+v", resp)
+	}
+	post(t, srv.URL, "UnlockAddress", []string{tokenModerator, "127.0.0.1"}).result(t)
+	post(t, srv.URL, "UnlockUser", []string{tokenModerator, user}).result(t)
+	post(t, srv.URL, "Login", []string{user, testPassword}).result(t)
+}
+
+func TestHTTPBatch(t *testing.T) {
+	srv := httptest.NewServer(xorpc.Handler())
+	t.Cleanup(srv.Close)
+
+	user := unique("batch")
+	body := fmt.Sprintf(`[
+		{"jsonrpc": "2.0", "method": "RegisterUser", "params": [%q, %q]},
+		{"jsonrpc": "2.0", "method": "Login", "params": [%[1]q, %[2]q], "id": "login"},
+		{"jsonrpc": "2.0", "method": "Fly", "id": 2},
+		1
+	]`, user, testPassword)
+
+	var resps []response
+	unmarshal(t, postRaw(t, srv.URL, body), &resps)
+	if len(resps) != 3 {
+		t.Fatalf("got %d responses, want 3 as notification is not replied: %+v", len(resps), resps)
+	}
+
+	if string(resps[0].ID) != `"login"` || resps[0].Error != nil || len(resps[0].Result) == 0 {
+		t.Errorf("unexpected login response %+v", resps[0])
+	} else if string(resps[1].ID) != "2" || resps[1].Error == nil || resps[1].Error.Code != xorpc.CodeMethodNotFound {
+		t.Errorf("unexpected Fly response %+v", resps[1])
+	} else if resps[2].Error == nil || resps[2].Error.Code != xorpc.CodeInvalidRequest {
+		t.Errorf("unexpected response to invalid request %+v", resps[2])
+	}
+
+	resp, err := http.Post(srv.URL, "application/json", strings.NewReader(`[{"jsonrpc": "2.0", "method": "SearchOpponents"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("got status %d for notifications only batch, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+}
+
+func TestTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go xorpc.ServeTCP(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	user := unique("tcp")
+	fmt.Fprintf(conn, `{"jsonrpc": "2.0", "method": "RegisterUser", "params": [%q, %q], "id": 1}`, user, testPassword)
+	fmt.Fprintf(conn, `[{"jsonrpc": "2.0", "method": "Login", "params": [%q, %q], "id": 2}]`+"\n", user, testPassword)
+
+	r := bufio.NewReader(conn)
+
+	var resp response
+	unmarshal(t, readLine(t, r), &resp)
+	if string(resp.ID) != "1" || resp.Error != nil {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+
+	var resps []response
+	unmarshal(t, readLine(t, r), &resps)
+	if len(resps) != 1 || string(resps[0].ID) != "2" || resps[0].Error != nil {
+		t.Fatalf("unexpected batch response %+v", resps)
+	}
+}
+
+func TestTCPDisconnect(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &closeListener{Listener: inner, closed: make(chan struct{})}
+	t.Cleanup(func() { l.Close() })
+	go xorpc.ServeTCP(l)
+
+	first, second := unique("tcp1"), unique("tcp2")
+	var tokenFirst, tokenSecond string
+	for _, user := range []string{first, second} {
+		if err := xo.RegisterUser(user, testPassword); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tokenFirst, err = xo.Login(first, testPassword); err != nil {
+		t.Fatal(err)
+	} else if tokenSecond, err = xo.Login(second, testPassword); err != nil {
+		t.Fatal(err)
+	} else if err := xo.RegisterSelfAsParticipant(tokenFirst, "x"); err != nil {
+		t.Fatal(err)
+	} else if err := xo.StartPlayingWithWaitingOpponent(tokenSecond, "o", xo.TypeUser(first)); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the second player waits for the first move without a timeout
+	fmt.Fprintf(conn, `{"jsonrpc": "2.0", "method": "WaitForTurn", "params": [%q, -1], "id": 1}`+"\n", tokenSecond)
+	time.Sleep(10 * time.Millisecond)
+	conn.Close()
+
+	select {
+	case <-l.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiting for the turn is not cancelled by the disconnect")
+	}
+}
+
+// closeListener closes closed when the server closes an accepted connection.
+type closeListener struct {
+	net.Listener
+	closed chan struct{}
+}
+
+func (l *closeListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return closeConn{conn, l.closed}, nil
+}
+
+type closeConn struct {
+	net.Conn
+	closed chan struct{}
+}
+
+func (c closeConn) Close() error {
+	close(c.closed)
+	return c.Conn.Close()
+}
+
+func TestHTTPRequestTooLarge(t *testing.T) {
+	srv := httptest.NewServer(xorpc.Handler())
+	t.Cleanup(srv.Close)
+
+	body := fmt.Sprintf(`{"jsonrpc": "2.0", "method": "Login", "params": [%q, ""], "id": 1}`, strings.Repeat("a", 2<<20))
+	httpResp, err := http.Post(srv.URL, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer httpResp.Body.Close()
+
+	var resp response
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if httpResp.StatusCode != http.StatusRequestEntityTooLarge || resp.Error == nil || resp.Error.Code != xorpc.CodeInvalidRequest {
+		t.Fatalf("unexpected response %d %+v", httpResp.StatusCode, resp)
+	}
+}
+
+func TestTCPRequestTooLarge(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go xorpc.ServeTCP(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go fmt.Fprintf(conn, `{"jsonrpc": "2.0", "method": "Login", "params": [%q, ""], "id": 1}`, strings.Repeat("a", 2<<20))
+
+	var resp response
+	unmarshal(t, readLine(t, bufio.NewReader(conn)), &resp)
+	if resp.Error == nil || resp.Error.Code != xorpc.CodeInvalidRequest {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+}
+
+type response struct {
+	JSONRPC string
+	Result  json.RawMessage
+	Error   *xorpc.Error
+	ID      json.RawMessage
+}
+
+func (resp response) result(t *testing.T) json.RawMessage {
+	t.Helper()
+
+	if resp.Error != nil {
+		t.Fatalf("error %d: %s", resp.Error.Code, resp.Error.Message)
+	} else if resp.JSONRPC != "2.0" {
+		t.Fatalf("unexpected jsonrpc version %q", resp.JSONRPC)
+	}
+
+	return resp.Result
+}
+
+func post(t *testing.T, url, method string, params any) response {
+	t.Helper()
+
+	req := map[string]any{"jsonrpc": "2.0", "method": method, "id": 1}
+	if params != nil {
+		req["params"] = params
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var resp response
+	unmarshal(t, postRaw(t, url, string(data)), &resp)
+
+	return resp
+}
+
+func postRaw(t *testing.T, url, body string) []byte {
+	t.Helper()
+
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var data json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func readLine(t *testing.T, r *bufio.Reader) []byte {
+	t.Helper()
+
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return line
+}
+
+func unmarshal(t *testing.T, data []byte, v any) {
+	t.Helper()
+
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("%s: %v", data, err)
+	}
+}
+
+var uniqueCounter int
+
+// unique returns a name unique within the process, the engine keeps users
+// between tests.
+func unique(name string) string {
+	uniqueCounter++
+	return fmt.Sprintf("%s-%d", name, uniqueCounter)
+}
@@ -0,0 +1,99 @@
+package xotext
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Client talks to a Serve server.
+type Client struct {
+	conn net.Conn
+
+	mu      sync.Mutex
+	replies chan string
+	events  chan []string
+}
+
+// clientEventsBuffer is the number of events kept for a client, events beyond
+// it are dropped.
+const clientEventsBuffer = 64
+
+func Dial(addr string) (*Client, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("xotext: Dial(%s): %w", addr, err)
+	}
+
+	return NewClient(conn), nil
+}
+
+func NewClient(conn net.Conn) *Client {
+	c := &Client{
+		conn:    conn,
+		replies: make(chan string),
+		events:  make(chan []string, clientEventsBuffer),
+	}
+
+	go c.read()
+
+	return c
+}
+
+func (c *Client) read() {
+	defer close(c.replies)
+	defer close(c.events)
+
+	scanner := bufio.NewScanner(c.conn)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "EVENT ") {
+			select {
+			case c.events <- strings.Fields(strings.TrimPrefix(line, "EVENT ")):
+			default:
+			}
+
+			continue
+		}
+
+		c.replies <- line
+	}
+}
+
+// Events returns notifications split into words without the EVENT prefix,
+// the channel is closed with the connection.
+func (c *Client) Events() <-chan []string { return c.events }
+
+var ErrClosed = errors.New("xotext: connection is closed")
+
+// Call sends a command and returns the payload of the OK reply, ERR reply is
+// returned as an error.
+func (c *Client) Call(command string, args ...string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	line := strings.Join(append([]string{command}, args...), " ")
+	if _, err := fmt.Fprintf(c.conn, "%s\n", line); err != nil {
+		return "", fmt.Errorf("xotext: Call(%s): %w", command, err)
+	}
+
+	reply, ok := <-c.replies
+	if !ok {
+		return "", ErrClosed
+	}
+
+	if strings.HasPrefix(reply, "ERR ") {
+		return "", errors.New(strings.TrimPrefix(reply, "ERR "))
+	} else if reply == "OK" {
+		return "", nil
+	} else if strings.HasPrefix(reply, "OK ") {
+		return strings.TrimPrefix(reply, "OK "), nil
+	}
+
+	return "", fmt.Errorf("xotext: Call(%s): unexpected reply %q", command, reply)
+}
+
+func (c *Client) Close() error { return c.conn.Close() }
@@ -0,0 +1,128 @@
+// Package xotext serves xo games over a line-oriented TCP text protocol
+// simple enough to be played from netcat.
+//
+// A client sends one command per line, words are separated by spaces and
+// commands are case insensitive. Every command gets exactly one reply line,
+// either
+//
+//	OK [payload]
+//
+// or
+//
+//	ERR message
+//
+// Commands:
+//
+//	REGISTER user [password]   registers a new user, usernames have from 3 to
+//	                           32 latin letters, digits, '-', '_' and '.'
+//	LOGIN user [password]      logs in, binds the session to the connection,
+//	                           failed logins are throttled by the user and
+//	                           by the address of the client
+//	LOGOUT                     ends the session, forfeits a running game
+//	PASSWORD [old] new         changes the password, the old one is omitted
+//	                           when it is empty
+//	UNREGISTER [password]      deletes the user, forfeits a running game
+//	VARIANTS                   replies with the names of variants
+//	LOBBY                      replies with waiting opponents: OK user:sign:variant ...,
+//	                           users blocking or blocked by the logged in user
+//	                           are left out, login is required
+//	WAIT sign [variant]        waits in the lobby for an opponent, x or o,
+//	                           to play the variant, classic by default
+//	JOIN user sign             starts a game with a waiting user, who moves first
+//	ROOM sign [variant]        opens a private room hidden from the lobby like
+//	                           WAIT, replies with its code: OK K7MX2P, the
+//	                           room closes when nobody enters it in 10 minutes
+//	ENTER code sign            starts a game with the host of the room, who
+//	                           moves first, codes are case insensitive, at
+//	                           most 5 wrong codes a minute
+//	CLOSE                      closes the room of the logged in user
+//	MOVE row col [layer] [sign]
+//	                           makes a move, rows, columns and layers count
+//	                           from 1, replies with the result if the game is over,
+//	                           the row is ignored by gravity variants, the sign
+//	                           is chosen by the mover in wild variants
+//	BOARD                      replies with the user to move and the rows,
+//	                           layers of three-dimensional boards are
+//	                           separated by |:
+//	                           OK user x.o .x. ...
+//	HINT                       replies with the value of the board for the side
+//	                           to move, the moves to the end of the game and
+//	                           the best moves as row,col[,layer][,sign], the
+//	                           layer is given on three-dimensional boards, the
+//	                           game is not rated after it:
+//	                           OK win 3 1,1 3,3
+//	FRIEND user                asks the user for friendship or accepts the
+//	                           request of the user
+//	UNFRIEND user              ends the friendship, declines or withdraws a
+//	                           request
+//	FRIENDS                    replies with friends and their presence, then
+//	                           requests and blocked users, on one line:
+//	                           OK user1:online user2:game user3:incoming
+//	                           user4:outgoing user5:blocked
+//	BLOCK user                 ends the friendship, hides the logged in user
+//	                           from the user in the lobby and from challenges
+//	UNBLOCK user               lifts the block of the user
+//	PRESENCE user              replies with offline, online, lobby or game,
+//	                           users blocking or blocked by the logged in user
+//	                           are offline, login is required
+//	PROFILE user               replies with the profile of the user and its
+//	                           last games, the last first, on one line:
+//	                           OK joined=2024-01-31 games=2 wins=1 draws=1
+//	                           losses=0 rating=1515 sign=x
+//	                           recent=draw:user3:qubic,win:user2:classic
+//	TOP [variant|all] [month]  replies with the best players by rating as
+//	                           rank:user:rating, all-time unless selected by
+//	                           the variant and the month like 2024-01
+//	RESIGN                     resigns, replies with the result
+//	DRAW                       offers a draw
+//	ACCEPT                     accepts a draw offer, replies with the result
+//	DECLINE                    declines a draw offer
+//	WATCH user                 spectates the game of the user, replies like
+//	                           BOARD, spectators get its notifications
+//	UNWATCH                    stops spectating
+//	SAY text                   sends the text to the chat of the game played
+//	                           or watched, at most 280 characters, 5 messages
+//	                           in 10 seconds
+//	CHAT                       replies with the last messages of the chat as
+//	                           users and quoted texts: OK user1 "hi" user2 "gl"
+//	MUTE user                  hides messages of the user until the game ends
+//	UNMUTE user                shows messages of the user again
+//	HELP                       replies with the list of commands
+//	QUIT                       logs out and closes the connection
+//
+// Moderators and admins have in addition:
+//
+//	SESSIONS                   replies with logged in users, their roles and
+//	                           states: OK user:role[:playing|:waiting] ...
+//	KICK user                  logs the user out
+//	BAN user duration|forever [reason]
+//	                           bans the user, e.g. for 24h, and logs out
+//	UNBAN user                 lifts the ban of the user
+//	ABORT user                 ends the game of the user without a result
+//	ADJUDICATE user winner|draw
+//	                           ends the game of the user, replies with the result
+//	PURGE [user ...]           removes the users or everybody from the lobby,
+//	                           replies with the number of removed users
+//	ROLE user role             grants player, moderator or admin role, admins
+//	                           only
+//
+// KICK, BAN, UNBAN, ABORT and ADJUDICATE need a role higher than the roles
+// of the users, of both players for games, so moderators do not judge their
+// own games.
+//
+// After LOGIN the server sends asynchronous notifications about games the
+// user plays or watches, they may interleave with replies:
+//
+//	EVENT START user:sign user:sign variant
+//	                                  game started, the first user moves first
+//	EVENT MOVE user row col [layer] [sign]
+//	                                  user made a move, the layer is sent for
+//	                                  three-dimensional boards, the sign when
+//	                                  it is not the sign of the user
+//	EVENT DRAW user                   user offered a draw
+//	EVENT DECLINE user                user declined a draw
+//	EVENT END result                  game is over, e.g. "user1 wins user2" or "draw"
+//	EVENT CHAT user text              user said the text in the chat
+//
+// Closing the connection logs the user out.
+package xotext
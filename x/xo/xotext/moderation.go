@@ -0,0 +1,128 @@
+package xotext
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ayzatziko/stuff/x/xo/xo"
+)
+
+// moderate runs a command of a moderator taking from min to max arguments.
+func (c *conn) moderate(args []string, min, max int) (string, error) {
+	token, err := c.session()
+	if err != nil {
+		return "", err
+	}
+
+	return token, wantArgs(args, min, max)
+}
+
+func cmdSessions(c *conn, args []string) (string, error) {
+	token, err := c.moderate(args, 0, 0)
+	if err != nil {
+		return "", err
+	}
+
+	sessions, err := xo.SessionsContext(c.ctx, token)
+	if err != nil {
+		return "", err
+	}
+
+	formatted := make([]string, len(sessions))
+	for i, s := range sessions {
+		formatted[i] = fmt.Sprintf("%s:%s", s.User, s.Role)
+		if s.Playing {
+			formatted[i] += ":playing"
+		} else if s.Waiting {
+			formatted[i] += ":waiting"
+		}
+	}
+
+	return strings.Join(formatted, " "), nil
+}
+
+func cmdKick(c *conn, args []string) (string, error) {
+	token, err := c.moderate(args, 1, 1)
+	if err != nil {
+		return "", err
+	}
+
+	return "", xo.ForceLogoutContext(c.ctx, token, xo.TypeUser(args[0]))
+}
+
+func cmdBan(c *conn, args []string) (string, error) {
+	token, err := c.moderate(args, 2, 1<<10)
+	if err != nil {
+		return "", err
+	}
+
+	var duration time.Duration
+	if args[1] != "forever" {
+		if duration, err = time.ParseDuration(args[1]); err != nil {
+			return "", err
+		}
+	}
+
+	return "", xo.BanContext(c.ctx, token, xo.TypeUser(args[0]), strings.Join(args[2:], " "), duration)
+}
+
+func cmdUnban(c *conn, args []string) (string, error) {
+	token, err := c.moderate(args, 1, 1)
+	if err != nil {
+		return "", err
+	}
+
+	return "", xo.UnbanContext(c.ctx, token, xo.TypeUser(args[0]))
+}
+
+func cmdAbort(c *conn, args []string) (string, error) {
+	token, err := c.moderate(args, 1, 1)
+	if err != nil {
+		return "", err
+	}
+
+	return xo.AbortGameContext(c.ctx, token, xo.TypeUser(args[0]))
+}
+
+func cmdAdjudicate(c *conn, args []string) (string, error) {
+	token, err := c.moderate(args, 2, 2)
+	if err != nil {
+		return "", err
+	}
+
+	winner := xo.TypeUser(args[1])
+	if strings.EqualFold(args[1], "draw") {
+		winner = ""
+	}
+
+	return xo.AdjudicateContext(c.ctx, token, xo.TypeUser(args[0]), winner)
+}
+
+func cmdPurge(c *conn, args []string) (string, error) {
+	token, err := c.moderate(args, 0, 1<<10)
+	if err != nil {
+		return "", err
+	}
+
+	users := make([]xo.TypeUser, len(args))
+	for i, arg := range args {
+		users[i] = xo.TypeUser(arg)
+	}
+
+	n, err := xo.PurgeWaitingContext(c.ctx, token, users...)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprint(n), nil
+}
+
+func cmdRole(c *conn, args []string) (string, error) {
+	token, err := c.moderate(args, 2, 2)
+	if err != nil {
+		return "", err
+	}
+
+	return "", xo.GrantRoleContext(c.ctx, token, args[0], xo.TypeRole(strings.ToLower(args[1])))
+}
@@ -0,0 +1,813 @@
+package xotext
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ayzatziko/stuff/x/xo/xo"
+)
+
+// Serve accepts connections on l and serves each of them in its own
+// goroutine. It returns when l is closed.
+func Serve(l net.Listener) error {
+	for {
+		rw, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("xotext: Serve: %w", err)
+		}
+
+		go serveConn(rw)
+	}
+}
+
+type conn struct {
+	rw net.Conn
+	// ctx carries the address of the client and is done when the client
+	// disconnects, base is never done.
+	ctx  context.Context
+	base context.Context
+
+	wmu sync.Mutex
+	w   *bufio.Writer
+
+	token        string
+	cancelEvents func()
+}
+
+func serveConn(rw net.Conn) {
+	host, _, err := net.SplitHostPort(rw.RemoteAddr().String())
+	if err != nil {
+		host = rw.RemoteAddr().String()
+	}
+
+	base := xo.WithClientAddress(context.Background(), host)
+	ctx, cancel := context.WithCancel(base)
+	defer cancel()
+
+	c := &conn{rw: rw, ctx: ctx, base: base, w: bufio.NewWriter(rw)}
+	defer rw.Close()
+	defer c.logout()
+
+	// lines are read while a command runs, so a disconnect cancels it
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		defer cancel()
+
+		scanner := bufio.NewScanner(rw)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		name := strings.ToUpper(fields[0])
+		cmd, ok := commands[name]
+		if !ok {
+			c.writeLine("ERR unknown command %q, try HELP", fields[0])
+			continue
+		}
+
+		payload, err := cmd(c, fields[1:])
+		if err != nil {
+			c.writeLine("ERR %s", oneLine(err.Error()))
+		} else if payload != "" {
+			c.writeLine("OK %s", payload)
+		} else {
+			c.writeLine("OK")
+		}
+
+		if name == "QUIT" {
+			return
+		}
+	}
+}
+
+func (c *conn) writeLine(format string, args ...any) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	fmt.Fprintf(c.w, format+"\n", args...)
+	c.w.Flush()
+}
+
+func (c *conn) logout() error {
+	if c.token == "" {
+		return fmt.Errorf("not logged in")
+	}
+
+	c.cancelEvents()
+	// the client may be gone
+	err := xo.LogoutContext(c.base, c.token)
+	c.token, c.cancelEvents = "", nil
+
+	return err
+}
+
+func (c *conn) forwardEvents(events <-chan xo.TypeEvent) {
+	for e := range events {
+		c.writeLine("EVENT %s", formatEvent(e))
+	}
+}
+
+func formatEvent(e xo.TypeEvent) string {
+	switch e.Kind {
+	case xo.EventGameStarted:
+		return fmt.Sprintf("START %s %s %s", formatUserSign(e.Participants[0]), formatUserSign(e.Participants[1]), e.Rules.Name())
+	case xo.EventMove:
+		move := fmt.Sprintf("MOVE %s %d %d", e.User, e.Cell.Row()+1, e.Cell.Col()+1)
+		if _, _, depth := e.Rules.NewPosition().Size(); depth > 1 {
+			move += fmt.Sprintf(" %d", e.Cell.Layer()+1)
+		}
+
+		for _, p := range e.Participants {
+			if p.User() == e.User && p.Sign() != e.Sign {
+				move += " " + string(e.Sign)
+			}
+		}
+
+		return move
+	case xo.EventDrawOffered:
+		return fmt.Sprintf("DRAW %s", e.User)
+	case xo.EventDrawDeclined:
+		return fmt.Sprintf("DECLINE %s", e.User)
+	case xo.EventGameFinished:
+		return fmt.Sprintf("END %s", e.Message)
+	case xo.EventChat:
+		return fmt.Sprintf("CHAT %s %s", e.User, oneLine(e.Message))
+	}
+
+	return strings.ToUpper(string(e.Kind))
+}
+
+func formatUserSign(userSign interface {
+	User() xo.TypeUser
+	Sign() xo.TypeSign
+}) string {
+	return fmt.Sprintf("%s:%s", userSign.User(), userSign.Sign())
+}
+
+func oneLine(s string) string {
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+type command func(c *conn, args []string) (string, error)
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"REGISTER":   cmdRegister,
+		"LOGIN":      cmdLogin,
+		"LOGOUT":     cmdLogout,
+		"PASSWORD":   cmdPassword,
+		"UNREGISTER": cmdUnregister,
+		"VARIANTS":   cmdVariants,
+		"LOBBY":      cmdLobby,
+		"WAIT":       cmdWait,
+		"JOIN":       cmdJoin,
+		"ROOM":       cmdRoom,
+		"ENTER":      cmdEnter,
+		"CLOSE":      cmdClose,
+		"MOVE":       cmdMove,
+		"BOARD":      cmdBoard,
+		"HINT":       cmdHint,
+		"PROFILE":    cmdProfile,
+		"FRIEND":     userCommand(xo.RequestFriendContext),
+		"UNFRIEND":   userCommand(xo.RemoveFriendContext),
+		"BLOCK":      userCommand(xo.BlockContext),
+		"UNBLOCK":    userCommand(xo.UnblockContext),
+		"FRIENDS":    cmdFriends,
+		"PRESENCE":   cmdPresence,
+		"TOP":        cmdTop,
+		"RESIGN":     cmdResign,
+		"DRAW":       cmdDraw,
+		"ACCEPT":     cmdAccept,
+		"DECLINE":    cmdDecline,
+		"WATCH":      cmdWatch,
+		"UNWATCH":    cmdUnwatch,
+		"SAY":        cmdSay,
+		"CHAT":       cmdChat,
+		"MUTE":       cmdMute,
+		"UNMUTE":     cmdUnmute,
+		"SESSIONS":   cmdSessions,
+		"KICK":       cmdKick,
+		"BAN":        cmdBan,
+		"UNBAN":      cmdUnban,
+		"ABORT":      cmdAbort,
+		"ADJUDICATE": cmdAdjudicate,
+		"PURGE":      cmdPurge,
+		"ROLE":       cmdRole,
+		"HELP":       cmdHelp,
+		"QUIT":       cmdQuit,
+	}
+}
+
+func wantArgs(args []string, min, max int) error {
+	if len(args) < min || len(args) > max {
+		return fmt.Errorf("wrong number of arguments")
+	}
+
+	return nil
+}
+
+func (c *conn) session() (string, error) {
+	if c.token == "" {
+		return "", fmt.Errorf("not logged in")
+	}
+
+	return c.token, nil
+}
+
+func cmdRegister(c *conn, args []string) (string, error) {
+	if err := wantArgs(args, 1, 2); err != nil {
+		return "", err
+	}
+
+	return "", xo.RegisterUserContext(c.ctx, args[0], argOrEmpty(args, 1))
+}
+
+func cmdLogin(c *conn, args []string) (string, error) {
+	if err := wantArgs(args, 1, 2); err != nil {
+		return "", err
+	}
+
+	token, err := xo.LoginContext(c.ctx, args[0], argOrEmpty(args, 1))
+	if err != nil {
+		return "", err
+	}
+
+	if c.token != "" {
+		c.logout()
+	}
+
+	events, cancel, err := xo.SubscribeContext(c.ctx, token)
+	if err != nil {
+		return "", err
+	}
+
+	c.token, c.cancelEvents = token, cancel
+	go c.forwardEvents(events)
+
+	return "", nil
+}
+
+func cmdLogout(c *conn, args []string) (string, error) {
+	if err := wantArgs(args, 0, 0); err != nil {
+		return "", err
+	}
+
+	return "", c.logout()
+}
+
+func cmdPassword(c *conn, args []string) (string, error) {
+	token, err := c.session()
+	if err != nil {
+		return "", err
+	} else if err := wantArgs(args, 1, 2); err != nil {
+		return "", err
+	}
+
+	// the old password is omitted when it is empty
+	if len(args) == 1 {
+		args = []string{"", args[0]}
+	}
+
+	token, err = xo.ChangePasswordContext(c.ctx, token, args[0], args[1])
+	if err != nil {
+		return "", err
+	}
+	c.token = token
+
+	return "", nil
+}
+
+func cmdUnregister(c *conn, args []string) (string, error) {
+	token, err := c.session()
+	if err != nil {
+		return "", err
+	} else if err := wantArgs(args, 0, 1); err != nil {
+		return "", err
+	}
+
+	if err := xo.DeleteAccountContext(c.ctx, token, argOrEmpty(args, 0)); err != nil {
+		return "", err
+	}
+
+	c.cancelEvents()
+	c.token, c.cancelEvents = "", nil
+
+	return "", nil
+}
+
+func cmdLobby(c *conn, args []string) (string, error) {
+	if err := wantArgs(args, 0, 0); err != nil {
+		return "", err
+	}
+
+	// listings filtered by blocks need the user
+	token, err := c.session()
+	if err != nil {
+		return "", err
+	}
+
+	return formatLobby(xo.SearchOpponentsForContext(c.ctx, token))
+}
+
+func formatLobby[O interface {
+	User() xo.TypeUser
+	Sign() xo.TypeSign
+	Rules() xo.Rules
+}](opponents []O, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+
+	var waiting []string
+	for _, opponent := range opponents {
+		waiting = append(waiting, formatUserSign(opponent)+":"+opponent.Rules().Name())
+	}
+	sort.Strings(waiting)
+
+	return strings.Join(waiting, " "), nil
+}
+
+func cmdVariants(c *conn, args []string) (string, error) {
+	if err := wantArgs(args, 0, 0); err != nil {
+		return "", err
+	}
+
+	return strings.Join(xo.Variants(), " "), nil
+}
+
+func cmdWait(c *conn, args []string) (string, error) {
+	token, err := c.session()
+	if err != nil {
+		return "", err
+	} else if err := wantArgs(args, 1, 2); err != nil {
+		return "", err
+	}
+
+	rules := xo.Classic()
+	if len(args) == 2 {
+		if rules, err = xo.RulesByName(args[1]); err != nil {
+			return "", err
+		}
+	}
+
+	return "", xo.RegisterSelfAsParticipantContext(c.ctx, token, xo.TypeSign(strings.ToLower(args[0])), rules)
+}
+
+func cmdJoin(c *conn, args []string) (string, error) {
+	token, err := c.session()
+	if err != nil {
+		return "", err
+	} else if err := wantArgs(args, 2, 2); err != nil {
+		return "", err
+	}
+
+	return "", xo.StartPlayingWithWaitingOpponentContext(c.ctx, token, xo.TypeSign(strings.ToLower(args[1])), xo.TypeUser(args[0]))
+}
+
+func cmdRoom(c *conn, args []string) (string, error) {
+	token, err := c.session()
+	if err != nil {
+		return "", err
+	} else if err := wantArgs(args, 1, 2); err != nil {
+		return "", err
+	}
+
+	rules := xo.Classic()
+	if len(args) == 2 {
+		if rules, err = xo.RulesByName(args[1]); err != nil {
+			return "", err
+		}
+	}
+
+	return xo.CreateRoomContext(c.ctx, token, xo.TypeSign(strings.ToLower(args[0])), rules)
+}
+
+func cmdEnter(c *conn, args []string) (string, error) {
+	token, err := c.session()
+	if err != nil {
+		return "", err
+	} else if err := wantArgs(args, 2, 2); err != nil {
+		return "", err
+	}
+
+	return "", xo.JoinRoomContext(c.ctx, token, args[0], xo.TypeSign(strings.ToLower(args[1])))
+}
+
+func cmdClose(c *conn, args []string) (string, error) {
+	token, err := c.session()
+	if err != nil {
+		return "", err
+	} else if err := wantArgs(args, 0, 0); err != nil {
+		return "", err
+	}
+
+	return "", xo.CloseRoomContext(c.ctx, token)
+}
+
+func cmdMove(c *conn, args []string) (string, error) {
+	token, err := c.session()
+	if err != nil {
+		return "", err
+	} else if err := wantArgs(args, 2, 4); err != nil {
+		return "", err
+	}
+
+	// the sign chosen by the mover in variants like wild goes last
+	var sign xo.TypeSign
+	if last := xo.TypeSign(strings.ToLower(args[len(args)-1])); last == xo.SignX || last == xo.SignO {
+		sign, args = last, args[:len(args)-1]
+	} else if len(args) == 4 {
+		return "", fmt.Errorf("invalid sign %q", args[3])
+	}
+
+	row, err := strconv.Atoi(args[0])
+	if err != nil {
+		return "", fmt.Errorf("invalid row %q", args[0])
+	}
+
+	col, err := strconv.Atoi(args[1])
+	if err != nil {
+		return "", fmt.Errorf("invalid column %q", args[1])
+	}
+
+	layer := 1
+	if len(args) == 3 {
+		if layer, err = strconv.Atoi(args[2]); err != nil {
+			return "", fmt.Errorf("invalid layer %q", args[2])
+		}
+	}
+
+	cell, err := xo.NewCell3D(row-1, col-1, layer-1)
+	if err != nil {
+		return "", err
+	}
+
+	_, result, err := xo.MakeAMoveContext(c.ctx, token, cell, sign)
+	return result, err
+}
+
+func cmdBoard(c *conn, args []string) (string, error) {
+	token, err := c.session()
+	if err != nil {
+		return "", err
+	} else if err := wantArgs(args, 0, 0); err != nil {
+		return "", err
+	}
+
+	board, err := xo.CurrentBoardContext(c.ctx, token)
+	if err != nil {
+		return "", err
+	}
+
+	return formatBoard(&board), nil
+}
+
+func formatBoard(board *xo.TypeBoard) string {
+	height, width, depth := board.Dimensions()
+	fields := []string{string(board.Turn().User())}
+	for layer := 0; layer < depth; layer++ {
+		if layer > 0 {
+			fields = append(fields, "|")
+		}
+
+		for row := 0; row < height; row++ {
+			var b strings.Builder
+			for col := 0; col < width; col++ {
+				cell, _ := xo.NewCell3D(row, col, layer)
+				if sign := board.Cell(cell); sign != "" {
+					b.WriteString(string(sign))
+				} else {
+					b.WriteString(".")
+				}
+			}
+			fields = append(fields, b.String())
+		}
+	}
+
+	return strings.Join(fields, " ")
+}
+
+func cmdHint(c *conn, args []string) (string, error) {
+	token, err := c.session()
+	if err != nil {
+		return "", err
+	} else if err := wantArgs(args, 0, 0); err != nil {
+		return "", err
+	}
+
+	board, err := xo.CurrentBoardContext(c.ctx, token)
+	if err != nil {
+		return "", err
+	}
+	analysis, err := xo.HintContext(c.ctx, token)
+	if err != nil {
+		return "", err
+	}
+
+	fields := []string{analysis.Value.String(), strconv.Itoa(analysis.Distance)}
+	for _, m := range analysis.Best {
+		move := fmt.Sprintf("%d,%d", m.Move.Cell.Row()+1, m.Move.Cell.Col()+1)
+		if board.Layers() > 1 {
+			move += fmt.Sprintf(",%d", m.Move.Cell.Layer()+1)
+		}
+		if m.Move.Sign != "" {
+			move += "," + string(m.Move.Sign)
+		}
+
+		fields = append(fields, move)
+	}
+
+	return strings.Join(fields, " "), nil
+}
+
+func cmdResign(c *conn, args []string) (string, error) {
+	token, err := c.session()
+	if err != nil {
+		return "", err
+	} else if err := wantArgs(args, 0, 0); err != nil {
+		return "", err
+	}
+
+	_, result, err := xo.ResignContext(c.ctx, token)
+	return result, err
+}
+
+func cmdDraw(c *conn, args []string) (string, error) {
+	token, err := c.session()
+	if err != nil {
+		return "", err
+	} else if err := wantArgs(args, 0, 0); err != nil {
+		return "", err
+	}
+
+	return "", xo.OfferDrawContext(c.ctx, token)
+}
+
+func cmdAccept(c *conn, args []string) (string, error) {
+	token, err := c.session()
+	if err != nil {
+		return "", err
+	} else if err := wantArgs(args, 0, 0); err != nil {
+		return "", err
+	}
+
+	_, result, err := xo.AcceptDrawContext(c.ctx, token)
+	return result, err
+}
+
+func cmdDecline(c *conn, args []string) (string, error) {
+	token, err := c.session()
+	if err != nil {
+		return "", err
+	} else if err := wantArgs(args, 0, 0); err != nil {
+		return "", err
+	}
+
+	return "", xo.DeclineDrawContext(c.ctx, token)
+}
+
+func cmdWatch(c *conn, args []string) (string, error) {
+	token, err := c.session()
+	if err != nil {
+		return "", err
+	} else if err := wantArgs(args, 1, 1); err != nil {
+		return "", err
+	}
+
+	board, err := xo.SpectateContext(c.ctx, token, xo.TypeUser(args[0]))
+	if err != nil {
+		return "", err
+	}
+
+	return formatBoard(&board), nil
+}
+
+func cmdUnwatch(c *conn, args []string) (string, error) {
+	token, err := c.session()
+	if err != nil {
+		return "", err
+	} else if err := wantArgs(args, 0, 0); err != nil {
+		return "", err
+	}
+
+	return "", xo.StopSpectatingContext(c.ctx, token)
+}
+
+func cmdSay(c *conn, args []string) (string, error) {
+	token, err := c.session()
+	if err != nil {
+		return "", err
+	} else if len(args) == 0 {
+		return "", fmt.Errorf("wrong number of arguments")
+	}
+
+	return "", xo.SendChatContext(c.ctx, token, strings.Join(args, " "))
+}
+
+func cmdChat(c *conn, args []string) (string, error) {
+	token, err := c.session()
+	if err != nil {
+		return "", err
+	} else if err := wantArgs(args, 0, 0); err != nil {
+		return "", err
+	}
+
+	messages, err := xo.ChatHistoryContext(c.ctx, token)
+	if err != nil {
+		return "", err
+	}
+
+	fields := make([]string, 0, 2*len(messages))
+	for _, m := range messages {
+		fields = append(fields, string(m.User), strconv.Quote(m.Text))
+	}
+
+	return strings.Join(fields, " "), nil
+}
+
+func cmdMute(c *conn, args []string) (string, error) {
+	token, err := c.session()
+	if err != nil {
+		return "", err
+	} else if err := wantArgs(args, 1, 1); err != nil {
+		return "", err
+	}
+
+	return "", xo.MuteContext(c.ctx, token, xo.TypeUser(args[0]))
+}
+
+func cmdUnmute(c *conn, args []string) (string, error) {
+	token, err := c.session()
+	if err != nil {
+		return "", err
+	} else if err := wantArgs(args, 1, 1); err != nil {
+		return "", err
+	}
+
+	return "", xo.UnmuteContext(c.ctx, token, xo.TypeUser(args[0]))
+}
+
+// userCommand makes a command of an operation of the session user on
+// another user.
+func userCommand(op func(ctx context.Context, sessionToken string, user xo.TypeUser) error) command {
+	return func(c *conn, args []string) (string, error) {
+		token, err := c.session()
+		if err != nil {
+			return "", err
+		} else if err := wantArgs(args, 1, 1); err != nil {
+			return "", err
+		}
+
+		return "", op(c.ctx, token, xo.TypeUser(args[0]))
+	}
+}
+
+func cmdFriends(c *conn, args []string) (string, error) {
+	token, err := c.session()
+	if err != nil {
+		return "", err
+	} else if err := wantArgs(args, 0, 0); err != nil {
+		return "", err
+	}
+
+	friends, err := xo.FriendsContext(c.ctx, token)
+	if err != nil {
+		return "", err
+	}
+
+	var fields []string
+	for _, f := range friends.Friends {
+		fields = append(fields, fmt.Sprintf("%s:%s", f.User, f.Presence))
+	}
+	for _, list := range []struct {
+		users []xo.TypeUser
+		state string
+	}{{friends.Incoming, "incoming"}, {friends.Outgoing, "outgoing"}, {friends.Blocked, "blocked"}} {
+		for _, user := range list.users {
+			fields = append(fields, fmt.Sprintf("%s:%s", user, list.state))
+		}
+	}
+
+	return strings.Join(fields, " "), nil
+}
+
+func cmdPresence(c *conn, args []string) (string, error) {
+	token, err := c.session()
+	if err != nil {
+		return "", err
+	} else if err := wantArgs(args, 1, 1); err != nil {
+		return "", err
+	}
+
+	presence, err := xo.PresenceContext(c.ctx, token, xo.TypeUser(args[0]))
+	return string(presence), err
+}
+
+func cmdProfile(c *conn, args []string) (string, error) {
+	if err := wantArgs(args, 1, 1); err != nil {
+		return "", err
+	}
+
+	profile, err := xo.ProfileContext(c.ctx, args[0])
+	if err != nil {
+		return "", err
+	}
+
+	fields := []string{
+		"joined=" + profile.Joined.UTC().Format("2006-01-02"),
+		fmt.Sprintf("games=%d wins=%d draws=%d losses=%d rating=%d", profile.Games, profile.Wins, profile.Draws, profile.Losses, profile.Rating),
+	}
+	if profile.FavoriteSign != "" {
+		fields = append(fields, "sign="+string(profile.FavoriteSign))
+	}
+
+	recent := make([]string, 0, len(profile.Recent))
+	for _, g := range profile.Recent {
+		recent = append(recent, fmt.Sprintf("%s:%s:%s", g.Result, g.Opponent, g.Variant))
+	}
+	if len(recent) > 0 {
+		fields = append(fields, "recent="+strings.Join(recent, ","))
+	}
+
+	return strings.Join(fields, " "), nil
+}
+
+func cmdTop(c *conn, args []string) (string, error) {
+	if err := wantArgs(args, 0, 2); err != nil {
+		return "", err
+	}
+
+	var query xo.TypeLeaderboardQuery
+	if variant := argOrEmpty(args, 0); variant != "all" {
+		query.Variant = variant
+	}
+	if len(args) == 2 {
+		month, err := time.Parse("2006-01", args[1])
+		if err != nil {
+			return "", fmt.Errorf("month is not like 2024-01")
+		}
+		query.Month = month
+	}
+
+	entries, err := xo.LeaderboardContext(c.ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	fields := make([]string, 0, len(entries))
+	for _, e := range entries {
+		fields = append(fields, fmt.Sprintf("%d:%s:%d", e.Rank, e.User, e.Rating))
+	}
+
+	return strings.Join(fields, " "), nil
+}
+
+func cmdHelp(c *conn, args []string) (string, error) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return strings.Join(names, " "), nil
+}
+
+func cmdQuit(c *conn, args []string) (string, error) {
+	if c.token != "" {
+		c.logout()
+	}
+
+	return "", nil
+}
+
+func argOrEmpty(args []string, i int) string {
+	if i < len(args) {
+		return args[i]
+	}
+
+	return ""
+}
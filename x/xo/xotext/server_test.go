@@ -0,0 +1,446 @@
+package xotext_test
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ayzatziko/stuff/x/xo/xo"
+	"github.com/ayzatziko/stuff/x/xo/xotext"
+)
+
+func TestGame(t *testing.T) {
+	addr := serve(t)
+	first, second := dial(t, addr), dial(t, addr)
+	r := unique("game1", "game2")
+
+	call(t, first, r.Replace("REGISTER game1 password"))
+	call(t, first, r.Replace("LOGIN game1 password"))
+	call(t, first, "WAIT x")
+
+	call(t, second, r.Replace("REGISTER game2 password"))
+	if _, err := second.Call("LOBBY"); err == nil {
+		t.Fatalf("expected error listing the lobby without login")
+	}
+	call(t, second, r.Replace("LOGIN game2 password"))
+	if lobby := call(t, second, "LOBBY"); !strings.Contains(lobby, r.Replace("game1:x:classic")) {
+		t.Fatalf("game1 is not in the lobby %q", lobby)
+	}
+	call(t, second, r.Replace("JOIN game1 o"))
+
+	wantEvent(t, first, r.Replace("START game1:x game2:o classic"))
+	wantEvent(t, second, r.Replace("START game1:x game2:o classic"))
+
+	if board := call(t, second, "BOARD"); board != r.Replace("game1 ... ... ...") {
+		t.Fatalf("unexpected board %q", board)
+	}
+
+	if _, err := second.Call("MOVE", "1", "1"); err == nil {
+		t.Fatalf("expected error moving out of turn")
+	}
+
+	for i, m := range []struct {
+		c    *xotext.Client
+		move string
+	}{
+		{first, "1 1"},
+		{second, "2 1"},
+		{first, "1 2"},
+		{second, "2 2"},
+	} {
+		call(t, m.c, "MOVE "+m.move)
+
+		user := r.Replace([]string{"game1", "game2"}[i%2])
+		wantEvent(t, first, "MOVE "+user+" "+m.move)
+		wantEvent(t, second, "MOVE "+user+" "+m.move)
+	}
+
+	if board := call(t, first, "board"); board != r.Replace("game1 xx. oo. ...") {
+		t.Fatalf("unexpected board %q", board)
+	}
+
+	if result := call(t, first, "MOVE 1 3"); result != r.Replace("game1 wins game2") {
+		t.Fatalf("unexpected result %q", result)
+	}
+
+	wantEvent(t, first, r.Replace("MOVE game1 1 3"))
+	wantEvent(t, second, r.Replace("MOVE game1 1 3"))
+	wantEvent(t, second, r.Replace("END game1 wins game2"))
+}
+
+func TestDisconnectForfeits(t *testing.T) {
+	addr := serve(t)
+	first, second := dial(t, addr), dial(t, addr)
+
+	r := unique("forfeit1", "forfeit2")
+
+	call(t, first, r.Replace("REGISTER forfeit1 password"))
+	call(t, first, r.Replace("LOGIN forfeit1 password"))
+	call(t, first, "WAIT o")
+	call(t, second, r.Replace("REGISTER forfeit2 password"))
+	call(t, second, r.Replace("LOGIN forfeit2 password"))
+	call(t, second, r.Replace("JOIN forfeit1 x"))
+	wantEvent(t, second, r.Replace("START forfeit1:o forfeit2:x classic"))
+
+	first.Close()
+	wantEvent(t, second, r.Replace("END forfeit2 wins forfeit1"))
+}
+
+func TestQubic(t *testing.T) {
+	addr := serve(t)
+	first, second := dial(t, addr), dial(t, addr)
+	r := unique("qubic1", "qubic2")
+
+	if variants := call(t, first, "VARIANTS"); !strings.Contains(variants, "qubic") {
+		t.Fatalf("qubic is not in variants %q", variants)
+	}
+
+	call(t, first, r.Replace("REGISTER qubic1 password"))
+	call(t, first, r.Replace("LOGIN qubic1 password"))
+	if _, err := first.Call("WAIT", "x", "no-such-variant"); err == nil {
+		t.Fatalf("expected error waiting to play unknown variant")
+	}
+	call(t, first, "WAIT x qubic")
+
+	call(t, second, r.Replace("REGISTER qubic2 password"))
+	call(t, second, r.Replace("LOGIN qubic2 password"))
+	if lobby := call(t, second, "LOBBY"); !strings.Contains(lobby, r.Replace("qubic1:x:qubic")) {
+		t.Fatalf("qubic1 is not in the lobby %q", lobby)
+	}
+	call(t, second, r.Replace("JOIN qubic1 o"))
+	wantEvent(t, first, r.Replace("START qubic1:x qubic2:o qubic"))
+
+	call(t, first, "MOVE 1 1 1")
+	wantEvent(t, first, r.Replace("MOVE qubic1 1 1 1"))
+	call(t, second, "MOVE 4 4 2")
+	wantEvent(t, first, r.Replace("MOVE qubic2 4 4 2"))
+
+	want := r.Replace("qubic1 x... .... .... .... | .... .... .... ...o | .... .... .... .... | .... .... .... ....")
+	if board := call(t, first, "BOARD"); board != want {
+		t.Fatalf("got board %q, want %q", board, want)
+	}
+}
+
+func TestWild(t *testing.T) {
+	addr := serve(t)
+	first, second := dial(t, addr), dial(t, addr)
+	r := unique("wild1", "wild2")
+
+	call(t, first, r.Replace("REGISTER wild1 password"))
+	call(t, first, r.Replace("LOGIN wild1 password"))
+	call(t, first, "WAIT x wild")
+
+	call(t, second, r.Replace("REGISTER wild2 password"))
+	call(t, second, r.Replace("LOGIN wild2 password"))
+	call(t, second, r.Replace("JOIN wild1 o"))
+	wantEvent(t, first, r.Replace("START wild1:x wild2:o wild"))
+
+	call(t, first, "MOVE 1 1 o")
+	wantEvent(t, first, r.Replace("MOVE wild1 1 1 o"))
+	call(t, second, "MOVE 2 2 o")
+	wantEvent(t, first, r.Replace("MOVE wild2 2 2"))
+
+	if reply, err := first.Call("MOVE", "3", "3", "1", "z"); err == nil {
+		t.Fatalf("expected error moving with unknown sign, got %q", reply)
+	}
+
+	if result := call(t, first, "MOVE 3 3 o"); result != r.Replace("wild1 wins wild2") {
+		t.Fatalf("unexpected result %q", result)
+	}
+}
+
+func TestHint(t *testing.T) {
+	addr := serve(t)
+	first, second := dial(t, addr), dial(t, addr)
+	r := unique("hint1", "hint2")
+
+	call(t, first, r.Replace("REGISTER hint1 password"))
+	call(t, first, r.Replace("LOGIN hint1 password"))
+	call(t, first, "WAIT x")
+	call(t, second, r.Replace("REGISTER hint2 password"))
+	call(t, second, r.Replace("LOGIN hint2 password"))
+	call(t, second, r.Replace("JOIN hint1 o"))
+
+	for _, line := range []string{"MOVE 1 1", "MOVE 2 1", "MOVE 1 2", "MOVE 2 2"} {
+		call(t, first, line)
+		first, second = second, first
+	}
+
+	if hint := call(t, first, "HINT"); hint != "win 1 1,3" {
+		t.Fatalf("unexpected hint %q", hint)
+	}
+}
+
+func TestAccount(t *testing.T) {
+	c := dial(t, serve(t))
+	r := unique("account")
+
+	call(t, c, r.Replace("REGISTER account password"))
+	call(t, c, r.Replace("LOGIN account password"))
+	call(t, c, "PASSWORD password new-secret")
+	if _, err := c.Call("UNREGISTER", "wrong"); err == nil {
+		t.Fatalf("expected error unregistering with wrong password")
+	}
+	call(t, c, "UNREGISTER new-secret")
+
+	if _, err := c.Call("LOGIN", r.Replace("account"), "new-secret"); err == nil {
+		t.Fatalf("expected error logging in as unregistered user")
+	}
+	call(t, c, r.Replace("REGISTER account password"))
+}
+
+func TestModeration(t *testing.T) {
+	addr := serve(t)
+	moderator, first, second := dial(t, addr), dial(t, addr), dial(t, addr)
+	r := unique("mod", "play1", "play2")
+
+	call(t, moderator, r.Replace("REGISTER mod password"))
+	if err := xo.SetRole(r.Replace("mod"), xo.RoleModerator); err != nil {
+		t.Fatal(err)
+	}
+	call(t, moderator, r.Replace("LOGIN mod password"))
+
+	call(t, first, r.Replace("REGISTER play1 password"))
+	call(t, first, r.Replace("LOGIN play1 password"))
+	call(t, first, "WAIT x")
+	call(t, second, r.Replace("REGISTER play2 password"))
+	call(t, second, r.Replace("LOGIN play2 password"))
+
+	if _, err := second.Call("SESSIONS"); err == nil {
+		t.Fatalf("expected error listing sessions by player")
+	}
+	if sessions := call(t, moderator, "SESSIONS"); !strings.Contains(sessions, r.Replace("play1:player:waiting play2:player")) {
+		t.Fatalf("unexpected sessions %q", sessions)
+	}
+
+	call(t, second, r.Replace("JOIN play1 o"))
+	wantEvent(t, first, r.Replace("START play1:x play2:o classic"))
+	if result := call(t, moderator, r.Replace("ADJUDICATE play1 draw")); result != "draw" {
+		t.Fatalf("unexpected result %q", result)
+	}
+	wantEvent(t, first, "END draw")
+
+	call(t, moderator, r.Replace("BAN play2 1h cheating again"))
+	if _, err := second.Call("LOGIN", r.Replace("play2"), "password"); err == nil || !strings.Contains(err.Error(), "cheating again") {
+		t.Fatalf("unexpected error of banned login %v", err)
+	}
+	call(t, moderator, r.Replace("UNBAN play2"))
+	call(t, second, r.Replace("LOGIN play2 password"))
+}
+
+func TestChat(t *testing.T) {
+	addr := serve(t)
+	first, second, fan := dial(t, addr), dial(t, addr), dial(t, addr)
+	r := unique("chat1", "chat2", "chatfan")
+
+	call(t, first, r.Replace("REGISTER chat1 password"))
+	call(t, first, r.Replace("LOGIN chat1 password"))
+	call(t, first, "WAIT x")
+	call(t, second, r.Replace("REGISTER chat2 password"))
+	call(t, second, r.Replace("LOGIN chat2 password"))
+	call(t, second, r.Replace("JOIN chat1 o"))
+	wantEvent(t, first, r.Replace("START chat1:x chat2:o classic"))
+	wantEvent(t, second, r.Replace("START chat1:x chat2:o classic"))
+
+	call(t, fan, r.Replace("REGISTER chatfan password"))
+	call(t, fan, r.Replace("LOGIN chatfan password"))
+	if board := call(t, fan, r.Replace("WATCH chat2")); board != r.Replace("chat1 ... ... ...") {
+		t.Fatalf("unexpected board %q", board)
+	}
+
+	call(t, first, "SAY good  luck")
+	for _, c := range []*xotext.Client{first, second, fan} {
+		wantEvent(t, c, r.Replace("CHAT chat1 good luck"))
+	}
+
+	call(t, second, r.Replace("MUTE chatfan"))
+	call(t, fan, "SAY go")
+	wantEvent(t, first, r.Replace("CHAT chatfan go"))
+	wantEvent(t, fan, r.Replace("CHAT chatfan go"))
+
+	if chat := call(t, second, "CHAT"); chat != r.Replace(`chat1 "good luck"`) {
+		t.Fatalf("unexpected chat %q", chat)
+	}
+
+	call(t, fan, "UNWATCH")
+	call(t, first, "RESIGN")
+	wantEvent(t, second, r.Replace("END chat2 wins chat1"))
+	if _, err := fan.Call("SAY", "gg"); err == nil {
+		t.Fatalf("expected error chatting after spectating")
+	}
+}
+
+func TestProfile(t *testing.T) {
+	addr := serve(t)
+	first, second := dial(t, addr), dial(t, addr)
+	r := unique("profile1", "profile2")
+
+	call(t, first, r.Replace("REGISTER profile1 password"))
+	call(t, first, r.Replace("LOGIN profile1 password"))
+	call(t, first, "WAIT o wild")
+	call(t, second, r.Replace("REGISTER profile2 password"))
+	call(t, second, r.Replace("LOGIN profile2 password"))
+	call(t, second, r.Replace("JOIN profile1 x"))
+	call(t, first, "RESIGN")
+
+	profile := call(t, second, r.Replace("PROFILE profile2"))
+	want := r.Replace("games=1 wins=1 draws=0 losses=0 rating=1516 sign=x recent=win:profile1:wild")
+	if !strings.HasPrefix(profile, "joined=") || !strings.HasSuffix(profile, want) {
+		t.Fatalf("unexpected profile %q", profile)
+	}
+
+	top := call(t, first, "TOP wild "+time.Now().UTC().Format("2006-01"))
+	if !strings.Contains(top, r.Replace(":profile2:1516")) || !strings.Contains(top, r.Replace(":profile1:1484")) {
+		t.Fatalf("unexpected leaderboard %q", top)
+	}
+
+	if _, err := first.Call("TOP", "all", "january"); err == nil {
+		t.Fatalf("expected error for invalid month")
+	}
+}
+
+func TestFriends(t *testing.T) {
+	addr := serve(t)
+	first, second := dial(t, addr), dial(t, addr)
+	r := unique("friend1", "friend2")
+
+	call(t, first, r.Replace("REGISTER friend1 password"))
+	call(t, first, r.Replace("LOGIN friend1 password"))
+	call(t, second, r.Replace("REGISTER friend2 password"))
+	call(t, second, r.Replace("LOGIN friend2 password"))
+
+	call(t, first, r.Replace("FRIEND friend2"))
+	if friends := call(t, second, "FRIENDS"); friends != r.Replace("friend1:incoming") {
+		t.Fatalf("unexpected friends %q", friends)
+	}
+	call(t, second, r.Replace("FRIEND friend1"))
+	call(t, second, "WAIT x")
+	if friends := call(t, first, "FRIENDS"); friends != r.Replace("friend2:lobby") {
+		t.Fatalf("unexpected friends %q", friends)
+	}
+
+	call(t, second, r.Replace("BLOCK friend1"))
+	if lobby := call(t, first, "LOBBY"); strings.Contains(lobby, r.Replace("friend2:")) {
+		t.Fatalf("blocked user sees friend2 in the lobby %q", lobby)
+	}
+	if presence := call(t, first, r.Replace("PRESENCE friend2")); presence != "offline" {
+		t.Fatalf("blocking user is %q to the blocked user", presence)
+	}
+	if _, err := first.Call("JOIN", r.Replace("friend2"), "o"); err == nil {
+		t.Fatalf("expected error joining a blocking user")
+	}
+
+	call(t, second, r.Replace("UNBLOCK friend1"))
+	call(t, first, r.Replace("JOIN friend2 o"))
+	if presence := call(t, first, r.Replace("PRESENCE friend2")); presence != "game" {
+		t.Fatalf("unexpected presence %q", presence)
+	}
+}
+
+func TestRoom(t *testing.T) {
+	addr := serve(t)
+	first, second := dial(t, addr), dial(t, addr)
+	r := unique("room1", "room2")
+
+	call(t, first, r.Replace("REGISTER room1 password"))
+	call(t, first, r.Replace("LOGIN room1 password"))
+	call(t, second, r.Replace("REGISTER room2 password"))
+	call(t, second, r.Replace("LOGIN room2 password"))
+
+	code := call(t, first, "ROOM x")
+	if lobby := call(t, second, "LOBBY"); strings.Contains(lobby, r.Replace("room1:")) {
+		t.Fatalf("room1 is in the lobby %q", lobby)
+	}
+	if _, err := first.Call("ENTER", code, "o"); err == nil {
+		t.Fatalf("expected error entering own room")
+	}
+
+	call(t, first, "CLOSE")
+	if _, err := second.Call("ENTER", code, "o"); err == nil {
+		t.Fatalf("expected error entering a closed room")
+	}
+
+	code = call(t, first, "ROOM x")
+	call(t, second, "ENTER "+strings.ToLower(code)+" o")
+	wantEvent(t, first, r.Replace("START room1:x room2:o classic"))
+	wantEvent(t, second, r.Replace("START room1:x room2:o classic"))
+}
+
+func TestErrors(t *testing.T) {
+	c := dial(t, serve(t))
+
+	for _, line := range []string{"FLY", "MOVE 1 1", "LOGIN", "LOGIN nobody", "REGISTER a b c", "REGISTER no", "PASSWORD x"} {
+		fields := strings.Fields(line)
+		if reply, err := c.Call(fields[0], fields[1:]...); err == nil {
+			t.Errorf("%s: expected error, got %q", line, reply)
+		}
+	}
+}
+
+var uniqueCounter int
+
+// unique returns a replacer of names to names unique within the process, the
+// engine keeps users between tests.
+func unique(names ...string) *strings.Replacer {
+	uniqueCounter++
+
+	var oldnew []string
+	for _, name := range names {
+		oldnew = append(oldnew, name, fmt.Sprintf("%s-%d", name, uniqueCounter))
+	}
+
+	return strings.NewReplacer(oldnew...)
+}
+
+func serve(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go xotext.Serve(l)
+
+	return l.Addr().String()
+}
+
+func dial(t *testing.T, addr string) *xotext.Client {
+	t.Helper()
+
+	c, err := xotext.Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	return c
+}
+
+func call(t *testing.T, c *xotext.Client, line string) string {
+	t.Helper()
+
+	fields := strings.Fields(line)
+	reply, err := c.Call(fields[0], fields[1:]...)
+	if err != nil {
+		t.Fatalf("%s: %v", line, err)
+	}
+
+	return reply
+}
+
+func wantEvent(t *testing.T, c *xotext.Client, want string) {
+	t.Helper()
+
+	select {
+	case event := <-c.Events():
+		if got := strings.Join(event, " "); got != want {
+			t.Fatalf("got event %q, want %q", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no event %q", want)
+	}
+}